@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/sqlite"
+	"errors"
+	"flag"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/admin"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/courses"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/enrollment"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/student"
-	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,51 +20,67 @@ import (
 func main(){
 	// load config
 	cfg:=config.MustLoad()
+
+	// migrate mode: CTRLB migrate up|down|status|to <version>
+	if !flag.Parsed(){
+		flag.Parse()
+	}
+	if args:=flag.Args(); len(args)>0 && args[0]=="migrate"{
+		if err:=runMigrate(cfg,args[1:]); err!=nil{
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// database setup
-	storage,dberr:=sqlite.New(cfg)
+	storage,dberr:=newStorage(cfg)
 	if dberr!=nil{
 		log.Fatal(dberr)
 	}
-	slog.Info("Storage intialized", slog.String("env",cfg.Env),slog.String("version","1.0.0"))
+	slog.Info("Storage intialized", slog.String("env",cfg.Env),slog.String("driver",cfg.Storage.Driver),slog.String("version","1.0.0"))
+
+	if err:=seedAdmin(context.Background(),storage,cfg.Admin); err!=nil{
+		log.Fatal(err)
+	}
+
+	keys,keyerr:=auth.LoadKeys(*cfg)
+	if keyerr!=nil{
+		log.Fatal(keyerr)
+	}
+
+	mailer,mailerr:=mail.New(cfg.Mail)
+	if mailerr!=nil{
+		log.Fatal(mailerr)
+	}
+
+	var oidc *auth.OIDC
+	if cfg.Auth.OIDC.Issuer!=""{
+		var oidcerr error
+		oidc,oidcerr=auth.NewOIDC(context.Background(),cfg.Auth.OIDC)
+		if oidcerr!=nil{
+			log.Fatal(oidcerr)
+		}
+	}
 
 	// setup router
-	router:=http.NewServeMux()
-
-	// Basic Route
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-    	w.Write([]byte("Welcome to CtrlB Backend!"))
-	})
-
-	// Admin
-		router.HandleFunc("POST /api/admin",admin.LoginAdmin(*cfg))
-		router.HandleFunc("POST /api/admin/logout",middlewares.AdminMiddleware(cfg.JWTSecret,admin.Logout()))
-
-	// Student
-		router.HandleFunc("POST /api/students",student.Register(storage))
-		router.HandleFunc("POST /api/students/login",student.LoginStudent(storage,*cfg))
-		router.HandleFunc("GET /api/students/{id}",middlewares.AdminMiddleware(cfg.JWTSecret,student.GetById(storage)))
-		router.HandleFunc("GET /api/students/all",middlewares.AdminMiddleware(cfg.JWTSecret,student.GetAllStudents(storage)))
-		router.HandleFunc("GET /api/students",middlewares.AdminMiddleware(cfg.JWTSecret,student.GetStudentByEmail(storage)))
-		router.HandleFunc("PUT /api/students/update",middlewares.StudentMiddleware(cfg.JWTSecret, student.UpdateStudent(storage)))
-		router.HandleFunc("POST /api/students/logout",middlewares.StudentMiddleware(cfg.JWTSecret,student.Logout()))
-
-	// Courses
-		router.HandleFunc("POST /api/courses",middlewares.AdminMiddleware(cfg.JWTSecret,courses.CreateCourse(storage)))
-		router.HandleFunc("GET /api/courses/{id}",courses.GetCourseById(storage))
-		router.HandleFunc("GET /api/courses/all",courses.GetAllCourses(storage))
-		router.HandleFunc("PUT /api/courses/update/{id}",middlewares.AdminMiddleware(cfg.JWTSecret,courses.UpdateCourse(storage)))
-		router.HandleFunc("GET /api/courses/search",courses.SearchCoursesByName(storage))
-
-	// Enrollment
-		router.HandleFunc("POST /api/enrollment",middlewares.StudentMiddleware(cfg.JWTSecret,enrollment.EnrollStudent(storage)))
-		router.HandleFunc("POST /api/unenrollment", middlewares.StudentMiddleware(cfg.JWTSecret,enrollment.UnenrollStudent(storage)))
-		router.HandleFunc("GET /api/enrolled/students/{id}",middlewares.StudentMiddleware(cfg.JWTSecret,enrollment.GetCoursesByStudentID(storage)))
-		router.HandleFunc("GET /api/enrolled/courses/{id}",middlewares.AdminMiddleware(cfg.JWTSecret,enrollment.GetStudentsByCourseID(storage)))
+	router:=routes(storage,keys,mailer,oidc,cfg)
 
 	// setup server
+	// Every request context derives from baseCtx, so cancelling it aborts
+	// in-flight storage queries that outlive the graceful shutdown.
+	baseCtx, cancelRequests:=context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	// Forget revoked and expired tokens, and expired login throttles, once they
+	// could no longer be used.
+	go auth.CleanupExpired(baseCtx,storage,time.Hour)
+
 	server:=http.Server{
 		Addr: cfg.Addr,
 		Handler: router,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	slog.Info("Server Started!!! ",slog.String("address",cfg.HTTPServer.Addr))
@@ -75,7 +90,7 @@ func main(){
 
 	go func(){ // gorountine 
 		err := server.ListenAndServe()
-	if err!=nil{
+	if err!=nil && !errors.Is(err,http.ErrServerClosed){
 		log.Fatal("failed to Start sever")
 	}
 	}()
@@ -90,6 +105,7 @@ func main(){
 	err:=server.Shutdown(ctx) // Take Time , to solve use context
 	if err!=nil{
 		slog.Error("Failed to ShutDown Server",slog.String("error",err.Error()))
+		cancelRequests() // stop handlers still waiting on the database
 	}
 
 	slog.Info("Shutting shutdown successfully!!!")
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/migrations"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var errMigrateUsage = errors.New("usage: CTRLB migrate up|down|status|to <version>")
+
+// runMigrate handles `CTRLB migrate ...` instead of starting the server.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	db, dialect, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrations("applied", applied)
+		return nil
+	case "down":
+		rolledBack, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if rolledBack == nil {
+			fmt.Println("nothing to roll back")
+			return nil
+		}
+		printMigrations("rolled back", []migrations.Migration{*rolledBack})
+		return nil
+	case "to":
+		if len(args) != 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		changed, err := migrator.To(ctx, version)
+		if err != nil {
+			return err
+		}
+		printMigrations("migrated", changed)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Local().Format(time.DateTime)
+			}
+			if status.Modified {
+				state = "modified"
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return out.Flush()
+	default:
+		return errMigrateUsage
+	}
+}
+
+func printMigrations(action string, changed []migrations.Migration) {
+	if len(changed) == 0 {
+		fmt.Println("database is already at the requested version")
+		return
+	}
+	for _, migration := range changed {
+		fmt.Printf("%s %d_%s\n", action, migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/admin"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/applications"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/courses"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/enrollment"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/mfa"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/session"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/sso"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/student"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http"
+)
+
+// routes registers every route of the API. Single sign-on is served only
+// with an oidc provider.
+func routes(storage storage.Storage, keys *auth.Keys, mailer mail.Mailer, oidc *auth.OIDC, cfg *config.Config) *http.ServeMux{
+	router:=http.NewServeMux()
+
+	// authorize guards a route with the permission it requires; authenticate
+	// only requires a logged-in user. Both take the session token from an
+	// Authorization: Bearer header or the auth_token cookie, and authorize
+	// also takes API keys.
+	authorize:=func(permission models.Permission, next http.HandlerFunc) http.HandlerFunc{
+		return middlewares.Authorize(keys,storage,permission,next)
+	}
+	authenticate:=func(next http.HandlerFunc) http.HandlerFunc{
+		return middlewares.Authenticate(keys,storage,next)
+	}
+
+	// Basic Route
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+    	w.Write([]byte("Welcome to CtrlB Backend!"))
+	})
+
+	// Session
+		router.HandleFunc("POST "+auth.RefreshPath,session.Refresh(storage,keys,*cfg))
+		router.HandleFunc("GET "+auth.JWKSPath,session.JWKS(keys))
+
+	// Single sign-on
+		if oidc!=nil{
+			router.HandleFunc("GET "+auth.OIDCPath,sso.Login(oidc,keys,*cfg))
+			router.HandleFunc("GET "+auth.OIDCCallbackPath,sso.Callback(storage,oidc,keys,*cfg))
+		}
+
+	// Two-factor authentication
+	// The auth routes take the mfa_token of a login held after its password;
+	// the others need a session.
+		pendingSetup:=func(next http.HandlerFunc) http.HandlerFunc{
+			return middlewares.PendingMFA(storage,keys,*cfg,auth.MFASetup,next)
+		}
+		router.HandleFunc("POST "+auth.MFAPath,mfa.Verify(storage,keys,*cfg))
+		router.HandleFunc("POST "+auth.MFAPath+"/totp",pendingSetup(mfa.SetUpTOTP(storage,*cfg)))
+		router.HandleFunc("POST "+auth.MFAPath+"/totp/confirm",pendingSetup(mfa.ConfirmTOTP(storage,keys,*cfg)))
+		router.HandleFunc("POST /api/mfa/totp",authenticate(mfa.SetUpTOTP(storage,*cfg)))
+		router.HandleFunc("POST /api/mfa/totp/confirm",authenticate(mfa.ConfirmTOTP(storage,keys,*cfg)))
+		router.HandleFunc("DELETE /api/mfa/totp",authenticate(mfa.DisableTOTP(storage,*cfg)))
+
+	// Admin
+		admins:=auth.NewAdminAuthenticator(storage,*cfg)
+		router.HandleFunc("POST /api/admin",admin.LoginAdmin(admins,storage,keys,*cfg))
+		router.HandleFunc("POST /api/admin/logout",authenticate(admin.Logout(storage,*cfg)))
+		router.HandleFunc("POST /api/admin/logout/all",authenticate(admin.LogoutEverywhere(storage,*cfg)))
+		router.HandleFunc("POST /api/admins",authorize(models.PermissionAdminsManage,admin.CreateAdmin(storage,*cfg)))
+		router.HandleFunc("GET /api/admins",authorize(models.PermissionAdminsRead,admin.GetAllAdmins(storage)))
+		router.HandleFunc("PUT /api/admins/{id}/disable",authorize(models.PermissionAdminsManage,admin.SetDisabled(storage,true)))
+		router.HandleFunc("PUT /api/admins/{id}/enable",authorize(models.PermissionAdminsManage,admin.SetDisabled(storage,false)))
+		router.HandleFunc("DELETE /api/admins/{id}",authorize(models.PermissionAdminsManage,admin.DeleteAdmin(storage)))
+		router.HandleFunc("GET /api/admin/lockouts",authorize(models.PermissionLoginsManage,admin.GetLockedLogins(storage)))
+		router.HandleFunc("DELETE /api/admin/lockouts/{key}",authorize(models.PermissionLoginsManage,admin.Unlock(storage,*cfg)))
+		router.HandleFunc("GET /api/admin/audit",authorize(models.PermissionAuditRead,admin.GetAuditLog(storage)))
+
+	// API keys
+		router.HandleFunc("POST /api/admin/apikeys",authorize(models.PermissionAPIKeysManage,admin.CreateAPIKey(storage,*cfg)))
+		router.HandleFunc("GET /api/admin/apikeys",authorize(models.PermissionAPIKeysManage,admin.GetAPIKeys(storage)))
+		router.HandleFunc("DELETE /api/admin/apikeys/{id}",authorize(models.PermissionAPIKeysManage,admin.RevokeAPIKey(storage,*cfg)))
+
+	// Roles
+		router.HandleFunc("GET /api/roles",authorize(models.PermissionRolesRead,admin.GetAllRoles(storage)))
+		router.HandleFunc("POST /api/roles",authorize(models.PermissionRolesManage,admin.CreateRole(storage)))
+		router.HandleFunc("PUT /api/roles/{name}/permissions",authorize(models.PermissionRolesManage,admin.SetRolePermissions(storage)))
+		router.HandleFunc("DELETE /api/roles/{name}",authorize(models.PermissionRolesManage,admin.DeleteRole(storage)))
+		router.HandleFunc("GET /api/admins/{id}/roles",authorize(models.PermissionRolesRead,admin.GetAdminRoles(storage)))
+		router.HandleFunc("POST /api/admins/{id}/roles",authorize(models.PermissionRolesManage,admin.AssignRole(storage)))
+		router.HandleFunc("DELETE /api/admins/{id}/roles/{role}",authorize(models.PermissionRolesManage,admin.UnassignRole(storage)))
+
+	// Student
+		router.HandleFunc("POST /api/students",student.Register(storage,keys,mailer,*cfg))
+		router.HandleFunc("POST /api/students/login",student.LoginStudent(storage,keys,*cfg))
+		router.HandleFunc("GET /api/students/{id}",authorize(models.PermissionStudentsRead,student.GetById(storage)))
+		router.HandleFunc("GET /api/students/all",authorize(models.PermissionStudentsRead,student.GetAllStudents(storage)))
+		router.HandleFunc("GET /api/students",authorize(models.PermissionStudentsRead,student.GetStudentByEmail(storage)))
+		router.HandleFunc("PUT /api/students/update",authorize(models.PermissionProfileUpdate,student.UpdateStudent(storage)))
+		router.HandleFunc("POST /api/students/logout",authenticate(student.Logout(storage,*cfg)))
+		router.HandleFunc("POST /api/students/logout/all",authenticate(student.LogoutEverywhere(storage,*cfg)))
+		router.HandleFunc("POST /api/students/password/forgot",student.ForgotPassword(storage,mailer,*cfg))
+		router.HandleFunc("PUT /api/students/password",authorize(models.PermissionProfileUpdate,student.ChangePassword(storage,*cfg)))
+		router.HandleFunc("POST "+auth.ResetPasswordPath,student.ResetPassword(storage,*cfg))
+		router.HandleFunc("GET "+auth.VerifyEmailPath,student.VerifyEmail(storage,keys))
+		router.HandleFunc("POST "+auth.VerifyEmailPath+"/resend",student.ResendVerification(storage,keys,mailer,*cfg))
+
+	// Courses
+		router.HandleFunc("POST /api/courses",authorize(models.PermissionCoursesWrite,courses.CreateCourse(storage)))
+		router.HandleFunc("GET /api/courses/{id}",courses.GetCourseById(storage))
+		router.HandleFunc("GET /api/courses/all",courses.GetAllCourses(storage))
+		router.HandleFunc("PUT /api/courses/update/{id}",authorize(models.PermissionCoursesWrite,courses.UpdateCourse(storage)))
+		router.HandleFunc("GET /api/courses/search",courses.SearchCoursesByName(storage))
+
+	// Enrollment
+		router.HandleFunc("POST /api/enrollment",authorize(models.PermissionEnrollmentsSelf,enrollment.EnrollStudent(storage,*cfg)))
+		router.HandleFunc("POST /api/unenrollment", authorize(models.PermissionEnrollmentsSelf,enrollment.UnenrollStudent(storage)))
+		router.HandleFunc("GET /api/enrolled/students/{id}",authorize(models.PermissionEnrollmentsSelf,enrollment.GetCoursesByStudentID(storage)))
+		router.HandleFunc("GET /api/enrolled/courses/{id}",authorize(models.PermissionEnrollmentsRead,enrollment.GetStudentsByCourseID(storage)))
+		router.HandleFunc("GET /api/enrollments/courses/{id}",authorize(models.PermissionEnrollmentsRead,enrollment.GetEnrollmentsByCourseID(storage)))
+		router.HandleFunc("PUT /api/enrollment/{id}/status",authorize(models.PermissionEnrollmentsManage,enrollment.UpdateEnrollmentStatus(storage)))
+
+	// Waitlist
+		router.HandleFunc("GET /api/waitlist",authorize(models.PermissionEnrollmentsSelf,enrollment.GetMyWaitlist(storage)))
+		router.HandleFunc("GET /api/waitlist/courses/{id}",authorize(models.PermissionEnrollmentsSelf,enrollment.GetWaitlistPosition(storage)))
+		router.HandleFunc("GET /api/waitlisted/courses/{id}",authorize(models.PermissionEnrollmentsRead,enrollment.GetWaitlistByCourseID(storage)))
+
+	// Applications
+		router.HandleFunc("POST /api/applications",authorize(models.PermissionApplicationsSelf,applications.SubmitApplication(storage)))
+		router.HandleFunc("GET /api/applications",authorize(models.PermissionApplicationsSelf,applications.GetMyApplications(storage)))
+		router.HandleFunc("GET /api/applications/{id}",authorize(models.PermissionApplicationsSelf,applications.GetMyApplication(storage)))
+		router.HandleFunc("GET /api/admin/applications",authorize(models.PermissionApplicationsRead,applications.GetApplications(storage)))
+		router.HandleFunc("GET /api/admin/applications/{id}",authorize(models.PermissionApplicationsRead,applications.GetApplicationById(storage)))
+		router.HandleFunc("POST /api/admin/applications/{id}/reviewers",authorize(models.PermissionApplicationsManage,applications.AssignReviewer(storage)))
+		router.HandleFunc("PUT /api/admin/applications/{id}/review",authorize(models.PermissionApplicationsReview,applications.ReviewApplication(storage)))
+		router.HandleFunc("PUT /api/admin/applications/{id}/decision",authorize(models.PermissionApplicationsManage,applications.DecideApplication(storage)))
+
+	return router
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth/ldaptest"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth/oidctest"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testCfg = config.Config{
+	JWTSecret: "test-secret",
+	Auth: config.AuthConfig{
+		AccessTokenLifetime:       15 * time.Minute,
+		RefreshTokenLifetime:      time.Hour,
+		EmailVerificationURL:      "http://localhost/api/students/verify",
+		EmailVerificationLifetime: time.Hour,
+		RequireVerifiedEmail:      config.RequireVerifiedNone,
+		PasswordPolicy:            config.PasswordPolicyConfig{MinLength: 8},
+		MailThrottle:              config.MailThrottleConfig{PerEmail: 3, PerIP: 20, Window: time.Hour},
+	},
+}
+
+// server is the API over a memory store, as main serves it.
+type server struct {
+	t       *testing.T
+	storage *memory.Memory
+	keys    *auth.Keys
+	router  http.Handler
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	keys, err := auth.LoadKeys(testCfg)
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	s := memory.New()
+	cfg := testCfg
+	return &server{t: t, storage: s, keys: keys, router: routes(s, keys, mail.NewWriter(io.Discard, "portal@example.com"), nil, &cfg)}
+}
+
+// login returns the access token cookie of a new session of the user.
+func (s *server) login(userType models.UserType, userID int64, email string) *http.Cookie {
+	s.t.Helper()
+	session, err := auth.Login(s.t.Context(), s.storage, s.keys, testCfg, userType, userID, email)
+	if err != nil {
+		s.t.Fatalf("Login: %v", err)
+	}
+	return &http.Cookie{Name: auth.CookieName, Value: session.AccessToken}
+}
+
+// admin creates an admin holding role and logs them in.
+func (s *server) admin(email string, role string) *http.Cookie {
+	s.t.Helper()
+	id, err := s.storage.CreateAdmin(s.t.Context(), "Admin", email, "hash")
+	if err != nil {
+		s.t.Fatalf("CreateAdmin: %v", err)
+	}
+	if err := s.storage.AssignRole(s.t.Context(), id, role); err != nil {
+		s.t.Fatalf("AssignRole(%s): %v", role, err)
+	}
+	return s.login(models.UserAdmin, id, email)
+}
+
+// do sends a request as a page of the site would: with cookie and, when that
+// is a session cookie, a CSRF token in both the csrf_token cookie and header.
+func (s *server) do(method string, path string, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	s.t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	if cookie != nil && cookie.Name == auth.CookieName {
+		r.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "csrf"})
+		r.Header.Set(auth.CSRFHeader, "csrf")
+	}
+	return s.serve(r)
+}
+
+// bearer sends a request with token in an Authorization: Bearer header.
+func (s *server) bearer(method string, path string, body string, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	return s.serve(r)
+}
+
+func (s *server) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+// studentObjects returns the JSON objects of a response holding one student
+// or a list of them.
+func studentObjects(t *testing.T, body []byte) []map[string]any {
+	t.Helper()
+	var list []map[string]any
+	if err := json.Unmarshal(body, &list); err == nil {
+		return list
+	}
+	var one map[string]any
+	if err := json.Unmarshal(body, &one); err != nil {
+		t.Fatalf("response is not a student or a list of them: %s", body)
+	}
+	return []map[string]any{one}
+}
+
+// TestStudentResponses guards every route that returns students against
+// leaking password hashes, and personal details to admins without
+// students:pii.
+func TestStudentResponses(t *testing.T) {
+	s := newServer(t)
+
+	register := s.do("POST", "/api/students", `{"full_name":"Asha K","email":"asha@example.com","password":"correct-horse","age":20,"gender":"female","phone_number":"9876543210","dob":"2004-01-02","address":"Indore"}`, nil)
+	if register.Code != http.StatusCreated {
+		t.Fatalf("POST /api/students = %d %s", register.Code, register.Body)
+	}
+	if strings.Contains(register.Body.String(), "password") || strings.Contains(register.Body.String(), "correct-horse") {
+		t.Errorf("POST /api/students answered %s", register.Body)
+	}
+	student, err := s.storage.GetStudentByEmail(t.Context(), "asha@example.com")
+	if err != nil {
+		t.Fatalf("GetStudentByEmail: %v", err)
+	}
+	courseID, err := s.storage.CreateCourse(t.Context(), "Algorithms", "Graphs", "12 weeks", 4, 1000, 10)
+	if err != nil {
+		t.Fatalf("CreateCourse: %v", err)
+	}
+	if _, err := s.storage.EnrollStudent(t.Context(), student.Id, courseID); err != nil {
+		t.Fatalf("EnrollStudent: %v", err)
+	}
+
+	public := []string{"full_name", "id", "verified"}
+	personal := []string{"address", "age", "dob", "email", "full_name", "gender", "id", "phone_number", "verified"}
+	viewers := []struct {
+		name   string
+		cookie *http.Cookie
+		fields []string
+	}{
+		{"superadmin", s.admin("root@example.com", models.RoleSuperadmin), personal},
+		{"registrar", s.admin("registrar@example.com", "registrar"), personal},
+		{"auditor", s.admin("auditor@example.com", "auditor"), public},
+	}
+	paths := []string{
+		fmt.Sprintf("/api/students/%d", student.Id),
+		"/api/students/all",
+		"/api/students?email=asha@example.com",
+		fmt.Sprintf("/api/enrolled/courses/%d", courseID),
+	}
+
+	for _, viewer := range viewers {
+		for _, path := range paths {
+			t.Run(viewer.name+" "+path, func(t *testing.T) {
+				w := s.do("GET", path, "", viewer.cookie)
+				if w.Code != http.StatusOK {
+					t.Fatalf("GET %s = %d %s", path, w.Code, w.Body)
+				}
+				body := w.Body.String()
+				if strings.Contains(body, student.Password) || strings.Contains(body, "$2a$") || strings.Contains(body, "password") {
+					t.Errorf("GET %s leaked the password hash: %s", path, body)
+				}
+
+				objects := studentObjects(t, w.Body.Bytes())
+				if len(objects) != 1 {
+					t.Fatalf("GET %s returned %d students, want 1: %s", path, len(objects), body)
+				}
+				if fields := slices.Sorted(maps.Keys(objects[0])); !slices.Equal(fields, viewer.fields) {
+					t.Errorf("GET %s fields = %v, want %v", path, fields, viewer.fields)
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateStudentRefusesPassword(t *testing.T) {
+	s := newServer(t)
+	id, err := s.storage.CreateStudent(t.Context(), "Asha K", "asha@example.com", "hash", 20, "female", "9876543210", "2004-01-02", "Indore")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	cookie := s.login(models.UserStudent, id, "asha@example.com")
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"password", `{"full_name":"Asha","password":"new-password"}`, http.StatusBadRequest},
+		{"invalid email", `{"email":"not-an-email"}`, http.StatusBadRequest},
+		{"age out of range", `{"age":7}`, http.StatusBadRequest},
+		{"profile", `{"full_name":"Asha Kumar","address":"Pune"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.do("PUT", "/api/students/update", tt.body, cookie); w.Code != tt.code {
+				t.Errorf("PUT /api/students/update %s = %d %s, want %d", tt.body, w.Code, w.Body, tt.code)
+			}
+		})
+	}
+
+	got, err := s.storage.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	if got.Password != "hash" || got.FullName != "Asha Kumar" || got.Address != "Pune" || got.Email != "asha@example.com" || got.Age != 20 {
+		t.Errorf("after the updates the student is %+v", got)
+	}
+}
+
+// TestNewPasswordsMeetThePolicy checks the routes that set a password without
+// registering or changing one.
+func TestNewPasswordsMeetThePolicy(t *testing.T) {
+	s := newServer(t)
+	superadmin := s.admin("root@example.com", models.RoleSuperadmin)
+
+	for _, password := range []string{"short7", strings.Repeat("x", 73)} {
+		body := fmt.Sprintf(`{"name":"Ravi","email":"ravi@example.com","password":%q}`, password)
+		if w := s.do("POST", "/api/admins", body, superadmin); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "password policy") {
+			t.Errorf("POST /api/admins with password %q = %d %s, want 400", password, w.Code, w.Body)
+		}
+		body = fmt.Sprintf(`{"token":"unused","password":%q}`, password)
+		if w := s.do("POST", "/api/students/password/reset", body, nil); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "password policy") {
+			t.Errorf("POST /api/students/password/reset with password %q = %d %s, want 400", password, w.Code, w.Body)
+		}
+	}
+	if _, err := s.storage.GetAdminByEmail(t.Context(), "ravi@example.com"); err == nil {
+		t.Error("an admin was created with a password that falls short")
+	}
+}
+
+func TestEnrollmentsAreSelfService(t *testing.T) {
+	s := newServer(t)
+	ids := map[string]int64{}
+	for _, email := range []string{"asha@example.com", "ravi@example.com"} {
+		id, err := s.storage.CreateStudent(t.Context(), "Student", email, "hash", 20, "female", "9876543210", "2004-01-02", "Indore")
+		if err != nil {
+			t.Fatalf("CreateStudent: %v", err)
+		}
+		ids[email] = id
+	}
+	asha := s.login(models.UserStudent, ids["asha@example.com"], "asha@example.com")
+	ravi := ids["ravi@example.com"]
+	courseID, err := s.storage.CreateCourse(t.Context(), "Algorithms", "Graphs", "12 weeks", 4, 1000, 10)
+	if err != nil {
+		t.Fatalf("CreateCourse: %v", err)
+	}
+	if _, err := s.storage.EnrollStudent(t.Context(), ravi, courseID); err != nil {
+		t.Fatalf("EnrollStudent: %v", err)
+	}
+
+	// Asha cannot act on Ravi's enrollments.
+	for _, request := range []struct{ method, path, body string }{
+		{"POST", "/api/enrollment", fmt.Sprintf(`{"student_id":%d,"course_id":%d}`, ravi, courseID)},
+		{"POST", "/api/unenrollment", fmt.Sprintf(`{"student_id":%d,"course_id":%d}`, ravi, courseID)},
+		{"GET", fmt.Sprintf("/api/enrolled/students/%d", ravi), ""},
+	} {
+		if w := s.do(request.method, request.path, request.body, asha); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s for another student = %d %s, want 403", request.method, request.path, w.Code, w.Body)
+		}
+	}
+	if courses, err := s.storage.GetCoursesByStudentID(t.Context(), ravi); err != nil || len(courses) != 1 {
+		t.Errorf("Ravi's courses = %v, %v, want his enrollment kept", courses, err)
+	}
+
+	// She acts on her own, naming herself or not.
+	if w := s.do("POST", "/api/enrollment", fmt.Sprintf(`{"course_id":%d}`, courseID), asha); w.Code != http.StatusCreated {
+		t.Errorf("POST /api/enrollment for herself = %d %s", w.Code, w.Body)
+	}
+	if w := s.do("GET", fmt.Sprintf("/api/enrolled/students/%d", ids["asha@example.com"]), "", asha); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Algorithms") {
+		t.Errorf("GET her courses = %d %s", w.Code, w.Body)
+	}
+	if w := s.do("POST", "/api/unenrollment", fmt.Sprintf(`{"student_id":%d,"course_id":%d}`, ids["asha@example.com"], courseID), asha); w.Code != http.StatusOK {
+		t.Errorf("POST /api/unenrollment for herself = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestEnrollmentNeedsVerifiedEmail(t *testing.T) {
+	cfg := testCfg
+	cfg.Auth.RequireVerifiedEmail = config.RequireVerifiedEnrollment
+	s := newServer(t)
+	s.router = routes(s.storage, s.keys, mail.NewWriter(io.Discard, "portal@example.com"), nil, &cfg)
+
+	ashaID, err := s.storage.CreateStudent(t.Context(), "Asha K", "asha@example.com", "hash", 20, "female", "9876543210", "2004-01-02", "Indore")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	raviID, err := s.storage.CreateStudent(t.Context(), "Ravi S", "ravi@example.com", "hash", 21, "male", "9876543211", "2003-05-06", "Bhopal")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	if err := s.storage.VerifyStudentEmail(t.Context(), raviID, "ravi@example.com"); err != nil {
+		t.Fatalf("VerifyStudentEmail: %v", err)
+	}
+	courseID, err := s.storage.CreateCourse(t.Context(), "Algorithms", "Graphs", "12 weeks", 4, 1000, 10)
+	if err != nil {
+		t.Fatalf("CreateCourse: %v", err)
+	}
+	asha := s.login(models.UserStudent, ashaID, "asha@example.com")
+
+	// Naming a verified student does not get Asha past her own verification.
+	for _, body := range []string{
+		fmt.Sprintf(`{"student_id":%d,"course_id":%d}`, ashaID, courseID),
+		fmt.Sprintf(`{"student_id":%d,"course_id":%d}`, raviID, courseID),
+	} {
+		if w := s.do("POST", "/api/enrollment", body, asha); w.Code != http.StatusForbidden {
+			t.Errorf("POST /api/enrollment %s while unverified = %d %s, want 403", body, w.Code, w.Body)
+		}
+	}
+	if courses, err := s.storage.GetCoursesByStudentID(t.Context(), raviID); err != nil || len(courses) != 0 {
+		t.Errorf("Ravi's courses = %v, %v, want none", courses, err)
+	}
+
+	if err := s.storage.VerifyStudentEmail(t.Context(), ashaID, "asha@example.com"); err != nil {
+		t.Fatalf("VerifyStudentEmail: %v", err)
+	}
+	if w := s.do("POST", "/api/enrollment", fmt.Sprintf(`{"course_id":%d}`, courseID), asha); w.Code != http.StatusCreated {
+		t.Errorf("POST /api/enrollment once verified = %d %s", w.Code, w.Body)
+	}
+}
+
+// TestBearerSessions follows a client that keeps its own tokens through
+// logging in, refreshing and logging out.
+func TestBearerSessions(t *testing.T) {
+	s := newServer(t)
+	if w := s.do("POST", "/api/students", `{"full_name":"Asha K","email":"asha@example.com","password":"correct-horse","age":20,"gender":"female","phone_number":"9876543210","dob":"2004-01-02","address":"Indore"}`, nil); w.Code != http.StatusCreated {
+		t.Fatalf("POST /api/students = %d %s", w.Code, w.Body)
+	}
+
+	r := httptest.NewRequest("POST", "/api/students/login", strings.NewReader(`{"email":"asha@example.com","password":"correct-horse"}`))
+	r.Header.Set("Prefer", auth.BearerPreference)
+	w := s.serve(r)
+	var login struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &login); err != nil || w.Code != http.StatusOK || login.AccessToken == "" || login.RefreshToken == "" || login.TokenType != "Bearer" {
+		t.Fatalf("login preferring bearer = %d %s", w.Code, w.Body)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("login preferring bearer set cookies %+v", cookies)
+	}
+
+	if w := s.bearer("GET", "/api/waitlist", "", login.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("GET /api/waitlist with a bearer token = %d %s", w.Code, w.Body)
+	}
+	if w := s.bearer("GET", "/api/waitlist", "", login.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/waitlist with the refresh token = %d, want 401", w.Code)
+	}
+
+	w = s.do("POST", auth.RefreshPath, `{"refresh_token":"`+login.RefreshToken+`"}`, nil)
+	var refreshed struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &refreshed); err != nil || w.Code != http.StatusOK || refreshed.AccessToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh with a body token = %d %s", w.Code, w.Body)
+	}
+
+	if w := s.bearer("POST", "/api/students/logout", "", refreshed.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("logout with a bearer token = %d %s", w.Code, w.Body)
+	}
+	if w := s.bearer("GET", "/api/waitlist", "", refreshed.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/waitlist after logout = %d, want 401", w.Code)
+	}
+}
+
+// TestPendingLoginsCompleteOnce replays the token of a login held for its
+// second step after the login completed.
+func TestPendingLoginsCompleteOnce(t *testing.T) {
+	cfg := testCfg
+	cfg.Auth.RequireAdminMFA = true
+	cfg.Auth.MFATokenLifetime = 5 * time.Minute
+	s := newServer(t)
+	s.router = routes(s.storage, s.keys, mail.NewWriter(io.Discard, "portal@example.com"), nil, &cfg)
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	if _, err := s.storage.CreateAdmin(t.Context(), "Admin", "admin@example.com", string(hash)); err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+
+	// login logs in preferring bearer tokens and returns the pending login's
+	// token, after checking the step it waits for.
+	login := func(step string) string {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/admin", strings.NewReader(`{"email":"admin@example.com","password":"admin password"}`))
+		r.Header.Set("Prefer", auth.BearerPreference)
+		w := s.serve(r)
+		var body struct {
+			MFA   string `json:"mfa"`
+			Token string `json:"mfa_token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK || body.MFA != step || body.Token == "" {
+			t.Fatalf("login = %d %s, want step %s", w.Code, w.Body, step)
+		}
+		return body.Token
+	}
+	code := func(secret string, at time.Time) string {
+		t.Helper()
+		code, err := auth.GenerateTOTP(secret, at)
+		if err != nil {
+			t.Fatalf("GenerateTOTP: %v", err)
+		}
+		return code
+	}
+
+	setup := login(auth.MFASetup)
+	w := s.bearer("POST", auth.MFAPath+"/totp", "", setup)
+	var secret struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &secret); err != nil || w.Code != http.StatusOK || secret.Secret == "" {
+		t.Fatalf("POST %s/totp = %d %s", auth.MFAPath, w.Code, w.Body)
+	}
+	now := time.Now()
+	if w := s.bearer("POST", auth.MFAPath+"/totp/confirm", fmt.Sprintf(`{"code":%q}`, code(secret.Secret, now)), setup); w.Code != http.StatusOK || !slices.ContainsFunc(w.Result().Cookies(), func(c *http.Cookie) bool { return c.Name == auth.CookieName }) {
+		t.Fatalf("POST %s/totp/confirm = %d %s", auth.MFAPath, w.Code, w.Body)
+	}
+	// The setup token is used up, and the admin no longer needs setting up.
+	if w := s.bearer("POST", auth.MFAPath+"/totp", "", setup); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST %s/totp with a used setup token = %d, want 401", auth.MFAPath, w.Code)
+	}
+	if w := s.bearer("POST", auth.MFAPath+"/totp/confirm", fmt.Sprintf(`{"code":%q}`, code(secret.Secret, now.Add(30*time.Second))), setup); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST %s/totp/confirm with a used setup token = %d, want 401", auth.MFAPath, w.Code)
+	}
+
+	verify := login(auth.MFAVerify)
+	if w := s.bearer("POST", auth.MFAPath, fmt.Sprintf(`{"code":%q}`, code(secret.Secret, now.Add(30*time.Second))), verify); w.Code != http.StatusOK {
+		t.Fatalf("POST %s = %d %s", auth.MFAPath, w.Code, w.Body)
+	}
+	if w := s.bearer("POST", auth.MFAPath, fmt.Sprintf(`{"code":%q}`, code(secret.Secret, now.Add(60*time.Second))), verify); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST %s with a used token = %d, want 401", auth.MFAPath, w.Code)
+	}
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	s := newServer(t)
+	root := s.admin("root@example.com", models.RoleSuperadmin)
+
+	w := s.do("POST", "/api/admin/apikeys", `{"name":"export","permissions":["students:read"]}`, root)
+	var created struct {
+		Key    string        `json:"key"`
+		APIKey models.APIKey `json:"api_key"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated || !auth.IsAPIKey(created.Key) {
+		t.Fatalf("POST /api/admin/apikeys = %d %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "hash") {
+		t.Errorf("POST /api/admin/apikeys answered the key hash: %s", w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"granted permission", "GET", "/api/students/all", "", http.StatusOK},
+		{"permission outside the key", "GET", "/api/admins", "", http.StatusForbidden},
+		{"route without a permission", "POST", "/api/admin/logout", "", http.StatusForbidden},
+		{"keys cannot make keys", "POST", "/api/admin/apikeys", `{"name":"more","permissions":["students:read"]}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.bearer(tt.method, tt.path, tt.body, created.Key); w.Code != tt.code {
+				t.Errorf("%s %s with the key = %d %s, want %d", tt.method, tt.path, w.Code, w.Body, tt.code)
+			}
+		})
+	}
+
+	if w := s.do("POST", "/api/admin/apikeys", `{"name":"self","permissions":["profile:update"]}`, root); w.Code != http.StatusForbidden {
+		t.Errorf("creating a key with a permission the admin lacks = %d %s, want 403", w.Code, w.Body)
+	}
+	auditor := s.admin("auditor@example.com", "auditor")
+	if w := s.do("GET", "/api/admin/apikeys", "", auditor); w.Code != http.StatusForbidden {
+		t.Errorf("GET /api/admin/apikeys as an auditor = %d, want 403", w.Code)
+	}
+
+	w = s.do("GET", "/api/admin/apikeys", "", root)
+	var keys []models.APIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("GET /api/admin/apikeys = %d %s, want the key with its last use", w.Code, w.Body)
+	}
+
+	if w := s.do("DELETE", fmt.Sprintf("/api/admin/apikeys/%d", created.APIKey.ID), "", root); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /api/admin/apikeys = %d %s", w.Code, w.Body)
+	}
+	if w := s.bearer("GET", "/api/students/all", "", created.Key); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/students/all with a revoked key = %d, want 401", w.Code)
+	}
+	if w := s.bearer("GET", "/api/students/all", "", auth.APIKeyPrefix+"unknown"); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/students/all with an unknown key = %d, want 401", w.Code)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	s := newServer(t)
+	if w := s.do("POST", "/api/students", `{"full_name":"Asha K","email":"asha@example.com","password":"correct-horse","age":20,"gender":"female","phone_number":"9876543210","dob":"2004-01-02","address":"Indore"}`, nil); w.Code != http.StatusCreated {
+		t.Fatalf("POST /api/students = %d %s", w.Code, w.Body)
+	}
+	w := s.do("POST", "/api/students/login", `{"email":"asha@example.com","password":"correct-horse"}`, nil)
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	session, csrf := cookies[auth.CookieName], cookies[auth.CSRFCookieName]
+	if w.Code != http.StatusOK || session == nil || csrf == nil || csrf.Value == "" || csrf.HttpOnly {
+		t.Fatalf("login = %d, cookies %+v", w.Code, cookies)
+	}
+
+	update := func(header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PUT", "/api/students/update", strings.NewReader(`{"address":"Pune"}`))
+		r.AddCookie(session)
+		r.AddCookie(csrf)
+		if header != "" {
+			r.Header.Set(auth.CSRFHeader, header)
+		}
+		return s.serve(r)
+	}
+	if w := update(""); w.Code != http.StatusForbidden {
+		t.Errorf("PUT /api/students/update without a CSRF header = %d, want 403", w.Code)
+	}
+	if w := update("forged"); w.Code != http.StatusForbidden {
+		t.Errorf("PUT /api/students/update with a wrong CSRF header = %d, want 403", w.Code)
+	}
+	if w := update(csrf.Value); w.Code != http.StatusOK {
+		t.Errorf("PUT /api/students/update with the CSRF header = %d %s", w.Code, w.Body)
+	}
+
+	r := httptest.NewRequest("GET", "/api/waitlist", nil)
+	r.AddCookie(session)
+	if w := s.serve(r); w.Code != http.StatusOK {
+		t.Errorf("GET /api/waitlist without a CSRF header = %d, want 200", w.Code)
+	}
+}
+
+func TestSingleSignOn(t *testing.T) {
+	provider := oidctest.New(t)
+	cfg := testCfg
+	cfg.Auth.OIDC = config.OIDCConfig{
+		Issuer:        provider.URL,
+		ClientID:      provider.ClientID,
+		ClientSecret:  provider.ClientSecret,
+		RedirectURL:   "http://portal.example.com" + auth.OIDCCallbackPath,
+		GroupsClaim:   "groups",
+		GroupRoles:    map[string]string{"office": "registrar"},
+		AfterLoginURL: "/dashboard",
+		LoginLifetime: time.Minute,
+	}
+	oidc, err := auth.NewOIDC(t.Context(), cfg.Auth.OIDC)
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	s := newServer(t)
+	s.router = routes(s.storage, s.keys, mail.NewWriter(io.Discard, "portal@example.com"), oidc, &cfg)
+
+	// login goes through the provider as the user with claims and returns
+	// the callback's answer.
+	login := func(claims map[string]any) *httptest.ResponseRecorder {
+		t.Helper()
+		w := s.do("GET", auth.OIDCPath, "", nil)
+		if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), provider.URL+"/authorize?") {
+			t.Fatalf("GET %s = %d, Location %q", auth.OIDCPath, w.Code, w.Header().Get("Location"))
+		}
+		callback := provider.Authorize(t, w.Header().Get("Location"), claims)
+		r := httptest.NewRequest("GET", strings.TrimPrefix(callback, "http://portal.example.com"), nil)
+		for _, c := range w.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		return s.serve(r)
+	}
+	session := func(w *httptest.ResponseRecorder) *http.Cookie {
+		t.Helper()
+		for _, c := range w.Result().Cookies() {
+			if c.Name == auth.CookieName && c.Value != "" {
+				return c
+			}
+		}
+		t.Fatalf("callback = %d %s without a session", w.Code, w.Body)
+		return nil
+	}
+
+	w := login(map[string]any{"sub": "u-1", "email": "asha@example.com", "email_verified": true, "name": "Asha K"})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("student callback = %d, Location %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if w := s.do("GET", "/api/waitlist", "", session(w)); w.Code != http.StatusOK {
+		t.Errorf("GET /api/waitlist after single sign-on = %d %s", w.Code, w.Body)
+	}
+
+	w = login(map[string]any{"sub": "u-2", "email": "meera@example.com", "email_verified": true, "groups": []string{"office"}})
+	staff := session(w)
+	if w := s.do("GET", "/api/admin/applications", "", staff); w.Code != http.StatusOK {
+		t.Errorf("GET /api/admin/applications as a registrar = %d %s", w.Code, w.Body)
+	}
+	if w := s.do("GET", "/api/admins", "", staff); w.Code != http.StatusForbidden {
+		t.Errorf("GET /api/admins as a registrar = %d, want 403", w.Code)
+	}
+
+	s.admin("root@example.com", models.RoleSuperadmin)
+	if w := login(map[string]any{"sub": "u-4", "email": "root@example.com", "email_verified": true, "groups": []string{"office"}}); w.Code != http.StatusConflict {
+		t.Errorf("callback with a local admin's email = %d, want 409", w.Code)
+	}
+	if w := login(map[string]any{"sub": "u-3", "email": "new@example.com"}); w.Code != http.StatusForbidden {
+		t.Errorf("callback with an unverified email = %d, want 403", w.Code)
+	}
+	if w := s.do("GET", auth.OIDCCallbackPath+"?code=x&state=y", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("callback without a started login = %d, want 401", w.Code)
+	}
+}
+
+func TestDirectoryLogin(t *testing.T) {
+	directory := ldaptest.New(t)
+	directory.AddUser("meera", "correct horse", "meera@example.com", "cn=office,ou=groups,dc=example,dc=edu")
+	cfg := testCfg
+	cfg.Auth.LDAP = config.LDAPConfig{
+		URL:            directory.URL,
+		BindDN:         directory.BindDN,
+		BindPassword:   directory.BindPassword,
+		BaseDN:         directory.BaseDN,
+		UserFilter:     "(mail=%s)",
+		EmailAttribute: "mail",
+		NameAttribute:  "cn",
+		GroupAttribute: "memberOf",
+		GroupRoles:     map[string]string{"cn=office,ou=groups,dc=example,dc=edu": "registrar"},
+		Timeout:        5 * time.Second,
+	}
+	s := newServer(t)
+	s.router = routes(s.storage, s.keys, mail.NewWriter(io.Discard, "portal@example.com"), nil, &cfg)
+	superadmin := s.admin("root@example.com", models.RoleSuperadmin)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		t.Helper()
+		return s.do("POST", "/api/admin", fmt.Sprintf(`{"email":"meera@example.com","password":%q}`, password), nil)
+	}
+
+	w := login("correct horse")
+	var staff *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.CookieName {
+			staff = c
+		}
+	}
+	if w.Code != http.StatusOK || staff == nil {
+		t.Fatalf("directory login = %d %s", w.Code, w.Body)
+	}
+	if w := s.do("GET", "/api/admin/applications", "", staff); w.Code != http.StatusOK {
+		t.Errorf("GET /api/admin/applications as a registrar = %d %s", w.Code, w.Body)
+	}
+	if w := login("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("directory login with a wrong password = %d, want 401", w.Code)
+	}
+
+	// Disabling the admin the directory logs in as keeps them out.
+	meera, err := s.storage.GetAdminByEmail(t.Context(), "meera@example.com")
+	if err != nil {
+		t.Fatalf("GetAdminByEmail: %v", err)
+	}
+	if w := s.do("PUT", fmt.Sprintf("/api/admins/%d/disable", meera.ID), "", superadmin); w.Code != http.StatusOK {
+		t.Fatalf("disable = %d %s", w.Code, w.Body)
+	}
+	if w := login("correct horse"); w.Code != http.StatusForbidden {
+		t.Errorf("directory login of a disabled admin = %d, want 403", w.Code)
+	}
+
+	directory.Close()
+	if w := login("correct horse"); w.Code != http.StatusBadGateway {
+		t.Errorf("directory login with the directory down = %d, want 502", w.Code)
+	}
+	// Guesses at a local password while the directory is down are counted.
+	if w := s.do("POST", "/api/admin", `{"email":"root@example.com","password":"guess"}`, nil); w.Code != http.StatusBadGateway {
+		t.Errorf("local login with a wrong password and the directory down = %d, want 502", w.Code)
+	}
+	if throttle, err := s.storage.GetLoginThrottle(t.Context(), auth.AccountKey(models.UserAdmin, "root@example.com")); err != nil || throttle.Failures != 1 {
+		t.Errorf("failed logins counted with the directory down = %+v, %v, want 1", throttle, err)
+	}
+}
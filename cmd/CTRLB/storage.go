@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/migrations"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/postgres"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/sqlite"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"log/slog"
+)
+
+// newStorage opens the backend selected by storage.driver and migrates it.
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			return nil, fmt.Errorf("storage_path is required for the sqlite driver")
+		}
+		return sqlite.New(cfg)
+	case "postgres":
+		return postgres.New(cfg)
+	case "memory":
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// seedAdmin creates the admin from the config file when the database has
+// none, so a fresh install can log in. Once any admin exists the config
+// admin is ignored.
+func seedAdmin(ctx context.Context, s storage.Storage, cfg config.AdminConfig) error {
+	admins, err := s.GetAllAdmins(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list admins: %w", err)
+	}
+	if len(admins) > 0 {
+		return nil
+	}
+	if cfg.Email == "" || cfg.Password == "" {
+		slog.Warn("No admin exists; set admin.email and admin.password to create the first one")
+		return nil
+	}
+
+	hashedPassword, err := security.HashPassword(cfg.Password)
+	if err != nil {
+		return err
+	}
+	created, err := s.CreateFirstAdmin(ctx, cfg.Name, cfg.Email, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to create the first admin: %w", err)
+	}
+	if created {
+		slog.Info("Created the first admin from config", slog.String("email", storage.NormalizeEmail(cfg.Email)))
+	}
+	return nil
+}
+
+// openDatabase opens the SQL database selected by storage.driver without
+// migrating it, for the migrate command.
+func openDatabase(cfg *config.Config) (*sql.DB, migrations.Dialect, error) {
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			return nil, "", fmt.Errorf("storage_path is required for the sqlite driver")
+		}
+		s, err := sqlite.Open(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return s.Db, migrations.SQLite, nil
+	case "postgres":
+		p, err := postgres.Open(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return p.Db, migrations.Postgres, nil
+	case "memory":
+		return nil, "", fmt.Errorf("the memory driver has no schema to migrate")
+	default:
+		return nil, "", fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
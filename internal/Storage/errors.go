@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Every backend wraps its failures in one of these kinds so callers can
+// tell them apart with errors.Is, whatever the underlying driver.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("already exists")
+	ErrConstraint = errors.New("constraint violation")
+	ErrInvalid    = errors.New("invalid input")
+
+	// ErrTimeout is returned when a storage call runs past its deadline,
+	// either the caller's or the backend's default query timeout.
+	ErrTimeout = errors.New("query timed out")
+)
+
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Unwrap() error { return e.kind }
+
+// Errorf formats an error message that matches kind under errors.Is while
+// keeping the message itself free of the kind's text.
+func Errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// ContextError marks err as ErrTimeout when it was caused by an expired
+// deadline. Cancellation and every other error are returned unchanged.
+func ContextError(err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrTimeout, err)
+}
+
+// NormalizeEmail is the canonical form emails are stored and looked up in,
+// which makes them unique regardless of case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
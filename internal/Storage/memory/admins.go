@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"maps"
+	"sort"
+	"time"
+)
+
+// Admin
+
+func (m *Memory) CreateAdmin(ctx context.Context, name string, email string, password string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createAdmin(name, storage.NormalizeEmail(email), password)
+}
+
+func (m *Memory) CreateFirstAdmin(ctx context.Context, name string, email string, password string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.admins) > 0 {
+		return false, nil
+	}
+	id, err := m.createAdmin(name, storage.NormalizeEmail(email), password)
+	if err != nil {
+		return false, err
+	}
+	superadmin, _ := m.roleByName(models.RoleSuperadmin)
+	m.adminRoles[id] = []int64{superadmin.ID}
+	return true, nil
+}
+
+func (m *Memory) GetAdminById(ctx context.Context, id int64) (models.Admin, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Admin{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	admin, ok := m.admins[id]
+	if !ok {
+		return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)
+	}
+	return admin, nil
+}
+
+func (m *Memory) GetAdminByEmail(ctx context.Context, email string) (models.Admin, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Admin{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	email = storage.NormalizeEmail(email)
+	for _, admin := range m.admins {
+		if admin.Email == email {
+			return admin, nil
+		}
+	}
+	return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with email %s", email)
+}
+
+func (m *Memory) GetAllAdmins(ctx context.Context) ([]models.Admin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var admins []models.Admin
+	for _, admin := range m.admins {
+		admins = append(admins, admin)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].ID < admins[j].ID })
+	return admins, nil
+}
+
+func (m *Memory) SetAdminDisabled(ctx context.Context, id int64, disabled bool) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, ok := m.admins[id]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)
+	}
+	if disabled && m.lastEnabledAdmin(id) {
+		return storage.Errorf(storage.ErrConflict, "admin %d is the last enabled admin", id)
+	}
+
+	changed := admin
+	changed.Disabled = disabled
+	return m.keepRoleManager(
+		func() { m.admins[id] = changed },
+		func() { m.admins[id] = admin },
+	)
+}
+
+func (m *Memory) DeleteAdmin(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, ok := m.admins[id]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)
+	}
+	if m.lastEnabledAdmin(id) {
+		return storage.Errorf(storage.ErrConflict, "admin %d is the last enabled admin", id)
+	}
+
+	roles := m.adminRoles[id]
+	apiKeys := m.apiKeys
+	identities := maps.Clone(m.identities)
+	return m.keepRoleManager(
+		func() {
+			delete(m.admins, id)
+			delete(m.adminRoles, id)
+			m.deleteAPIKeys(id)
+			m.deleteIdentities(userKey{models.UserAdmin, id})
+		},
+		func() {
+			m.admins[id] = admin
+			m.adminRoles[id] = roles
+			m.apiKeys = apiKeys
+			m.identities = identities
+		},
+	)
+}
+
+// The helpers below expect the caller to hold m.mu.
+
+func (m *Memory) createAdmin(name string, email string, password string) (int64, error) {
+	for _, admin := range m.admins {
+		if admin.Email == email {
+			return 0, storage.Errorf(storage.ErrConflict, "an admin with email %s already exists", email)
+		}
+	}
+
+	now := time.Now().UTC()
+	m.lastAdminID++
+	m.admins[m.lastAdminID] = models.Admin{
+		ID:        m.lastAdminID,
+		Name:      name,
+		Email:     email,
+		Password:  password,
+		CreatedAt: &now,
+	}
+	return m.lastAdminID, nil
+}
+
+// lastEnabledAdmin reports whether id is the only admin that is not disabled.
+func (m *Memory) lastEnabledAdmin(id int64) bool {
+	if m.admins[id].Disabled {
+		return false
+	}
+	for other, admin := range m.admins {
+		if other != id && !admin.Disabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// API key
+
+func (m *Memory) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, storage.ContextError(err)
+	}
+
+	permissions, err := checkPermissions(key.Permissions)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.admins[key.CreatedBy]; !ok {
+		return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", key.CreatedBy)
+	}
+	for _, existing := range m.apiKeys {
+		if existing.Hash == key.Hash {
+			return models.APIKey{}, storage.Errorf(storage.ErrConflict, "an API key with that hash already exists")
+		}
+	}
+
+	m.lastAPIKeyID++
+	key.ID = m.lastAPIKeyID
+	key.Permissions = permissions
+	key.CreatedAt = key.CreatedAt.UTC()
+	key.ExpiresAt = copyTime(key.ExpiresAt)
+	key.LastUsedAt = nil
+	key.RevokedAt = nil
+	m.apiKeys = append(m.apiKeys, key)
+	return copyAPIKey(key), nil
+}
+
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "unknown API key")
+}
+
+func (m *Memory) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range m.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	return keys, nil
+}
+
+func (m *Memory) RevokeAPIKey(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.apiKeyIndex(id)
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id)
+	}
+	if m.apiKeys[i].RevokedAt == nil {
+		now := time.Now().UTC()
+		m.apiKeys[i].RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.apiKeyIndex(id)
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id)
+	}
+	at = at.UTC()
+	m.apiKeys[i].LastUsedAt = &at
+	return nil
+}
+
+func (m *Memory) apiKeyIndex(id int64) (int, bool) {
+	for i, key := range m.apiKeys {
+		if key.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// deleteAPIKeys drops the keys created by an admin who is being deleted.
+func (m *Memory) deleteAPIKeys(adminID int64) {
+	var kept []models.APIKey
+	for _, key := range m.apiKeys {
+		if key.CreatedBy != adminID {
+			kept = append(kept, key)
+		}
+	}
+	m.apiKeys = kept
+}
+
+// copyAPIKey keeps callers from changing a stored key through its slice and
+// pointers.
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Permissions = append([]models.Permission{}, key.Permissions...)
+	key.ExpiresAt = copyTime(key.ExpiresAt)
+	key.LastUsedAt = copyTime(key.LastUsedAt)
+	key.RevokedAt = copyTime(key.RevokedAt)
+	return key
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := t.UTC()
+	return &copied
+}
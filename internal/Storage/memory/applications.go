@@ -0,0 +1,246 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"maps"
+	"time"
+)
+
+// Application
+
+func (m *Memory) SubmitApplication(ctx context.Context, studentID int64, courseID int64, answers map[string]string) (models.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Application{}, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, studentExists := m.students[studentID]
+	_, courseExists := m.courses[courseID]
+	if !studentExists || !courseExists {
+		return models.Application{}, storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+	}
+	for _, a := range m.applications {
+		if a.StudentID == studentID && a.CourseID == courseID && a.Status.Open() {
+			return models.Application{}, storage.Errorf(storage.ErrConflict, "student %d already has an open application for course %d", studentID, courseID)
+		}
+	}
+
+	if answers == nil {
+		answers = map[string]string{}
+	}
+	now := time.Now().UTC()
+	m.lastApplicationID++
+	m.applications = append(m.applications, models.Application{
+		ID:          m.lastApplicationID,
+		StudentID:   studentID,
+		CourseID:    courseID,
+		Answers:     maps.Clone(answers),
+		Status:      models.ApplicationSubmitted,
+		SubmittedAt: &now,
+	})
+
+	return m.application(len(m.applications) - 1), nil
+}
+
+func (m *Memory) GetApplicationById(ctx context.Context, id int64) (models.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Application{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.applicationIndex(id)
+	if i < 0 {
+		return models.Application{}, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+	}
+
+	return m.applicationWithReviews(i), nil
+}
+
+func (m *Memory) GetApplicationsByStudentID(ctx context.Context, studentID int64) ([]models.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var applications []models.Application
+	for i, a := range m.applications {
+		if a.StudentID == studentID {
+			applications = append(applications, m.application(i))
+		}
+	}
+
+	return applications, nil
+}
+
+func (m *Memory) GetApplications(ctx context.Context, statuses ...models.ApplicationStatus) ([]models.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var applications []models.Application
+	for i, a := range m.applications {
+		if statusIn(a.Status, statuses) {
+			applications = append(applications, m.application(i))
+		}
+	}
+
+	return applications, nil
+}
+
+func (m *Memory) AssignReviewer(ctx context.Context, applicationID int64, reviewer string) (models.ApplicationReview, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ApplicationReview{}, storage.ContextError(err)
+	}
+
+	reviewer = storage.NormalizeEmail(reviewer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.openApplication(applicationID)
+	if err != nil {
+		return models.ApplicationReview{}, err
+	}
+	if m.reviewIndex(applicationID, reviewer) >= 0 {
+		return models.ApplicationReview{}, storage.Errorf(storage.ErrConflict, "reviewer %s is already assigned to application %d", reviewer, applicationID)
+	}
+
+	if m.applications[i].Status == models.ApplicationSubmitted {
+		m.applications[i].Status = models.ApplicationUnderReview
+	}
+
+	now := time.Now().UTC()
+	m.lastReviewID++
+	m.reviews = append(m.reviews, models.ApplicationReview{
+		ID:            m.lastReviewID,
+		ApplicationID: applicationID,
+		Reviewer:      reviewer,
+		AssignedAt:    &now,
+	})
+
+	return m.reviews[len(m.reviews)-1], nil
+}
+
+func (m *Memory) ReviewApplication(ctx context.Context, applicationID int64, reviewer string, score int, comment string) (models.ApplicationReview, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ApplicationReview{}, storage.ContextError(err)
+	}
+	if score < 0 || score > models.MaxReviewScore {
+		return models.ApplicationReview{}, storage.Errorf(storage.ErrInvalid, "review score must be between 0 and %d", models.MaxReviewScore)
+	}
+
+	reviewer = storage.NormalizeEmail(reviewer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.openApplication(applicationID); err != nil {
+		return models.ApplicationReview{}, err
+	}
+	j := m.reviewIndex(applicationID, reviewer)
+	if j < 0 {
+		return models.ApplicationReview{}, storage.Errorf(storage.ErrConstraint, "reviewer %s is not assigned to application %d", reviewer, applicationID)
+	}
+
+	now := time.Now().UTC()
+	review := &m.reviews[j]
+	review.Score = &score
+	review.Comment = comment
+	review.ReviewedAt = &now
+
+	return *review, nil
+}
+
+func (m *Memory) DecideApplication(ctx context.Context, id int64, decision models.ApplicationStatus, note string) (models.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Application{}, storage.ContextError(err)
+	}
+	if !decision.Decision() {
+		return models.Application{}, storage.Errorf(storage.ErrInvalid, "%q is not an application decision", decision)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.applicationIndex(id)
+	if i < 0 {
+		return models.Application{}, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+	}
+	a := &m.applications[i]
+	if !a.Status.CanTransitionTo(decision) {
+		return models.Application{}, storage.Errorf(storage.ErrConflict, "cannot change application %d from %s to %s", id, a.Status, decision)
+	}
+
+	now := time.Now().UTC()
+	a.Status = decision
+	a.DecisionNote = note
+	a.DecidedAt = &now
+
+	return m.applicationWithReviews(i), nil
+}
+
+// The helpers below expect the caller to hold m.mu.
+
+// applicationIndex returns the position of the application with id in
+// m.applications, or -1.
+func (m *Memory) applicationIndex(id int64) int {
+	for i, a := range m.applications {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// openApplication returns the index of an application that still awaits a
+// final decision.
+func (m *Memory) openApplication(id int64) (int, error) {
+	i := m.applicationIndex(id)
+	if i < 0 {
+		return -1, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+	}
+	if status := m.applications[i].Status; !status.Open() {
+		return -1, storage.Errorf(storage.ErrConflict, "application %d has already been %s", id, status)
+	}
+	return i, nil
+}
+
+// reviewIndex returns the position of reviewer's assignment to the
+// application in m.reviews, or -1.
+func (m *Memory) reviewIndex(applicationID int64, reviewer string) int {
+	for j, r := range m.reviews {
+		if r.ApplicationID == applicationID && r.Reviewer == reviewer {
+			return j
+		}
+	}
+	return -1
+}
+
+// application copies the application at index i so callers cannot modify
+// its answers in place.
+func (m *Memory) application(i int) models.Application {
+	a := m.applications[i]
+	a.Answers = maps.Clone(a.Answers)
+	return a
+}
+
+func (m *Memory) applicationWithReviews(i int) models.Application {
+	a := m.application(i)
+	for _, r := range m.reviews {
+		if r.ApplicationID == a.ID {
+			a.Reviews = append(a.Reviews, r)
+		}
+	}
+	return a
+}
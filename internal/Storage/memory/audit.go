@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Audit log
+
+func (m *Memory) CreateAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastAuditID++
+	entry.ID = m.lastAuditID
+	m.audit = append(m.audit, entry)
+	return entry.ID, nil
+}
+
+func (m *Memory) GetAuditEntries(ctx context.Context, limit int, events ...models.AuditEvent) ([]models.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if statusIn(m.audit[i].Event, events) {
+			entries = append(entries, m.audit[i])
+		}
+	}
+	return entries, nil
+}
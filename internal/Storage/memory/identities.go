@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// identityKey names an external identity.
+type identityKey struct {
+	issuer  string
+	subject string
+}
+
+// External identity
+
+func (m *Memory) LinkIdentity(ctx context.Context, identity models.ExternalIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+	if !identity.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", identity.UserType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var exists bool
+	switch identity.UserType {
+	case models.UserStudent:
+		_, exists = m.students[identity.UserID]
+	case models.UserAdmin:
+		_, exists = m.admins[identity.UserID]
+	}
+	if !exists {
+		return storage.Errorf(storage.ErrNotFound, "no %s found with id %d", identity.UserType, identity.UserID)
+	}
+	key := identityKey{identity.Issuer, identity.Subject}
+	if _, ok := m.identities[key]; ok {
+		return storage.Errorf(storage.ErrConflict, "identity %s of %s is already linked", identity.Subject, identity.Issuer)
+	}
+
+	identity.CreatedAt = identity.CreatedAt.UTC()
+	m.identities[key] = identity
+	return nil
+}
+
+func (m *Memory) GetIdentity(ctx context.Context, issuer string, subject string) (models.ExternalIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ExternalIdentity{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identity, ok := m.identities[identityKey{issuer, subject}]
+	if !ok {
+		return models.ExternalIdentity{}, storage.Errorf(storage.ErrNotFound, "identity %s of %s is not linked", subject, issuer)
+	}
+	return identity, nil
+}
+
+// deleteIdentities unlinks every identity of user. The caller holds m.mu.
+func (m *Memory) deleteIdentities(user userKey) {
+	for key, identity := range m.identities {
+		if identity.UserType == user.userType && identity.UserID == user.userID {
+			delete(m.identities, key)
+		}
+	}
+}
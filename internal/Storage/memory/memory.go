@@ -0,0 +1,703 @@
+// Package memory is a pure-Go storage.Storage kept entirely in process memory.
+// It needs neither CGO nor a database file, which makes it suitable for demos
+// and handler tests; everything is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	security "github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type waitlistEntry struct {
+	id        int64
+	studentID int64
+	courseID  int64
+	createdAt time.Time
+}
+
+type Memory struct {
+	mu sync.RWMutex
+
+	students    map[int64]models.Student
+	courses     map[int64]models.Course
+	enrollments []models.Enrollment // in creation order, finished ones included
+	waitlist    []waitlistEntry     // in arrival order
+
+	applications []models.Application       // in submission order, without their reviews
+	reviews      []models.ApplicationReview // in assignment order
+	admins       map[int64]models.Admin
+	roles        map[int64]models.Role
+	adminRoles   map[int64][]int64 // role IDs by admin, in assignment order
+	tokens       map[string]models.Token
+	refresh      []models.RefreshToken  // in issue order
+	resets       []models.PasswordReset // in creation order
+	throttles    map[string]models.LoginThrottle
+	audit        []models.AuditEntry // in creation order
+	totp         map[userKey]models.TOTP
+	recovery     []recoveryCode
+	apiKeys      []models.APIKey // in creation order
+	identities   map[identityKey]models.ExternalIdentity
+
+	lastStudentID     int64
+	lastCourseID      int64
+	lastEnrollmentID  int64
+	lastWaitlistID    int64
+	lastApplicationID int64
+	lastReviewID      int64
+	lastAdminID       int64
+	lastRoleID        int64
+	lastRefreshID     int64
+	lastResetID       int64
+	lastAuditID       int64
+	lastAPIKeyID      int64
+}
+
+var _ storage.Storage = (*Memory)(nil)
+
+func New() *Memory {
+	m := &Memory{
+		students:   map[int64]models.Student{},
+		courses:    map[int64]models.Course{},
+		admins:     map[int64]models.Admin{},
+		roles:      map[int64]models.Role{},
+		adminRoles: map[int64][]int64{},
+		tokens:     map[string]models.Token{},
+		throttles:  map[string]models.LoginThrottle{},
+		totp:       map[userKey]models.TOTP{},
+		identities: map[identityKey]models.ExternalIdentity{},
+	}
+	m.seedRoles()
+	return m
+}
+
+// Student
+
+func (m *Memory) CreateStudent(ctx context.Context, FullName string, Email string, Password string, Age int, Gender string, PhoneNumber string, DOB string, Address string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	Email = storage.NormalizeEmail(Email)
+	if m.emailTaken(Email, 0) {
+		return 0, storage.Errorf(storage.ErrConflict, "a student with email %s already exists", Email)
+	}
+
+	m.lastStudentID++
+	m.students[m.lastStudentID] = models.Student{
+		Id:          m.lastStudentID,
+		FullName:    FullName,
+		Email:       Email,
+		Password:    Password,
+		Age:         Age,
+		Gender:      Gender,
+		PhoneNumber: PhoneNumber,
+		DOB:         DOB,
+		Address:     Address,
+	}
+
+	return m.lastStudentID, nil
+}
+
+func (m *Memory) LoginStudent(ctx context.Context, email string, password string) (models.Student, error) {
+	student, err := m.GetStudentByEmail(ctx, email)
+	if err != nil {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	if !security.CheckPasswordHash(password, student.Password) {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	return student, nil
+}
+
+func (m *Memory) GetStudentByEmail(ctx context.Context, email string) (models.Student, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Student{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	email = storage.NormalizeEmail(email)
+	for _, student := range m.sortedStudents() {
+		if student.Email == email {
+			return student, nil
+		}
+	}
+
+	return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with email %s", email)
+}
+
+func (m *Memory) GetStudentById(ctx context.Context, id int64) (models.Student, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Student{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	student, ok := m.students[id]
+	if !ok {
+		return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)
+	}
+
+	return student, nil
+}
+
+func (m *Memory) GetAllStudents(ctx context.Context) ([]models.Student, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedStudents(), nil
+}
+
+func (m *Memory) UpdateStudent(ctx context.Context, id int64, student models.Student) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.students[id]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)
+	}
+
+	student.Email = storage.NormalizeEmail(student.Email)
+	if m.emailTaken(student.Email, id) {
+		return storage.Errorf(storage.ErrConflict, "a student with email %s already exists", student.Email)
+	}
+
+	// A changed email has to be verified again.
+	current := m.students[id]
+	student.Verified = current.Verified && current.Email == student.Email
+	student.Password = current.Password
+
+	student.Id = id
+	m.students[id] = student
+	return nil
+}
+
+func (m *Memory) VerifyStudentEmail(ctx context.Context, id int64, email string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	email = storage.NormalizeEmail(email)
+	student, ok := m.students[id]
+	if !ok || student.Email != email {
+		return storage.Errorf(storage.ErrNotFound, "no student found with id %d and email %s", id, email)
+	}
+	student.Verified = true
+	m.students[id] = student
+	return nil
+}
+
+// Courses
+
+func (m *Memory) CreateCourse(ctx context.Context, Name string, Description string, Duration string, Credits int, Price int, Capacity int) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+	if Capacity < 0 {
+		return 0, storage.Errorf(storage.ErrConstraint, "course capacity must not be negative")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastCourseID++
+	m.courses[m.lastCourseID] = models.Course{
+		ID:          m.lastCourseID,
+		Name:        Name,
+		Description: Description,
+		Duration:    Duration,
+		Credits:     Credits,
+		Price:       Price,
+		Capacity:    Capacity,
+	}
+
+	return m.lastCourseID, nil
+}
+
+func (m *Memory) GetCourseById(ctx context.Context, id int64) (models.Course, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Course{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	course, ok := m.courses[id]
+	if !ok {
+		return models.Course{}, storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)
+	}
+
+	return course, nil
+}
+
+func (m *Memory) GetAllCourses(ctx context.Context) ([]models.Course, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedCourses(), nil
+}
+
+// UpdateCourse also promotes waitlisted students into any seats a raised
+// capacity opens up.
+func (m *Memory) UpdateCourse(ctx context.Context, id int64, course models.Course) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+	if course.Capacity < 0 {
+		return storage.Errorf(storage.ErrConstraint, "course capacity must not be negative")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.courses[id]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)
+	}
+
+	course.ID = id
+	m.courses[id] = course
+	m.promoteWaitlisted(id)
+	return nil
+}
+
+func (m *Memory) SearchCoursesByName(ctx context.Context, name string) ([]models.Course, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var courses []models.Course
+	for _, course := range m.sortedCourses() {
+		if strings.Contains(strings.ToLower(course.Name), strings.ToLower(name)) {
+			courses = append(courses, course)
+		}
+	}
+
+	if len(courses) == 0 {
+		return nil, storage.Errorf(storage.ErrNotFound, "no courses found with name containing: %s", name)
+	}
+
+	return courses, nil
+}
+
+// Enrollment
+
+// EnrollStudent takes a free seat in the course, or queues the student on
+// the course's waitlist when every seat is taken.
+func (m *Memory) EnrollStudent(ctx context.Context, studentID int64, courseID int64) (models.Enrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Enrollment{}, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, studentExists := m.students[studentID]
+	course, courseExists := m.courses[courseID]
+	if !studentExists || !courseExists {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+	}
+	if m.activeEnrollment(studentID, courseID) >= 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already enrolled in course %d", studentID, courseID)
+	}
+	if m.waitlistPosition(studentID, courseID) > 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already on the waitlist for course %d", studentID, courseID)
+	}
+
+	if m.hasFreeSeat(course) {
+		return m.enroll(studentID, courseID), nil
+	}
+
+	m.lastWaitlistID++
+	m.waitlist = append(m.waitlist, waitlistEntry{
+		id:        m.lastWaitlistID,
+		studentID: studentID,
+		courseID:  courseID,
+		createdAt: time.Now().UTC(),
+	})
+
+	return models.Enrollment{
+		StudentID:  studentID,
+		CourseID:   courseID,
+		Waitlisted: true,
+		Position:   m.waitlistPosition(studentID, courseID),
+	}, nil
+}
+
+// UnenrollStudent gives up the student's seat, handing it to the head of the
+// waitlist, or takes the student off the waitlist if they were only queued.
+// A pending enrollment is withdrawn without a trace; an approved one is kept
+// as dropped.
+func (m *Memory) UnenrollStudent(ctx context.Context, studentID int64, courseID int64) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.activeEnrollment(studentID, courseID); i >= 0 {
+		if m.enrollments[i].Status == models.EnrollmentPending {
+			m.enrollments = append(m.enrollments[:i], m.enrollments[i+1:]...)
+		} else {
+			setStatus(&m.enrollments[i], models.EnrollmentDropped)
+		}
+		m.promoteWaitlisted(courseID)
+		return nil
+	}
+
+	for i, w := range m.waitlist {
+		if w.studentID == studentID && w.courseID == courseID {
+			m.waitlist = append(m.waitlist[:i], m.waitlist[i+1:]...)
+			return nil
+		}
+	}
+
+	return storage.Errorf(storage.ErrNotFound, "no enrollment found for student %d in course %d", studentID, courseID)
+}
+
+func (m *Memory) GetEnrollmentById(ctx context.Context, id int64) (models.Enrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Enrollment{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, e := range m.enrollments {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return models.Enrollment{}, storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+}
+
+func (m *Memory) GetEnrollmentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Enrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var enrollments []models.Enrollment
+	for _, e := range m.enrollments {
+		if e.CourseID == courseID && statusIn(e.Status, statuses) {
+			enrollments = append(enrollments, e)
+		}
+	}
+
+	return enrollments, nil
+}
+
+// UpdateEnrollmentStatus moves an enrollment along the state machine of
+// models.EnrollmentStatus. Leaving an active status frees the seat for the
+// head of the waitlist.
+func (m *Memory) UpdateEnrollmentStatus(ctx context.Context, id int64, status models.EnrollmentStatus) (models.Enrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Enrollment{}, storage.ContextError(err)
+	}
+	if !status.Valid() {
+		return models.Enrollment{}, storage.Errorf(storage.ErrInvalid, "unknown enrollment status %q", status)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.enrollments {
+		e := &m.enrollments[i]
+		if e.ID != id {
+			continue
+		}
+		if !e.Status.CanTransitionTo(status) {
+			return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "cannot change enrollment %d from %s to %s", id, e.Status, status)
+		}
+
+		wasActive := e.Status.Active()
+		setStatus(e, status)
+		updated := *e
+		if wasActive && !status.Active() {
+			m.promoteWaitlisted(updated.CourseID)
+		}
+		return updated, nil
+	}
+
+	return models.Enrollment{}, storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+}
+
+// GetStudentsByCourseID lists the students with an enrollment in one of
+// statuses in the course, or with any enrollment when statuses is empty.
+func (m *Memory) GetStudentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Student, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[int64]bool{}
+	var students []models.Student
+	for _, e := range m.enrollments {
+		student, ok := m.students[e.StudentID]
+		if e.CourseID == courseID && statusIn(e.Status, statuses) && ok && !seen[student.Id] {
+			seen[student.Id] = true
+			students = append(students, student)
+		}
+	}
+	sort.SliceStable(students, func(i, j int) bool { return students[i].Id < students[j].Id })
+
+	return students, nil
+}
+
+// GetCoursesByStudentID lists the courses the student has an enrollment in
+// one of statuses for, or any enrollment when statuses is empty.
+func (m *Memory) GetCoursesByStudentID(ctx context.Context, studentID int64, statuses ...models.EnrollmentStatus) ([]models.Course, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[int64]bool{}
+	var courses []models.Course
+	for _, e := range m.enrollments {
+		course, ok := m.courses[e.CourseID]
+		if e.StudentID == studentID && statusIn(e.Status, statuses) && ok && !seen[course.ID] {
+			seen[course.ID] = true
+			courses = append(courses, course)
+		}
+	}
+	sort.SliceStable(courses, func(i, j int) bool { return courses[i].ID < courses[j].ID })
+
+	return courses, nil
+}
+
+// Waitlist
+
+func (m *Memory) GetWaitlistByStudentID(ctx context.Context, studentID int64) ([]models.WaitlistEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.WaitlistEntry
+	for _, w := range m.waitlist {
+		if w.studentID == studentID {
+			entries = append(entries, m.waitlistEntry(w))
+		}
+	}
+
+	return entries, nil
+}
+
+func (m *Memory) GetWaitlistByCourseID(ctx context.Context, courseID int64) ([]models.WaitlistEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.WaitlistEntry
+	for _, w := range m.waitlist {
+		if w.courseID == courseID {
+			entries = append(entries, m.waitlistEntry(w))
+		}
+	}
+
+	return entries, nil
+}
+
+func (m *Memory) GetWaitlistPosition(ctx context.Context, studentID int64, courseID int64) (models.WaitlistEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return models.WaitlistEntry{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, w := range m.waitlist {
+		if w.studentID == studentID && w.courseID == courseID {
+			return m.waitlistEntry(w), nil
+		}
+	}
+
+	return models.WaitlistEntry{}, storage.Errorf(storage.ErrNotFound, "student %d is not on the waitlist for course %d", studentID, courseID)
+}
+
+// enroll seats the student in the course with a pending enrollment.
+// Callers must hold m.mu.
+func (m *Memory) enroll(studentID int64, courseID int64) models.Enrollment {
+	now := time.Now().UTC()
+	m.lastEnrollmentID++
+	m.enrollments = append(m.enrollments, models.Enrollment{
+		ID:         m.lastEnrollmentID,
+		StudentID:  studentID,
+		CourseID:   courseID,
+		Status:     models.EnrollmentPending,
+		EnrolledAt: &now,
+	})
+	return m.enrollments[len(m.enrollments)-1]
+}
+
+// activeEnrollment returns the index of the student's enrollment holding a
+// seat in the course, or -1. Callers must hold m.mu.
+func (m *Memory) activeEnrollment(studentID int64, courseID int64) int {
+	for i, e := range m.enrollments {
+		if e.StudentID == studentID && e.CourseID == courseID && e.Status.Active() {
+			return i
+		}
+	}
+	return -1
+}
+
+// setStatus moves e to status and records when it did.
+func setStatus(e *models.Enrollment, status models.EnrollmentStatus) {
+	now := time.Now().UTC()
+	e.Status = status
+	switch status {
+	case models.EnrollmentApproved:
+		e.ApprovedAt = &now
+	case models.EnrollmentRejected:
+		e.RejectedAt = &now
+	case models.EnrollmentDropped:
+		e.DroppedAt = &now
+	case models.EnrollmentCompleted:
+		e.CompletedAt = &now
+	}
+}
+
+// statusIn reports whether status is one of statuses; no statuses means any.
+func statusIn[S comparable](status S, statuses []S) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFreeSeat reports whether course can take one more student.
+// Callers must hold m.mu.
+func (m *Memory) hasFreeSeat(course models.Course) bool {
+	if course.Capacity == 0 {
+		return true
+	}
+
+	enrolled := 0
+	for _, e := range m.enrollments {
+		if e.CourseID == course.ID && e.Status.Active() {
+			enrolled++
+		}
+	}
+	return enrolled < course.Capacity
+}
+
+// promoteWaitlisted moves students from the head of the course's waitlist
+// into its free seats. Callers must hold m.mu.
+func (m *Memory) promoteWaitlisted(courseID int64) {
+	course := m.courses[courseID]
+	for i := 0; i < len(m.waitlist) && m.hasFreeSeat(course); {
+		w := m.waitlist[i]
+		if w.courseID != courseID {
+			i++
+			continue
+		}
+		m.waitlist = append(m.waitlist[:i], m.waitlist[i+1:]...)
+		m.enroll(w.studentID, courseID)
+	}
+}
+
+// waitlistPosition returns the student's 1-based place in the course's
+// waitlist, or 0 if they are not on it. Callers must hold m.mu.
+func (m *Memory) waitlistPosition(studentID int64, courseID int64) int {
+	position := 0
+	for _, w := range m.waitlist {
+		if w.courseID != courseID {
+			continue
+		}
+		position++
+		if w.studentID == studentID {
+			return position
+		}
+	}
+	return 0
+}
+
+// waitlistEntry converts w for callers. Callers must hold m.mu.
+func (m *Memory) waitlistEntry(w waitlistEntry) models.WaitlistEntry {
+	return models.WaitlistEntry{
+		ID:        w.id,
+		StudentID: w.studentID,
+		CourseID:  w.courseID,
+		Position:  m.waitlistPosition(w.studentID, w.courseID),
+		CreatedAt: w.createdAt,
+	}
+}
+
+// emailTaken reports whether a student other than except already uses email.
+// Callers must hold m.mu.
+func (m *Memory) emailTaken(email string, except int64) bool {
+	for id, student := range m.students {
+		if id != except && student.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedStudents returns all students ordered by id, like the SQL backends.
+// Callers must hold m.mu.
+func (m *Memory) sortedStudents() []models.Student {
+	var students []models.Student
+	for _, student := range m.students {
+		students = append(students, student)
+	}
+	sort.Slice(students, func(i, j int) bool { return students[i].Id < students[j].Id })
+	return students
+}
+
+// sortedCourses returns all courses ordered by id. Callers must hold m.mu.
+func (m *Memory) sortedCourses() []models.Course {
+	var courses []models.Course
+	for _, course := range m.courses {
+		courses = append(courses, course)
+	}
+	sort.Slice(courses, func(i, j int) bool { return courses[i].ID < courses[j].ID })
+	return courses
+}
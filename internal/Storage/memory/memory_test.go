@@ -0,0 +1,14 @@
+package memory_test
+
+import (
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/storagetest"
+	"testing"
+)
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return memory.New()
+	})
+}
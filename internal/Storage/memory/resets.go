@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Password reset
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.students[reset.StudentID]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)
+	}
+	for _, existing := range m.resets {
+		if existing.Hash == reset.Hash {
+			return storage.Errorf(storage.ErrConflict, "password reset token already exists")
+		}
+	}
+
+	m.lastResetID++
+	reset.ID = m.lastResetID
+	reset.CreatedAt = reset.CreatedAt.UTC()
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+	reset.UsedAt = nil
+	m.resets = append(m.resets, reset)
+	return nil
+}
+
+func (m *Memory) ResetPassword(ctx context.Context, hash string, passwordHash string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := -1
+	for j, reset := range m.resets {
+		if reset.Hash == hash {
+			i = j
+		}
+	}
+	if i < 0 {
+		return 0, storage.Errorf(storage.ErrNotFound, "unknown password reset token")
+	}
+	reset := m.resets[i]
+
+	now := time.Now().UTC()
+	if reset.UsedAt != nil {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token was already used")
+	}
+	if !reset.ExpiresAt.After(now) {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token has expired")
+	}
+
+	student, ok := m.students[reset.StudentID]
+	if !ok {
+		return 0, storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)
+	}
+	student.Password = passwordHash
+	m.students[reset.StudentID] = student
+
+	for j := range m.resets {
+		if m.resets[j].StudentID == reset.StudentID && m.resets[j].UsedAt == nil {
+			m.resets[j].UsedAt = &now
+		}
+	}
+	// Whoever knew the old password may still hold a session.
+	m.revokeTokens(func(family string, t models.UserType, id int64) bool {
+		return t == models.UserStudent && id == reset.StudentID
+	})
+	return reset.StudentID, nil
+}
+
+func (m *Memory) ChangeStudentPassword(ctx context.Context, id int64, passwordHash string, keepFamily string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	student, ok := m.students[id]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)
+	}
+	student.Password = passwordHash
+	m.students[id] = student
+
+	now := time.Now().UTC()
+	for j := range m.resets {
+		if m.resets[j].StudentID == id && m.resets[j].UsedAt == nil {
+			m.resets[j].UsedAt = &now
+		}
+	}
+	m.revokeTokens(func(family string, t models.UserType, userID int64) bool {
+		return t == models.UserStudent && userID == id && (family == "" || family != keepFamily)
+	})
+	return nil
+}
@@ -0,0 +1,354 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"sort"
+)
+
+// Role
+
+func (m *Memory) CreateRole(ctx context.Context, name string, description string, permissions []models.Permission) (models.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Role{}, storage.ContextError(err)
+	}
+
+	permissions, err := checkPermissions(permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roleByName(name); ok {
+		return models.Role{}, storage.Errorf(storage.ErrConflict, "a role named %s already exists", name)
+	}
+	return m.createRole(name, description, false, permissions), nil
+}
+
+func (m *Memory) GetRoleByName(ctx context.Context, name string) (models.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Role{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	role, ok := m.roleByName(name)
+	if !ok {
+		return models.Role{}, storage.Errorf(storage.ErrNotFound, "no role named %s", name)
+	}
+	return copyRole(role), nil
+}
+
+func (m *Memory) GetAllRoles(ctx context.Context) ([]models.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var roles []models.Role
+	for _, role := range m.roles {
+		roles = append(roles, copyRole(role))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (m *Memory) SetRolePermissions(ctx context.Context, name string, permissions []models.Permission) (models.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Role{}, storage.ContextError(err)
+	}
+
+	permissions, err := checkPermissions(permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, err := m.changeableRole(name)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	changed := role
+	changed.Permissions = permissions
+	err = m.keepRoleManager(
+		func() { m.roles[role.ID] = changed },
+		func() { m.roles[role.ID] = role },
+	)
+	if err != nil {
+		return models.Role{}, err
+	}
+	return copyRole(changed), nil
+}
+
+func (m *Memory) DeleteRole(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role, err := m.changeableRole(name)
+	if err != nil {
+		return err
+	}
+
+	adminRoles := map[int64][]int64{}
+	for admin, roles := range m.adminRoles {
+		adminRoles[admin] = roles
+	}
+	return m.keepRoleManager(
+		func() {
+			delete(m.roles, role.ID)
+			for admin := range m.adminRoles {
+				m.removeAdminRole(admin, role.ID)
+			}
+		},
+		func() {
+			m.roles[role.ID] = role
+			m.adminRoles = adminRoles
+		},
+	)
+}
+
+func (m *Memory) GetAdminRoles(ctx context.Context, adminID int64) ([]models.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.admins[adminID]; !ok {
+		return nil, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", adminID)
+	}
+
+	var roles []models.Role
+	for _, id := range m.adminRoles[adminID] {
+		roles = append(roles, copyRole(m.roles[id]))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (m *Memory) AssignRole(ctx context.Context, adminID int64, role string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assigned, ok := m.roleByName(role)
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no role named %s", role)
+	}
+	if _, ok := m.admins[adminID]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "no admin found with id %d", adminID)
+	}
+	for _, id := range m.adminRoles[adminID] {
+		if id == assigned.ID {
+			return storage.Errorf(storage.ErrConflict, "admin %d already has role %s", adminID, role)
+		}
+	}
+
+	m.adminRoles[adminID] = append(m.adminRoles[adminID], assigned.ID)
+	return nil
+}
+
+func (m *Memory) UnassignRole(ctx context.Context, adminID int64, role string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unassigned, ok := m.roleByName(role)
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no role named %s", role)
+	}
+
+	roles := m.adminRoles[adminID]
+	held := false
+	for _, id := range roles {
+		held = held || id == unassigned.ID
+	}
+	if !held {
+		return storage.Errorf(storage.ErrNotFound, "admin %d does not have role %s", adminID, role)
+	}
+
+	return m.keepRoleManager(
+		func() { m.removeAdminRole(adminID, unassigned.ID) },
+		func() { m.adminRoles[adminID] = roles },
+	)
+}
+
+func (m *Memory) GetAdminPermissions(ctx context.Context, adminID int64) ([]models.Permission, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.adminPermissions(adminID), nil
+}
+
+// checkPermissions rejects unknown permissions and returns the rest sorted
+// and without duplicates.
+func checkPermissions(permissions []models.Permission) ([]models.Permission, error) {
+	seen := map[models.Permission]bool{}
+	unique := []models.Permission{}
+	for _, permission := range permissions {
+		if !permission.Valid() {
+			return nil, storage.Errorf(storage.ErrInvalid, "unknown permission %q", permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			unique = append(unique, permission)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+	return unique, nil
+}
+
+// copyRole keeps callers from changing a stored role's permissions.
+func copyRole(role models.Role) models.Role {
+	role.Permissions = append([]models.Permission{}, role.Permissions...)
+	return role
+}
+
+// The helpers below expect the caller to hold m.mu.
+
+// seedRoles creates the roles that migration 0009 seeds in the SQL backends.
+func (m *Memory) seedRoles() {
+	m.createRole(models.RoleSuperadmin, "Every administrative permission", true, []models.Permission{
+		models.PermissionStudentsRead,
+		models.PermissionStudentsPII,
+		models.PermissionCoursesWrite,
+		models.PermissionEnrollmentsRead,
+		models.PermissionEnrollmentsManage,
+		models.PermissionApplicationsRead,
+		models.PermissionApplicationsReview,
+		models.PermissionApplicationsManage,
+		models.PermissionAdminsRead,
+		models.PermissionAdminsManage,
+		models.PermissionRolesRead,
+		models.PermissionRolesManage,
+		models.PermissionAuditRead,
+		models.PermissionLoginsManage,
+		models.PermissionAPIKeysManage,
+	})
+	m.createRole(models.RoleStudent, "Self-service permissions held by every student", true, []models.Permission{
+		models.PermissionProfileUpdate,
+		models.PermissionEnrollmentsSelf,
+		models.PermissionApplicationsSelf,
+	})
+	m.createRole("registrar", "Reviews applications and approves enrollments", false, []models.Permission{
+		models.PermissionStudentsRead,
+		models.PermissionStudentsPII,
+		models.PermissionEnrollmentsRead,
+		models.PermissionEnrollmentsManage,
+		models.PermissionApplicationsRead,
+		models.PermissionApplicationsReview,
+		models.PermissionApplicationsManage,
+	})
+	m.createRole("auditor", "Read-only access to students, enrollments, applications and admins", false, []models.Permission{
+		models.PermissionStudentsRead,
+		models.PermissionEnrollmentsRead,
+		models.PermissionApplicationsRead,
+		models.PermissionAdminsRead,
+		models.PermissionRolesRead,
+		models.PermissionAuditRead,
+	})
+}
+
+func (m *Memory) createRole(name string, description string, builtIn bool, permissions []models.Permission) models.Role {
+	permissions = append([]models.Permission{}, permissions...)
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+
+	m.lastRoleID++
+	role := models.Role{
+		ID:          m.lastRoleID,
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		BuiltIn:     builtIn,
+	}
+	m.roles[role.ID] = role
+	return copyRole(role)
+}
+
+func (m *Memory) roleByName(name string) (models.Role, bool) {
+	for _, role := range m.roles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return models.Role{}, false
+}
+
+// changeableRole finds a role and fails if it is built in.
+func (m *Memory) changeableRole(name string) (models.Role, error) {
+	role, ok := m.roleByName(name)
+	if !ok {
+		return models.Role{}, storage.Errorf(storage.ErrNotFound, "no role named %s", name)
+	}
+	if role.BuiltIn {
+		return models.Role{}, storage.Errorf(storage.ErrConflict, "role %s is built in and cannot be changed", name)
+	}
+	return role, nil
+}
+
+func (m *Memory) removeAdminRole(adminID int64, roleID int64) {
+	var kept []int64
+	for _, id := range m.adminRoles[adminID] {
+		if id != roleID {
+			kept = append(kept, id)
+		}
+	}
+	m.adminRoles[adminID] = kept
+}
+
+func (m *Memory) adminPermissions(adminID int64) []models.Permission {
+	var granted []models.Permission
+	for _, id := range m.adminRoles[adminID] {
+		granted = append(granted, m.roles[id].Permissions...)
+	}
+	// Every granted permission is known, so this only sorts and dedupes.
+	permissions, _ := checkPermissions(granted)
+	return permissions
+}
+
+// roleManagers counts the enabled admins who can manage roles.
+func (m *Memory) roleManagers() int {
+	managers := 0
+	for id, admin := range m.admins {
+		if !admin.Disabled && models.HasPermission(m.adminPermissions(id), models.PermissionRolesManage) {
+			managers++
+		}
+	}
+	return managers
+}
+
+// keepRoleManager applies change, and undoes it with ErrConflict if it took
+// the number of enabled admins who can manage roles from some down to zero.
+func (m *Memory) keepRoleManager(change func(), undo func()) error {
+	before := m.roleManagers()
+	change()
+	if before > 0 && m.roleManagers() == 0 {
+		undo()
+		return storage.Errorf(storage.ErrConflict, "no enabled admin would be left who can manage roles")
+	}
+	return nil
+}
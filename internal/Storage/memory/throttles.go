@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"sort"
+	"time"
+)
+
+// Login throttle
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return models.LoginThrottle{}, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, ok := m.throttles[key]
+	if !ok || !throttle.ExpiresAt.After(at) {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	throttle.ExpiresAt = at.Add(window)
+	m.throttles[key] = throttle
+	return copyThrottle(throttle), nil
+}
+
+func (m *Memory) LockLogin(ctx context.Context, key string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, ok := m.throttles[key]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key)
+	}
+	throttle.LockedUntil = &until
+	if until.After(throttle.ExpiresAt) {
+		throttle.ExpiresAt = until
+	}
+	m.throttles[key] = throttle
+	return nil
+}
+
+func (m *Memory) GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return models.LoginThrottle{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	throttle, ok := m.throttles[key]
+	if !ok {
+		return models.LoginThrottle{}, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key)
+	}
+	return copyThrottle(throttle), nil
+}
+
+func (m *Memory) GetLockedLogins(ctx context.Context, at time.Time) ([]models.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var throttles []models.LoginThrottle
+	for _, throttle := range m.throttles {
+		if throttle.Locked(at) {
+			throttles = append(throttles, copyThrottle(throttle))
+		}
+	}
+	sort.Slice(throttles, func(i, j int) bool { return throttles[i].Key < throttles[j].Key })
+	return throttles, nil
+}
+
+func (m *Memory) ClearLoginFailures(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.throttles[key]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key)
+	}
+	delete(m.throttles, key)
+	return nil
+}
+
+// copyThrottle keeps callers from changing a stored lock through its pointer.
+func copyThrottle(throttle models.LoginThrottle) models.LoginThrottle {
+	if throttle.LockedUntil != nil {
+		until := *throttle.LockedUntil
+		throttle.LockedUntil = &until
+	}
+	return throttle
+}
+
+func (m *Memory) DeleteExpiredLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, throttle := range m.throttles {
+		if throttle.ExpiresAt.Before(before) {
+			delete(m.throttles, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,253 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Token
+
+func (m *Memory) CreateToken(ctx context.Context, token models.Token) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[token.JTI]; ok {
+		return storage.Errorf(storage.ErrConflict, "a token with id %s already exists", token.JTI)
+	}
+	token.IssuedAt = token.IssuedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.RevokedAt = nil
+	m.tokens[token.JTI] = token
+	return nil
+}
+
+func (m *Memory) GetToken(ctx context.Context, jti string) (models.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Token{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.tokens[jti]
+	if !ok {
+		return models.Token{}, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti)
+	}
+	return token, nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, jti string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[jti]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "no token with id %s", jti)
+	}
+	if !token.Revoked() {
+		now := time.Now().UTC()
+		token.RevokedAt = &now
+		m.tokens[jti] = token
+	}
+	return nil
+}
+
+func (m *Memory) UseToken(ctx context.Context, jti string) (models.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Token{}, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[jti]
+	if !ok {
+		return models.Token{}, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti)
+	}
+	if token.Revoked() {
+		return models.Token{}, storage.Errorf(storage.ErrConflict, "token %s was already used or revoked", jti)
+	}
+	now := time.Now().UTC()
+	if !token.ExpiresAt.After(now) {
+		return models.Token{}, storage.Errorf(storage.ErrInvalid, "token %s has expired", jti)
+	}
+	token.RevokedAt = &now
+	m.tokens[jti] = token
+	return token, nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userType models.UserType, userID int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.revokeTokens(func(family string, t models.UserType, id int64) bool {
+		return t == userType && id == userID
+	}), nil
+}
+
+func (m *Memory) RevokeTokenFamily(ctx context.Context, family string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+	if family == "" {
+		return 0, storage.Errorf(storage.ErrInvalid, "token family must not be empty")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.revokeTokens(func(f string, t models.UserType, id int64) bool {
+		return f == family
+	}), nil
+}
+
+func (m *Memory) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for jti, token := range m.tokens {
+		if token.ExpiresAt.Before(before) {
+			delete(m.tokens, jti)
+			deleted++
+		}
+	}
+
+	var kept []models.RefreshToken
+	for _, token := range m.refresh {
+		if token.ExpiresAt.Before(before) {
+			deleted++
+		} else {
+			kept = append(kept, token)
+		}
+	}
+	m.refresh = kept
+
+	var resets []models.PasswordReset
+	for _, reset := range m.resets {
+		if reset.ExpiresAt.Before(before) {
+			deleted++
+		} else {
+			resets = append(resets, reset)
+		}
+	}
+	m.resets = resets
+	return deleted, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.createRefreshToken(token)
+	return err
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return models.RefreshToken{}, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := -1
+	for j, token := range m.refresh {
+		if token.Hash == hash {
+			i = j
+		}
+	}
+	if i < 0 {
+		return models.RefreshToken{}, storage.Errorf(storage.ErrNotFound, "unknown refresh token")
+	}
+	current := m.refresh[i]
+
+	now := time.Now().UTC()
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		m.revokeTokens(func(family string, t models.UserType, id int64) bool {
+			return family == current.Family
+		})
+		return models.RefreshToken{}, storage.Errorf(storage.ErrConflict, "refresh token was already used; every token of its login has been revoked")
+	}
+	if !current.ExpiresAt.After(now) {
+		return models.RefreshToken{}, storage.Errorf(storage.ErrInvalid, "refresh token has expired")
+	}
+
+	next.Family = current.Family
+	next.UserType = current.UserType
+	next.UserID = current.UserID
+	next, err := m.createRefreshToken(next)
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	m.refresh[i].UsedAt = &now
+	return next, nil
+}
+
+// The helpers below expect the caller to hold m.mu.
+
+func (m *Memory) createRefreshToken(token models.RefreshToken) (models.RefreshToken, error) {
+	for _, existing := range m.refresh {
+		if existing.Hash == token.Hash {
+			return models.RefreshToken{}, storage.Errorf(storage.ErrConflict, "refresh token already exists")
+		}
+	}
+
+	m.lastRefreshID++
+	token.ID = m.lastRefreshID
+	token.IssuedAt = token.IssuedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.UsedAt = nil
+	token.RevokedAt = nil
+	m.refresh = append(m.refresh, token)
+	return token, nil
+}
+
+// revokeTokens revokes the unexpired access and refresh tokens that match
+// and reports how many.
+func (m *Memory) revokeTokens(match func(family string, userType models.UserType, userID int64) bool) int64 {
+	now := time.Now().UTC()
+	var revoked int64
+	for jti, token := range m.tokens {
+		if match(token.Family, token.UserType, token.UserID) && !token.Revoked() && token.ExpiresAt.After(now) {
+			token.RevokedAt = &now
+			m.tokens[jti] = token
+			revoked++
+		}
+	}
+	for i, token := range m.refresh {
+		if match(token.Family, token.UserType, token.UserID) && token.RevokedAt == nil && token.ExpiresAt.After(now) {
+			m.refresh[i].RevokedAt = &now
+			revoked++
+		}
+	}
+	return revoked
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// userKey names a student or an admin.
+type userKey struct {
+	userType models.UserType
+	userID   int64
+}
+
+type recoveryCode struct {
+	user userKey
+	hash string
+	used bool
+}
+
+// TOTP
+
+func (m *Memory) CreateTOTP(ctx context.Context, totp models.TOTP) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+	if !totp.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", totp.UserType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := userKey{totp.UserType, totp.UserID}
+	if existing, ok := m.totp[key]; ok && existing.Confirmed() {
+		return storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up")
+	}
+	totp.ConfirmedAt = nil
+	totp.LastUsedStep = 0
+	m.totp[key] = totp
+	return nil
+}
+
+func (m *Memory) GetTOTP(ctx context.Context, userType models.UserType, userID int64) (models.TOTP, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TOTP{}, storage.ContextError(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totp, ok := m.totp[userKey{userType, userID}]
+	if !ok {
+		return models.TOTP{}, storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+	}
+	if totp.ConfirmedAt != nil {
+		confirmedAt := *totp.ConfirmedAt
+		totp.ConfirmedAt = &confirmedAt
+	}
+	return totp, nil
+}
+
+func (m *Memory) ConfirmTOTP(ctx context.Context, userType models.UserType, userID int64, step int64, recoveryHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := userKey{userType, userID}
+	totp, ok := m.totp[key]
+	if !ok {
+		return storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+	}
+	if totp.Confirmed() {
+		return storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up")
+	}
+	now := time.Now()
+	totp.ConfirmedAt = &now
+	totp.LastUsedStep = step
+	m.totp[key] = totp
+
+	m.deleteRecoveryCodes(key)
+	for _, hash := range recoveryHashes {
+		m.recovery = append(m.recovery, recoveryCode{user: key, hash: hash})
+	}
+	return nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, userType models.UserType, userID int64, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := userKey{userType, userID}
+	totp, ok := m.totp[key]
+	if !ok || totp.LastUsedStep >= step {
+		return storage.Errorf(storage.ErrConflict, "authentication code was already used")
+	}
+	totp.LastUsedStep = step
+	m.totp[key] = totp
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, userType models.UserType, userID int64, hash string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := userKey{userType, userID}
+	found := false
+	remaining := 0
+	for i, code := range m.recovery {
+		switch {
+		case code.user != key || code.used:
+		case code.hash == hash && !found:
+			m.recovery[i].used = true
+			found = true
+		default:
+			remaining++
+		}
+	}
+	if !found {
+		return 0, storage.Errorf(storage.ErrNotFound, "unknown recovery code")
+	}
+	return remaining, nil
+}
+
+func (m *Memory) DeleteTOTP(ctx context.Context, userType models.UserType, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return storage.ContextError(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := userKey{userType, userID}
+	if _, ok := m.totp[key]; !ok {
+		return storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+	}
+	delete(m.totp, key)
+	m.deleteRecoveryCodes(key)
+	return nil
+}
+
+func (m *Memory) deleteRecoveryCodes(key userKey) {
+	var kept []recoveryCode
+	for _, code := range m.recovery {
+		if code.user != key {
+			kept = append(kept, code)
+		}
+	}
+	m.recovery = kept
+}
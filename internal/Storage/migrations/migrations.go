@@ -0,0 +1,381 @@
+// Package migrations applies the versioned SQL schema migrations embedded in
+// this package. Every migration is a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, and the migrations
+// applied to a database are recorded in its schema_migrations table together
+// with a checksum, so a migration that is edited after it was applied is
+// detected instead of silently diverging.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+// Dialect selects the directory of migrations written for one database engine.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied with a checksum that no longer matches the file
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func New(db *sql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := Load(files, string(dialect))
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found for dialect %q", dialect)
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Load reads the migrations stored in dir of fsys, ordered by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migration.Checksum = checksum(migration.Up, migration.Down)
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func checksum(up string, down string) string {
+	sum := sha256.Sum256([]byte(up + "\x00" + down))
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrations returns every known migration, ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// Latest returns the highest known migration version.
+func (m *Migrator) Latest() int64 {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied migration version, or 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	done, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	for v := range done {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := done[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+			status.Modified = record.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration. It returns nil when
+// nothing has been applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, nil
+	}
+
+	target := int64(0)
+	for _, migration := range m.migrations {
+		if migration.Version < version {
+			target = migration.Version
+		}
+	}
+
+	changed, err := m.To(ctx, target)
+	if err != nil || len(changed) == 0 {
+		return nil, err
+	}
+	return &changed[0], nil
+}
+
+// To migrates the database up or down until exactly the migrations with a
+// version at or below target are applied. Version 0 rolls everything back.
+// It returns the migrations it applied or rolled back, in execution order.
+func (m *Migrator) To(ctx context.Context, target int64) ([]Migration, error) {
+	if target != 0 && m.find(target) == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(done); err != nil {
+		return nil, err
+	}
+
+	var changed []Migration
+
+	// Roll back newest first, then apply oldest first.
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := done[migration.Version]; !ok || migration.Version <= target {
+			continue
+		}
+		if err := m.run(ctx, migration, false); err != nil {
+			return changed, err
+		}
+		changed = append(changed, migration)
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := done[migration.Version]; ok || migration.Version > target {
+			continue
+		}
+		if err := m.run(ctx, migration, true); err != nil {
+			return changed, err
+		}
+		changed = append(changed, migration)
+	}
+
+	return changed, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// verify refuses to touch a database whose applied migrations were edited
+// afterwards or are unknown to this binary.
+func (m *Migrator) verify(done map[int64]applied) error {
+	for version, record := range done {
+		migration := m.find(version)
+		if migration == nil {
+			return fmt.Errorf("%w: %d_%s is applied but not known to this build", ErrUnknownVersion, version, record.name)
+		}
+		if migration.Checksum != record.checksum {
+			return fmt.Errorf("%w: %d_%s was modified after it was applied", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]applied, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := map[int64]applied{}
+	for rows.Next() {
+		var version int64
+		var record applied
+		if err := rows.Scan(&version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// run executes one migration and its bookkeeping in a single transaction.
+func (m *Migrator) run(ctx context.Context, migration Migration, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	direction, script := "up", migration.Up
+	if !up {
+		direction, script = "down", migration.Down
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.bind("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+			migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, m.bind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// bind rewrites ? placeholders into the dialect's placeholder syntax.
+func (m *Migrator) bind(query string) string {
+	if m.dialect != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testFiles are two migrations, as they would sit in a dialect's directory.
+var testFiles = fstest.MapFS{
+	"test/0001_create_people.up.sql":   {Data: []byte("CREATE TABLE people (id INTEGER PRIMARY KEY)")},
+	"test/0001_create_people.down.sql": {Data: []byte("DROP TABLE people")},
+	"test/0002_create_pets.up.sql":     {Data: []byte("CREATE TABLE pets (id INTEGER PRIMARY KEY)")},
+	"test/0002_create_pets.down.sql":   {Data: []byte("DROP TABLE pets")},
+}
+
+// openDB returns an empty in-memory SQLite database. It keeps to one
+// connection, as each connection to :memory: is a database of its own.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newMigrator returns a migrator of the migrations in fsys over db.
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	migrations, err := Load(fsys, "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return &Migrator{db: db, dialect: SQLite, migrations: migrations}
+}
+
+func versions(migrations []Migration) []int64 {
+	list := []int64{}
+	for _, migration := range migrations {
+		list = append(list, migration.Version)
+	}
+	return list
+}
+
+func hasTable(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatalf("look up table %s: %v", name, err)
+	}
+	return count == 1
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFiles, "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := versions(migrations); !slices.Equal(got, []int64{1, 2}) {
+		t.Fatalf("Load versions = %v, want [1 2]", got)
+	}
+	if m := migrations[0]; m.Name != "create_people" || m.Up != "CREATE TABLE people (id INTEGER PRIMARY KEY)" || m.Down != "DROP TABLE people" || m.Checksum == "" {
+		t.Errorf("Load migration 1 = %+v", m)
+	}
+
+	for _, test := range []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"bad file name", fstest.MapFS{"test/1-people.up.sql": {}}},
+		{"version zero", fstest.MapFS{"test/0000_people.up.sql": {}, "test/0000_people.down.sql": {}}},
+		{"missing down", fstest.MapFS{"test/0001_people.up.sql": {Data: []byte("SELECT 1")}}},
+		{"conflicting names", fstest.MapFS{"test/0001_people.up.sql": {Data: []byte("SELECT 1")}, "test/0001_persons.down.sql": {Data: []byte("SELECT 1")}}},
+		{"missing directory", fstest.MapFS{}},
+	} {
+		if _, err := Load(test.files, "test"); err == nil {
+			t.Errorf("Load with %s succeeded", test.name)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := openDB(t)
+	m := newMigrator(t, db, testFiles)
+	ctx := t.Context()
+
+	changed, err := m.Up(ctx)
+	if err != nil || !slices.Equal(versions(changed), []int64{1, 2}) {
+		t.Fatalf("Up = %v, %v, want [1 2]", versions(changed), err)
+	}
+	if !hasTable(t, db, "people") || !hasTable(t, db, "pets") {
+		t.Error("Up did not create the tables")
+	}
+	if changed, err := m.Up(ctx); err != nil || len(changed) != 0 {
+		t.Errorf("Up again = %v, %v, want nothing", versions(changed), err)
+	}
+
+	down, err := m.Down(ctx)
+	if err != nil || down == nil || down.Version != 2 {
+		t.Fatalf("Down = %+v, %v, want 2", down, err)
+	}
+	if hasTable(t, db, "pets") || !hasTable(t, db, "people") {
+		t.Error("Down did not roll back only the newest migration")
+	}
+	if version, err := m.Version(ctx); err != nil || version != 1 {
+		t.Errorf("Version after Down = %d, %v, want 1", version, err)
+	}
+
+	// To rolls back newest first and applies oldest first.
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	changed, err = m.To(ctx, 0)
+	if err != nil || !slices.Equal(versions(changed), []int64{2, 1}) {
+		t.Fatalf("To(0) = %v, %v, want [2 1]", versions(changed), err)
+	}
+	if hasTable(t, db, "people") || hasTable(t, db, "pets") {
+		t.Error("To(0) left tables behind")
+	}
+	if down, err := m.Down(ctx); err != nil || down != nil {
+		t.Errorf("Down on an empty database = %+v, %v, want nil", down, err)
+	}
+	changed, err = m.To(ctx, 1)
+	if err != nil || !slices.Equal(versions(changed), []int64{1}) {
+		t.Errorf("To(1) = %v, %v, want [1]", versions(changed), err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied || statuses[0].Modified {
+		t.Errorf("Status = %+v, %v", statuses, err)
+	}
+}
+
+func TestToUnknownVersion(t *testing.T) {
+	m := newMigrator(t, openDB(t), testFiles)
+	if _, err := m.To(t.Context(), 3); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("To(3) error = %v, want ErrUnknownVersion", err)
+	}
+	if version, err := m.Version(t.Context()); err != nil || version != 0 {
+		t.Errorf("Version after To(3) = %d, %v, want 0", version, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db := openDB(t)
+	if _, err := newMigrator(t, db, testFiles).Up(t.Context()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// A migration edited after it was applied is refused.
+	edited := fstest.MapFS{}
+	for name, file := range testFiles {
+		edited[name] = file
+	}
+	edited["test/0002_create_pets.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE pets (id INTEGER PRIMARY KEY, name TEXT)")}
+	m := newMigrator(t, db, edited)
+	if _, err := m.To(t.Context(), 0); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("To with an edited migration error = %v, want ErrChecksumMismatch", err)
+	}
+	if statuses, err := m.Status(t.Context()); err != nil || statuses[0].Modified || !statuses[1].Modified {
+		t.Errorf("Status with an edited migration = %+v, %v", statuses, err)
+	}
+	if !hasTable(t, db, "pets") {
+		t.Error("To with an edited migration rolled it back")
+	}
+
+	// So is a database with migrations this build does not know.
+	older := fstest.MapFS{
+		"test/0001_create_people.up.sql":   testFiles["test/0001_create_people.up.sql"],
+		"test/0001_create_people.down.sql": testFiles["test/0001_create_people.down.sql"],
+	}
+	if _, err := newMigrator(t, db, older).Up(t.Context()); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Up with an unknown applied migration error = %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestBind(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{SQLite, "DELETE FROM t WHERE a = ? AND b = ?", "DELETE FROM t WHERE a = ? AND b = ?"},
+		{Postgres, "DELETE FROM t WHERE a = ? AND b = ?", "DELETE FROM t WHERE a = $1 AND b = $2"},
+		{Postgres, "INSERT INTO t VALUES (?, ?, ?, ?)", "INSERT INTO t VALUES ($1, $2, $3, $4)"},
+		{Postgres, "SELECT 1", "SELECT 1"},
+	} {
+		m := &Migrator{dialect: test.dialect}
+		if got := m.bind(test.query); got != test.want {
+			t.Errorf("%s bind(%q) = %q, want %q", test.dialect, test.query, got, test.want)
+		}
+	}
+}
+
+// TestSQLiteMigrations applies and rolls back the migrations this build
+// ships for SQLite.
+func TestSQLiteMigrations(t *testing.T) {
+	db := openDB(t)
+	m, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := m.Up(t.Context()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if version, err := m.Version(t.Context()); err != nil || version != m.Latest() {
+		t.Errorf("Version = %d, %v, want %d", version, err, m.Latest())
+	}
+	changed, err := m.To(t.Context(), 0)
+	if err != nil || len(changed) != len(m.Migrations()) {
+		t.Fatalf("To(0) rolled back %d of %d migrations: %v", len(changed), len(m.Migrations()), err)
+	}
+	if _, err := m.Up(t.Context()); err != nil {
+		t.Errorf("Up after rolling back: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS students (
+	id BIGSERIAL PRIMARY KEY,
+	FullName TEXT,
+	Email TEXT,
+	Password TEXT,
+	Age INTEGER,
+	Gender TEXT,
+	PhoneNumber TEXT,
+	DOB TEXT,
+	Address TEXT
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS enrollments (
+	id BIGSERIAL PRIMARY KEY,
+	student_id BIGINT REFERENCES students(id),
+	course_id BIGINT REFERENCES courses(id),
+	enrolled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+ALTER TABLE courses ADD COLUMN Capacity INTEGER NOT NULL DEFAULT 0 CHECK (Capacity >= 0);
+
+CREATE TABLE waitlist (
+	id BIGSERIAL PRIMARY KEY,
+	student_id BIGINT NOT NULL REFERENCES students(id),
+	course_id BIGINT NOT NULL REFERENCES courses(id),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (student_id, course_id)
+);
+CREATE INDEX idx_waitlist_course ON waitlist (course_id, id);
@@ -0,0 +1,14 @@
+ALTER TABLE enrollments ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+	CHECK (status IN ('pending', 'approved', 'rejected', 'dropped', 'completed'));
+ALTER TABLE enrollments ADD COLUMN approved_at TIMESTAMP;
+ALTER TABLE enrollments ADD COLUMN rejected_at TIMESTAMP;
+ALTER TABLE enrollments ADD COLUMN dropped_at TIMESTAMP;
+ALTER TABLE enrollments ADD COLUMN completed_at TIMESTAMP;
+
+-- Enrollments made before statuses existed were in effect approved on the spot.
+UPDATE enrollments SET approved_at = enrolled_at;
+
+-- Finished enrollments stay as history, so only an active one must be unique.
+DROP INDEX idx_enrollments_student_course;
+CREATE UNIQUE INDEX idx_enrollments_active ON enrollments (student_id, course_id)
+	WHERE status IN ('pending', 'approved');
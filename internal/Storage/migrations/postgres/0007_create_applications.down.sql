@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS application_reviews;
+DROP TABLE IF EXISTS applications;
@@ -0,0 +1,26 @@
+CREATE TABLE applications (
+	id BIGSERIAL PRIMARY KEY,
+	student_id BIGINT NOT NULL REFERENCES students(id),
+	course_id BIGINT NOT NULL REFERENCES courses(id),
+	answers TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL DEFAULT 'submitted'
+		CHECK (status IN ('submitted', 'under_review', 'accepted', 'rejected', 'waitlisted')),
+	decision_note TEXT NOT NULL DEFAULT '',
+	submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	decided_at TIMESTAMP
+);
+-- Decided applications stay as history, so only an open one must be unique.
+CREATE UNIQUE INDEX idx_applications_open ON applications (student_id, course_id)
+	WHERE status IN ('submitted', 'under_review', 'waitlisted');
+CREATE INDEX idx_applications_status ON applications (status, id);
+
+CREATE TABLE application_reviews (
+	id BIGSERIAL PRIMARY KEY,
+	application_id BIGINT NOT NULL REFERENCES applications(id),
+	reviewer TEXT NOT NULL,
+	score INTEGER CHECK (score BETWEEN 0 AND 10),
+	comment TEXT NOT NULL DEFAULT '',
+	assigned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	reviewed_at TIMESTAMP,
+	UNIQUE (application_id, reviewer)
+);
@@ -0,0 +1,60 @@
+CREATE TABLE roles (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	built_in BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE role_permissions (
+	role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE admin_roles (
+	admin_id BIGINT NOT NULL REFERENCES admins(id) ON DELETE CASCADE,
+	role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	assigned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (admin_id, role_id)
+);
+CREATE INDEX idx_admin_roles_role ON admin_roles (role_id);
+
+INSERT INTO roles (name, description, built_in) VALUES
+	('superadmin', 'Every administrative permission', TRUE),
+	('student', 'Self-service permissions held by every student', TRUE),
+	('registrar', 'Reviews applications and approves enrollments', FALSE),
+	('auditor', 'Read-only access to students, enrollments, applications and admins', FALSE);
+
+WITH grants (role, permission) AS (VALUES
+	('superadmin', 'students:read'),
+	('superadmin', 'courses:write'),
+	('superadmin', 'enrollments:read'),
+	('superadmin', 'enrollments:manage'),
+	('superadmin', 'applications:read'),
+	('superadmin', 'applications:review'),
+	('superadmin', 'applications:manage'),
+	('superadmin', 'admins:read'),
+	('superadmin', 'admins:manage'),
+	('superadmin', 'roles:read'),
+	('superadmin', 'roles:manage'),
+	('student', 'profile:update'),
+	('student', 'enrollments:self'),
+	('student', 'applications:self'),
+	('registrar', 'students:read'),
+	('registrar', 'enrollments:read'),
+	('registrar', 'enrollments:manage'),
+	('registrar', 'applications:read'),
+	('registrar', 'applications:review'),
+	('registrar', 'applications:manage'),
+	('auditor', 'students:read'),
+	('auditor', 'enrollments:read'),
+	('auditor', 'applications:read'),
+	('auditor', 'admins:read'),
+	('auditor', 'roles:read')
+)
+INSERT INTO role_permissions (role_id, permission)
+SELECT roles.id, grants.permission FROM grants JOIN roles ON roles.name = grants.role;
+
+-- Every admin so far could do everything.
+INSERT INTO admin_roles (admin_id, role_id)
+SELECT admins.id, roles.id FROM admins, roles WHERE roles.name = 'superadmin';
@@ -0,0 +1,10 @@
+CREATE TABLE tokens (
+	jti TEXT PRIMARY KEY,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id BIGINT NOT NULL,
+	issued_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX idx_tokens_user ON tokens (user_type, user_id);
+CREATE INDEX idx_tokens_expires ON tokens (expires_at);
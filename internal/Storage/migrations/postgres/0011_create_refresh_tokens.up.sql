@@ -0,0 +1,18 @@
+-- Access tokens minted from the same login share a family with its refresh tokens.
+ALTER TABLE tokens ADD COLUMN family TEXT;
+CREATE INDEX idx_tokens_family ON tokens (family);
+
+CREATE TABLE refresh_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	family TEXT NOT NULL,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id BIGINT NOT NULL,
+	issued_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens (user_type, user_id);
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE password_resets (
+	id BIGSERIAL PRIMARY KEY,
+	student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+CREATE INDEX idx_password_resets_student ON password_resets (student_id);
+CREATE INDEX idx_password_resets_expires ON password_resets (expires_at);
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission IN ('audit:read', 'logins:manage');
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS login_throttles;
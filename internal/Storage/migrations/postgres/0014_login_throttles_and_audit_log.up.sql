@@ -0,0 +1,26 @@
+CREATE TABLE login_throttles (
+	throttle_key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_login_throttles_expires ON login_throttles (expires_at);
+
+-- Entries name their actor rather than reference it, so they outlive deleted users.
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	event TEXT NOT NULL,
+	actor_type TEXT NOT NULL DEFAULT '',
+	actor_id BIGINT NOT NULL DEFAULT 0,
+	subject TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_audit_log_event ON audit_log (event);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'audit:read' FROM roles WHERE name IN ('superadmin', 'auditor');
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'logins:manage' FROM roles WHERE name = 'superadmin';
@@ -0,0 +1,18 @@
+CREATE TABLE totp_secrets (
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id BIGINT NOT NULL,
+	secret TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	confirmed_at TIMESTAMP,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_type, user_id)
+);
+
+CREATE TABLE recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id BIGINT NOT NULL,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMP
+);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes (user_type, user_id);
@@ -0,0 +1 @@
+DELETE FROM role_permissions WHERE permission = 'students:pii';
@@ -0,0 +1,22 @@
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_by BIGINT NOT NULL REFERENCES admins(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX idx_api_keys_created_by ON api_keys (created_by);
+
+CREATE TABLE api_key_permissions (
+	key_id BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (key_id, permission)
+);
+
+-- Only superadmins manage API keys until other roles are granted it.
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'apikeys:manage' FROM roles WHERE name = 'superadmin';
@@ -0,0 +1,10 @@
+CREATE TABLE external_identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id BIGINT NOT NULL,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX idx_external_identities_user ON external_identities (user_type, user_id);
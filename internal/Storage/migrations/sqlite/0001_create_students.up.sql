@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS students (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	FullName TEXT,
+	Email TEXT,
+	Password TEXT,
+	Age INTEGER,
+	Gender TEXT,
+	PhoneNumber TEXT,
+	DOB TEXT,
+	Address TEXT
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS courses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	Name TEXT NOT NULL,
+	Description TEXT,
+	Duration TEXT,
+	Credits INTEGER,
+	Price INTEGER
+);
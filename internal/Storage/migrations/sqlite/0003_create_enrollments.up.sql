@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS enrollments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER,
+	course_id INTEGER,
+	enrolled_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(student_id) REFERENCES students(id),
+	FOREIGN KEY(course_id) REFERENCES courses(id)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_enrollments_student_course;
+DROP INDEX IF EXISTS idx_students_email;
@@ -0,0 +1,11 @@
+-- Emails are compared case-insensitively, so store them normalized.
+UPDATE students SET Email = lower(trim(Email));
+
+-- Duplicate enrollments carry no information; keep the oldest of each pair.
+DELETE FROM enrollments WHERE id NOT IN (
+	SELECT MIN(id) FROM enrollments GROUP BY student_id, course_id
+);
+
+-- Fails if two students already share an email; merge them by hand first.
+CREATE UNIQUE INDEX idx_students_email ON students (Email);
+CREATE UNIQUE INDEX idx_enrollments_student_course ON enrollments (student_id, course_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS waitlist;
+ALTER TABLE courses DROP COLUMN Capacity;
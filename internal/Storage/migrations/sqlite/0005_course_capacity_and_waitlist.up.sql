@@ -0,0 +1,12 @@
+ALTER TABLE courses ADD COLUMN Capacity INTEGER NOT NULL DEFAULT 0 CHECK (Capacity >= 0);
+
+CREATE TABLE waitlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(student_id) REFERENCES students(id),
+	FOREIGN KEY(course_id) REFERENCES courses(id),
+	UNIQUE (student_id, course_id)
+);
+CREATE INDEX idx_waitlist_course ON waitlist (course_id, id);
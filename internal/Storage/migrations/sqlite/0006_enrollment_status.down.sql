@@ -0,0 +1,11 @@
+-- Only active enrollments existed before statuses did.
+DELETE FROM enrollments WHERE status NOT IN ('pending', 'approved');
+
+DROP INDEX IF EXISTS idx_enrollments_active;
+CREATE UNIQUE INDEX idx_enrollments_student_course ON enrollments (student_id, course_id);
+
+ALTER TABLE enrollments DROP COLUMN completed_at;
+ALTER TABLE enrollments DROP COLUMN dropped_at;
+ALTER TABLE enrollments DROP COLUMN rejected_at;
+ALTER TABLE enrollments DROP COLUMN approved_at;
+ALTER TABLE enrollments DROP COLUMN status;
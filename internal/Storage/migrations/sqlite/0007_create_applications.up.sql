@@ -0,0 +1,29 @@
+CREATE TABLE applications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	answers TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL DEFAULT 'submitted'
+		CHECK (status IN ('submitted', 'under_review', 'accepted', 'rejected', 'waitlisted')),
+	decision_note TEXT NOT NULL DEFAULT '',
+	submitted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	decided_at DATETIME,
+	FOREIGN KEY(student_id) REFERENCES students(id),
+	FOREIGN KEY(course_id) REFERENCES courses(id)
+);
+-- Decided applications stay as history, so only an open one must be unique.
+CREATE UNIQUE INDEX idx_applications_open ON applications (student_id, course_id)
+	WHERE status IN ('submitted', 'under_review', 'waitlisted');
+CREATE INDEX idx_applications_status ON applications (status, id);
+
+CREATE TABLE application_reviews (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	application_id INTEGER NOT NULL,
+	reviewer TEXT NOT NULL,
+	score INTEGER CHECK (score BETWEEN 0 AND 10),
+	comment TEXT NOT NULL DEFAULT '',
+	assigned_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	reviewed_at DATETIME,
+	FOREIGN KEY(application_id) REFERENCES applications(id),
+	UNIQUE (application_id, reviewer)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE admins (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+CREATE TABLE tokens (
+	jti TEXT PRIMARY KEY,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id INTEGER NOT NULL,
+	issued_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME
+);
+CREATE INDEX idx_tokens_user ON tokens (user_type, user_id);
+CREATE INDEX idx_tokens_expires ON tokens (expires_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS refresh_tokens;
+DROP INDEX IF EXISTS idx_tokens_family;
+ALTER TABLE tokens DROP COLUMN family;
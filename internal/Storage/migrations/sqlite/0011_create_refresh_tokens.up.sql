@@ -0,0 +1,18 @@
+-- Access tokens minted from the same login share a family with its refresh tokens.
+ALTER TABLE tokens ADD COLUMN family TEXT;
+CREATE INDEX idx_tokens_family ON tokens (family);
+
+CREATE TABLE refresh_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token_hash TEXT NOT NULL UNIQUE,
+	family TEXT NOT NULL,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id INTEGER NOT NULL,
+	issued_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	revoked_at DATETIME
+);
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens (user_type, user_id);
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens (expires_at);
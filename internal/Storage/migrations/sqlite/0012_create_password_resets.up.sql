@@ -0,0 +1,11 @@
+CREATE TABLE password_resets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	FOREIGN KEY(student_id) REFERENCES students(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_password_resets_student ON password_resets (student_id);
+CREATE INDEX idx_password_resets_expires ON password_resets (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE students ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Students registered before verification existed keep their accounts usable.
+UPDATE students SET verified = TRUE;
@@ -0,0 +1,18 @@
+CREATE TABLE totp_secrets (
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id INTEGER NOT NULL,
+	secret TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	confirmed_at DATETIME,
+	last_used_step INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_type, user_id)
+);
+
+CREATE TABLE recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_type TEXT NOT NULL CHECK (user_type IN ('student', 'admin')),
+	user_id INTEGER NOT NULL,
+	code_hash TEXT NOT NULL,
+	used_at DATETIME
+);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes (user_type, user_id);
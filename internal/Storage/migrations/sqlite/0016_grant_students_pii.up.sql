@@ -0,0 +1,3 @@
+-- Students' personal details are shown only to roles allowed to see them.
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'students:pii' FROM roles WHERE name IN ('superadmin', 'registrar');
@@ -0,0 +1,24 @@
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	revoked_at DATETIME,
+	FOREIGN KEY(created_by) REFERENCES admins(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_api_keys_created_by ON api_keys (created_by);
+
+CREATE TABLE api_key_permissions (
+	key_id INTEGER NOT NULL,
+	permission TEXT NOT NULL,
+	FOREIGN KEY(key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+	PRIMARY KEY (key_id, permission)
+);
+
+-- Only superadmins manage API keys until other roles are granted it.
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'apikeys:manage' FROM roles WHERE name = 'superadmin';
@@ -0,0 +1,235 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Admin
+
+const adminColumns = "id, name, email, password, disabled, created_at"
+
+func scanAdmin(row scanner) (models.Admin, error) {
+	var admin models.Admin
+	err := row.Scan(&admin.ID, &admin.Name, &admin.Email, &admin.Password, &admin.Disabled, &admin.CreatedAt)
+	return admin, err
+}
+
+// adminError explains a failed admin insert in terms of the email that
+// collided with an existing admin.
+func adminError(err error, email string) error {
+	err = dbError(err)
+	if errors.Is(err, storage.ErrConflict) {
+		return storage.Errorf(storage.ErrConflict, "an admin with email %s already exists", email)
+	}
+	return err
+}
+
+func (p *Postgres) CreateAdmin(ctx context.Context, name string, email string, password string) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+
+	var id int64
+	err := p.Db.QueryRowContext(ctx, "INSERT INTO admins (name, email, password) VALUES ($1, $2, $3) RETURNING id", name, email, password).Scan(&id)
+	if err != nil {
+		return 0, adminError(err, email)
+	}
+	return id, nil
+}
+
+// CreateFirstAdmin inserts the admin only while the table is empty. The
+// table lock keeps two servers starting together from both seeding one.
+func (p *Postgres) CreateFirstAdmin(ctx context.Context, name string, email string, password string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, dbError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE admins IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return false, dbError(err)
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO admins (name, email, password) SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM admins) RETURNING id", name, email, password).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, adminError(err, email)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO admin_roles (admin_id, role_id) SELECT $1, id FROM roles WHERE name = $2", id, models.RoleSuperadmin)
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, dbError(err)
+	}
+	return true, nil
+}
+
+func (p *Postgres) GetAdminById(ctx context.Context, id int64) (models.Admin, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	admin, err := scanAdmin(p.Db.QueryRowContext(ctx, "SELECT "+adminColumns+" FROM admins WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)
+		}
+		return models.Admin{}, dbError(err)
+	}
+	return admin, nil
+}
+
+func (p *Postgres) GetAdminByEmail(ctx context.Context, email string) (models.Admin, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+	admin, err := scanAdmin(p.Db.QueryRowContext(ctx, "SELECT "+adminColumns+" FROM admins WHERE email = $1", email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with email %s", email)
+		}
+		return models.Admin{}, dbError(err)
+	}
+	return admin, nil
+}
+
+func (p *Postgres) GetAllAdmins(ctx context.Context) ([]models.Admin, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.Db.QueryContext(ctx, "SELECT "+adminColumns+" FROM admins ORDER BY id")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var admins []models.Admin
+	for rows.Next() {
+		admin, err := scanAdmin(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		admins = append(admins, admin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return admins, nil
+}
+
+func (p *Postgres) SetAdminDisabled(ctx context.Context, id int64, disabled bool) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	if disabled {
+		if err := keepEnabledAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	managers, err := roleManagers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE admins SET disabled = $1 WHERE id = $2", disabled, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)); err != nil {
+		return err
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) DeleteAdmin(ctx context.Context, id int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	if err := keepEnabledAdmin(ctx, tx, id); err != nil {
+		return err
+	}
+	managers, err := roleManagers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM admins WHERE id = $1", id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM external_identities WHERE user_type = 'admin' AND user_id = $1", id); err != nil {
+		return dbError(err)
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+// keepEnabledAdmin fails with ErrConflict when id is the only enabled admin,
+// so disabling or deleting it would lock everyone out. The enabled admins
+// stay locked until tx ends, so two admins cannot disable each other at once.
+func keepEnabledAdmin(ctx context.Context, tx *sql.Tx, id int64) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM admins WHERE disabled = FALSE ORDER BY id FOR UPDATE")
+	if err != nil {
+		return dbError(err)
+	}
+	defer rows.Close()
+
+	target, others := false, 0
+	for rows.Next() {
+		var enabled int64
+		if err := rows.Scan(&enabled); err != nil {
+			return dbError(err)
+		}
+		if enabled == id {
+			target = true
+		} else {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return dbError(err)
+	}
+
+	if target && others == 0 {
+		return storage.Errorf(storage.ErrConflict, "admin %d is the last enabled admin", id)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// API key
+
+const apiKeyColumns = "id, name, prefix, key_hash, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func (p *Postgres) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	permissions, err := checkPermissions(key.Permissions)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var expiresAt *time.Time
+	if key.ExpiresAt != nil {
+		utc := key.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO api_keys (name, prefix, key_hash, created_by, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		key.Name, key.Prefix, key.Hash, key.CreatedBy, key.CreatedAt.UTC(), expiresAt).Scan(&id)
+	if err != nil {
+		err = dbError(err)
+		switch {
+		case errors.Is(err, storage.ErrConflict):
+			return models.APIKey{}, storage.Errorf(storage.ErrConflict, "an API key with that hash already exists")
+		case errors.Is(err, storage.ErrConstraint):
+			return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", key.CreatedBy)
+		}
+		return models.APIKey{}, err
+	}
+	for _, permission := range permissions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO api_key_permissions (key_id, permission) VALUES ($1, $2)", id, permission); err != nil {
+			return models.APIKey{}, dbError(err)
+		}
+	}
+
+	keys, err := queryAPIKeys(ctx, tx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.APIKey{}, dbError(err)
+	}
+	return keys[0], nil
+}
+
+func (p *Postgres) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	keys, err := queryAPIKeys(ctx, p.Db, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if len(keys) == 0 {
+		return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "unknown API key")
+	}
+	return keys[0], nil
+}
+
+func (p *Postgres) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return queryAPIKeys(ctx, p.Db, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+}
+
+func (p *Postgres) RevokeAPIKey(ctx context.Context, id int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2", time.Now().UTC(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id))
+}
+
+func (p *Postgres) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", at.UTC(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id))
+}
+
+// queryAPIKeys runs a query selecting apiKeyColumns and fills in each key's
+// permissions.
+func queryAPIKeys(ctx context.Context, q querier, query string, args ...any) ([]models.APIKey, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.CreatedBy, &key.CreatedAt,
+			&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	rows.Close()
+
+	for i := range keys {
+		keys[i].Permissions, err = queryPermissions(ctx, q, "SELECT permission FROM api_key_permissions WHERE key_id = $1 ORDER BY permission", keys[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
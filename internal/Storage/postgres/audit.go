@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Audit log
+
+func (p *Postgres) CreateAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := p.Db.QueryRowContext(ctx, "INSERT INTO audit_log (event, actor_type, actor_id, subject, ip, detail, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		string(entry.Event), string(entry.ActorType), entry.ActorID, entry.Subject, entry.IP, entry.Detail, entry.CreatedAt.UTC()).Scan(&id)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+func (p *Postgres) GetAuditEntries(ctx context.Context, limit int, events ...models.AuditEvent) ([]models.AuditEntry, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("event", events, 1)
+	rows, err := p.Db.QueryContext(ctx, fmt.Sprintf("SELECT id, event, actor_type, actor_id, subject, ip, detail, created_at FROM audit_log WHERE 1 = 1%s ORDER BY id DESC LIMIT $%d", filter, len(args)+1),
+		append(args, limit)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Event, &entry.ActorType, &entry.ActorID, &entry.Subject, &entry.IP, &entry.Detail, &entry.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,845 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/migrations"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	security "github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+type Postgres struct {
+	Db *sql.DB
+
+	queryTimeout time.Duration
+}
+
+var _ storage.Storage = (*Postgres)(nil)
+
+// Open connects to the PostgreSQL database without touching its schema.
+func Open(cfg *config.Config) (*Postgres, error) {
+	if cfg.Storage.DSN == "" {
+		return nil, fmt.Errorf("storage.dsn is required for the postgres driver")
+	}
+
+	db, err := sql.Open("pgx", cfg.Storage.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	return &Postgres{
+		Db:           db,
+		queryTimeout: cfg.Storage.QueryTimeout,
+	}, nil
+}
+
+// New connects to the PostgreSQL database and applies any pending schema migrations.
+func New(cfg *config.Config) (*Postgres, error) {
+	p, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.New(p.Db, migrations.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	for _, migration := range applied {
+		slog.Info("Applied migration", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+	}
+
+	return p, nil
+}
+
+// withTimeout bounds ctx by the configured default query timeout.
+func (p *Postgres) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.queryTimeout)
+}
+
+// dbError maps driver failures onto the storage error kinds.
+func dbError(err error) error {
+	err = storage.ContextError(err)
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch {
+	case pgErr.Code == "23505": // unique_violation
+		return fmt.Errorf("%w: %v", storage.ErrConflict, err)
+	case strings.HasPrefix(pgErr.Code, "23"): // integrity constraint violations
+		return fmt.Errorf("%w: %v", storage.ErrConstraint, err)
+	case strings.HasPrefix(pgErr.Code, "22"): // data exceptions
+		return fmt.Errorf("%w: %v", storage.ErrInvalid, err)
+	}
+	return err
+}
+
+// studentError explains a failed student write in terms of the email that
+// collided with an existing student.
+func studentError(err error, email string) error {
+	err = dbError(err)
+	if errors.Is(err, storage.ErrConflict) {
+		return storage.Errorf(storage.ErrConflict, "a student with email %s already exists", email)
+	}
+	return err
+}
+
+// enrollmentError explains a failed enrollment insert: the pair already
+// exists, or one of its foreign keys points nowhere.
+func enrollmentError(err error, studentID int64, courseID int64) error {
+	err = dbError(err)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		return storage.Errorf(storage.ErrConflict, "student %d is already enrolled in course %d", studentID, courseID)
+	case errors.Is(err, storage.ErrConstraint):
+		return storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+	}
+	return err
+}
+
+// updated returns notFound when an UPDATE matched no rows.
+func updated(result sql.Result, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError(err)
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+const studentColumns = "id, FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address, verified"
+
+const courseColumns = "id, Name, Description, Duration, Credits, Price, Capacity"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStudent(row scanner) (models.Student, error) {
+	var student models.Student
+	err := row.Scan(
+		&student.Id,
+		&student.FullName,
+		&student.Email,
+		&student.Password,
+		&student.Age,
+		&student.Gender,
+		&student.PhoneNumber,
+		&student.DOB,
+		&student.Address,
+		&student.Verified,
+	)
+	return student, err
+}
+
+func scanCourse(row scanner) (models.Course, error) {
+	var course models.Course
+	err := row.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price, &course.Capacity)
+	return course, err
+}
+
+func (p *Postgres) queryStudents(ctx context.Context, query string, args ...any) ([]models.Student, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var students []models.Student
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		students = append(students, student)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return students, nil
+}
+
+func (p *Postgres) queryCourses(ctx context.Context, query string, args ...any) ([]models.Course, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var courses []models.Course
+	for rows.Next() {
+		course, err := scanCourse(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		courses = append(courses, course)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return courses, nil
+}
+
+// Student
+
+func (p *Postgres) CreateStudent(ctx context.Context, FullName string, Email string, Password string, Age int, Gender string, PhoneNumber string, DOB string, Address string) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	Email = storage.NormalizeEmail(Email)
+
+	var id int64
+	err := p.Db.QueryRowContext(ctx,
+		"INSERT INTO students (FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address,
+	).Scan(&id)
+	if err != nil {
+		return 0, studentError(err, Email)
+	}
+
+	return id, nil
+}
+
+func (p *Postgres) LoginStudent(ctx context.Context, email string, password string) (models.Student, error) {
+	student, err := p.GetStudentByEmail(ctx, email)
+	if err != nil {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	if !security.CheckPasswordHash(password, student.Password) {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	return student, nil
+}
+
+func (p *Postgres) GetStudentByEmail(ctx context.Context, email string) (models.Student, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+
+	student, err := scanStudent(p.Db.QueryRowContext(ctx, "SELECT "+studentColumns+" FROM students WHERE Email = $1 LIMIT 1", email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with email %s", email)
+		}
+		return models.Student{}, dbError(err)
+	}
+
+	return student, nil
+}
+
+func (p *Postgres) GetStudentById(ctx context.Context, id int64) (models.Student, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	student, err := scanStudent(p.Db.QueryRowContext(ctx, "SELECT "+studentColumns+" FROM students WHERE id = $1 LIMIT 1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)
+		}
+		return models.Student{}, dbError(err)
+	}
+
+	return student, nil
+}
+
+func (p *Postgres) GetAllStudents(ctx context.Context) ([]models.Student, error) {
+	return p.queryStudents(ctx, "SELECT "+studentColumns+" FROM students ORDER BY id")
+}
+
+func (p *Postgres) UpdateStudent(ctx context.Context, id int64, student models.Student) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	student.Email = storage.NormalizeEmail(student.Email)
+
+	// A changed email has to be verified again.
+	result, err := p.Db.ExecContext(ctx, `UPDATE students SET
+		verified = (verified AND Email = $2),
+		FullName = $1,
+		Email = $2,
+		Age = $3,
+		Gender = $4,
+		PhoneNumber = $5,
+		DOB = $6,
+		Address = $7
+		WHERE id = $8`,
+		student.FullName,
+		student.Email,
+		student.Age,
+		student.Gender,
+		student.PhoneNumber,
+		student.DOB,
+		student.Address,
+		id,
+	)
+	if err != nil {
+		return studentError(err, student.Email)
+	}
+
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id))
+}
+
+func (p *Postgres) VerifyStudentEmail(ctx context.Context, id int64, email string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+	result, err := p.Db.ExecContext(ctx, "UPDATE students SET verified = TRUE WHERE id = $1 AND Email = $2", id, email)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d and email %s", id, email))
+}
+
+// Courses
+
+func (p *Postgres) CreateCourse(ctx context.Context, Name string, Description string, Duration string, Credits int, Price int, Capacity int) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := p.Db.QueryRowContext(ctx,
+		"INSERT INTO courses (Name, Description, Duration, Credits, Price, Capacity) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		Name, Description, Duration, Credits, Price, Capacity,
+	).Scan(&id)
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	return id, nil
+}
+
+func (p *Postgres) GetCourseById(ctx context.Context, id int64) (models.Course, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	course, err := scanCourse(p.Db.QueryRowContext(ctx, "SELECT "+courseColumns+" FROM courses WHERE id = $1 LIMIT 1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Course{}, storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)
+		}
+		return models.Course{}, dbError(err)
+	}
+
+	return course, nil
+}
+
+func (p *Postgres) GetAllCourses(ctx context.Context) ([]models.Course, error) {
+	return p.queryCourses(ctx, "SELECT "+courseColumns+" FROM courses ORDER BY id")
+}
+
+// UpdateCourse also promotes waitlisted students into any seats a raised
+// capacity opens up.
+func (p *Postgres) UpdateCourse(ctx context.Context, id int64, course models.Course) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE courses SET
+			Name = $1,
+			Description = $2,
+			Duration = $3,
+			Credits = $4,
+			Price = $5,
+			Capacity = $6
+		WHERE id = $7
+	`, course.Name, course.Description, course.Duration, course.Credits, course.Price, course.Capacity, id)
+	if err != nil {
+		return dbError(err)
+	}
+
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)); err != nil {
+		return err
+	}
+
+	if err := promoteWaitlisted(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) SearchCoursesByName(ctx context.Context, name string) ([]models.Course, error) {
+	// ILIKE matches SQLite's case-insensitive LIKE.
+	courses, err := p.queryCourses(ctx, "SELECT "+courseColumns+" FROM courses WHERE Name ILIKE $1 ORDER BY id", "%"+name+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(courses) == 0 {
+		return nil, storage.Errorf(storage.ErrNotFound, "no courses found with name containing: %s", name)
+	}
+
+	return courses, nil
+}
+
+// Enrollment
+
+// activeEnrollment matches the enrollments that hold a seat, as
+// models.EnrollmentStatus.Active defines them.
+const activeEnrollment = "status IN ('pending', 'approved')"
+
+const enrollmentColumns = "id, student_id, course_id, status, enrolled_at, approved_at, rejected_at, dropped_at, completed_at"
+
+// statusTimestamps names the column recording when an enrollment entered
+// each status it can move to.
+var statusTimestamps = map[models.EnrollmentStatus]string{
+	models.EnrollmentApproved:  "approved_at",
+	models.EnrollmentRejected:  "rejected_at",
+	models.EnrollmentDropped:   "dropped_at",
+	models.EnrollmentCompleted: "completed_at",
+}
+
+func scanEnrollment(row scanner) (models.Enrollment, error) {
+	var enrollment models.Enrollment
+	var status string
+	err := row.Scan(&enrollment.ID, &enrollment.StudentID, &enrollment.CourseID, &status,
+		&enrollment.EnrolledAt, &enrollment.ApprovedAt, &enrollment.RejectedAt, &enrollment.DroppedAt, &enrollment.CompletedAt)
+	enrollment.Status = models.EnrollmentStatus(status)
+	return enrollment, err
+}
+
+// statusIn restricts a query to rows whose column holds one of statuses,
+// numbering its placeholders from $first; no statuses means any status.
+func statusIn[S ~string](column string, statuses []S, first int) (string, []any) {
+	if len(statuses) == 0 {
+		return "", nil
+	}
+
+	placeholders := make([]string, len(statuses))
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+		args[i] = string(status)
+	}
+	return " AND " + column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// EnrollStudent takes a free seat in the course, or queues the student on
+// the course's waitlist when every seat is taken. The course row stays locked
+// until the transaction ends, so concurrent enrollments cannot overfill it.
+func (p *Postgres) EnrollStudent(ctx context.Context, studentID int64, courseID int64) (models.Enrollment, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var capacity int
+	err = tx.QueryRowContext(ctx, "SELECT Capacity FROM courses WHERE id = $1 FOR UPDATE", courseID).Scan(&capacity)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+
+	waiting, err := count(ctx, tx, "SELECT COUNT(*) FROM waitlist WHERE student_id = $1 AND course_id = $2", studentID, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+	if waiting > 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already on the waitlist for course %d", studentID, courseID)
+	}
+
+	enrolled, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE course_id = $1 AND "+activeEnrollment, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+
+	if capacity == 0 || enrolled < capacity {
+		id, err := insertEnrollment(ctx, tx, studentID, courseID)
+		if err != nil {
+			return models.Enrollment{}, err
+		}
+		enrollment, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = $1", id))
+		if err != nil {
+			return models.Enrollment{}, dbError(err)
+		}
+		if err := tx.Commit(); err != nil {
+			return models.Enrollment{}, dbError(err)
+		}
+		return enrollment, nil
+	}
+
+	// A full course may still hold the student already.
+	seated, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE student_id = $1 AND course_id = $2 AND "+activeEnrollment, studentID, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+	if seated > 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already enrolled in course %d", studentID, courseID)
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO waitlist (student_id, course_id) VALUES ($1, $2) RETURNING id", studentID, courseID).Scan(&id)
+	if err != nil {
+		return models.Enrollment{}, enrollmentError(err, studentID, courseID)
+	}
+	position, err := count(ctx, tx, "SELECT COUNT(*) FROM waitlist WHERE course_id = $1 AND id <= $2", courseID, id)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	return models.Enrollment{StudentID: studentID, CourseID: courseID, Waitlisted: true, Position: position}, nil
+}
+
+// UnenrollStudent gives up the student's seat, handing it to the head of the
+// waitlist, or takes the student off the waitlist if they were only queued.
+// A pending enrollment is withdrawn without a trace; an approved one is kept
+// as dropped.
+func (p *Postgres) UnenrollStudent(ctx context.Context, studentID int64, courseID int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	// Lock the course first, like EnrollStudent, so seats are counted in
+	// one order. A missing course simply has nothing to unenroll.
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM courses WHERE id = $1 FOR UPDATE", courseID); err != nil {
+		return dbError(err)
+	}
+
+	notFound := storage.Errorf(storage.ErrNotFound, "no enrollment found for student %d in course %d", studentID, courseID)
+
+	var id int64
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT id, status FROM enrollments WHERE student_id = $1 AND course_id = $2 AND "+activeEnrollment, studentID, courseID).Scan(&id, &status)
+	if err == sql.ErrNoRows {
+		// No seat is freed when the student was only queued.
+		result, err := tx.ExecContext(ctx, "DELETE FROM waitlist WHERE student_id = $1 AND course_id = $2", studentID, courseID)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := updated(result, notFound); err != nil {
+			return err
+		}
+		return dbError(tx.Commit())
+	}
+	if err != nil {
+		return dbError(err)
+	}
+
+	if models.EnrollmentStatus(status) == models.EnrollmentPending {
+		_, err = tx.ExecContext(ctx, "DELETE FROM enrollments WHERE id = $1", id)
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE enrollments SET status = $1, dropped_at = CURRENT_TIMESTAMP WHERE id = $2", string(models.EnrollmentDropped), id)
+	}
+	if err != nil {
+		return dbError(err)
+	}
+
+	if err := promoteWaitlisted(ctx, tx, courseID); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) GetEnrollmentById(ctx context.Context, id int64) (models.Enrollment, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	enrollment, err := scanEnrollment(p.Db.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+
+	return enrollment, nil
+}
+
+func (p *Postgres) GetEnrollmentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Enrollment, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("status", statuses, 2)
+	rows, err := p.Db.QueryContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE course_id = $1"+filter+" ORDER BY id", append([]any{courseID}, args...)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var enrollments []models.Enrollment
+	for rows.Next() {
+		enrollment, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return enrollments, nil
+}
+
+// UpdateEnrollmentStatus moves an enrollment along the state machine of
+// models.EnrollmentStatus. Leaving an active status frees the seat for the
+// head of the waitlist.
+func (p *Postgres) UpdateEnrollmentStatus(ctx context.Context, id int64, status models.EnrollmentStatus) (models.Enrollment, error) {
+	if !status.Valid() {
+		return models.Enrollment{}, storage.Errorf(storage.ErrInvalid, "unknown enrollment status %q", status)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	notFound := storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+
+	// Lock the course before the enrollment, in the same order as
+	// UnenrollStudent, then read the enrollment's current status.
+	var courseID int64
+	err = tx.QueryRowContext(ctx, "SELECT course_id FROM enrollments WHERE id = $1", id).Scan(&courseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, notFound
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM courses WHERE id = $1 FOR UPDATE", courseID); err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	current, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, notFound
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+	if !current.Status.CanTransitionTo(status) {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "cannot change enrollment %d from %s to %s", id, current.Status, status)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE enrollments SET status = $1, "+statusTimestamps[status]+" = CURRENT_TIMESTAMP WHERE id = $2", string(status), id)
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	if current.Status.Active() && !status.Active() {
+		if err := promoteWaitlisted(ctx, tx, current.CourseID); err != nil {
+			return models.Enrollment{}, err
+		}
+	}
+
+	enrollment, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = $1", id))
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	return enrollment, nil
+}
+
+// GetStudentsByCourseID lists the students with an enrollment in one of
+// statuses in the course, or with any enrollment when statuses is empty.
+func (p *Postgres) GetStudentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Student, error) {
+	filter, args := statusIn("enrollments.status", statuses, 2)
+	return p.queryStudents(ctx, `
+		SELECT DISTINCT students.id, students.FullName, students.Email, students.Password, students.Age,
+		       students.Gender, students.PhoneNumber, students.DOB, students.Address, students.verified
+		FROM students
+		INNER JOIN enrollments ON students.id = enrollments.student_id
+		WHERE enrollments.course_id = $1`+filter+`
+		ORDER BY students.id
+	`, append([]any{courseID}, args...)...)
+}
+
+// GetCoursesByStudentID lists the courses the student has an enrollment in
+// one of statuses for, or any enrollment when statuses is empty.
+func (p *Postgres) GetCoursesByStudentID(ctx context.Context, studentID int64, statuses ...models.EnrollmentStatus) ([]models.Course, error) {
+	filter, args := statusIn("enrollments.status", statuses, 2)
+	return p.queryCourses(ctx, `
+		SELECT DISTINCT courses.id, courses.Name, courses.Description, courses.Duration,
+		       courses.Credits, courses.Price, courses.Capacity
+		FROM courses
+		INNER JOIN enrollments ON courses.id = enrollments.course_id
+		WHERE enrollments.student_id = $1`+filter+`
+		ORDER BY courses.id
+	`, append([]any{studentID}, args...)...)
+}
+
+// Waitlist
+
+// waitlistQuery selects waitlist entries with their 1-based position in the
+// queue of their course.
+const waitlistQuery = `
+	SELECT waitlist.id, waitlist.student_id, waitlist.course_id, waitlist.created_at,
+	       (SELECT COUNT(*) FROM waitlist AS ahead
+	        WHERE ahead.course_id = waitlist.course_id AND ahead.id <= waitlist.id)
+	FROM waitlist`
+
+func (p *Postgres) GetWaitlistByStudentID(ctx context.Context, studentID int64) ([]models.WaitlistEntry, error) {
+	return p.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.student_id = $1 ORDER BY waitlist.id", studentID)
+}
+
+func (p *Postgres) GetWaitlistByCourseID(ctx context.Context, courseID int64) ([]models.WaitlistEntry, error) {
+	return p.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.course_id = $1 ORDER BY waitlist.id", courseID)
+}
+
+func (p *Postgres) GetWaitlistPosition(ctx context.Context, studentID int64, courseID int64) (models.WaitlistEntry, error) {
+	entries, err := p.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.student_id = $1 AND waitlist.course_id = $2", studentID, courseID)
+	if err != nil {
+		return models.WaitlistEntry{}, err
+	}
+	if len(entries) == 0 {
+		return models.WaitlistEntry{}, storage.Errorf(storage.ErrNotFound, "student %d is not on the waitlist for course %d", studentID, courseID)
+	}
+
+	return entries[0], nil
+}
+
+func (p *Postgres) queryWaitlist(ctx context.Context, query string, args ...any) ([]models.WaitlistEntry, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.WaitlistEntry
+	for rows.Next() {
+		var entry models.WaitlistEntry
+		err := rows.Scan(&entry.ID, &entry.StudentID, &entry.CourseID, &entry.CreatedAt, &entry.Position)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return entries, nil
+}
+
+// promoteWaitlisted moves students from the head of the course's waitlist
+// into its free seats, inside the transaction that freed them. The caller
+// must hold the course row lock.
+func promoteWaitlisted(ctx context.Context, tx *sql.Tx, courseID int64) error {
+	var capacity int
+	if err := tx.QueryRowContext(ctx, "SELECT Capacity FROM courses WHERE id = $1", courseID).Scan(&capacity); err != nil {
+		return dbError(err)
+	}
+
+	for {
+		if capacity > 0 {
+			enrolled, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE course_id = $1 AND "+activeEnrollment, courseID)
+			if err != nil {
+				return err
+			}
+			if enrolled >= capacity {
+				return nil
+			}
+		}
+
+		var studentID int64
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM waitlist
+			WHERE id = (SELECT id FROM waitlist WHERE course_id = $1 ORDER BY id LIMIT 1)
+			RETURNING student_id
+		`, courseID).Scan(&studentID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return dbError(err)
+		}
+
+		if _, err := insertEnrollment(ctx, tx, studentID, courseID); err != nil {
+			return err
+		}
+	}
+}
+
+// insertEnrollment adds a pending enrollment and returns its id.
+func insertEnrollment(ctx context.Context, tx *sql.Tx, studentID int64, courseID int64) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO enrollments (student_id, course_id, status) VALUES ($1, $2, $3) RETURNING id",
+		studentID, courseID, string(models.EnrollmentPending),
+	).Scan(&id)
+	if err != nil {
+		return 0, enrollmentError(err, studentID, courseID)
+	}
+	return id, nil
+}
+
+// count runs a SELECT COUNT(*) query inside tx.
+func count(ctx context.Context, tx *sql.Tx, query string, args ...any) (int, error) {
+	var n int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, dbError(err)
+	}
+	return n, nil
+}
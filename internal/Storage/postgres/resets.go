@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Password reset
+
+func (p *Postgres) CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.Db.ExecContext(ctx, "INSERT INTO password_resets (student_id, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4)",
+		reset.StudentID, reset.Hash, reset.CreatedAt.UTC(), reset.ExpiresAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		switch {
+		case errors.Is(err, storage.ErrConflict):
+			return storage.Errorf(storage.ErrConflict, "password reset token already exists")
+		case errors.Is(err, storage.ErrConstraint):
+			return storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Postgres) ResetPassword(ctx context.Context, hash string, passwordHash string) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var reset models.PasswordReset
+	err = tx.QueryRowContext(ctx, "SELECT id, student_id, expires_at, used_at FROM password_resets WHERE token_hash = $1 FOR UPDATE", hash).
+		Scan(&reset.ID, &reset.StudentID, &reset.ExpiresAt, &reset.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.Errorf(storage.ErrNotFound, "unknown password reset token")
+		}
+		return 0, dbError(err)
+	}
+
+	now := time.Now().UTC()
+	if reset.UsedAt != nil {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token was already used")
+	}
+	if !reset.ExpiresAt.After(now) {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token has expired")
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE students SET Password = $1 WHERE id = $2", passwordHash, reset.StudentID)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at = $1 WHERE student_id = $2 AND used_at IS NULL", now, reset.StudentID); err != nil {
+		return 0, dbError(err)
+	}
+	// Whoever knew the old password may still hold a session.
+	if _, err := revokeTokens(ctx, tx, now, "user_type = $2 AND user_id = $3", string(models.UserStudent), reset.StudentID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return reset.StudentID, nil
+}
+
+func (p *Postgres) ChangeStudentPassword(ctx context.Context, id int64, passwordHash string, keepFamily string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE students SET Password = $1 WHERE id = $2", passwordHash, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at = $1 WHERE student_id = $2 AND used_at IS NULL", now, id); err != nil {
+		return dbError(err)
+	}
+	// Tokens from before families existed have none, and are revoked too.
+	if _, err := revokeTokens(ctx, tx, now, "user_type = $2 AND user_id = $3 AND (family IS NULL OR family = '' OR family <> $4)", string(models.UserStudent), id, keepFamily); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
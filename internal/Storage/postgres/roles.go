@@ -0,0 +1,398 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"sort"
+)
+
+// Role
+
+const roleColumns = "roles.id, roles.name, roles.description, roles.built_in"
+
+// roleManagersQuery counts the enabled admins who can manage roles, who
+// must never drop from some to none. Run it through roleManagers.
+const roleManagersQuery = `
+	SELECT COUNT(DISTINCT admins.id) FROM admins
+	INNER JOIN admin_roles ON admin_roles.admin_id = admins.id
+	INNER JOIN role_permissions ON role_permissions.role_id = admin_roles.role_id
+	WHERE admins.disabled = FALSE AND role_permissions.permission = 'roles:manage'`
+
+// checkPermissions rejects unknown permissions and returns the rest sorted
+// and without duplicates.
+func checkPermissions(permissions []models.Permission) ([]models.Permission, error) {
+	seen := map[models.Permission]bool{}
+	unique := []models.Permission{}
+	for _, permission := range permissions {
+		if !permission.Valid() {
+			return nil, storage.Errorf(storage.ErrInvalid, "unknown permission %q", permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			unique = append(unique, permission)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+	return unique, nil
+}
+
+func (p *Postgres) CreateRole(ctx context.Context, name string, description string, permissions []models.Permission) (models.Role, error) {
+	permissions, err := checkPermissions(permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Role{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id", name, description).Scan(&id)
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return models.Role{}, storage.Errorf(storage.ErrConflict, "a role named %s already exists", name)
+		}
+		return models.Role{}, err
+	}
+	if err := insertPermissions(ctx, tx, id, permissions); err != nil {
+		return models.Role{}, err
+	}
+
+	role, err := getRole(ctx, tx, name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Role{}, dbError(err)
+	}
+
+	return role, nil
+}
+
+func (p *Postgres) GetRoleByName(ctx context.Context, name string) (models.Role, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return getRole(ctx, p.Db, name)
+}
+
+func (p *Postgres) GetAllRoles(ctx context.Context) ([]models.Role, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return queryRoles(ctx, p.Db, "SELECT "+roleColumns+" FROM roles ORDER BY roles.id")
+}
+
+// SetRolePermissions replaces every permission of a role that is not built in.
+func (p *Postgres) SetRolePermissions(ctx context.Context, name string, permissions []models.Permission) (models.Role, error) {
+	permissions, err := checkPermissions(permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Role{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	role, err := changeableRole(ctx, tx, name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	managers, err := roleManagers(ctx, tx)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = $1", role.ID); err != nil {
+		return models.Role{}, dbError(err)
+	}
+	if err := insertPermissions(ctx, tx, role.ID, permissions); err != nil {
+		return models.Role{}, err
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return models.Role{}, err
+	}
+
+	role, err = getRole(ctx, tx, name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Role{}, dbError(err)
+	}
+
+	return role, nil
+}
+
+// DeleteRole removes a role that is not built in, taking it away from every
+// admin who had it.
+func (p *Postgres) DeleteRole(ctx context.Context, name string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	role, err := changeableRole(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	managers, err := roleManagers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE id = $1", role.ID); err != nil {
+		return dbError(err)
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) GetAdminRoles(ctx context.Context, adminID int64) ([]models.Role, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	exists, err := adminExists(ctx, p.Db, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", adminID)
+	}
+
+	return queryRoles(ctx, p.Db, "SELECT "+roleColumns+` FROM roles
+		INNER JOIN admin_roles ON admin_roles.role_id = roles.id
+		WHERE admin_roles.admin_id = $1 ORDER BY roles.id`, adminID)
+}
+
+func (p *Postgres) AssignRole(ctx context.Context, adminID int64, role string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	roleID, err := roleID(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+	exists, err := adminExists(ctx, tx, adminID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return storage.Errorf(storage.ErrNotFound, "no admin found with id %d", adminID)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO admin_roles (admin_id, role_id) VALUES ($1, $2)", adminID, roleID)
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return storage.Errorf(storage.ErrConflict, "admin %d already has role %s", adminID, role)
+		}
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) UnassignRole(ctx context.Context, adminID int64, role string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	roleID, err := roleID(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+	managers, err := roleManagers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM admin_roles WHERE admin_id = $1 AND role_id = $2", adminID, roleID)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "admin %d does not have role %s", adminID, role)); err != nil {
+		return err
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (p *Postgres) GetAdminPermissions(ctx context.Context, adminID int64) ([]models.Permission, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return queryPermissions(ctx, p.Db, `
+		SELECT DISTINCT role_permissions.permission FROM role_permissions
+		INNER JOIN admin_roles ON admin_roles.role_id = role_permissions.role_id
+		WHERE admin_roles.admin_id = $1
+		ORDER BY role_permissions.permission`, adminID)
+}
+
+// getRole reads a role together with its permissions.
+func getRole(ctx context.Context, q querier, name string) (models.Role, error) {
+	roles, err := queryRoles(ctx, q, "SELECT "+roleColumns+" FROM roles WHERE roles.name = $1", name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	if len(roles) == 0 {
+		return models.Role{}, storage.Errorf(storage.ErrNotFound, "no role named %s", name)
+	}
+	return roles[0], nil
+}
+
+// queryRoles runs a query selecting roleColumns and fills in each role's
+// permissions.
+func queryRoles(ctx context.Context, q querier, query string, args ...any) ([]models.Role, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.BuiltIn); err != nil {
+			return nil, dbError(err)
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	rows.Close()
+
+	for i := range roles {
+		roles[i].Permissions, err = queryPermissions(ctx, q, "SELECT permission FROM role_permissions WHERE role_id = $1 ORDER BY permission", roles[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return roles, nil
+}
+
+func queryPermissions(ctx context.Context, q querier, query string, args ...any) ([]models.Permission, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission); err != nil {
+			return nil, dbError(err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return permissions, nil
+}
+
+func insertPermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []models.Permission) error {
+	for _, permission := range permissions {
+		_, err := tx.ExecContext(ctx, "INSERT INTO role_permissions (role_id, permission) VALUES ($1, $2)", roleID, string(permission))
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	return nil
+}
+
+func roleID(ctx context.Context, tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = $1", name).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.Errorf(storage.ErrNotFound, "no role named %s", name)
+		}
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+// changeableRole reads a role inside tx and fails if it is built in.
+func changeableRole(ctx context.Context, tx *sql.Tx, name string) (models.Role, error) {
+	role, err := getRole(ctx, tx, name)
+	if err != nil {
+		return models.Role{}, err
+	}
+	if role.BuiltIn {
+		return models.Role{}, storage.Errorf(storage.ErrConflict, "role %s is built in and cannot be changed", name)
+	}
+	return role, nil
+}
+
+func adminExists(ctx context.Context, q querier, id int64) (bool, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM admins WHERE id = $1)", id).Scan(&exists); err != nil {
+		return false, dbError(err)
+	}
+	return exists, nil
+}
+
+// roleManagers locks role assignments and grants until tx ends, so two
+// concurrent changes cannot each leave the other as the last role manager,
+// and then counts the enabled admins who can manage roles.
+func roleManagers(ctx context.Context, tx *sql.Tx) (int, error) {
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE admin_roles, role_permissions IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return 0, dbError(err)
+	}
+	return count(ctx, tx, roleManagersQuery)
+}
+
+// keepRoleManager fails with ErrConflict when the changes made in tx took the
+// number of enabled admins who can manage roles from before down to zero.
+// before must come from roleManagers.
+func keepRoleManager(ctx context.Context, tx *sql.Tx, before int) error {
+	after, err := count(ctx, tx, roleManagersQuery)
+	if err != nil {
+		return err
+	}
+	if before > 0 && after == 0 {
+		return storage.Errorf(storage.ErrConflict, "no enabled admin would be left who can manage roles")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Login throttle
+
+const throttleColumns = "throttle_key, failures, last_failure_at, locked_until, expires_at"
+
+func scanThrottle(row scanner) (models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := row.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil, &throttle.ExpiresAt)
+	return throttle, err
+}
+
+// RecordLoginFailure counts the failure in a single upsert, so concurrent
+// failures are all counted even before the throttle's row exists.
+func (p *Postgres) RecordLoginFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginThrottle, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	throttle, err := scanThrottle(p.Db.QueryRowContext(ctx, `INSERT INTO login_throttles (throttle_key, failures, last_failure_at, expires_at) VALUES ($1, 1, $2, $3)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.expires_at > $2 THEN login_throttles.failures + 1 ELSE 1 END,
+			locked_until = CASE WHEN login_throttles.expires_at > $2 THEN login_throttles.locked_until END,
+			last_failure_at = $2, expires_at = $3
+		RETURNING `+throttleColumns,
+		key, at.UTC(), at.Add(window).UTC()))
+	if err != nil {
+		return models.LoginThrottle{}, dbError(err)
+	}
+	return throttle, nil
+}
+
+func (p *Postgres) LockLogin(ctx context.Context, key string, until time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "UPDATE login_throttles SET locked_until = $1, expires_at = GREATEST(expires_at, $1) WHERE throttle_key = $2", until.UTC(), key)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key))
+}
+
+func (p *Postgres) GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	throttle, err := scanThrottle(p.Db.QueryRowContext(ctx, "SELECT "+throttleColumns+" FROM login_throttles WHERE throttle_key = $1", key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.LoginThrottle{}, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key)
+		}
+		return models.LoginThrottle{}, dbError(err)
+	}
+	return throttle, nil
+}
+
+func (p *Postgres) GetLockedLogins(ctx context.Context, at time.Time) ([]models.LoginThrottle, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.Db.QueryContext(ctx, "SELECT "+throttleColumns+" FROM login_throttles WHERE locked_until > $1 ORDER BY throttle_key", at.UTC())
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var throttles []models.LoginThrottle
+	for rows.Next() {
+		throttle, err := scanThrottle(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		throttles = append(throttles, throttle)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return throttles, nil
+}
+
+func (p *Postgres) ClearLoginFailures(ctx context.Context, key string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "DELETE FROM login_throttles WHERE throttle_key = $1", key)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key))
+}
+
+func (p *Postgres) DeleteExpiredLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "DELETE FROM login_throttles WHERE expires_at < $1", before.UTC())
+	if err != nil {
+		return 0, dbError(err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Token
+//
+// Times are written from Go in UTC rather than with CURRENT_TIMESTAMP, so
+// that they compare correctly with the expiry times written alongside them.
+
+// Tokens issued before refresh tokens existed have no family.
+const tokenColumns = "jti, COALESCE(family, ''), user_type, user_id, issued_at, expires_at, revoked_at"
+
+const refreshTokenColumns = "id, token_hash, family, user_type, user_id, issued_at, expires_at, used_at, revoked_at"
+
+func scanRefreshToken(row scanner) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := row.Scan(&token.ID, &token.Hash, &token.Family, &token.UserType, &token.UserID, &token.IssuedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	return token, err
+}
+
+func (p *Postgres) CreateToken(ctx context.Context, token models.Token) error {
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.Db.ExecContext(ctx, "INSERT INTO tokens (jti, family, user_type, user_id, issued_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		token.JTI, token.Family, string(token.UserType), token.UserID, token.IssuedAt.UTC(), token.ExpiresAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return storage.Errorf(storage.ErrConflict, "a token with id %s already exists", token.JTI)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Postgres) GetToken(ctx context.Context, jti string) (models.Token, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var token models.Token
+	err := p.Db.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM tokens WHERE jti = $1", jti).
+		Scan(&token.JTI, &token.Family, &token.UserType, &token.UserID, &token.IssuedAt, &token.ExpiresAt, &token.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Token{}, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti)
+		}
+		return models.Token{}, dbError(err)
+	}
+	return token, nil
+}
+
+func (p *Postgres) RevokeToken(ctx context.Context, jti string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "UPDATE tokens SET revoked_at = COALESCE(revoked_at, $1) WHERE jti = $2", time.Now().UTC(), jti)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti))
+}
+
+func (p *Postgres) UseToken(ctx context.Context, jti string) (models.Token, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	result, err := p.Db.ExecContext(ctx, "UPDATE tokens SET revoked_at = $1 WHERE jti = $2 AND revoked_at IS NULL AND expires_at > $3", now, jti, now)
+	if err != nil {
+		return models.Token{}, dbError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.Token{}, dbError(err)
+	}
+
+	token, err := p.GetToken(ctx, jti)
+	if err != nil || rowsAffected == 1 {
+		return token, err
+	}
+	if token.Revoked() {
+		return models.Token{}, storage.Errorf(storage.ErrConflict, "token %s was already used or revoked", jti)
+	}
+	return models.Token{}, storage.Errorf(storage.ErrInvalid, "token %s has expired", jti)
+}
+
+func (p *Postgres) RevokeUserTokens(ctx context.Context, userType models.UserType, userID int64) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokens(ctx, tx, time.Now().UTC(), "user_type = $2 AND user_id = $3", string(userType), userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return revoked, nil
+}
+
+func (p *Postgres) RevokeTokenFamily(ctx context.Context, family string) (int64, error) {
+	if family == "" {
+		return 0, storage.Errorf(storage.ErrInvalid, "token family must not be empty")
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokens(ctx, tx, time.Now().UTC(), "family = $2", family)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return revoked, nil
+}
+
+func (p *Postgres) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, table := range []string{"tokens", "refresh_tokens", "password_resets"} {
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at < $1", before.UTC())
+		if err != nil {
+			return 0, dbError(err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, dbError(err)
+		}
+		deleted += rowsAffected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return deleted, nil
+}
+
+func (p *Postgres) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := insertRefreshToken(ctx, p.Db, token)
+	return err
+}
+
+func (p *Postgres) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanRefreshToken(tx.QueryRowContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE", hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.RefreshToken{}, storage.Errorf(storage.ErrNotFound, "unknown refresh token")
+		}
+		return models.RefreshToken{}, dbError(err)
+	}
+
+	now := time.Now().UTC()
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		if _, err := revokeTokens(ctx, tx, now, "family = $2", current.Family); err != nil {
+			return models.RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return models.RefreshToken{}, dbError(err)
+		}
+		return models.RefreshToken{}, storage.Errorf(storage.ErrConflict, "refresh token was already used; every token of its login has been revoked")
+	}
+	if !current.ExpiresAt.After(now) {
+		return models.RefreshToken{}, storage.Errorf(storage.ErrInvalid, "refresh token has expired")
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = $1 WHERE id = $2", now, current.ID); err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+
+	next.Family = current.Family
+	next.UserType = current.UserType
+	next.UserID = current.UserID
+	next.ID, err = insertRefreshToken(ctx, tx, next)
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+	return next, nil
+}
+
+func insertRefreshToken(ctx context.Context, q querier, token models.RefreshToken) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, "INSERT INTO refresh_tokens (token_hash, family, user_type, user_id, issued_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		token.Hash, token.Family, string(token.UserType), token.UserID, token.IssuedAt.UTC(), token.ExpiresAt.UTC()).Scan(&id)
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return 0, storage.Errorf(storage.ErrConflict, "refresh token already exists")
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// revokeTokens revokes the unexpired access and refresh tokens matching
+// where, which both tables must understand, and reports how many. now is $1,
+// so where numbers its own parameters from $2.
+func revokeTokens(ctx context.Context, tx *sql.Tx, now time.Time, where string, args ...any) (int64, error) {
+	var revoked int64
+	for _, table := range []string{"tokens", "refresh_tokens"} {
+		result, err := tx.ExecContext(ctx, "UPDATE "+table+" SET revoked_at = $1 WHERE "+where+" AND revoked_at IS NULL AND expires_at > $1",
+			append([]any{now}, args...)...)
+		if err != nil {
+			return 0, dbError(err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, dbError(err)
+		}
+		revoked += rowsAffected
+	}
+	return revoked, nil
+}
@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// TOTP
+
+func (p *Postgres) CreateTOTP(ctx context.Context, totp models.TOTP) error {
+	if !totp.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", totp.UserType)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, `INSERT INTO totp_secrets (user_type, user_id, secret, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_type, user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at, last_used_step = 0
+		WHERE totp_secrets.confirmed_at IS NULL`,
+		string(totp.UserType), totp.UserID, totp.Secret, totp.CreatedAt.UTC())
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up"))
+}
+
+func (p *Postgres) GetTOTP(ctx context.Context, userType models.UserType, userID int64) (models.TOTP, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	totp := models.TOTP{UserType: userType, UserID: userID}
+	err := p.Db.QueryRowContext(ctx, "SELECT secret, created_at, confirmed_at, last_used_step FROM totp_secrets WHERE user_type = $1 AND user_id = $2", string(userType), userID).
+		Scan(&totp.Secret, &totp.CreatedAt, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+		}
+		return models.TOTP{}, dbError(err)
+	}
+	return totp, nil
+}
+
+func (p *Postgres) ConfirmTOTP(ctx context.Context, userType models.UserType, userID int64, step int64, recoveryHashes []string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	var confirmedAt *time.Time
+	err = tx.QueryRowContext(ctx, "SELECT confirmed_at FROM totp_secrets WHERE user_type = $1 AND user_id = $2 FOR UPDATE", string(userType), userID).Scan(&confirmedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+		}
+		return dbError(err)
+	}
+	if confirmedAt != nil {
+		return storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up")
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE totp_secrets SET confirmed_at = $1, last_used_step = $2 WHERE user_type = $3 AND user_id = $4",
+		time.Now().UTC(), step, string(userType), userID); err != nil {
+		return dbError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_type = $1 AND user_id = $2", string(userType), userID); err != nil {
+		return dbError(err)
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_type, user_id, code_hash) VALUES ($1, $2, $3)", string(userType), userID, hash); err != nil {
+			return dbError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+func (p *Postgres) UseTOTPStep(ctx context.Context, userType models.UserType, userID int64, step int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.Db.ExecContext(ctx, "UPDATE totp_secrets SET last_used_step = $1 WHERE user_type = $2 AND user_id = $3 AND last_used_step < $4",
+		step, string(userType), userID, step)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrConflict, "authentication code was already used"))
+}
+
+func (p *Postgres) UseRecoveryCode(ctx context.Context, userType models.UserType, userID int64, hash string) (int, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE recovery_codes SET used_at = $1 WHERE user_type = $2 AND user_id = $3 AND code_hash = $4 AND used_at IS NULL",
+		time.Now().UTC(), string(userType), userID, hash)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "unknown recovery code")); err != nil {
+		return 0, err
+	}
+
+	var remaining int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_type = $1 AND user_id = $2 AND used_at IS NULL", string(userType), userID).Scan(&remaining)
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return remaining, nil
+}
+
+func (p *Postgres) DeleteTOTP(ctx context.Context, userType models.UserType, userID int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM totp_secrets WHERE user_type = $1 AND user_id = $2", string(userType), userID)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_type = $1 AND user_id = $2", string(userType), userID); err != nil {
+		return dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Admin
+
+const adminColumns = "id, name, email, password, disabled, created_at"
+
+func scanAdmin(row scanner) (models.Admin, error) {
+	var admin models.Admin
+	err := row.Scan(&admin.ID, &admin.Name, &admin.Email, &admin.Password, &admin.Disabled, &admin.CreatedAt)
+	return admin, err
+}
+
+// adminError explains a failed admin insert in terms of the email that
+// collided with an existing admin.
+func adminError(err error, email string) error {
+	err = dbError(err)
+	if errors.Is(err, storage.ErrConflict) {
+		return storage.Errorf(storage.ErrConflict, "an admin with email %s already exists", email)
+	}
+	return err
+}
+
+func (s *Sqlite) CreateAdmin(ctx context.Context, name string, email string, password string) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+	result, err := s.Db.ExecContext(ctx, "INSERT INTO admins (name, email, password) VALUES (?, ?, ?)", name, email, password)
+	if err != nil {
+		return 0, adminError(err, email)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+// CreateFirstAdmin inserts the admin in the same statement that checks the
+// table is empty, so two servers starting together seed only one.
+func (s *Sqlite) CreateFirstAdmin(ctx context.Context, name string, email string, password string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, dbError(err)
+	}
+	defer tx.Rollback()
+
+	email = storage.NormalizeEmail(email)
+	result, err := tx.ExecContext(ctx, "INSERT INTO admins (name, email, password) SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM admins)", name, email, password)
+	if err != nil {
+		return false, adminError(err, email)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError(err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, dbError(err)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO admin_roles (admin_id, role_id) SELECT ?, id FROM roles WHERE name = ?", id, models.RoleSuperadmin)
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, dbError(err)
+	}
+	return true, nil
+}
+
+func (s *Sqlite) GetAdminById(ctx context.Context, id int64) (models.Admin, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	admin, err := scanAdmin(s.Db.QueryRowContext(ctx, "SELECT "+adminColumns+" FROM admins WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)
+		}
+		return models.Admin{}, dbError(err)
+	}
+	return admin, nil
+}
+
+func (s *Sqlite) GetAdminByEmail(ctx context.Context, email string) (models.Admin, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+	admin, err := scanAdmin(s.Db.QueryRowContext(ctx, "SELECT "+adminColumns+" FROM admins WHERE email = ?", email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Admin{}, storage.Errorf(storage.ErrNotFound, "no admin found with email %s", email)
+		}
+		return models.Admin{}, dbError(err)
+	}
+	return admin, nil
+}
+
+func (s *Sqlite) GetAllAdmins(ctx context.Context) ([]models.Admin, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, "SELECT "+adminColumns+" FROM admins ORDER BY id")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var admins []models.Admin
+	for rows.Next() {
+		admin, err := scanAdmin(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		admins = append(admins, admin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return admins, nil
+}
+
+func (s *Sqlite) SetAdminDisabled(ctx context.Context, id int64, disabled bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	if disabled {
+		if err := keepEnabledAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	managers, err := count(ctx, tx, roleManagersQuery)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE admins SET disabled = ? WHERE id = ?", disabled, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)); err != nil {
+		return err
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+func (s *Sqlite) DeleteAdmin(ctx context.Context, id int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	if err := keepEnabledAdmin(ctx, tx, id); err != nil {
+		return err
+	}
+	managers, err := count(ctx, tx, roleManagersQuery)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM admins WHERE id = ?", id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", id)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM external_identities WHERE user_type = 'admin' AND user_id = ?", id); err != nil {
+		return dbError(err)
+	}
+	if err := keepRoleManager(ctx, tx, managers); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
+}
+
+// keepEnabledAdmin fails with ErrConflict when id is the only enabled admin,
+// so disabling or deleting it would lock everyone out.
+func keepEnabledAdmin(ctx context.Context, tx *sql.Tx, id int64) error {
+	others, err := count(ctx, tx, "SELECT COUNT(*) FROM admins WHERE disabled = FALSE AND id <> ?", id)
+	if err != nil {
+		return err
+	}
+	target, err := count(ctx, tx, "SELECT COUNT(*) FROM admins WHERE disabled = FALSE AND id = ?", id)
+	if err != nil {
+		return err
+	}
+	if target > 0 && others == 0 {
+		return storage.Errorf(storage.ErrConflict, "admin %d is the last enabled admin", id)
+	}
+	return nil
+}
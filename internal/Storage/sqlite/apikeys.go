@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// API key
+
+const apiKeyColumns = "id, name, prefix, key_hash, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func (s *Sqlite) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	permissions, err := checkPermissions(key.Permissions)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var expiresAt *time.Time
+	if key.ExpiresAt != nil {
+		utc := key.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	result, err := tx.ExecContext(ctx, "INSERT INTO api_keys (name, prefix, key_hash, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		key.Name, key.Prefix, key.Hash, key.CreatedBy, key.CreatedAt.UTC(), expiresAt)
+	if err != nil {
+		err = dbError(err)
+		switch {
+		case errors.Is(err, storage.ErrConflict):
+			return models.APIKey{}, storage.Errorf(storage.ErrConflict, "an API key with that hash already exists")
+		case errors.Is(err, storage.ErrConstraint):
+			return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "no admin found with id %d", key.CreatedBy)
+		}
+		return models.APIKey{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.APIKey{}, dbError(err)
+	}
+	for _, permission := range permissions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO api_key_permissions (key_id, permission) VALUES (?, ?)", id, permission); err != nil {
+			return models.APIKey{}, dbError(err)
+		}
+	}
+
+	keys, err := queryAPIKeys(ctx, tx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.APIKey{}, dbError(err)
+	}
+	return keys[0], nil
+}
+
+func (s *Sqlite) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys, err := queryAPIKeys(ctx, s.Db, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if len(keys) == 0 {
+		return models.APIKey{}, storage.Errorf(storage.ErrNotFound, "unknown API key")
+	}
+	return keys[0], nil
+}
+
+func (s *Sqlite) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return queryAPIKeys(ctx, s.Db, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+}
+
+func (s *Sqlite) RevokeAPIKey(ctx context.Context, id int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id))
+}
+
+func (s *Sqlite) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", at.UTC(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no API key found with id %d", id))
+}
+
+// queryAPIKeys runs a query selecting apiKeyColumns and fills in each key's
+// permissions.
+func queryAPIKeys(ctx context.Context, q querier, query string, args ...any) ([]models.APIKey, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.CreatedBy, &key.CreatedAt,
+			&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	rows.Close()
+
+	for i := range keys {
+		keys[i].Permissions, err = queryPermissions(ctx, q, "SELECT permission FROM api_key_permissions WHERE key_id = ? ORDER BY permission", keys[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,322 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Application
+
+const applicationColumns = "id, student_id, course_id, answers, status, decision_note, submitted_at, decided_at"
+
+const reviewColumns = "id, application_id, reviewer, score, comment, assigned_at, reviewed_at"
+
+// querier is what *sql.DB and *sql.Tx have in common for reads.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func scanApplication(row scanner) (models.Application, error) {
+	var application models.Application
+	var answers string
+	err := row.Scan(&application.ID, &application.StudentID, &application.CourseID, &answers, &application.Status,
+		&application.DecisionNote, &application.SubmittedAt, &application.DecidedAt)
+	if err != nil {
+		return models.Application{}, err
+	}
+	if err := json.Unmarshal([]byte(answers), &application.Answers); err != nil {
+		return models.Application{}, fmt.Errorf("application %d has malformed answers: %w", application.ID, err)
+	}
+	return application, nil
+}
+
+func scanReview(row scanner) (models.ApplicationReview, error) {
+	var review models.ApplicationReview
+	err := row.Scan(&review.ID, &review.ApplicationID, &review.Reviewer, &review.Score, &review.Comment,
+		&review.AssignedAt, &review.ReviewedAt)
+	return review, err
+}
+
+// applicationError explains a failed application insert: the student
+// already has an open application, or one of its foreign keys points nowhere.
+func applicationError(err error, studentID int64, courseID int64) error {
+	err = dbError(err)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		return storage.Errorf(storage.ErrConflict, "student %d already has an open application for course %d", studentID, courseID)
+	case errors.Is(err, storage.ErrConstraint):
+		return storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+	}
+	return err
+}
+
+func (s *Sqlite) SubmitApplication(ctx context.Context, studentID int64, courseID int64, answers map[string]string) (models.Application, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if answers == nil {
+		answers = map[string]string{}
+	}
+	encoded, err := json.Marshal(answers)
+	if err != nil {
+		return models.Application{}, err
+	}
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO applications (student_id, course_id, answers, status) VALUES (?, ?, ?, ?)",
+		studentID, courseID, string(encoded), models.ApplicationSubmitted)
+	if err != nil {
+		return models.Application{}, applicationError(err, studentID, courseID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+
+	application, err := scanApplication(tx.QueryRowContext(ctx, "SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Application{}, dbError(err)
+	}
+
+	return application, nil
+}
+
+func (s *Sqlite) GetApplicationById(ctx context.Context, id int64) (models.Application, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return getApplication(ctx, s.Db, id)
+}
+
+func (s *Sqlite) GetApplicationsByStudentID(ctx context.Context, studentID int64) ([]models.Application, error) {
+	return s.queryApplications(ctx, "SELECT "+applicationColumns+" FROM applications WHERE student_id = ? ORDER BY id", studentID)
+}
+
+// GetApplications lists the applications in one of statuses, or every
+// application when statuses is empty.
+func (s *Sqlite) GetApplications(ctx context.Context, statuses ...models.ApplicationStatus) ([]models.Application, error) {
+	filter, args := statusIn("status", statuses)
+	return s.queryApplications(ctx, "SELECT "+applicationColumns+" FROM applications WHERE 1 = 1"+filter+" ORDER BY id", args...)
+}
+
+func (s *Sqlite) queryApplications(ctx context.Context, query string, args ...any) ([]models.Application, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var applications []models.Application
+	for rows.Next() {
+		application, err := scanApplication(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		applications = append(applications, application)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return applications, nil
+}
+
+// AssignReviewer adds reviewer to an application that is still open. A
+// submitted application goes under review with its first reviewer.
+func (s *Sqlite) AssignReviewer(ctx context.Context, applicationID int64, reviewer string) (models.ApplicationReview, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	reviewer = storage.NormalizeEmail(reviewer)
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	current, err := openApplication(ctx, tx, applicationID)
+	if err != nil {
+		return models.ApplicationReview{}, err
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO application_reviews (application_id, reviewer) VALUES (?, ?)", applicationID, reviewer)
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return models.ApplicationReview{}, storage.Errorf(storage.ErrConflict, "reviewer %s is already assigned to application %d", reviewer, applicationID)
+		}
+		return models.ApplicationReview{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+
+	if current.Status == models.ApplicationSubmitted {
+		_, err = tx.ExecContext(ctx, "UPDATE applications SET status = ? WHERE id = ?", models.ApplicationUnderReview, applicationID)
+		if err != nil {
+			return models.ApplicationReview{}, dbError(err)
+		}
+	}
+
+	review, err := scanReview(tx.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM application_reviews WHERE id = ?", id))
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+
+	return review, nil
+}
+
+// ReviewApplication scores an open application on behalf of one of its
+// assigned reviewers.
+func (s *Sqlite) ReviewApplication(ctx context.Context, applicationID int64, reviewer string, score int, comment string) (models.ApplicationReview, error) {
+	if score < 0 || score > models.MaxReviewScore {
+		return models.ApplicationReview{}, storage.Errorf(storage.ErrInvalid, "review score must be between 0 and %d", models.MaxReviewScore)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	reviewer = storage.NormalizeEmail(reviewer)
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := openApplication(ctx, tx, applicationID); err != nil {
+		return models.ApplicationReview{}, err
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE application_reviews SET score = ?, comment = ?, reviewed_at = CURRENT_TIMESTAMP WHERE application_id = ? AND reviewer = ?",
+		score, comment, applicationID, reviewer)
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrConstraint, "reviewer %s is not assigned to application %d", reviewer, applicationID)); err != nil {
+		return models.ApplicationReview{}, err
+	}
+
+	review, err := scanReview(tx.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM application_reviews WHERE application_id = ? AND reviewer = ?", applicationID, reviewer))
+	if err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ApplicationReview{}, dbError(err)
+	}
+
+	return review, nil
+}
+
+// DecideApplication accepts, rejects or waitlists an application, following
+// the state machine of models.ApplicationStatus.
+func (s *Sqlite) DecideApplication(ctx context.Context, id int64, decision models.ApplicationStatus, note string) (models.Application, error) {
+	if !decision.Decision() {
+		return models.Application{}, storage.Errorf(storage.ErrInvalid, "%q is not an application decision", decision)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanApplication(tx.QueryRowContext(ctx, "SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Application{}, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+		}
+		return models.Application{}, dbError(err)
+	}
+	if !current.Status.CanTransitionTo(decision) {
+		return models.Application{}, storage.Errorf(storage.ErrConflict, "cannot change application %d from %s to %s", id, current.Status, decision)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE applications SET status = ?, decision_note = ?, decided_at = CURRENT_TIMESTAMP WHERE id = ?", decision, note, id)
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+
+	application, err := getApplication(ctx, tx, id)
+	if err != nil {
+		return models.Application{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Application{}, dbError(err)
+	}
+
+	return application, nil
+}
+
+// getApplication reads an application together with its reviews.
+func getApplication(ctx context.Context, q querier, id int64) (models.Application, error) {
+	application, err := scanApplication(q.QueryRowContext(ctx, "SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Application{}, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+		}
+		return models.Application{}, dbError(err)
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT "+reviewColumns+" FROM application_reviews WHERE application_id = ? ORDER BY id", id)
+	if err != nil {
+		return models.Application{}, dbError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return models.Application{}, dbError(err)
+		}
+		application.Reviews = append(application.Reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return models.Application{}, dbError(err)
+	}
+
+	return application, nil
+}
+
+// openApplication reads an application inside tx and fails unless it still
+// awaits a final decision.
+func openApplication(ctx context.Context, tx *sql.Tx, id int64) (models.Application, error) {
+	application, err := scanApplication(tx.QueryRowContext(ctx, "SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Application{}, storage.Errorf(storage.ErrNotFound, "no application found with id %d", id)
+		}
+		return models.Application{}, dbError(err)
+	}
+	if !application.Status.Open() {
+		return models.Application{}, storage.Errorf(storage.ErrConflict, "application %d has already been %s", id, application.Status)
+	}
+	return application, nil
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// Audit log
+
+func (s *Sqlite) CreateAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "INSERT INTO audit_log (event, actor_type, actor_id, subject, ip, detail, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		string(entry.Event), string(entry.ActorType), entry.ActorID, entry.Subject, entry.IP, entry.Detail, entry.CreatedAt.UTC())
+	if err != nil {
+		return 0, dbError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+func (s *Sqlite) GetAuditEntries(ctx context.Context, limit int, events ...models.AuditEvent) ([]models.AuditEntry, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("event", events)
+	rows, err := s.Db.QueryContext(ctx, "SELECT id, event, actor_type, actor_id, subject, ip, detail, created_at FROM audit_log WHERE 1 = 1"+filter+" ORDER BY id DESC LIMIT ?",
+		append(args, limit)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Event, &entry.ActorType, &entry.ActorID, &entry.Subject, &entry.IP, &entry.Detail, &entry.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+)
+
+// External identity
+
+func (s *Sqlite) LinkIdentity(ctx context.Context, identity models.ExternalIdentity) error {
+	table, ok := userTables[identity.UserType]
+	if !ok {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", identity.UserType)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = ?)", identity.UserID).Scan(&exists); err != nil {
+		return dbError(err)
+	}
+	if !exists {
+		return storage.Errorf(storage.ErrNotFound, "no %s found with id %d", identity.UserType, identity.UserID)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO external_identities (issuer, subject, user_type, user_id, email, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		identity.Issuer, identity.Subject, string(identity.UserType), identity.UserID, identity.Email, identity.CreatedAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return storage.Errorf(storage.ErrConflict, "identity %s of %s is already linked", identity.Subject, identity.Issuer)
+		}
+		return err
+	}
+	return dbError(tx.Commit())
+}
+
+func (s *Sqlite) GetIdentity(ctx context.Context, issuer string, subject string) (models.ExternalIdentity, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	identity := models.ExternalIdentity{Issuer: issuer, Subject: subject}
+	var userType string
+	err := s.Db.QueryRowContext(ctx, "SELECT user_type, user_id, email, created_at FROM external_identities WHERE issuer = ? AND subject = ?", issuer, subject).
+		Scan(&userType, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ExternalIdentity{}, storage.Errorf(storage.ErrNotFound, "identity %s of %s is not linked", subject, issuer)
+		}
+		return models.ExternalIdentity{}, dbError(err)
+	}
+	identity.UserType = models.UserType(userType)
+	return identity, nil
+}
+
+// userTables names the table of each type of user.
+var userTables = map[models.UserType]string{
+	models.UserStudent: "students",
+	models.UserAdmin:   "admins",
+}
@@ -0,0 +1,113 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Password reset
+
+func (s *Sqlite) CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, "INSERT INTO password_resets (student_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		reset.StudentID, reset.Hash, reset.CreatedAt.UTC(), reset.ExpiresAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		switch {
+		case errors.Is(err, storage.ErrConflict):
+			return storage.Errorf(storage.ErrConflict, "password reset token already exists")
+		case errors.Is(err, storage.ErrConstraint):
+			return storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Sqlite) ResetPassword(ctx context.Context, hash string, passwordHash string) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var reset models.PasswordReset
+	err = tx.QueryRowContext(ctx, "SELECT id, student_id, expires_at, used_at FROM password_resets WHERE token_hash = ?", hash).
+		Scan(&reset.ID, &reset.StudentID, &reset.ExpiresAt, &reset.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.Errorf(storage.ErrNotFound, "unknown password reset token")
+		}
+		return 0, dbError(err)
+	}
+
+	now := time.Now().UTC()
+	if reset.UsedAt != nil {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token was already used")
+	}
+	if !reset.ExpiresAt.After(now) {
+		return 0, storage.Errorf(storage.ErrInvalid, "password reset token has expired")
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE students SET Password = ? WHERE id = ?", passwordHash, reset.StudentID)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", reset.StudentID)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at = ? WHERE student_id = ? AND used_at IS NULL", now, reset.StudentID); err != nil {
+		return 0, dbError(err)
+	}
+	// Whoever knew the old password may still hold a session.
+	if _, err := revokeTokens(ctx, tx, now, "user_type = ? AND user_id = ?", models.UserStudent, reset.StudentID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return reset.StudentID, nil
+}
+
+func (s *Sqlite) ChangeStudentPassword(ctx context.Context, id int64, passwordHash string, keepFamily string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE students SET Password = ? WHERE id = ?", passwordHash, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at = ? WHERE student_id = ? AND used_at IS NULL", now, id); err != nil {
+		return dbError(err)
+	}
+	// Tokens from before families existed have none, and are revoked too.
+	if _, err := revokeTokens(ctx, tx, now, "user_type = ? AND user_id = ? AND (family IS NULL OR family = '' OR family <> ?)", models.UserStudent, id, keepFamily); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
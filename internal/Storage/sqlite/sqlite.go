@@ -1,163 +1,245 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/migrations"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
 	"github/Bharatjawa2/CtrlB_Assignment/models"
 	security "github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"log/slog"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 type Sqlite struct {
 	Db *sql.DB
+
+	queryTimeout time.Duration
 }
 
-// Making Table
+var _ storage.Storage = (*Sqlite)(nil)
 
-func New(cfg *config.Config) (*Sqlite, error) {
-	db, err := sql.Open("sqlite3", cfg.StoragePath)
+// Open connects to the SQLite database without touching its schema.
+func Open(cfg *config.Config) (*Sqlite, error) {
+	db, err := sql.Open("sqlite3", dsn(cfg.StoragePath))
 	if err != nil {
 		return nil, err
 	}
 
-	// Create students table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS students (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	FullName TEXT,
-	Email TEXT,
-	Password TEXT,
-	Age INTEGER,
-	Gender TEXT,
-	PhoneNumber TEXT,
-	DOB TEXT,
-	Address TEXT
-	)`)
+	return &Sqlite{
+		Db:           db,
+		queryTimeout: cfg.Storage.QueryTimeout,
+	}, nil
+}
 
+// dsn turns on foreign key enforcement, which SQLite leaves off by default,
+// for every connection opened on path. Transactions take the write lock when
+// they begin, so two of them reading the same seat count queue up on the
+// busy timeout instead of failing when both try to write.
+func dsn(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_foreign_keys=on&_txlock=immediate"
+}
+
+// New connects to the SQLite database and applies any pending schema migrations.
+func New(cfg *config.Config) (*Sqlite, error) {
+	s, err := Open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create students table: %w", err)
+		return nil, err
 	}
 
-	// Create courses table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS courses (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		Name TEXT NOT NULL,
-		Description TEXT,
-		Duration TEXT,
-		Credits INTEGER,
-		Price INTEGER
-	)`)
+	migrator, err := migrations.New(s.Db, migrations.SQLite)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create courses table: %w", err)
+		return nil, err
 	}
 
-	// Create Enrollment table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS enrollments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		student_id INTEGER,
-		course_id INTEGER,
-		enrolled_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(student_id) REFERENCES students(id),
-		FOREIGN KEY(course_id) REFERENCES courses(id)
-	)`)
+	applied, err := migrator.Up(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create enrollments table: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	for _, migration := range applied {
+		slog.Info("Applied migration", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
 	}
 
-	return &Sqlite{
-		Db: db,
-	}, nil
+	return s, nil
+}
+
+// withTimeout bounds ctx by the configured default query timeout.
+func (s *Sqlite) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// dbError maps driver failures onto the storage error kinds.
+func dbError(err error) error {
+	err = storage.ContextError(err)
+
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch {
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+		return fmt.Errorf("%w: %v", storage.ErrConflict, err)
+	case sqliteErr.Code == sqlite3.ErrConstraint:
+		return fmt.Errorf("%w: %v", storage.ErrConstraint, err)
+	case sqliteErr.Code == sqlite3.ErrMismatch || sqliteErr.Code == sqlite3.ErrTooBig:
+		return fmt.Errorf("%w: %v", storage.ErrInvalid, err)
+	}
+	return err
+}
+
+// studentError explains a failed student write in terms of the email that
+// collided with an existing student.
+func studentError(err error, email string) error {
+	err = dbError(err)
+	if errors.Is(err, storage.ErrConflict) {
+		return storage.Errorf(storage.ErrConflict, "a student with email %s already exists", email)
+	}
+	return err
+}
+
+// enrollmentError explains a failed enrollment insert: the pair already
+// exists, or one of its foreign keys points nowhere.
+func enrollmentError(err error, studentID int64, courseID int64) error {
+	err = dbError(err)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		return storage.Errorf(storage.ErrConflict, "student %d is already enrolled in course %d", studentID, courseID)
+	case errors.Is(err, storage.ErrConstraint):
+		return storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+	}
+	return err
+}
+
+// updated returns notFound when an UPDATE matched no rows.
+func updated(result sql.Result, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError(err)
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
 }
 
 // Student
 
-func (s *Sqlite) CreateStudent(FullName string, Email string, Password string, Age int, Gender string, PhoneNumber string, DOB string, Address string) (int64, error) {
-	stmt, err := s.Db.Prepare("INSERT INTO students (FullName,Email,Password,Age,Gender,PhoneNumber,DOB,Address) VALUES (?,?,?,?,?,?,?,?)")
+func (s *Sqlite) CreateStudent(ctx context.Context, FullName string, Email string, Password string, Age int, Gender string, PhoneNumber string, DOB string, Address string) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Db.PrepareContext(ctx, "INSERT INTO students (FullName,Email,Password,Age,Gender,PhoneNumber,DOB,Address) VALUES (?,?,?,?,?,?,?,?)")
 	if err != nil {
-		return 0, err
+		return 0, dbError(err)
 	}
 
 	defer stmt.Close()
 
-	result, err := stmt.Exec(FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address)
+	Email = storage.NormalizeEmail(Email)
+	result, err := stmt.ExecContext(ctx, FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address)
 	if err != nil {
-		return 0, err
+		return 0, studentError(err, Email)
 	}
 
 	lastid, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, dbError(err)
 	}
 
 	return lastid, nil
 }
 
-func (s *Sqlite) LoginStudent(email string, password string) (models.Student, error) {
-    student, err := s.GetStudentByEmail(email)
-    if err != nil {
-        return models.Student{}, fmt.Errorf("invalid email or password")
-    }
-    if !security.CheckPasswordHash(password, student.Password) {
-        return models.Student{}, fmt.Errorf("invalid email or password")
-    }
-    return student, nil
-}
-
-
-func (s *Sqlite) GetStudentByEmail(email string) (models.Student, error) {
-    stmt, err := s.Db.Prepare("SELECT * FROM students WHERE Email = ? LIMIT 1")
-    if err != nil {
-        return models.Student{}, err
-    }
-    defer stmt.Close()
-
-    var student models.Student
-    err = stmt.QueryRow(email).Scan(
-        &student.Id,
-        &student.FullName,
-        &student.Email,
-        &student.Password,
-        &student.Age,
-        &student.Gender,
-        &student.PhoneNumber,
-        &student.DOB,
-        &student.Address,
-    )
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return models.Student{}, fmt.Errorf("no Student Found with email %s", email)
-        }
-        return models.Student{}, err
-    }
-
-    return student, nil
-}
-
-func (s *Sqlite) GetStudentById(id int64) (models.Student, error) {
-	stmt, err := s.Db.Prepare("SELECT * FROM students WHERE id = ? LIMIT 1")
-	if err != nil {
-		return models.Student{}, err
+func (s *Sqlite) LoginStudent(ctx context.Context, email string, password string) (models.Student, error) {
+	student, err := s.GetStudentByEmail(ctx, email)
+	if err != nil {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	if !security.CheckPasswordHash(password, student.Password) {
+		return models.Student{}, fmt.Errorf("invalid email or password")
+	}
+	return student, nil
+}
+
+
+func (s *Sqlite) GetStudentByEmail(ctx context.Context, email string) (models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Db.PrepareContext(ctx, "SELECT id, FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address, verified FROM students WHERE Email = ? LIMIT 1")
+	if err != nil {
+		return models.Student{}, dbError(err)
+	}
+	defer stmt.Close()
+
+	email = storage.NormalizeEmail(email)
+
+	var student models.Student
+	err = stmt.QueryRowContext(ctx, email).Scan(
+		&student.Id,
+		&student.FullName,
+		&student.Email,
+		&student.Password,
+		&student.Age,
+		&student.Gender,
+		&student.PhoneNumber,
+		&student.DOB,
+		&student.Address,
+		&student.Verified,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with email %s", email)
+		}
+		return models.Student{}, dbError(err)
+	}
+
+	return student, nil
+}
+
+func (s *Sqlite) GetStudentById(ctx context.Context, id int64) (models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Db.PrepareContext(ctx, "SELECT id, FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address, verified FROM students WHERE id = ? LIMIT 1")
+	if err != nil {
+		return models.Student{}, dbError(err)
 	}
 	defer stmt.Close()
 
 	var student models.Student
 
-	err = stmt.QueryRow(id).Scan(&student.Id, &student.FullName, &student.Email, &student.Password, &student.Age, &student.Gender, &student.PhoneNumber, &student.DOB, &student.Address)
+	err = stmt.QueryRowContext(ctx, id).Scan(&student.Id, &student.FullName, &student.Email, &student.Password, &student.Age, &student.Gender, &student.PhoneNumber, &student.DOB, &student.Address, &student.Verified)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return models.Student{}, fmt.Errorf("No Student Found with id %s", fmt.Sprint(id))
+			return models.Student{}, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id)
 		}
-		return models.Student{}, fmt.Errorf("Query Error: %w", err)
+		return models.Student{}, dbError(err)
 	}
 
 	return student, nil
 }
 
-func (s *Sqlite) GetAllStudents() ([]models.Student, error) {
-	rows, err := s.Db.Query("SELECT * FROM students")
+func (s *Sqlite) GetAllStudents(ctx context.Context) ([]models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, "SELECT id, FullName, Email, Password, Age, Gender, PhoneNumber, DOB, Address, verified FROM students ORDER BY id")
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
@@ -175,25 +257,30 @@ func (s *Sqlite) GetAllStudents() ([]models.Student, error) {
 			&student.PhoneNumber,
 			&student.DOB,
 			&student.Address,
+			&student.Verified,
 		)
 		if err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		students = append(students, student)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 
 	return students, nil
 }
 
-func (s *Sqlite) UpdateStudent(id int64, student models.Student) (error) {
-	stmt, err := s.Db.Prepare(`UPDATE students SET 
+func (s *Sqlite) UpdateStudent(ctx context.Context, id int64, student models.Student) (error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// A changed email has to be verified again.
+	stmt, err := s.Db.PrepareContext(ctx, `UPDATE students SET 
+		verified = (verified AND Email = ?),
 		FullName = ?, 
 		Email = ?, 
-		Password = ?, 
 		Age = ?, 
 		Gender = ?, 
 		PhoneNumber = ?, 
@@ -201,14 +288,14 @@ func (s *Sqlite) UpdateStudent(id int64, student models.Student) (error) {
 		Address = ? 
 		WHERE id = ?`)
 	if err != nil {
-		return err
+		return dbError(err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(
+	result, err := stmt.ExecContext(ctx,
+		storage.NormalizeEmail(student.Email),
 		student.FullName,
-		student.Email,
-		student.Password, // We'll hash this later
+		storage.NormalizeEmail(student.Email),
 		student.Age,
 		student.Gender,
 		student.PhoneNumber,
@@ -216,119 +303,165 @@ func (s *Sqlite) UpdateStudent(id int64, student models.Student) (error) {
 		student.Address,
 		id,
 	)
-	return err
+	if err != nil {
+		return studentError(err, storage.NormalizeEmail(student.Email))
+	}
+
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d", id))
 }
 
-func (s *Sqlite) Logout()(error){
-	return nil
+func (s *Sqlite) VerifyStudentEmail(ctx context.Context, id int64, email string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	email = storage.NormalizeEmail(email)
+	result, err := s.Db.ExecContext(ctx, "UPDATE students SET verified = TRUE WHERE id = ? AND Email = ?", id, email)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no student found with id %d and email %s", id, email))
 }
 
 
 // Courses
 
-func (s *Sqlite) CreateCourse(Name string, Description string, Duration string, Credits int, Price int) (int64, error) {
-	stmt, err := s.Db.Prepare("INSERT INTO courses (Name,Description,Duration,Credits,Price) VALUES (?,?,?,?,?)")
+func (s *Sqlite) CreateCourse(ctx context.Context, Name string, Description string, Duration string, Credits int, Price int, Capacity int) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Db.PrepareContext(ctx, "INSERT INTO courses (Name,Description,Duration,Credits,Price,Capacity) VALUES (?,?,?,?,?,?)")
 	if err != nil {
-		return 0, err
+		return 0, dbError(err)
 	}
 
 	defer stmt.Close()
 
-	result, err := stmt.Exec(Name, Description, Duration, Credits, Price)
+	result, err := stmt.ExecContext(ctx, Name, Description, Duration, Credits, Price, Capacity)
 	if err != nil {
-		return 0, err
+		return 0, dbError(err)
 	}
 
 	lastid, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, dbError(err)
 	}
 
 	return lastid, nil
 }
 
-func (s *Sqlite) GetCourseById(id int64) (models.Course, error) {
-	stmt, err := s.Db.Prepare(`SELECT id, Name, Description, Duration, Credits, Price FROM courses WHERE id = ? LIMIT 1`)
+func (s *Sqlite) GetCourseById(ctx context.Context, id int64) (models.Course, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	stmt, err := s.Db.PrepareContext(ctx, `SELECT id, Name, Description, Duration, Credits, Price, Capacity FROM courses WHERE id = ? LIMIT 1`)
 	if err != nil {
-		return models.Course{}, err
+		return models.Course{}, dbError(err)
 	}
 	defer stmt.Close()
 
 	var course models.Course
-	err = stmt.QueryRow(id).Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price)
+	err = stmt.QueryRowContext(ctx, id).Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price, &course.Capacity)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return models.Course{}, fmt.Errorf("no course found with id %d", id)
+			return models.Course{}, storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)
 		}
-		return models.Course{}, err
+		return models.Course{}, dbError(err)
 	}
 
 	return course, nil
 }
 
-func (s *Sqlite) GetAllCourses() ([]models.Course, error) {
-	rows, err := s.Db.Query("SELECT id, Name, Description, Duration, Credits, Price FROM courses")
+func (s *Sqlite) GetAllCourses(ctx context.Context) ([]models.Course, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, "SELECT id, Name, Description, Duration, Credits, Price, Capacity FROM courses ORDER BY id")
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
 	var courses []models.Course
 	for rows.Next() {
 		var course models.Course
-		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price)
+		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price, &course.Capacity)
 		if err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		courses = append(courses, course)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 
 	return courses, nil
 }
 
-func (s *Sqlite) UpdateCourse(id int64, course models.Course) error {
-	stmt, err := s.Db.Prepare(`
+// UpdateCourse also promotes waitlisted students into any seats a raised
+// capacity opens up.
+func (s *Sqlite) UpdateCourse(ctx context.Context, id int64, course models.Course) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		UPDATE courses SET 
 			Name = ?, 
 			Description = ?, 
 			Duration = ?, 
 			Credits = ?, 
-			Price = ? 
+			Price = ?, 
+			Capacity = ? 
 		WHERE id = ?
-	`)
+	`, course.Name, course.Description, course.Duration, course.Credits, course.Price, course.Capacity, id)
 	if err != nil {
+		return dbError(err)
+	}
+
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "no course found with id %d", id)); err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(course.Name, course.Description, course.Duration, course.Credits, course.Price, id)
-	return err
+	if err := promoteWaitlisted(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return dbError(tx.Commit())
 }
 
-func (s *Sqlite) SearchCoursesByName(name string) ([]models.Course, error) {
-	query := `SELECT id, Name, Description, Duration, Credits, Price FROM courses WHERE Name LIKE ?`
-	rows, err := s.Db.Query(query, "%"+name+"%")
+func (s *Sqlite) SearchCoursesByName(ctx context.Context, name string) ([]models.Course, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, Name, Description, Duration, Credits, Price, Capacity FROM courses WHERE Name LIKE ? ORDER BY id`
+	rows, err := s.Db.QueryContext(ctx, query, "%"+name+"%")
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
 	var courses []models.Course
 	for rows.Next() {
 		var course models.Course
-		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price)
+		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price, &course.Capacity)
 		if err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		courses = append(courses, course)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
 	if len(courses) == 0 {
-		return nil, fmt.Errorf("no courses found with name containing: %s", name)
+		return nil, storage.Errorf(storage.ErrNotFound, "no courses found with name containing: %s", name)
 	}
 
 	return courses, nil
@@ -336,60 +469,285 @@ func (s *Sqlite) SearchCoursesByName(name string) ([]models.Course, error) {
 
 // Enrollment
 
-func (s *Sqlite) EnrollStudent(studentID int64, courseID int64) (int64, error) {
-	stmt, err := s.Db.Prepare("INSERT INTO enrollments (student_id, course_id) VALUES (?, ?)")
+// activeEnrollment matches the enrollments that hold a seat, as
+// models.EnrollmentStatus.Active defines them.
+const activeEnrollment = "status IN ('pending', 'approved')"
+
+const enrollmentColumns = "id, student_id, course_id, status, enrolled_at, approved_at, rejected_at, dropped_at, completed_at"
+
+// statusTimestamps names the column recording when an enrollment entered
+// each status it can move to.
+var statusTimestamps = map[models.EnrollmentStatus]string{
+	models.EnrollmentApproved:  "approved_at",
+	models.EnrollmentRejected:  "rejected_at",
+	models.EnrollmentDropped:   "dropped_at",
+	models.EnrollmentCompleted: "completed_at",
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEnrollment(row scanner) (models.Enrollment, error) {
+	var enrollment models.Enrollment
+	err := row.Scan(&enrollment.ID, &enrollment.StudentID, &enrollment.CourseID, &enrollment.Status,
+		&enrollment.EnrolledAt, &enrollment.ApprovedAt, &enrollment.RejectedAt, &enrollment.DroppedAt, &enrollment.CompletedAt)
+	return enrollment, err
+}
+
+// statusIn restricts a query to rows whose column holds one of statuses;
+// no statuses means any status.
+func statusIn[S ~string](column string, statuses []S) (string, []any) {
+	if len(statuses) == 0 {
+		return "", nil
+	}
+
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		args[i] = string(status)
+	}
+	return " AND " + column + " IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")", args
+}
+
+// EnrollStudent takes a free seat in the course, or queues the student on
+// the course's waitlist when every seat is taken. Seats are counted and taken
+// in one transaction, so concurrent enrollments cannot overfill a course.
+func (s *Sqlite) EnrollStudent(ctx context.Context, studentID int64, courseID int64) (models.Enrollment, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, err
+		return models.Enrollment{}, dbError(err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	result, err := stmt.Exec(studentID, courseID)
+	var capacity int
+	err = tx.QueryRowContext(ctx, "SELECT Capacity FROM courses WHERE id = ?", courseID).Scan(&capacity)
 	if err != nil {
-		return 0, err
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, storage.Errorf(storage.ErrConstraint, "student %d or course %d does not exist", studentID, courseID)
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+
+	waiting, err := count(ctx, tx, "SELECT COUNT(*) FROM waitlist WHERE student_id = ? AND course_id = ?", studentID, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+	if waiting > 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already on the waitlist for course %d", studentID, courseID)
 	}
 
-	lastID, err := result.LastInsertId()
+	enrolled, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE course_id = ? AND "+activeEnrollment, courseID)
 	if err != nil {
-		return 0, err
+		return models.Enrollment{}, err
+	}
+
+	if capacity == 0 || enrolled < capacity {
+		id, err := insertEnrollment(ctx, tx, studentID, courseID)
+		if err != nil {
+			return models.Enrollment{}, err
+		}
+		enrollment, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = ?", id))
+		if err != nil {
+			return models.Enrollment{}, dbError(err)
+		}
+		if err := tx.Commit(); err != nil {
+			return models.Enrollment{}, dbError(err)
+		}
+		return enrollment, nil
 	}
 
-	return lastID, nil
+	// A full course may still hold the student already.
+	seated, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE student_id = ? AND course_id = ? AND "+activeEnrollment, studentID, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+	if seated > 0 {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "student %d is already enrolled in course %d", studentID, courseID)
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO waitlist (student_id, course_id) VALUES (?, ?)", studentID, courseID)
+	if err != nil {
+		return models.Enrollment{}, enrollmentError(err, studentID, courseID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	position, err := count(ctx, tx, "SELECT COUNT(*) FROM waitlist WHERE course_id = ? AND id <= ?", courseID, id)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	return models.Enrollment{StudentID: studentID, CourseID: courseID, Waitlisted: true, Position: position}, nil
 }
 
-func (s *Sqlite) UnenrollStudent(studentID int64, courseID int64) error {
-	stmt, err := s.Db.Prepare(`DELETE FROM enrollments WHERE student_id = ? AND course_id = ?`)
+// UnenrollStudent gives up the student's seat, handing it to the head of the
+// waitlist, or takes the student off the waitlist if they were only queued.
+// A pending enrollment is withdrawn without a trace; an approved one is kept
+// as dropped.
+func (s *Sqlite) UnenrollStudent(ctx context.Context, studentID int64, courseID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return dbError(err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	result, err := stmt.Exec(studentID, courseID)
+	notFound := storage.Errorf(storage.ErrNotFound, "no enrollment found for student %d in course %d", studentID, courseID)
+
+	var id int64
+	var status models.EnrollmentStatus
+	err = tx.QueryRowContext(ctx, "SELECT id, status FROM enrollments WHERE student_id = ? AND course_id = ? AND "+activeEnrollment, studentID, courseID).Scan(&id, &status)
+	if err == sql.ErrNoRows {
+		// No seat is freed when the student was only queued.
+		result, err := tx.ExecContext(ctx, `DELETE FROM waitlist WHERE student_id = ? AND course_id = ?`, studentID, courseID)
+		if err != nil {
+			return dbError(err)
+		}
+		if err := updated(result, notFound); err != nil {
+			return err
+		}
+		return dbError(tx.Commit())
+	}
 	if err != nil {
-		return err
+		return dbError(err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if status == models.EnrollmentPending {
+		_, err = tx.ExecContext(ctx, `DELETE FROM enrollments WHERE id = ?`, id)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE enrollments SET status = ?, dropped_at = CURRENT_TIMESTAMP WHERE id = ?`, models.EnrollmentDropped, id)
+	}
 	if err != nil {
+		return dbError(err)
+	}
+
+	if err := promoteWaitlisted(ctx, tx, courseID); err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no enrollment found for student %d in course %d", studentID, courseID)
+
+	return dbError(tx.Commit())
+}
+
+func (s *Sqlite) GetEnrollmentById(ctx context.Context, id int64) (models.Enrollment, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	enrollment, err := scanEnrollment(s.Db.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+		}
+		return models.Enrollment{}, dbError(err)
 	}
 
-	return nil
+	return enrollment, nil
+}
+
+func (s *Sqlite) GetEnrollmentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Enrollment, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("status", statuses)
+	rows, err := s.Db.QueryContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE course_id = ?"+filter+" ORDER BY id", append([]any{courseID}, args...)...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var enrollments []models.Enrollment
+	for rows.Next() {
+		enrollment, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return enrollments, nil
 }
 
-func (s *Sqlite) GetStudentsByCourseID(courseID int64) ([]models.Student, error) {
-	rows, err := s.Db.Query(`
-		SELECT students.id, students.FullName, students.Email, students.Password, students.Age, 
-		       students.Gender, students.PhoneNumber, students.DOB, students.Address
+// UpdateEnrollmentStatus moves an enrollment along the state machine of
+// models.EnrollmentStatus. Leaving an active status frees the seat for the
+// head of the waitlist.
+func (s *Sqlite) UpdateEnrollmentStatus(ctx context.Context, id int64, status models.EnrollmentStatus) (models.Enrollment, error) {
+	if !status.Valid() {
+		return models.Enrollment{}, storage.Errorf(storage.ErrInvalid, "unknown enrollment status %q", status)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Enrollment{}, storage.Errorf(storage.ErrNotFound, "no enrollment found with id %d", id)
+		}
+		return models.Enrollment{}, dbError(err)
+	}
+	if !current.Status.CanTransitionTo(status) {
+		return models.Enrollment{}, storage.Errorf(storage.ErrConflict, "cannot change enrollment %d from %s to %s", id, current.Status, status)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE enrollments SET status = ?, "+statusTimestamps[status]+" = CURRENT_TIMESTAMP WHERE id = ?", status, id)
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	if current.Status.Active() && !status.Active() {
+		if err := promoteWaitlisted(ctx, tx, current.CourseID); err != nil {
+			return models.Enrollment{}, err
+		}
+	}
+
+	enrollment, err := scanEnrollment(tx.QueryRowContext(ctx, "SELECT "+enrollmentColumns+" FROM enrollments WHERE id = ?", id))
+	if err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Enrollment{}, dbError(err)
+	}
+
+	return enrollment, nil
+}
+
+// GetStudentsByCourseID lists the students with an enrollment in one of
+// statuses in the course, or with any enrollment when statuses is empty.
+func (s *Sqlite) GetStudentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("enrollments.status", statuses)
+	rows, err := s.Db.QueryContext(ctx, `
+		SELECT DISTINCT students.id, students.FullName, students.Email, students.Password, students.Age, 
+		       students.Gender, students.PhoneNumber, students.DOB, students.Address, students.verified
 		FROM students
 		INNER JOIN enrollments ON students.id = enrollments.student_id
-		WHERE enrollments.course_id = ?
-	`, courseID)
+		WHERE enrollments.course_id = ?`+filter+`
+		ORDER BY students.id
+	`, append([]any{courseID}, args...)...)
 
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
@@ -397,37 +755,169 @@ func (s *Sqlite) GetStudentsByCourseID(courseID int64) ([]models.Student, error)
 	for rows.Next() {
 		var student models.Student
 		err := rows.Scan(&student.Id, &student.FullName, &student.Email, &student.Password, &student.Age,
-			&student.Gender, &student.PhoneNumber, &student.DOB, &student.Address)
+			&student.Gender, &student.PhoneNumber, &student.DOB, &student.Address, &student.Verified)
 		if err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		students = append(students, student)
 	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
 	return students, nil
 }
 
-func (s *Sqlite) GetCoursesByStudentID(studentID int64) ([]models.Course, error) {
-	rows, err := s.Db.Query(`
-		SELECT courses.id, courses.Name, courses.Description, courses.Duration, 
-		       courses.Credits, courses.Price
+// GetCoursesByStudentID lists the courses the student has an enrollment in
+// one of statuses for, or any enrollment when statuses is empty.
+func (s *Sqlite) GetCoursesByStudentID(ctx context.Context, studentID int64, statuses ...models.EnrollmentStatus) ([]models.Course, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filter, args := statusIn("enrollments.status", statuses)
+	rows, err := s.Db.QueryContext(ctx, `
+		SELECT DISTINCT courses.id, courses.Name, courses.Description, courses.Duration, 
+		       courses.Credits, courses.Price, courses.Capacity
 		FROM courses
 		INNER JOIN enrollments ON courses.id = enrollments.course_id
-		WHERE enrollments.student_id = ?
-	`, studentID)
+		WHERE enrollments.student_id = ?`+filter+`
+		ORDER BY courses.id
+	`, append([]any{studentID}, args...)...)
 
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
 	var courses []models.Course
 	for rows.Next() {
 		var course models.Course
-		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price)
+		err := rows.Scan(&course.ID, &course.Name, &course.Description, &course.Duration, &course.Credits, &course.Price, &course.Capacity)
 		if err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		courses = append(courses, course)
 	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
 	return courses, nil
-}
\ No newline at end of file
+}
+
+// Waitlist
+
+// waitlistQuery selects waitlist entries with their 1-based position in the
+// queue of their course.
+const waitlistQuery = `
+	SELECT waitlist.id, waitlist.student_id, waitlist.course_id, waitlist.created_at,
+	       (SELECT COUNT(*) FROM waitlist AS ahead
+	        WHERE ahead.course_id = waitlist.course_id AND ahead.id <= waitlist.id)
+	FROM waitlist`
+
+func (s *Sqlite) GetWaitlistByStudentID(ctx context.Context, studentID int64) ([]models.WaitlistEntry, error) {
+	return s.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.student_id = ? ORDER BY waitlist.id", studentID)
+}
+
+func (s *Sqlite) GetWaitlistByCourseID(ctx context.Context, courseID int64) ([]models.WaitlistEntry, error) {
+	return s.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.course_id = ? ORDER BY waitlist.id", courseID)
+}
+
+func (s *Sqlite) GetWaitlistPosition(ctx context.Context, studentID int64, courseID int64) (models.WaitlistEntry, error) {
+	entries, err := s.queryWaitlist(ctx, waitlistQuery+" WHERE waitlist.student_id = ? AND waitlist.course_id = ?", studentID, courseID)
+	if err != nil {
+		return models.WaitlistEntry{}, err
+	}
+	if len(entries) == 0 {
+		return models.WaitlistEntry{}, storage.Errorf(storage.ErrNotFound, "student %d is not on the waitlist for course %d", studentID, courseID)
+	}
+
+	return entries[0], nil
+}
+
+func (s *Sqlite) queryWaitlist(ctx context.Context, query string, args ...any) ([]models.WaitlistEntry, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.WaitlistEntry
+	for rows.Next() {
+		var entry models.WaitlistEntry
+		err := rows.Scan(&entry.ID, &entry.StudentID, &entry.CourseID, &entry.CreatedAt, &entry.Position)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return entries, nil
+}
+
+// promoteWaitlisted moves students from the head of the course's waitlist
+// into its free seats, inside the transaction that freed them.
+func promoteWaitlisted(ctx context.Context, tx *sql.Tx, courseID int64) error {
+	var capacity int
+	if err := tx.QueryRowContext(ctx, "SELECT Capacity FROM courses WHERE id = ?", courseID).Scan(&capacity); err != nil {
+		return dbError(err)
+	}
+
+	for {
+		if capacity > 0 {
+			enrolled, err := count(ctx, tx, "SELECT COUNT(*) FROM enrollments WHERE course_id = ? AND "+activeEnrollment, courseID)
+			if err != nil {
+				return err
+			}
+			if enrolled >= capacity {
+				return nil
+			}
+		}
+
+		var id, studentID int64
+		err := tx.QueryRowContext(ctx, "SELECT id, student_id FROM waitlist WHERE course_id = ? ORDER BY id LIMIT 1", courseID).Scan(&id, &studentID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return dbError(err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM waitlist WHERE id = ?", id); err != nil {
+			return dbError(err)
+		}
+		if _, err := insertEnrollment(ctx, tx, studentID, courseID); err != nil {
+			return err
+		}
+	}
+}
+
+// insertEnrollment adds a pending enrollment and returns its id.
+func insertEnrollment(ctx context.Context, tx *sql.Tx, studentID int64, courseID int64) (int64, error) {
+	result, err := tx.ExecContext(ctx, "INSERT INTO enrollments (student_id, course_id, status) VALUES (?, ?, ?)", studentID, courseID, models.EnrollmentPending)
+	if err != nil {
+		return 0, enrollmentError(err, studentID, courseID)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+// count runs a SELECT COUNT(*) query inside tx.
+func count(ctx context.Context, tx *sql.Tx, query string, args ...any) (int, error) {
+	var n int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, dbError(err)
+	}
+	return n, nil
+}
@@ -0,0 +1,44 @@
+package sqlite_test
+
+import (
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/sqlite"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/storagetest"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := sqlite.New(&config.Config{StoragePath: filepath.Join(t.TempDir(), "storage.db")})
+		if err != nil {
+			t.Fatalf("sqlite.New: %v", err)
+		}
+		t.Cleanup(func() { s.Db.Close() })
+		return s
+	})
+}
+
+func TestDefaultQueryTimeout(t *testing.T) {
+	cfg := &config.Config{StoragePath: filepath.Join(t.TempDir(), "storage.db")}
+	s, err := sqlite.New(cfg)
+	if err != nil {
+		t.Fatalf("sqlite.New: %v", err)
+	}
+	s.Db.Close()
+
+	// Reopen the migrated database with a timeout no query can meet.
+	cfg.Storage.QueryTimeout = time.Nanosecond
+	s, err = sqlite.Open(cfg)
+	if err != nil {
+		t.Fatalf("sqlite.Open: %v", err)
+	}
+	defer s.Db.Close()
+
+	if _, err := s.GetAllStudents(t.Context()); !errors.Is(err, storage.ErrTimeout) {
+		t.Errorf("GetAllStudents = %v, want storage.ErrTimeout", err)
+	}
+}
@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Login throttle
+
+const throttleColumns = "throttle_key, failures, last_failure_at, locked_until, expires_at"
+
+func scanThrottle(row scanner) (models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := row.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil, &throttle.ExpiresAt)
+	return throttle, err
+}
+
+// RecordLoginFailure reads and writes the throttle in one transaction, which
+// _txlock=immediate makes exclusive, so concurrent failures are all counted.
+func (s *Sqlite) RecordLoginFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginThrottle, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.LoginThrottle{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	at = at.UTC()
+	throttle, err := scanThrottle(tx.QueryRowContext(ctx, "SELECT "+throttleColumns+" FROM login_throttles WHERE throttle_key = ?", key))
+	if err != nil && err != sql.ErrNoRows {
+		return models.LoginThrottle{}, dbError(err)
+	}
+	if err == sql.ErrNoRows || !throttle.ExpiresAt.After(at) {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	throttle.ExpiresAt = at.Add(window)
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_throttles (`+throttleColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at,
+			locked_until = excluded.locked_until, expires_at = excluded.expires_at`,
+		throttle.Key, throttle.Failures, throttle.LastFailureAt, throttle.LockedUntil, throttle.ExpiresAt)
+	if err != nil {
+		return models.LoginThrottle{}, dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.LoginThrottle{}, dbError(err)
+	}
+	return throttle, nil
+}
+
+func (s *Sqlite) LockLogin(ctx context.Context, key string, until time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	until = until.UTC()
+	result, err := s.Db.ExecContext(ctx, "UPDATE login_throttles SET locked_until = ?, expires_at = MAX(expires_at, ?) WHERE throttle_key = ?", until, until, key)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key))
+}
+
+func (s *Sqlite) GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	throttle, err := scanThrottle(s.Db.QueryRowContext(ctx, "SELECT "+throttleColumns+" FROM login_throttles WHERE throttle_key = ?", key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.LoginThrottle{}, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key)
+		}
+		return models.LoginThrottle{}, dbError(err)
+	}
+	return throttle, nil
+}
+
+func (s *Sqlite) GetLockedLogins(ctx context.Context, at time.Time) ([]models.LoginThrottle, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, "SELECT "+throttleColumns+" FROM login_throttles WHERE locked_until > ? ORDER BY throttle_key", at.UTC())
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var throttles []models.LoginThrottle
+	for rows.Next() {
+		throttle, err := scanThrottle(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		throttles = append(throttles, throttle)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	return throttles, nil
+}
+
+func (s *Sqlite) ClearLoginFailures(ctx context.Context, key string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "DELETE FROM login_throttles WHERE throttle_key = ?", key)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no failed logins counted against %s", key))
+}
+
+func (s *Sqlite) DeleteExpiredLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "DELETE FROM login_throttles WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return 0, dbError(err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// Token
+//
+// Times are written from Go in UTC rather than with CURRENT_TIMESTAMP, so
+// that they compare correctly with the expiry times written alongside them.
+
+// Tokens issued before refresh tokens existed have no family.
+const tokenColumns = "jti, COALESCE(family, ''), user_type, user_id, issued_at, expires_at, revoked_at"
+
+const refreshTokenColumns = "id, token_hash, family, user_type, user_id, issued_at, expires_at, used_at, revoked_at"
+
+func scanRefreshToken(row scanner) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := row.Scan(&token.ID, &token.Hash, &token.Family, &token.UserType, &token.UserID, &token.IssuedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	return token, err
+}
+
+func (s *Sqlite) CreateToken(ctx context.Context, token models.Token) error {
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, "INSERT INTO tokens (jti, family, user_type, user_id, issued_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token.JTI, token.Family, token.UserType, token.UserID, token.IssuedAt.UTC(), token.ExpiresAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return storage.Errorf(storage.ErrConflict, "a token with id %s already exists", token.JTI)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Sqlite) GetToken(ctx context.Context, jti string) (models.Token, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var token models.Token
+	err := s.Db.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM tokens WHERE jti = ?", jti).
+		Scan(&token.JTI, &token.Family, &token.UserType, &token.UserID, &token.IssuedAt, &token.ExpiresAt, &token.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Token{}, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti)
+		}
+		return models.Token{}, dbError(err)
+	}
+	return token, nil
+}
+
+func (s *Sqlite) RevokeToken(ctx context.Context, jti string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "UPDATE tokens SET revoked_at = COALESCE(revoked_at, ?) WHERE jti = ?", time.Now().UTC(), jti)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrNotFound, "no token with id %s", jti))
+}
+
+func (s *Sqlite) UseToken(ctx context.Context, jti string) (models.Token, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	result, err := s.Db.ExecContext(ctx, "UPDATE tokens SET revoked_at = ? WHERE jti = ? AND revoked_at IS NULL AND expires_at > ?", now, jti, now)
+	if err != nil {
+		return models.Token{}, dbError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.Token{}, dbError(err)
+	}
+
+	token, err := s.GetToken(ctx, jti)
+	if err != nil || rowsAffected == 1 {
+		return token, err
+	}
+	if token.Revoked() {
+		return models.Token{}, storage.Errorf(storage.ErrConflict, "token %s was already used or revoked", jti)
+	}
+	return models.Token{}, storage.Errorf(storage.ErrInvalid, "token %s has expired", jti)
+}
+
+func (s *Sqlite) RevokeUserTokens(ctx context.Context, userType models.UserType, userID int64) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokens(ctx, tx, time.Now().UTC(), "user_type = ? AND user_id = ?", userType, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return revoked, nil
+}
+
+func (s *Sqlite) RevokeTokenFamily(ctx context.Context, family string) (int64, error) {
+	if family == "" {
+		return 0, storage.Errorf(storage.ErrInvalid, "token family must not be empty")
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeTokens(ctx, tx, time.Now().UTC(), "family = ?", family)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return revoked, nil
+}
+
+func (s *Sqlite) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, table := range []string{"tokens", "refresh_tokens", "password_resets"} {
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at < ?", before.UTC())
+		if err != nil {
+			return 0, dbError(err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, dbError(err)
+		}
+		deleted += rowsAffected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return deleted, nil
+}
+
+func (s *Sqlite) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if !token.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", token.UserType)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := insertRefreshToken(ctx, s.Db, token)
+	return err
+}
+
+func (s *Sqlite) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanRefreshToken(tx.QueryRowContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = ?", hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.RefreshToken{}, storage.Errorf(storage.ErrNotFound, "unknown refresh token")
+		}
+		return models.RefreshToken{}, dbError(err)
+	}
+
+	now := time.Now().UTC()
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		if _, err := revokeTokens(ctx, tx, now, "family = ?", current.Family); err != nil {
+			return models.RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return models.RefreshToken{}, dbError(err)
+		}
+		return models.RefreshToken{}, storage.Errorf(storage.ErrConflict, "refresh token was already used; every token of its login has been revoked")
+	}
+	if !current.ExpiresAt.After(now) {
+		return models.RefreshToken{}, storage.Errorf(storage.ErrInvalid, "refresh token has expired")
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ?", now, current.ID); err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+
+	next.Family = current.Family
+	next.UserType = current.UserType
+	next.UserID = current.UserID
+	next.ID, err = insertRefreshToken(ctx, tx, next)
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.RefreshToken{}, dbError(err)
+	}
+	return next, nil
+}
+
+// execer is what *sql.DB and *sql.Tx have in common for writes.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertRefreshToken(ctx context.Context, e execer, token models.RefreshToken) (int64, error) {
+	result, err := e.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, family, user_type, user_id, issued_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token.Hash, token.Family, token.UserType, token.UserID, token.IssuedAt.UTC(), token.ExpiresAt.UTC())
+	if err != nil {
+		err = dbError(err)
+		if errors.Is(err, storage.ErrConflict) {
+			return 0, storage.Errorf(storage.ErrConflict, "refresh token already exists")
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return id, nil
+}
+
+// revokeTokens revokes the unexpired access and refresh tokens matching
+// where, which both tables must understand, and reports how many.
+func revokeTokens(ctx context.Context, tx *sql.Tx, now time.Time, where string, args ...any) (int64, error) {
+	var revoked int64
+	for _, table := range []string{"tokens", "refresh_tokens"} {
+		result, err := tx.ExecContext(ctx, "UPDATE "+table+" SET revoked_at = ? WHERE "+where+" AND revoked_at IS NULL AND expires_at > ?",
+			append(append([]any{now}, args...), now)...)
+		if err != nil {
+			return 0, dbError(err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, dbError(err)
+		}
+		revoked += rowsAffected
+	}
+	return revoked, nil
+}
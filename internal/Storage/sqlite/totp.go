@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
+
+// TOTP
+
+func (s *Sqlite) CreateTOTP(ctx context.Context, totp models.TOTP) error {
+	if !totp.UserType.Valid() {
+		return storage.Errorf(storage.ErrInvalid, "unknown user type %q", totp.UserType)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, `INSERT INTO totp_secrets (user_type, user_id, secret, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_type, user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at, last_used_step = 0
+		WHERE totp_secrets.confirmed_at IS NULL`,
+		string(totp.UserType), totp.UserID, totp.Secret, totp.CreatedAt.UTC())
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up"))
+}
+
+func (s *Sqlite) GetTOTP(ctx context.Context, userType models.UserType, userID int64) (models.TOTP, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	totp := models.TOTP{UserType: userType, UserID: userID}
+	err := s.Db.QueryRowContext(ctx, "SELECT secret, created_at, confirmed_at, last_used_step FROM totp_secrets WHERE user_type = ? AND user_id = ?", string(userType), userID).
+		Scan(&totp.Secret, &totp.CreatedAt, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+		}
+		return models.TOTP{}, dbError(err)
+	}
+	return totp, nil
+}
+
+func (s *Sqlite) ConfirmTOTP(ctx context.Context, userType models.UserType, userID int64, step int64, recoveryHashes []string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	var confirmedAt *time.Time
+	err = tx.QueryRowContext(ctx, "SELECT confirmed_at FROM totp_secrets WHERE user_type = ? AND user_id = ?", string(userType), userID).Scan(&confirmedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")
+		}
+		return dbError(err)
+	}
+	if confirmedAt != nil {
+		return storage.Errorf(storage.ErrConflict, "two-factor authentication is already set up")
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE totp_secrets SET confirmed_at = ?, last_used_step = ? WHERE user_type = ? AND user_id = ?",
+		time.Now().UTC(), step, string(userType), userID); err != nil {
+		return dbError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_type = ? AND user_id = ?", string(userType), userID); err != nil {
+		return dbError(err)
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_type, user_id, code_hash) VALUES (?, ?, ?)", string(userType), userID, hash); err != nil {
+			return dbError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+func (s *Sqlite) UseTOTPStep(ctx context.Context, userType models.UserType, userID int64, step int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.Db.ExecContext(ctx, "UPDATE totp_secrets SET last_used_step = ? WHERE user_type = ? AND user_id = ? AND last_used_step < ?",
+		step, string(userType), userID, step)
+	if err != nil {
+		return dbError(err)
+	}
+	return updated(result, storage.Errorf(storage.ErrConflict, "authentication code was already used"))
+}
+
+func (s *Sqlite) UseRecoveryCode(ctx context.Context, userType models.UserType, userID int64, hash string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE recovery_codes SET used_at = ? WHERE user_type = ? AND user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), string(userType), userID, hash)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "unknown recovery code")); err != nil {
+		return 0, err
+	}
+
+	var remaining int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_type = ? AND user_id = ? AND used_at IS NULL", string(userType), userID).Scan(&remaining)
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError(err)
+	}
+	return remaining, nil
+}
+
+func (s *Sqlite) DeleteTOTP(ctx context.Context, userType models.UserType, userID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM totp_secrets WHERE user_type = ? AND user_id = ?", string(userType), userID)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := updated(result, storage.Errorf(storage.ErrNotFound, "two-factor authentication is not set up")); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_type = ? AND user_id = ?", string(userType), userID); err != nil {
+		return dbError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
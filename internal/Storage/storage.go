@@ -1,28 +1,177 @@
 package storage
 
-import "github/Bharatjawa2/CtrlB_Assignment/models"
+import (
+	"context"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"time"
+)
 
 type Storage interface{
 	// Student
-	CreateStudent(name string,email string,password string,age int,gender string,phoneNumber string,DOB string,Address string)(int64,error)
-	LoginStudent(email string,password string) (models.Student,error)
-	GetStudentByEmail(email string) (models.Student, error)
-	GetStudentById(id int64) (models.Student,error)
-	GetAllStudents() ([]models.Student, error)
-	UpdateStudent(id int64, student models.Student) (error)
-	Logout()(error)
+	CreateStudent(ctx context.Context, name string,email string,password string,age int,gender string,phoneNumber string,DOB string,Address string)(int64,error)
+	LoginStudent(ctx context.Context, email string,password string) (models.Student,error)
+	GetStudentByEmail(ctx context.Context, email string) (models.Student, error)
+	GetStudentById(ctx context.Context, id int64) (models.Student,error)
+	GetAllStudents(ctx context.Context) ([]models.Student, error)
+	// UpdateStudent keeps the student's password, and their verified state unless the email changes.
+	UpdateStudent(ctx context.Context, id int64, student models.Student) (error)
+	// ChangeStudentPassword sets the student's password, uses up their password reset tokens, and
+	// revokes their sessions other than those of the login family keepFamily.
+	ChangeStudentPassword(ctx context.Context, id int64, passwordHash string, keepFamily string) error
+	// VerifyStudentEmail marks the student verified, failing with ErrNotFound unless the
+	// student still has that email.
+	VerifyStudentEmail(ctx context.Context, id int64, email string) error
 
 
 	// Course
-	CreateCourse(name string,description string,duration string,credits int,price int) (int64,error)
-	GetCourseById(id int64) (models.Course,error)
-	GetAllCourses() ([]models.Course, error)
-	UpdateCourse(id int64, course models.Course) (error)
-	SearchCoursesByName(name string) ([]models.Course, error)
+	CreateCourse(ctx context.Context, name string,description string,duration string,credits int,price int,capacity int) (int64,error)
+	GetCourseById(ctx context.Context, id int64) (models.Course,error)
+	GetAllCourses(ctx context.Context) ([]models.Course, error)
+	UpdateCourse(ctx context.Context, id int64, course models.Course) (error)
+	SearchCoursesByName(ctx context.Context, name string) ([]models.Course, error)
 
 	// Enrollment
-	EnrollStudent(studentID int64, courseID int64)(int64,error)
-	UnenrollStudent(studentID int64, courseID int64) error
-	GetCoursesByStudentID(studentID int64) ([]models.Course, error)
-	GetStudentsByCourseID(courseID int64) ([]models.Student, error)
-}
\ No newline at end of file
+	// EnrollStudent puts the student on the course's waitlist instead when every seat is taken.
+	EnrollStudent(ctx context.Context, studentID int64, courseID int64)(models.Enrollment,error)
+	UnenrollStudent(ctx context.Context, studentID int64, courseID int64) error
+	GetEnrollmentById(ctx context.Context, id int64) (models.Enrollment, error)
+	GetEnrollmentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Enrollment, error)
+	// UpdateEnrollmentStatus fails with ErrConflict when the state machine does not allow the change.
+	UpdateEnrollmentStatus(ctx context.Context, id int64, status models.EnrollmentStatus) (models.Enrollment, error)
+	// Without statuses, enrollments in every status count.
+	GetCoursesByStudentID(ctx context.Context, studentID int64, statuses ...models.EnrollmentStatus) ([]models.Course, error)
+	GetStudentsByCourseID(ctx context.Context, courseID int64, statuses ...models.EnrollmentStatus) ([]models.Student, error)
+
+	// Waitlist
+	GetWaitlistByStudentID(ctx context.Context, studentID int64) ([]models.WaitlistEntry, error)
+	GetWaitlistByCourseID(ctx context.Context, courseID int64) ([]models.WaitlistEntry, error)
+	GetWaitlistPosition(ctx context.Context, studentID int64, courseID int64) (models.WaitlistEntry, error)
+
+	// Application
+	SubmitApplication(ctx context.Context, studentID int64, courseID int64, answers map[string]string) (models.Application, error)
+	// GetApplicationById is the only read that fills in the application's reviews.
+	GetApplicationById(ctx context.Context, id int64) (models.Application, error)
+	GetApplicationsByStudentID(ctx context.Context, studentID int64) ([]models.Application, error)
+	// Without statuses, applications in every status are listed.
+	GetApplications(ctx context.Context, statuses ...models.ApplicationStatus) ([]models.Application, error)
+	// AssignReviewer puts a submitted application under review.
+	AssignReviewer(ctx context.Context, applicationID int64, reviewer string) (models.ApplicationReview, error)
+	// ReviewApplication records an assigned reviewer's score and comment, replacing earlier ones.
+	ReviewApplication(ctx context.Context, applicationID int64, reviewer string, score int, comment string) (models.ApplicationReview, error)
+	// DecideApplication fails with ErrConflict when the state machine does not allow the decision.
+	DecideApplication(ctx context.Context, id int64, decision models.ApplicationStatus, note string) (models.Application, error)
+
+	// Admin
+	CreateAdmin(ctx context.Context, name string, email string, password string) (int64, error)
+	// CreateFirstAdmin creates a superadmin only while there are no admins, and reports whether it did.
+	CreateFirstAdmin(ctx context.Context, name string, email string, password string) (bool, error)
+	GetAdminById(ctx context.Context, id int64) (models.Admin, error)
+	GetAdminByEmail(ctx context.Context, email string) (models.Admin, error)
+	GetAllAdmins(ctx context.Context) ([]models.Admin, error)
+	// SetAdminDisabled and DeleteAdmin fail with ErrConflict rather than leave no enabled admin.
+	SetAdminDisabled(ctx context.Context, id int64, disabled bool) error
+	DeleteAdmin(ctx context.Context, id int64) error
+
+	// Role
+	// Changes that would leave no enabled admin able to manage roles fail with ErrConflict,
+	// as do changes to built-in roles.
+	CreateRole(ctx context.Context, name string, description string, permissions []models.Permission) (models.Role, error)
+	GetRoleByName(ctx context.Context, name string) (models.Role, error)
+	GetAllRoles(ctx context.Context) ([]models.Role, error)
+	SetRolePermissions(ctx context.Context, name string, permissions []models.Permission) (models.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	GetAdminRoles(ctx context.Context, adminID int64) ([]models.Role, error)
+	AssignRole(ctx context.Context, adminID int64, role string) error
+	UnassignRole(ctx context.Context, adminID int64, role string) error
+	// GetAdminPermissions is the union of the permissions of the admin's roles.
+	GetAdminPermissions(ctx context.Context, adminID int64) ([]models.Permission, error)
+
+	// Token
+	// Every issued access and refresh token is recorded so it can be revoked before it expires.
+	CreateToken(ctx context.Context, token models.Token) error
+	GetToken(ctx context.Context, jti string) (models.Token, error)
+	// RevokeToken keeps the first revocation time of a token revoked twice.
+	RevokeToken(ctx context.Context, jti string) error
+	// UseToken revokes the token jti and returns it, so that a single-use token works once. An
+	// unknown token fails with ErrNotFound, an expired one with ErrInvalid, and one already used
+	// or revoked with ErrConflict.
+	UseToken(ctx context.Context, jti string) (models.Token, error)
+	// RevokeUserTokens revokes every unexpired access and refresh token of a user and reports how many.
+	RevokeUserTokens(ctx context.Context, userType models.UserType, userID int64) (int64, error)
+	// RevokeTokenFamily revokes every unexpired access and refresh token of one login and reports how many.
+	RevokeTokenFamily(ctx context.Context, family string) (int64, error)
+	// DeleteExpiredTokens removes access, refresh and password reset tokens that expired before
+	// the given time.
+	DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error)
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) error
+	// RotateRefreshToken marks the refresh token with hash used and records next in its family
+	// for the same user, returning next as stored. An unknown token fails with ErrNotFound and an
+	// expired one with ErrInvalid. A used or revoked token fails with ErrConflict after its whole
+	// family has been revoked.
+	RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken) (models.RefreshToken, error)
+
+	// Password reset
+	// CreatePasswordReset fails with ErrNotFound when the student does not exist.
+	CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error
+	// ResetPassword sets the password of the student whose reset token has hash, uses up that
+	// token and the student's other reset tokens, revokes the student's sessions, and returns
+	// the student's id. An unknown token fails with ErrNotFound; a used or expired one with
+	// ErrInvalid.
+	ResetPassword(ctx context.Context, hash string, passwordHash string) (int64, error)
+
+	// Login throttle
+	// RecordLoginFailure counts a failed login against key and returns the throttle after it. A
+	// throttle that expired before at starts over. Either way it now expires window after at.
+	RecordLoginFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginThrottle, error)
+	// LockLogin refuses logins against key until the given time, keeping the throttle until then.
+	// A key without failures fails with ErrNotFound.
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// GetLoginThrottle fails with ErrNotFound when no failures are counted against key.
+	GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error)
+	// GetLockedLogins lists the throttles locked at the given time, by key.
+	GetLockedLogins(ctx context.Context, at time.Time) ([]models.LoginThrottle, error)
+	// ClearLoginFailures forgets the failures and lock of key, failing with ErrNotFound when there are none.
+	ClearLoginFailures(ctx context.Context, key string) error
+	// DeleteExpiredLoginThrottles removes the throttles that expired before the given time.
+	DeleteExpiredLoginThrottles(ctx context.Context, before time.Time) (int64, error)
+
+	// Audit log
+	CreateAuditEntry(ctx context.Context, entry models.AuditEntry) (int64, error)
+	// GetAuditEntries lists up to limit entries, newest first. Without events, entries of every event are listed.
+	GetAuditEntries(ctx context.Context, limit int, events ...models.AuditEvent) ([]models.AuditEntry, error)
+
+	// TOTP
+	// CreateTOTP stores a new unconfirmed secret for the user, replacing an unconfirmed one. A
+	// user whose secret is confirmed fails with ErrConflict.
+	CreateTOTP(ctx context.Context, totp models.TOTP) error
+	GetTOTP(ctx context.Context, userType models.UserType, userID int64) (models.TOTP, error)
+	// ConfirmTOTP confirms the user's secret with the code of step and replaces their recovery
+	// codes with the given hashes. A secret that is already confirmed fails with ErrConflict.
+	ConfirmTOTP(ctx context.Context, userType models.UserType, userID int64, step int64, recoveryHashes []string) error
+	// UseTOTPStep records that the code of step was accepted, failing with ErrConflict unless
+	// step is later than the last one, so every code works once.
+	UseTOTPStep(ctx context.Context, userType models.UserType, userID int64, step int64) error
+	// UseRecoveryCode uses up the user's recovery code with hash and reports how many remain.
+	// An unknown or used code fails with ErrNotFound.
+	UseRecoveryCode(ctx context.Context, userType models.UserType, userID int64, hash string) (int, error)
+	// DeleteTOTP removes the user's secret and recovery codes.
+	DeleteTOTP(ctx context.Context, userType models.UserType, userID int64) error
+
+	// API key
+	// CreateAPIKey stores a new key and returns it as stored. Unknown permissions fail with
+	// ErrInvalid, an unknown creator with ErrNotFound. Keys are deleted with their creator.
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	// GetAPIKeyByHash returns revoked and expired keys too.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// RevokeAPIKey keeps the first revocation time of a key revoked twice.
+	RevokeAPIKey(ctx context.Context, id int64) error
+	// TouchAPIKey records that the key was used at the given time.
+	TouchAPIKey(ctx context.Context, id int64, at time.Time) error
+
+	// External identity
+	// LinkIdentity links an external identity to a user. An identity that is already linked fails
+	// with ErrConflict, an unknown user with ErrNotFound. Identities are deleted with their admin.
+	LinkIdentity(ctx context.Context, identity models.ExternalIdentity) error
+	GetIdentity(ctx context.Context, issuer string, subject string) (models.ExternalIdentity, error)
+}
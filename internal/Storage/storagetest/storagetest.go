@@ -0,0 +1,3057 @@
+// Package storagetest is the behavioural contract of storage.Storage. Every
+// backend runs it against itself from its own tests:
+//
+//	func TestStorageContract(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			return memory.New()
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Factory returns a new, empty storage for a single test.
+type Factory func(t *testing.T) storage.Storage
+
+// Run executes the whole contract, giving every case a fresh storage.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Storage)
+	}{
+		{"CreateAndGetStudent", testCreateAndGetStudent},
+		{"StudentNotFound", testStudentNotFound},
+		{"GetAllStudents", testGetAllStudents},
+		{"UpdateStudent", testUpdateStudent},
+		{"VerifyStudentEmail", testVerifyStudentEmail},
+		{"LoginStudent", testLoginStudent},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"CreateAndGetCourse", testCreateAndGetCourse},
+		{"CourseNotFound", testCourseNotFound},
+		{"GetAllCourses", testGetAllCourses},
+		{"UpdateCourse", testUpdateCourse},
+		{"SearchCoursesByName", testSearchCoursesByName},
+		{"EnrollAndList", testEnrollAndList},
+		{"UnenrollStudent", testUnenrollStudent},
+		{"UnenrollNotEnrolled", testUnenrollNotEnrolled},
+		{"DuplicateEnrollment", testDuplicateEnrollment},
+		{"ConcurrentDuplicateEnrollments", testConcurrentDuplicateEnrollments},
+		{"EnrollmentReferences", testEnrollmentReferences},
+		{"ConcurrentEnrollments", testConcurrentEnrollments},
+		{"NegativeCapacity", testNegativeCapacity},
+		{"Waitlist", testWaitlist},
+		{"LeaveWaitlist", testLeaveWaitlist},
+		{"CapacityIncreasePromotes", testCapacityIncreasePromotes},
+		{"ConcurrentEnrollmentsAtCapacity", testConcurrentEnrollmentsAtCapacity},
+		{"EnrollmentLifecycle", testEnrollmentLifecycle},
+		{"IllegalStatusChanges", testIllegalStatusChanges},
+		{"RejectAndReenroll", testRejectAndReenroll},
+		{"UnenrollKeepsHistory", testUnenrollKeepsHistory},
+		{"FilterByStatus", testFilterByStatus},
+		{"FreedSeatPromotes", testFreedSeatPromotes},
+		{"ApplicationLifecycle", testApplicationLifecycle},
+		{"ApplicationRules", testApplicationRules},
+		{"IllegalDecisions", testIllegalDecisions},
+		{"ListApplications", testListApplications},
+		{"CreateAndGetAdmin", testCreateAndGetAdmin},
+		{"DuplicateAdminEmail", testDuplicateAdminEmail},
+		{"CreateFirstAdmin", testCreateFirstAdmin},
+		{"DisableAndDeleteAdmins", testDisableAndDeleteAdmins},
+		{"BuiltInRoles", testBuiltInRoles},
+		{"ManageRoles", testManageRoles},
+		{"AssignRoles", testAssignRoles},
+		{"FirstAdminIsSuperadmin", testFirstAdminIsSuperadmin},
+		{"KeepRoleManager", testKeepRoleManager},
+		{"CreateAndGetToken", testCreateAndGetToken},
+		{"RevokeToken", testRevokeToken},
+		{"UseToken", testUseToken},
+		{"RevokeUserTokens", testRevokeUserTokens},
+		{"DeleteExpiredTokens", testDeleteExpiredTokens},
+		{"CreateRefreshToken", testCreateRefreshToken},
+		{"RotateRefreshToken", testRotateRefreshToken},
+		{"RefreshTokenReuse", testRefreshTokenReuse},
+		{"RevokeTokenFamily", testRevokeTokenFamily},
+		{"RevokeUserRefreshTokens", testRevokeUserRefreshTokens},
+		{"DeleteExpiredRefreshTokens", testDeleteExpiredRefreshTokens},
+		{"CreatePasswordReset", testCreatePasswordReset},
+		{"ResetPassword", testResetPassword},
+		{"ResetPasswordRefusals", testResetPasswordRefusals},
+		{"ChangeStudentPassword", testChangeStudentPassword},
+		{"LoginThrottle", testLoginThrottle},
+		{"LockLogin", testLockLogin},
+		{"DeleteExpiredLoginThrottles", testDeleteExpiredLoginThrottles},
+		{"AuditLog", testAuditLog},
+		{"TOTPEnrollment", testTOTPEnrollment},
+		{"UseTOTPStep", testUseTOTPStep},
+		{"RecoveryCodes", testRecoveryCodes},
+		{"DeleteTOTP", testDeleteTOTP},
+		{"APIKeys", testAPIKeys},
+		{"RevokeAPIKey", testRevokeAPIKey},
+		{"DeleteAdminDeletesAPIKeys", testDeleteAdminDeletesAPIKeys},
+		{"Identities", testIdentities},
+		{"DeleteAdminUnlinksIdentities", testDeleteAdminUnlinksIdentities},
+		{"CanceledContext", testCanceledContext},
+		{"ExpiredDeadline", testExpiredDeadline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+func newStudent(email string) models.Student {
+	return models.Student{
+		FullName:    "Student " + email,
+		Email:       email,
+		Password:    "not-a-real-hash",
+		Age:         21,
+		Gender:      "female",
+		PhoneNumber: "9876543210",
+		DOB:         "2004-01-02",
+		Address:     "Indore",
+	}
+}
+
+func createStudent(t *testing.T, s storage.Storage, student models.Student) int64 {
+	t.Helper()
+	id, err := s.CreateStudent(t.Context(), student.FullName, student.Email, student.Password, student.Age, student.Gender, student.PhoneNumber, student.DOB, student.Address)
+	if err != nil {
+		t.Fatalf("CreateStudent(%s): %v", student.Email, err)
+	}
+	if id <= 0 {
+		t.Fatalf("CreateStudent(%s) returned id %d", student.Email, id)
+	}
+	return id
+}
+
+func newCourse(name string) models.Course {
+	return models.Course{
+		Name:        name,
+		Description: "About " + name,
+		Duration:    "3 months",
+		Credits:     4,
+		Price:       999,
+	}
+}
+
+func createCourse(t *testing.T, s storage.Storage, course models.Course) int64 {
+	t.Helper()
+	id, err := s.CreateCourse(t.Context(), course.Name, course.Description, course.Duration, course.Credits, course.Price, course.Capacity)
+	if err != nil {
+		t.Fatalf("CreateCourse(%s): %v", course.Name, err)
+	}
+	if id <= 0 {
+		t.Fatalf("CreateCourse(%s) returned id %d", course.Name, id)
+	}
+	return id
+}
+
+// enroll seats the student and fails the test if they were waitlisted instead.
+func enroll(t *testing.T, s storage.Storage, studentID int64, courseID int64) int64 {
+	t.Helper()
+	enrollment, err := s.EnrollStudent(t.Context(), studentID, courseID)
+	if err != nil {
+		t.Fatalf("EnrollStudent(%d, %d): %v", studentID, courseID, err)
+	}
+	if enrollment.Waitlisted {
+		t.Fatalf("EnrollStudent(%d, %d) waitlisted the student at position %d", studentID, courseID, enrollment.Position)
+	}
+	if enrollment.ID <= 0 || enrollment.StudentID != studentID || enrollment.CourseID != courseID || enrollment.Status != models.EnrollmentPending {
+		t.Fatalf("EnrollStudent(%d, %d) = %+v", studentID, courseID, enrollment)
+	}
+	return enrollment.ID
+}
+
+// waitlist enrolls the student into a full course and returns their
+// position in its waitlist.
+func waitlist(t *testing.T, s storage.Storage, studentID int64, courseID int64) int {
+	t.Helper()
+	enrollment, err := s.EnrollStudent(t.Context(), studentID, courseID)
+	if err != nil {
+		t.Fatalf("EnrollStudent(%d, %d): %v", studentID, courseID, err)
+	}
+	if !enrollment.Waitlisted {
+		t.Fatalf("EnrollStudent(%d, %d) took a seat, want the student waitlisted", studentID, courseID)
+	}
+	return enrollment.Position
+}
+
+func waitlistStudentIDs(entries []models.WaitlistEntry) []int64 {
+	ids := []int64{}
+	for _, entry := range entries {
+		ids = append(ids, entry.StudentID)
+	}
+	return ids
+}
+
+func studentIDs(students []models.Student) []int64 {
+	ids := []int64{}
+	for _, student := range students {
+		ids = append(ids, student.Id)
+	}
+	return ids
+}
+
+func courseIDs(courses []models.Course) []int64 {
+	ids := []int64{}
+	for _, course := range courses {
+		ids = append(ids, course.ID)
+	}
+	return ids
+}
+
+func sameIDs(got []int64, want ...int64) bool {
+	return fmt.Sprint(got) == fmt.Sprint(append([]int64{}, want...))
+}
+
+// Students
+
+func testCreateAndGetStudent(t *testing.T, s storage.Storage) {
+	want := newStudent("asha@example.com")
+	id := createStudent(t, s, want)
+	want.Id = id
+
+	byID, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	if byID != want {
+		t.Errorf("GetStudentById = %+v, want %+v", byID, want)
+	}
+
+	byEmail, err := s.GetStudentByEmail(t.Context(), want.Email)
+	if err != nil {
+		t.Fatalf("GetStudentByEmail: %v", err)
+	}
+	if byEmail != want {
+		t.Errorf("GetStudentByEmail = %+v, want %+v", byEmail, want)
+	}
+
+	otherID := createStudent(t, s, newStudent("ravi@example.com"))
+	if otherID == id {
+		t.Errorf("second student reused id %d", id)
+	}
+}
+
+func testStudentNotFound(t *testing.T, s storage.Storage) {
+	createStudent(t, s, newStudent("asha@example.com"))
+
+	if _, err := s.GetStudentById(t.Context(), 9999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetStudentById of a missing id = %v, want storage.ErrNotFound", err)
+	}
+	if _, err := s.GetStudentByEmail(t.Context(), "nobody@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetStudentByEmail of a missing email = %v, want storage.ErrNotFound", err)
+	}
+	if err := s.UpdateStudent(t.Context(), 9999, newStudent("nobody@example.com")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateStudent of a missing id = %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testGetAllStudents(t *testing.T, s storage.Storage) {
+	students, err := s.GetAllStudents(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllStudents on empty storage: %v", err)
+	}
+	if len(students) != 0 {
+		t.Fatalf("GetAllStudents on empty storage returned %d students", len(students))
+	}
+
+	first := createStudent(t, s, newStudent("asha@example.com"))
+	second := createStudent(t, s, newStudent("ravi@example.com"))
+
+	students, err = s.GetAllStudents(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllStudents: %v", err)
+	}
+	if got := studentIDs(students); !sameIDs(got, first, second) {
+		t.Errorf("GetAllStudents ids = %v, want [%d %d]", got, first, second)
+	}
+}
+
+func testUpdateStudent(t *testing.T, s storage.Storage) {
+	id := createStudent(t, s, newStudent("asha@example.com"))
+	otherID := createStudent(t, s, newStudent("ravi@example.com"))
+
+	updated := newStudent("asha.k@example.com")
+	updated.FullName = "Asha K"
+	updated.Age = 22
+	updated.Address = "Pune"
+	updated.Password = "ignored"
+	if err := s.UpdateStudent(t.Context(), id, updated); err != nil {
+		t.Fatalf("UpdateStudent: %v", err)
+	}
+
+	got, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	// The password only changes through ChangeStudentPassword.
+	updated.Id = id
+	updated.Password = "not-a-real-hash"
+	if got != updated {
+		t.Errorf("after UpdateStudent got %+v, want %+v", got, updated)
+	}
+
+	other, err := s.GetStudentById(t.Context(), otherID)
+	if err != nil {
+		t.Fatalf("GetStudentById(other): %v", err)
+	}
+	if other.Email != "ravi@example.com" {
+		t.Errorf("UpdateStudent changed another student: %+v", other)
+	}
+}
+
+func verified(t *testing.T, s storage.Storage, id int64) bool {
+	t.Helper()
+	student, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById(%d): %v", id, err)
+	}
+	return student.Verified
+}
+
+func testVerifyStudentEmail(t *testing.T, s storage.Storage) {
+	id := createStudent(t, s, newStudent("asha@example.com"))
+	otherID := createStudent(t, s, newStudent("ravi@example.com"))
+	if verified(t, s, id) {
+		t.Fatal("a new student is already verified")
+	}
+
+	if err := s.VerifyStudentEmail(t.Context(), id, "ravi@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("VerifyStudentEmail with another email error = %v, want ErrNotFound", err)
+	}
+	if err := s.VerifyStudentEmail(t.Context(), id+otherID, "asha@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("VerifyStudentEmail of a missing student error = %v, want ErrNotFound", err)
+	}
+	if verified(t, s, id) || verified(t, s, otherID) {
+		t.Fatal("a refused VerifyStudentEmail verified a student")
+	}
+
+	if err := s.VerifyStudentEmail(t.Context(), id, "asha@example.com"); err != nil {
+		t.Fatalf("VerifyStudentEmail: %v", err)
+	}
+	if err := s.VerifyStudentEmail(t.Context(), id, "asha@example.com"); err != nil {
+		t.Errorf("verifying twice: %v", err)
+	}
+	if !verified(t, s, id) || verified(t, s, otherID) {
+		t.Fatal("VerifyStudentEmail verified the wrong students")
+	}
+
+	updated := newStudent("asha@example.com")
+	updated.FullName = "Asha K"
+	if err := s.UpdateStudent(t.Context(), id, updated); err != nil {
+		t.Fatalf("UpdateStudent: %v", err)
+	}
+	if !verified(t, s, id) {
+		t.Error("UpdateStudent with the same email unverified the student")
+	}
+	updated.Email = "asha.k@example.com"
+	if err := s.UpdateStudent(t.Context(), id, updated); err != nil {
+		t.Fatalf("UpdateStudent: %v", err)
+	}
+	if verified(t, s, id) {
+		t.Error("a changed email is still verified")
+	}
+}
+
+func testLoginStudent(t *testing.T, s storage.Storage) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := newStudent("asha@example.com")
+	student.Password = string(hash)
+	id := createStudent(t, s, student)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  bool
+	}{
+		{"valid credentials", "asha@example.com", "secret123", false},
+		{"wrong password", "asha@example.com", "secret124", true},
+		{"unknown email", "ravi@example.com", "secret123", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.LoginStudent(t.Context(), tt.email, tt.password)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LoginStudent succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoginStudent: %v", err)
+			}
+			if got.Id != id {
+				t.Errorf("LoginStudent returned student %d, want %d", got.Id, id)
+			}
+		})
+	}
+}
+
+// Courses
+
+func testDuplicateEmail(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent(" Asha@Example.com "))
+
+	got, err := s.GetStudentById(t.Context(), asha)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	if got.Email != "asha@example.com" {
+		t.Errorf("stored email = %q, want it normalized to %q", got.Email, "asha@example.com")
+	}
+	if got, err := s.GetStudentByEmail(t.Context(), "ASHA@example.COM"); err != nil || got.Id != asha {
+		t.Errorf("GetStudentByEmail with different case = %d, %v, want %d", got.Id, err, asha)
+	}
+
+	for _, email := range []string{"asha@example.com", "ASHA@EXAMPLE.COM", "  asha@example.com"} {
+		student := newStudent(email)
+		_, err := s.CreateStudent(t.Context(), student.FullName, student.Email, student.Password, student.Age, student.Gender, student.PhoneNumber, student.DOB, student.Address)
+		if !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("CreateStudent(%q) error = %v, want ErrConflict", email, err)
+		}
+	}
+
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	update := newStudent("Asha@example.com")
+	if err := s.UpdateStudent(t.Context(), ravi, update); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("UpdateStudent to a taken email error = %v, want ErrConflict", err)
+	}
+
+	// Keeping one's own email, in any case, is not a conflict.
+	update = newStudent("ASHA@example.com")
+	update.FullName = "Asha K"
+	if err := s.UpdateStudent(t.Context(), asha, update); err != nil {
+		t.Errorf("UpdateStudent keeping own email: %v", err)
+	}
+}
+
+func testCreateAndGetCourse(t *testing.T, s storage.Storage) {
+	want := newCourse("Data Structures")
+	want.Capacity = 40
+	id := createCourse(t, s, want)
+	want.ID = id
+
+	got, err := s.GetCourseById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetCourseById: %v", err)
+	}
+	if got != want {
+		t.Errorf("GetCourseById = %+v, want %+v", got, want)
+	}
+}
+
+func testCourseNotFound(t *testing.T, s storage.Storage) {
+	if _, err := s.GetCourseById(t.Context(), 9999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetCourseById of a missing id = %v, want storage.ErrNotFound", err)
+	}
+	if err := s.UpdateCourse(t.Context(), 9999, newCourse("Nothing")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateCourse of a missing id = %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testGetAllCourses(t *testing.T, s storage.Storage) {
+	courses, err := s.GetAllCourses(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllCourses on empty storage: %v", err)
+	}
+	if len(courses) != 0 {
+		t.Fatalf("GetAllCourses on empty storage returned %d courses", len(courses))
+	}
+
+	first := createCourse(t, s, newCourse("Algorithms"))
+	second := createCourse(t, s, newCourse("Databases"))
+
+	courses, err = s.GetAllCourses(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllCourses: %v", err)
+	}
+	if got := courseIDs(courses); !sameIDs(got, first, second) {
+		t.Errorf("GetAllCourses ids = %v, want [%d %d]", got, first, second)
+	}
+}
+
+func testUpdateCourse(t *testing.T, s storage.Storage) {
+	id := createCourse(t, s, newCourse("Algorithms"))
+
+	updated := newCourse("Advanced Algorithms")
+	updated.Credits = 6
+	updated.Price = 1499
+	updated.Capacity = 30
+	if err := s.UpdateCourse(t.Context(), id, updated); err != nil {
+		t.Fatalf("UpdateCourse: %v", err)
+	}
+
+	got, err := s.GetCourseById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetCourseById: %v", err)
+	}
+	updated.ID = id
+	if got != updated {
+		t.Errorf("after UpdateCourse got %+v, want %+v", got, updated)
+	}
+}
+
+func testSearchCoursesByName(t *testing.T, s storage.Storage) {
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	advanced := createCourse(t, s, newCourse("Advanced Algorithms"))
+	databases := createCourse(t, s, newCourse("Databases"))
+
+	tests := []struct {
+		query   string
+		want    []int64
+		wantErr bool
+	}{
+		{"Algorithms", []int64{algorithms, advanced}, false},
+		{"algo", []int64{algorithms, advanced}, false},
+		{"DATA", []int64{databases}, false},
+		{"Advanced Algorithms", []int64{advanced}, false},
+		{"Compilers", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			courses, err := s.SearchCoursesByName(t.Context(), tt.query)
+			if tt.wantErr {
+				if !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("SearchCoursesByName(%q) = %v, %v, want storage.ErrNotFound for zero matches", tt.query, courseIDs(courses), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SearchCoursesByName(%q): %v", tt.query, err)
+			}
+			if got := courseIDs(courses); !sameIDs(got, tt.want...) {
+				t.Errorf("SearchCoursesByName(%q) ids = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// Enrollment
+
+func testEnrollAndList(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	databases := createCourse(t, s, newCourse("Databases"))
+
+	first := enroll(t, s, asha, algorithms)
+	second := enroll(t, s, asha, databases)
+	enroll(t, s, ravi, databases)
+	if first <= 0 || second <= first {
+		t.Errorf("enrollment ids = %d, %d, want positive and increasing", first, second)
+	}
+
+	courses, err := s.GetCoursesByStudentID(t.Context(), asha)
+	if err != nil {
+		t.Fatalf("GetCoursesByStudentID: %v", err)
+	}
+	if got := courseIDs(courses); !sameIDs(got, algorithms, databases) {
+		t.Errorf("GetCoursesByStudentID(asha) ids = %v, want [%d %d]", got, algorithms, databases)
+	}
+	if courses[0].Name != "Algorithms" {
+		t.Errorf("GetCoursesByStudentID returned course %+v, want the full course row", courses[0])
+	}
+
+	students, err := s.GetStudentsByCourseID(t.Context(), databases)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if got := studentIDs(students); !sameIDs(got, asha, ravi) {
+		t.Errorf("GetStudentsByCourseID(databases) ids = %v, want [%d %d]", got, asha, ravi)
+	}
+	if students[1].Email != "ravi@example.com" {
+		t.Errorf("GetStudentsByCourseID returned student %+v, want the full student row", students[1])
+	}
+
+	none, err := s.GetCoursesByStudentID(t.Context(), ravi+1000)
+	if err != nil {
+		t.Fatalf("GetCoursesByStudentID(unknown): %v", err)
+	}
+	if len(none) != 0 {
+		t.Errorf("GetCoursesByStudentID(unknown) = %v, want none", courseIDs(none))
+	}
+}
+
+func testUnenrollStudent(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	databases := createCourse(t, s, newCourse("Databases"))
+	enroll(t, s, asha, algorithms)
+	enroll(t, s, asha, databases)
+
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); err != nil {
+		t.Fatalf("UnenrollStudent: %v", err)
+	}
+
+	courses, err := s.GetCoursesByStudentID(t.Context(), asha)
+	if err != nil {
+		t.Fatalf("GetCoursesByStudentID: %v", err)
+	}
+	if got := courseIDs(courses); !sameIDs(got, databases) {
+		t.Errorf("after UnenrollStudent courses = %v, want [%d]", got, databases)
+	}
+}
+
+func testUnenrollNotEnrolled(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UnenrollStudent without an enrollment = %v, want storage.ErrNotFound", err)
+	}
+
+	enroll(t, s, asha, algorithms)
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); err != nil {
+		t.Fatalf("UnenrollStudent: %v", err)
+	}
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second UnenrollStudent = %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testDuplicateEnrollment(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	enroll(t, s, asha, algorithms)
+	if _, err := s.EnrollStudent(t.Context(), asha, algorithms); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("second EnrollStudent error = %v, want ErrConflict", err)
+	}
+
+	courses, err := s.GetCoursesByStudentID(t.Context(), asha)
+	if err != nil {
+		t.Fatalf("GetCoursesByStudentID: %v", err)
+	}
+	if !sameIDs(courseIDs(courses), algorithms) {
+		t.Errorf("courses = %v, want [%d]", courseIDs(courses), algorithms)
+	}
+
+	// Once unenrolled, the student may enroll again.
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); err != nil {
+		t.Fatalf("UnenrollStudent: %v", err)
+	}
+	enroll(t, s, asha, algorithms)
+}
+
+func testConcurrentDuplicateEnrollments(t *testing.T, s storage.Storage) {
+	const n = 20
+
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.EnrollStudent(t.Context(), asha, algorithms)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, storage.ErrConflict):
+			t.Errorf("concurrent duplicate EnrollStudent: %v, want ErrConflict", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent duplicate enrollments succeeded, want 1", succeeded)
+	}
+
+	students, err := s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if !sameIDs(studentIDs(students), asha) {
+		t.Errorf("students = %v, want [%d]", studentIDs(students), asha)
+	}
+}
+
+func testEnrollmentReferences(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	tests := []struct {
+		name    string
+		student int64
+		course  int64
+	}{
+		{"unknown student", asha + 1000, algorithms},
+		{"unknown course", asha, algorithms + 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.EnrollStudent(t.Context(), tt.student, tt.course); !errors.Is(err, storage.ErrConstraint) {
+				t.Errorf("EnrollStudent(%d, %d) error = %v, want ErrConstraint", tt.student, tt.course, err)
+			}
+		})
+	}
+}
+
+func testConcurrentEnrollments(t *testing.T, s storage.Storage) {
+	const n = 20
+
+	course := createCourse(t, s, newCourse("Algorithms"))
+	var want []int64
+	for i := 0; i < n; i++ {
+		want = append(want, createStudent(t, s, newStudent(fmt.Sprintf("student%d@example.com", i))))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	ids := make(chan int64, n)
+	for _, student := range want {
+		wg.Add(1)
+		go func(student int64) {
+			defer wg.Done()
+			enrollment, err := s.EnrollStudent(t.Context(), student, course)
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- enrollment.ID
+		}(student)
+	}
+	wg.Wait()
+	close(errs)
+	close(ids)
+
+	for err := range errs {
+		t.Errorf("concurrent EnrollStudent: %v", err)
+	}
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("concurrent enrollments shared id %d", id)
+		}
+		seen[id] = true
+	}
+
+	students, err := s.GetStudentsByCourseID(t.Context(), course)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	got := studentIDs(students)
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if !sameIDs(got, want...) {
+		t.Errorf("after concurrent enrollments students = %v, want %v", got, want)
+	}
+}
+
+// Context
+
+// contextCalls exercises one read and one write of every entity.
+func testNegativeCapacity(t *testing.T, s storage.Storage) {
+	course := newCourse("Algorithms")
+	course.Capacity = -1
+	if _, err := s.CreateCourse(t.Context(), course.Name, course.Description, course.Duration, course.Credits, course.Price, course.Capacity); !errors.Is(err, storage.ErrConstraint) {
+		t.Errorf("CreateCourse with capacity -1 error = %v, want ErrConstraint", err)
+	}
+
+	id := createCourse(t, s, newCourse("Algorithms"))
+	if err := s.UpdateCourse(t.Context(), id, course); !errors.Is(err, storage.ErrConstraint) {
+		t.Errorf("UpdateCourse with capacity -1 error = %v, want ErrConstraint", err)
+	}
+}
+
+func testWaitlist(t *testing.T, s storage.Storage) {
+	course := newCourse("Algorithms")
+	course.Capacity = 2
+	algorithms := createCourse(t, s, course)
+
+	var students []int64
+	for i := 0; i < 5; i++ {
+		students = append(students, createStudent(t, s, newStudent(fmt.Sprintf("student%d@example.com", i))))
+	}
+
+	enroll(t, s, students[0], algorithms)
+	enroll(t, s, students[1], algorithms)
+	for i, student := range students[2:] {
+		if position := waitlist(t, s, student, algorithms); position != i+1 {
+			t.Errorf("student %d waitlisted at position %d, want %d", student, position, i+1)
+		}
+	}
+
+	if _, err := s.EnrollStudent(t.Context(), students[2], algorithms); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("EnrollStudent of a waitlisted student error = %v, want ErrConflict", err)
+	}
+	if _, err := s.EnrollStudent(t.Context(), students[0], algorithms); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("EnrollStudent of an enrolled student into a full course error = %v, want ErrConflict", err)
+	}
+
+	enrolled, err := s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if !sameIDs(studentIDs(enrolled), students[0], students[1]) {
+		t.Errorf("enrolled = %v, want %v", studentIDs(enrolled), students[:2])
+	}
+
+	queue, err := s.GetWaitlistByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetWaitlistByCourseID: %v", err)
+	}
+	if !sameIDs(waitlistStudentIDs(queue), students[2:]...) {
+		t.Errorf("waitlist = %v, want %v", waitlistStudentIDs(queue), students[2:])
+	}
+	for i, entry := range queue {
+		if entry.Position != i+1 || entry.CourseID != algorithms || entry.CreatedAt.IsZero() {
+			t.Errorf("waitlist entry %d = %+v", i, entry)
+		}
+	}
+
+	// Freeing a seat promotes the head of the queue and moves everyone up.
+	if err := s.UnenrollStudent(t.Context(), students[0], algorithms); err != nil {
+		t.Fatalf("UnenrollStudent: %v", err)
+	}
+	enrolled, err = s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if !sameIDs(studentIDs(enrolled), students[1], students[2]) {
+		t.Errorf("after unenrollment enrolled = %v, want [%d %d]", studentIDs(enrolled), students[1], students[2])
+	}
+	if _, err := s.GetWaitlistPosition(t.Context(), students[2], algorithms); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetWaitlistPosition of a promoted student error = %v, want ErrNotFound", err)
+	}
+	entry, err := s.GetWaitlistPosition(t.Context(), students[4], algorithms)
+	if err != nil {
+		t.Fatalf("GetWaitlistPosition: %v", err)
+	}
+	if entry.Position != 2 || entry.StudentID != students[4] {
+		t.Errorf("GetWaitlistPosition = %+v, want position 2", entry)
+	}
+
+	mine, err := s.GetWaitlistByStudentID(t.Context(), students[3])
+	if err != nil {
+		t.Fatalf("GetWaitlistByStudentID: %v", err)
+	}
+	if len(mine) != 1 || mine[0].CourseID != algorithms || mine[0].Position != 1 {
+		t.Errorf("GetWaitlistByStudentID = %+v, want position 1 in course %d", mine, algorithms)
+	}
+}
+
+func testLeaveWaitlist(t *testing.T, s storage.Storage) {
+	course := newCourse("Algorithms")
+	course.Capacity = 1
+	algorithms := createCourse(t, s, course)
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	meera := createStudent(t, s, newStudent("meera@example.com"))
+
+	enroll(t, s, asha, algorithms)
+	waitlist(t, s, ravi, algorithms)
+	waitlist(t, s, meera, algorithms)
+
+	// Leaving the waitlist frees no seat, so nobody is promoted.
+	if err := s.UnenrollStudent(t.Context(), ravi, algorithms); err != nil {
+		t.Fatalf("UnenrollStudent of a waitlisted student: %v", err)
+	}
+	enrolled, err := s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if !sameIDs(studentIDs(enrolled), asha) {
+		t.Errorf("enrolled = %v, want [%d]", studentIDs(enrolled), asha)
+	}
+	queue, err := s.GetWaitlistByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetWaitlistByCourseID: %v", err)
+	}
+	if !sameIDs(waitlistStudentIDs(queue), meera) || queue[0].Position != 1 {
+		t.Errorf("waitlist = %+v, want only student %d at position 1", queue, meera)
+	}
+
+	if err := s.UnenrollStudent(t.Context(), ravi, algorithms); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second UnenrollStudent error = %v, want ErrNotFound", err)
+	}
+}
+
+func testCapacityIncreasePromotes(t *testing.T, s storage.Storage) {
+	course := newCourse("Algorithms")
+	course.Capacity = 1
+	algorithms := createCourse(t, s, course)
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	meera := createStudent(t, s, newStudent("meera@example.com"))
+
+	enroll(t, s, asha, algorithms)
+	waitlist(t, s, ravi, algorithms)
+	waitlist(t, s, meera, algorithms)
+
+	course.Capacity = 2
+	if err := s.UpdateCourse(t.Context(), algorithms, course); err != nil {
+		t.Fatalf("UpdateCourse: %v", err)
+	}
+	enrolled, err := s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if !sameIDs(studentIDs(enrolled), asha, ravi) {
+		t.Errorf("after raising capacity enrolled = %v, want [%d %d]", studentIDs(enrolled), asha, ravi)
+	}
+
+	// Unlimited capacity empties the waitlist.
+	course.Capacity = 0
+	if err := s.UpdateCourse(t.Context(), algorithms, course); err != nil {
+		t.Fatalf("UpdateCourse: %v", err)
+	}
+	queue, err := s.GetWaitlistByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetWaitlistByCourseID: %v", err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("after removing the limit waitlist = %v, want empty", waitlistStudentIDs(queue))
+	}
+}
+
+func testConcurrentEnrollmentsAtCapacity(t *testing.T, s storage.Storage) {
+	const n, capacity = 20, 5
+
+	course := newCourse("Algorithms")
+	course.Capacity = capacity
+	algorithms := createCourse(t, s, course)
+	var students []int64
+	for i := 0; i < n; i++ {
+		students = append(students, createStudent(t, s, newStudent(fmt.Sprintf("student%d@example.com", i))))
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan models.Enrollment, n)
+	errs := make(chan error, n)
+	for _, student := range students {
+		wg.Add(1)
+		go func(student int64) {
+			defer wg.Done()
+			enrollment, err := s.EnrollStudent(t.Context(), student, algorithms)
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- enrollment
+		}(student)
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent EnrollStudent: %v", err)
+	}
+	seated := 0
+	positions := map[int]bool{}
+	for enrollment := range results {
+		if !enrollment.Waitlisted {
+			seated++
+			continue
+		}
+		if positions[enrollment.Position] {
+			t.Errorf("two students waitlisted at position %d", enrollment.Position)
+		}
+		positions[enrollment.Position] = true
+	}
+	if seated != capacity {
+		t.Errorf("%d students took a seat, want %d", seated, capacity)
+	}
+	for position := 1; position <= n-capacity; position++ {
+		if !positions[position] {
+			t.Errorf("no student waitlisted at position %d", position)
+		}
+	}
+
+	enrolled, err := s.GetStudentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if len(enrolled) != capacity {
+		t.Errorf("course holds %d students, want %d", len(enrolled), capacity)
+	}
+}
+
+// setStatus moves an enrollment to status and fails the test if it cannot.
+func setStatus(t *testing.T, s storage.Storage, id int64, status models.EnrollmentStatus) models.Enrollment {
+	t.Helper()
+	enrollment, err := s.UpdateEnrollmentStatus(t.Context(), id, status)
+	if err != nil {
+		t.Fatalf("UpdateEnrollmentStatus(%d, %s): %v", id, status, err)
+	}
+	if enrollment.ID != id || enrollment.Status != status {
+		t.Fatalf("UpdateEnrollmentStatus(%d, %s) = %+v", id, status, enrollment)
+	}
+	return enrollment
+}
+
+func testEnrollmentLifecycle(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	id := enroll(t, s, asha, algorithms)
+	got, err := s.GetEnrollmentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetEnrollmentById: %v", err)
+	}
+	if got.Status != models.EnrollmentPending || got.EnrolledAt == nil || got.ApprovedAt != nil {
+		t.Errorf("new enrollment = %+v, want pending with only enrolled_at set", got)
+	}
+
+	approved := setStatus(t, s, id, models.EnrollmentApproved)
+	if approved.ApprovedAt == nil || approved.EnrolledAt == nil {
+		t.Errorf("approved enrollment = %+v, want enrolled_at and approved_at set", approved)
+	}
+
+	completed := setStatus(t, s, id, models.EnrollmentCompleted)
+	if completed.CompletedAt == nil || completed.ApprovedAt == nil || completed.DroppedAt != nil || completed.RejectedAt != nil {
+		t.Errorf("completed enrollment = %+v, want approved_at and completed_at set", completed)
+	}
+
+	if _, err := s.GetEnrollmentById(t.Context(), id+1000); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetEnrollmentById of a missing id error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.UpdateEnrollmentStatus(t.Context(), id+1000, models.EnrollmentApproved); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateEnrollmentStatus of a missing id error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.UpdateEnrollmentStatus(t.Context(), id, "archived"); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("UpdateEnrollmentStatus to an unknown status error = %v, want ErrInvalid", err)
+	}
+}
+
+func testIllegalStatusChanges(t *testing.T, s storage.Storage) {
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	tests := []struct {
+		path []models.EnrollmentStatus // legal changes made first
+		next models.EnrollmentStatus
+	}{
+		{nil, models.EnrollmentPending},
+		{nil, models.EnrollmentDropped},
+		{nil, models.EnrollmentCompleted},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved}, models.EnrollmentApproved},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved}, models.EnrollmentRejected},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved}, models.EnrollmentPending},
+		{[]models.EnrollmentStatus{models.EnrollmentRejected}, models.EnrollmentApproved},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved, models.EnrollmentDropped}, models.EnrollmentApproved},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved, models.EnrollmentCompleted}, models.EnrollmentDropped},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v to %s", tt.path, tt.next), func(t *testing.T) {
+			student := createStudent(t, s, newStudent(fmt.Sprintf("student%d@example.com", i)))
+			id := enroll(t, s, student, algorithms)
+			for _, status := range tt.path {
+				setStatus(t, s, id, status)
+			}
+
+			before, err := s.GetEnrollmentById(t.Context(), id)
+			if err != nil {
+				t.Fatalf("GetEnrollmentById: %v", err)
+			}
+			if _, err := s.UpdateEnrollmentStatus(t.Context(), id, tt.next); !errors.Is(err, storage.ErrConflict) {
+				t.Errorf("UpdateEnrollmentStatus(%s -> %s) error = %v, want ErrConflict", before.Status, tt.next, err)
+			}
+			after, err := s.GetEnrollmentById(t.Context(), id)
+			if err != nil {
+				t.Fatalf("GetEnrollmentById: %v", err)
+			}
+			if after.Status != before.Status {
+				t.Errorf("refused change left status %s, want %s", after.Status, before.Status)
+			}
+		})
+	}
+}
+
+func testRejectAndReenroll(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	first := enroll(t, s, asha, algorithms)
+	if rejected := setStatus(t, s, first, models.EnrollmentRejected); rejected.RejectedAt == nil {
+		t.Errorf("rejected enrollment = %+v, want rejected_at set", rejected)
+	}
+
+	// A rejected student may apply again; the rejection stays on record.
+	second := enroll(t, s, asha, algorithms)
+	if second == first {
+		t.Errorf("re-enrollment reused id %d", first)
+	}
+	if _, err := s.EnrollStudent(t.Context(), asha, algorithms); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("third EnrollStudent error = %v, want ErrConflict", err)
+	}
+
+	enrollments, err := s.GetEnrollmentsByCourseID(t.Context(), algorithms)
+	if err != nil {
+		t.Fatalf("GetEnrollmentsByCourseID: %v", err)
+	}
+	if len(enrollments) != 2 || enrollments[0].ID != first || enrollments[0].Status != models.EnrollmentRejected ||
+		enrollments[1].ID != second || enrollments[1].Status != models.EnrollmentPending {
+		t.Errorf("enrollments = %+v, want the rejected one then the pending one", enrollments)
+	}
+}
+
+func testUnenrollKeepsHistory(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	approved := enroll(t, s, asha, algorithms)
+	setStatus(t, s, approved, models.EnrollmentApproved)
+	pending := enroll(t, s, ravi, algorithms)
+
+	for _, student := range []int64{asha, ravi} {
+		if err := s.UnenrollStudent(t.Context(), student, algorithms); err != nil {
+			t.Fatalf("UnenrollStudent(%d): %v", student, err)
+		}
+	}
+
+	// The approved enrollment is dropped; the pending one is withdrawn.
+	dropped, err := s.GetEnrollmentById(t.Context(), approved)
+	if err != nil {
+		t.Fatalf("GetEnrollmentById: %v", err)
+	}
+	if dropped.Status != models.EnrollmentDropped || dropped.DroppedAt == nil {
+		t.Errorf("unenrolled approved enrollment = %+v, want dropped", dropped)
+	}
+	if _, err := s.GetEnrollmentById(t.Context(), pending); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetEnrollmentById of a withdrawn enrollment error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.UnenrollStudent(t.Context(), asha, algorithms); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UnenrollStudent of a dropped student error = %v, want ErrNotFound", err)
+	}
+	active, err := s.GetStudentsByCourseID(t.Context(), algorithms, models.EnrollmentPending, models.EnrollmentApproved)
+	if err != nil {
+		t.Fatalf("GetStudentsByCourseID: %v", err)
+	}
+	if len(active) != 0 {
+		t.Errorf("active students = %v, want none", studentIDs(active))
+	}
+}
+
+func testFilterByStatus(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	databases := createCourse(t, s, newCourse("Databases"))
+
+	setStatus(t, s, enroll(t, s, asha, algorithms), models.EnrollmentApproved)
+	enroll(t, s, asha, databases)
+	setStatus(t, s, enroll(t, s, ravi, algorithms), models.EnrollmentRejected)
+	// A second enrollment in the same course is listed once.
+	enroll(t, s, ravi, algorithms)
+
+	courseTests := []struct {
+		statuses []models.EnrollmentStatus
+		want     []int64
+	}{
+		{nil, []int64{algorithms, databases}},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved}, []int64{algorithms}},
+		{[]models.EnrollmentStatus{models.EnrollmentPending}, []int64{databases}},
+		{[]models.EnrollmentStatus{models.EnrollmentPending, models.EnrollmentApproved}, []int64{algorithms, databases}},
+		{[]models.EnrollmentStatus{models.EnrollmentCompleted}, nil},
+	}
+	for _, tt := range courseTests {
+		courses, err := s.GetCoursesByStudentID(t.Context(), asha, tt.statuses...)
+		if err != nil {
+			t.Fatalf("GetCoursesByStudentID(%v): %v", tt.statuses, err)
+		}
+		if got := courseIDs(courses); !sameIDs(got, tt.want...) {
+			t.Errorf("GetCoursesByStudentID(%v) = %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+
+	studentTests := []struct {
+		statuses []models.EnrollmentStatus
+		want     []int64
+	}{
+		{nil, []int64{asha, ravi}},
+		{[]models.EnrollmentStatus{models.EnrollmentApproved}, []int64{asha}},
+		{[]models.EnrollmentStatus{models.EnrollmentRejected}, []int64{ravi}},
+		{[]models.EnrollmentStatus{models.EnrollmentPending}, []int64{ravi}},
+	}
+	for _, tt := range studentTests {
+		students, err := s.GetStudentsByCourseID(t.Context(), algorithms, tt.statuses...)
+		if err != nil {
+			t.Fatalf("GetStudentsByCourseID(%v): %v", tt.statuses, err)
+		}
+		if got := studentIDs(students); !sameIDs(got, tt.want...) {
+			t.Errorf("GetStudentsByCourseID(%v) = %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+
+	pending, err := s.GetEnrollmentsByCourseID(t.Context(), algorithms, models.EnrollmentPending)
+	if err != nil {
+		t.Fatalf("GetEnrollmentsByCourseID: %v", err)
+	}
+	if len(pending) != 1 || pending[0].StudentID != ravi {
+		t.Errorf("pending enrollments = %+v, want only student %d", pending, ravi)
+	}
+}
+
+func testFreedSeatPromotes(t *testing.T, s storage.Storage) {
+	course := newCourse("Algorithms")
+	course.Capacity = 1
+	algorithms := createCourse(t, s, course)
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+
+	id := enroll(t, s, asha, algorithms)
+	waitlist(t, s, ravi, algorithms)
+
+	// Approval keeps the seat taken.
+	setStatus(t, s, id, models.EnrollmentApproved)
+	if queue, err := s.GetWaitlistByCourseID(t.Context(), algorithms); err != nil || len(queue) != 1 {
+		t.Fatalf("after approval waitlist = %v, %v, want one student", queue, err)
+	}
+
+	setStatus(t, s, id, models.EnrollmentCompleted)
+	pending, err := s.GetEnrollmentsByCourseID(t.Context(), algorithms, models.EnrollmentPending)
+	if err != nil {
+		t.Fatalf("GetEnrollmentsByCourseID: %v", err)
+	}
+	if len(pending) != 1 || pending[0].StudentID != ravi {
+		t.Errorf("after completion pending = %+v, want student %d promoted", pending, ravi)
+	}
+}
+
+// submit files an application and checks it starts out submitted.
+func submit(t *testing.T, s storage.Storage, studentID int64, courseID int64, answers map[string]string) int64 {
+	t.Helper()
+	application, err := s.SubmitApplication(t.Context(), studentID, courseID, answers)
+	if err != nil {
+		t.Fatalf("SubmitApplication(%d, %d): %v", studentID, courseID, err)
+	}
+	if application.ID <= 0 || application.StudentID != studentID || application.CourseID != courseID ||
+		application.Status != models.ApplicationSubmitted || application.SubmittedAt == nil {
+		t.Fatalf("SubmitApplication(%d, %d) = %+v", studentID, courseID, application)
+	}
+	return application.ID
+}
+
+func decide(t *testing.T, s storage.Storage, id int64, decision models.ApplicationStatus) models.Application {
+	t.Helper()
+	application, err := s.DecideApplication(t.Context(), id, decision, "")
+	if err != nil {
+		t.Fatalf("DecideApplication(%d, %s): %v", id, decision, err)
+	}
+	if application.Status != decision || application.DecidedAt == nil {
+		t.Fatalf("DecideApplication(%d, %s) = %+v", id, decision, application)
+	}
+	return application
+}
+
+func applicationIDs(applications []models.Application) []int64 {
+	ids := make([]int64, len(applications))
+	for i, application := range applications {
+		ids[i] = application.ID
+	}
+	return ids
+}
+
+func testApplicationLifecycle(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	answers := map[string]string{"motivation": "I like graphs", "experience": "two years"}
+	id := submit(t, s, asha, algorithms, answers)
+	answers["motivation"] = "changed after submitting"
+
+	application, err := s.GetApplicationById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetApplicationById: %v", err)
+	}
+	if len(application.Answers) != 2 || application.Answers["motivation"] != "I like graphs" || application.Answers["experience"] != "two years" {
+		t.Errorf("answers = %v, want the ones submitted", application.Answers)
+	}
+	if len(application.Reviews) != 0 {
+		t.Errorf("new application has reviews %+v", application.Reviews)
+	}
+
+	// Reviewers are known by email, in canonical form.
+	review, err := s.AssignReviewer(t.Context(), id, " Ravi@Example.com ")
+	if err != nil {
+		t.Fatalf("AssignReviewer: %v", err)
+	}
+	if review.ID <= 0 || review.ApplicationID != id || review.Reviewer != "ravi@example.com" || review.Score != nil || review.AssignedAt == nil {
+		t.Errorf("AssignReviewer = %+v", review)
+	}
+	if _, err := s.AssignReviewer(t.Context(), id, "meera@example.com"); err != nil {
+		t.Fatalf("AssignReviewer(meera): %v", err)
+	}
+
+	application, err = s.GetApplicationById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetApplicationById: %v", err)
+	}
+	if application.Status != models.ApplicationUnderReview || len(application.Reviews) != 2 {
+		t.Fatalf("application after assigning reviewers = %+v, want under review by two", application)
+	}
+
+	if _, err := s.ReviewApplication(t.Context(), id, "ravi@example.com", 4, "thin"); err != nil {
+		t.Fatalf("ReviewApplication: %v", err)
+	}
+	// A second review by the same reviewer replaces the first.
+	review, err = s.ReviewApplication(t.Context(), id, "RAVI@example.com", 8, "strong after the interview")
+	if err != nil {
+		t.Fatalf("ReviewApplication again: %v", err)
+	}
+	if review.Score == nil || *review.Score != 8 || review.Comment != "strong after the interview" || review.ReviewedAt == nil {
+		t.Errorf("ReviewApplication = %+v, want score 8 with the new comment", review)
+	}
+	if _, err := s.ReviewApplication(t.Context(), id, "meera@example.com", 0, ""); err != nil {
+		t.Fatalf("ReviewApplication(meera, 0): %v", err)
+	}
+
+	waitlisted, err := s.DecideApplication(t.Context(), id, models.ApplicationWaitlisted, "no seats yet")
+	if err != nil {
+		t.Fatalf("DecideApplication(waitlisted): %v", err)
+	}
+	if waitlisted.Status != models.ApplicationWaitlisted || waitlisted.DecisionNote != "no seats yet" || waitlisted.DecidedAt == nil {
+		t.Errorf("waitlisted application = %+v", waitlisted)
+	}
+
+	accepted := decide(t, s, id, models.ApplicationAccepted)
+	if len(accepted.Reviews) != 2 {
+		t.Fatalf("accepted application reviews = %+v, want two", accepted.Reviews)
+	}
+	ravi, meera := accepted.Reviews[0], accepted.Reviews[1]
+	if ravi.Reviewer != "ravi@example.com" || *ravi.Score != 8 || meera.Reviewer != "meera@example.com" || meera.Score == nil || *meera.Score != 0 {
+		t.Errorf("reviews = %+v, %+v", ravi, meera)
+	}
+}
+
+func testApplicationRules(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	id := submit(t, s, asha, algorithms, nil)
+
+	if _, err := s.SubmitApplication(t.Context(), asha, algorithms, nil); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("second open application error = %v, want ErrConflict", err)
+	}
+	if _, err := s.SubmitApplication(t.Context(), asha, algorithms+100, nil); !errors.Is(err, storage.ErrConstraint) {
+		t.Errorf("application to a missing course error = %v, want ErrConstraint", err)
+	}
+	if _, err := s.SubmitApplication(t.Context(), asha+100, algorithms, nil); !errors.Is(err, storage.ErrConstraint) {
+		t.Errorf("application by a missing student error = %v, want ErrConstraint", err)
+	}
+
+	if _, err := s.GetApplicationById(t.Context(), id+100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetApplicationById(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.AssignReviewer(t.Context(), id+100, "ravi@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("AssignReviewer(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.DecideApplication(t.Context(), id+100, models.ApplicationAccepted, ""); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DecideApplication(missing) error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.AssignReviewer(t.Context(), id, "ravi@example.com"); err != nil {
+		t.Fatalf("AssignReviewer: %v", err)
+	}
+	if _, err := s.AssignReviewer(t.Context(), id, "Ravi@example.com"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("assigning a reviewer twice error = %v, want ErrConflict", err)
+	}
+	if _, err := s.ReviewApplication(t.Context(), id, "meera@example.com", 5, ""); !errors.Is(err, storage.ErrConstraint) {
+		t.Errorf("review by an unassigned reviewer error = %v, want ErrConstraint", err)
+	}
+	for _, score := range []int{-1, models.MaxReviewScore + 1} {
+		if _, err := s.ReviewApplication(t.Context(), id, "ravi@example.com", score, ""); !errors.Is(err, storage.ErrInvalid) {
+			t.Errorf("review with score %d error = %v, want ErrInvalid", score, err)
+		}
+	}
+
+	// A decided application is closed to reviewers, and the student may apply again.
+	decide(t, s, id, models.ApplicationRejected)
+	if _, err := s.AssignReviewer(t.Context(), id, "meera@example.com"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("AssignReviewer after rejection error = %v, want ErrConflict", err)
+	}
+	if _, err := s.ReviewApplication(t.Context(), id, "ravi@example.com", 5, ""); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("ReviewApplication after rejection error = %v, want ErrConflict", err)
+	}
+	if again := submit(t, s, asha, algorithms, nil); again == id {
+		t.Errorf("new application reused id %d", id)
+	}
+}
+
+func testIllegalDecisions(t *testing.T, s storage.Storage) {
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+
+	invalid := []models.ApplicationStatus{models.ApplicationSubmitted, models.ApplicationUnderReview, "maybe"}
+	for _, decision := range invalid {
+		t.Run(string(decision), func(t *testing.T) {
+			student := createStudent(t, s, newStudent(string(decision)+"@example.com"))
+			id := submit(t, s, student, algorithms, nil)
+			if _, err := s.DecideApplication(t.Context(), id, decision, ""); !errors.Is(err, storage.ErrInvalid) {
+				t.Errorf("DecideApplication(%q) error = %v, want ErrInvalid", decision, err)
+			}
+		})
+	}
+
+	tests := []struct {
+		path []models.ApplicationStatus // legal decisions made first
+		next models.ApplicationStatus
+	}{
+		{[]models.ApplicationStatus{models.ApplicationWaitlisted}, models.ApplicationWaitlisted},
+		{[]models.ApplicationStatus{models.ApplicationAccepted}, models.ApplicationRejected},
+		{[]models.ApplicationStatus{models.ApplicationAccepted}, models.ApplicationWaitlisted},
+		{[]models.ApplicationStatus{models.ApplicationRejected}, models.ApplicationAccepted},
+		{[]models.ApplicationStatus{models.ApplicationWaitlisted, models.ApplicationRejected}, models.ApplicationAccepted},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v to %s", tt.path, tt.next), func(t *testing.T) {
+			student := createStudent(t, s, newStudent(fmt.Sprintf("student%d@example.com", i)))
+			id := submit(t, s, student, algorithms, nil)
+			for _, decision := range tt.path {
+				decide(t, s, id, decision)
+			}
+
+			if _, err := s.DecideApplication(t.Context(), id, tt.next, ""); !errors.Is(err, storage.ErrConflict) {
+				t.Errorf("DecideApplication(%s) error = %v, want ErrConflict", tt.next, err)
+			}
+			after, err := s.GetApplicationById(t.Context(), id)
+			if err != nil {
+				t.Fatalf("GetApplicationById: %v", err)
+			}
+			if want := tt.path[len(tt.path)-1]; after.Status != want {
+				t.Errorf("refused decision left status %s, want %s", after.Status, want)
+			}
+		})
+	}
+}
+
+func testListApplications(t *testing.T, s storage.Storage) {
+	asha := createStudent(t, s, newStudent("asha@example.com"))
+	ravi := createStudent(t, s, newStudent("ravi@example.com"))
+	algorithms := createCourse(t, s, newCourse("Algorithms"))
+	databases := createCourse(t, s, newCourse("Databases"))
+
+	ashaAlgorithms := submit(t, s, asha, algorithms, nil)
+	raviAlgorithms := submit(t, s, ravi, algorithms, nil)
+	ashaDatabases := submit(t, s, asha, databases, nil)
+	if _, err := s.AssignReviewer(t.Context(), raviAlgorithms, "meera@example.com"); err != nil {
+		t.Fatalf("AssignReviewer: %v", err)
+	}
+	decide(t, s, ashaDatabases, models.ApplicationAccepted)
+
+	mine, err := s.GetApplicationsByStudentID(t.Context(), asha)
+	if err != nil {
+		t.Fatalf("GetApplicationsByStudentID: %v", err)
+	}
+	if got := applicationIDs(mine); !sameIDs(got, ashaAlgorithms, ashaDatabases) {
+		t.Errorf("asha's applications = %v, want [%d %d]", got, ashaAlgorithms, ashaDatabases)
+	}
+	for _, application := range mine {
+		if application.Reviews != nil {
+			t.Errorf("listed application %d carries reviews", application.ID)
+		}
+	}
+
+	tests := []struct {
+		statuses []models.ApplicationStatus
+		want     []int64
+	}{
+		{nil, []int64{ashaAlgorithms, raviAlgorithms, ashaDatabases}},
+		{[]models.ApplicationStatus{models.ApplicationSubmitted}, []int64{ashaAlgorithms}},
+		{[]models.ApplicationStatus{models.ApplicationSubmitted, models.ApplicationUnderReview}, []int64{ashaAlgorithms, raviAlgorithms}},
+		{[]models.ApplicationStatus{models.ApplicationAccepted}, []int64{ashaDatabases}},
+		{[]models.ApplicationStatus{models.ApplicationRejected}, nil},
+	}
+	for _, tt := range tests {
+		applications, err := s.GetApplications(t.Context(), tt.statuses...)
+		if err != nil {
+			t.Fatalf("GetApplications(%v): %v", tt.statuses, err)
+		}
+		if got := applicationIDs(applications); !sameIDs(got, tt.want...) {
+			t.Errorf("GetApplications(%v) = %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func createAdmin(t *testing.T, s storage.Storage, email string) int64 {
+	t.Helper()
+	id, err := s.CreateAdmin(t.Context(), "Admin", email, "not-a-real-hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin(%s): %v", email, err)
+	}
+	if id <= 0 {
+		t.Fatalf("CreateAdmin(%s) returned id %d", email, id)
+	}
+	return id
+}
+
+func testCreateAndGetAdmin(t *testing.T, s storage.Storage) {
+	id := createAdmin(t, s, " Meera@Example.com ")
+
+	admin, err := s.GetAdminById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetAdminById: %v", err)
+	}
+	if admin.ID != id || admin.Name != "Admin" || admin.Email != "meera@example.com" ||
+		admin.Password != "not-a-real-hash" || admin.Disabled || admin.CreatedAt == nil {
+		t.Errorf("GetAdminById = %+v", admin)
+	}
+
+	byEmail, err := s.GetAdminByEmail(t.Context(), "MEERA@example.com")
+	if err != nil {
+		t.Fatalf("GetAdminByEmail: %v", err)
+	}
+	if byEmail.ID != id {
+		t.Errorf("GetAdminByEmail = %+v, want id %d", byEmail, id)
+	}
+
+	if _, err := s.GetAdminById(t.Context(), id+100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAdminById(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetAdminByEmail(t.Context(), "nobody@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAdminByEmail(missing) error = %v, want ErrNotFound", err)
+	}
+
+	other := createAdmin(t, s, "ravi@example.com")
+	admins, err := s.GetAllAdmins(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllAdmins: %v", err)
+	}
+	got := make([]int64, len(admins))
+	for i, admin := range admins {
+		got[i] = admin.ID
+	}
+	if !sameIDs(got, id, other) {
+		t.Errorf("GetAllAdmins ids = %v, want [%d %d]", got, id, other)
+	}
+}
+
+func testDuplicateAdminEmail(t *testing.T, s storage.Storage) {
+	createAdmin(t, s, "meera@example.com")
+
+	if _, err := s.CreateAdmin(t.Context(), "Impostor", "Meera@Example.com", "x"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("CreateAdmin with a taken email error = %v, want ErrConflict", err)
+	}
+}
+
+func testCreateFirstAdmin(t *testing.T, s storage.Storage) {
+	created, err := s.CreateFirstAdmin(t.Context(), "Root", "Root@Example.com", "hash")
+	if err != nil || !created {
+		t.Fatalf("CreateFirstAdmin on an empty store = %v, %v, want true", created, err)
+	}
+	admin, err := s.GetAdminByEmail(t.Context(), "root@example.com")
+	if err != nil {
+		t.Fatalf("GetAdminByEmail: %v", err)
+	}
+	if admin.Name != "Root" || admin.Password != "hash" {
+		t.Errorf("seeded admin = %+v", admin)
+	}
+
+	// Once any admin exists the seed is ignored, even with another email.
+	created, err = s.CreateFirstAdmin(t.Context(), "Other", "other@example.com", "hash")
+	if err != nil || created {
+		t.Errorf("second CreateFirstAdmin = %v, %v, want false", created, err)
+	}
+	if _, err := s.GetAdminByEmail(t.Context(), "other@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ignored seed was stored: %v", err)
+	}
+}
+
+func testDisableAndDeleteAdmins(t *testing.T, s storage.Storage) {
+	meera := createAdmin(t, s, "meera@example.com")
+	ravi := createAdmin(t, s, "ravi@example.com")
+
+	if err := s.SetAdminDisabled(t.Context(), ravi, true); err != nil {
+		t.Fatalf("SetAdminDisabled(ravi): %v", err)
+	}
+	admin, err := s.GetAdminById(t.Context(), ravi)
+	if err != nil {
+		t.Fatalf("GetAdminById: %v", err)
+	}
+	if !admin.Disabled {
+		t.Errorf("disabled admin = %+v", admin)
+	}
+	// Disabling an admin twice changes nothing.
+	if err := s.SetAdminDisabled(t.Context(), ravi, true); err != nil {
+		t.Errorf("SetAdminDisabled(ravi) again: %v", err)
+	}
+
+	// meera is now the only enabled admin and must stay.
+	if err := s.SetAdminDisabled(t.Context(), meera, true); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("disabling the last enabled admin error = %v, want ErrConflict", err)
+	}
+	if err := s.DeleteAdmin(t.Context(), meera); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("deleting the last enabled admin error = %v, want ErrConflict", err)
+	}
+
+	if err := s.SetAdminDisabled(t.Context(), ravi, false); err != nil {
+		t.Fatalf("re-enabling ravi: %v", err)
+	}
+	if err := s.DeleteAdmin(t.Context(), meera); err != nil {
+		t.Fatalf("DeleteAdmin(meera): %v", err)
+	}
+	if _, err := s.GetAdminById(t.Context(), meera); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAdminById(deleted) error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteAdmin(t.Context(), meera); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteAdmin(deleted) error = %v, want ErrNotFound", err)
+	}
+	if err := s.SetAdminDisabled(t.Context(), meera, false); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetAdminDisabled(deleted) error = %v, want ErrNotFound", err)
+	}
+}
+
+func roleNames(roles []models.Role) []string {
+	var names []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+func samePermissions(got []models.Permission, want ...models.Permission) bool {
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
+
+func testBuiltInRoles(t *testing.T, s storage.Storage) {
+	roles, err := s.GetAllRoles(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllRoles: %v", err)
+	}
+	if got := fmt.Sprint(roleNames(roles)); got != "[superadmin student registrar auditor]" {
+		t.Errorf("seeded roles = %s", got)
+	}
+
+	superadmin, err := s.GetRoleByName(t.Context(), models.RoleSuperadmin)
+	if err != nil {
+		t.Fatalf("GetRoleByName(superadmin): %v", err)
+	}
+	// Superadmins hold every permission but the three self-service ones.
+	if !superadmin.BuiltIn || len(superadmin.Permissions) != len(models.Permissions)-3 || !models.HasPermission(superadmin.Permissions, models.PermissionRolesManage) {
+		t.Errorf("superadmin = %+v", superadmin)
+	}
+	if !sort.SliceIsSorted(superadmin.Permissions, func(i, j int) bool { return superadmin.Permissions[i] < superadmin.Permissions[j] }) {
+		t.Errorf("superadmin permissions are not sorted: %v", superadmin.Permissions)
+	}
+
+	student, err := s.GetRoleByName(t.Context(), models.RoleStudent)
+	if err != nil {
+		t.Fatalf("GetRoleByName(student): %v", err)
+	}
+	if !student.BuiltIn || !samePermissions(student.Permissions, models.PermissionApplicationsSelf, models.PermissionEnrollmentsSelf, models.PermissionProfileUpdate) {
+		t.Errorf("student = %+v", student)
+	}
+
+	if _, err := s.GetRoleByName(t.Context(), "janitor"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetRoleByName(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Built-in roles cannot be changed.
+	if _, err := s.SetRolePermissions(t.Context(), models.RoleStudent, nil); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("changing the student role error = %v, want ErrConflict", err)
+	}
+	if err := s.DeleteRole(t.Context(), models.RoleSuperadmin); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("deleting superadmin error = %v, want ErrConflict", err)
+	}
+}
+
+func testManageRoles(t *testing.T, s storage.Storage) {
+	role, err := s.CreateRole(t.Context(), "grader", "Scores applications", []models.Permission{
+		models.PermissionApplicationsReview,
+		models.PermissionApplicationsRead,
+		models.PermissionApplicationsReview,
+	})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	if role.ID <= 0 || role.Name != "grader" || role.Description != "Scores applications" || role.BuiltIn {
+		t.Errorf("created role = %+v", role)
+	}
+	if !samePermissions(role.Permissions, models.PermissionApplicationsRead, models.PermissionApplicationsReview) {
+		t.Errorf("created permissions = %v, want sorted without duplicates", role.Permissions)
+	}
+
+	if _, err := s.CreateRole(t.Context(), "grader", "", nil); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("duplicate role error = %v, want ErrConflict", err)
+	}
+	if _, err := s.CreateRole(t.Context(), "wizard", "", []models.Permission{"spells:cast"}); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("unknown permission error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.GetRoleByName(t.Context(), "wizard"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("rejected role was stored: %v", err)
+	}
+
+	role, err = s.SetRolePermissions(t.Context(), "grader", []models.Permission{models.PermissionStudentsRead})
+	if err != nil {
+		t.Fatalf("SetRolePermissions: %v", err)
+	}
+	if !samePermissions(role.Permissions, models.PermissionStudentsRead) {
+		t.Errorf("replaced permissions = %v", role.Permissions)
+	}
+	if _, err := s.SetRolePermissions(t.Context(), "grader", []models.Permission{"spells:cast"}); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("unknown permission error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.SetRolePermissions(t.Context(), "janitor", nil); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetRolePermissions(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Removing every permission leaves an empty list, not nil.
+	role, err = s.SetRolePermissions(t.Context(), "grader", nil)
+	if err != nil || role.Permissions == nil || len(role.Permissions) != 0 {
+		t.Errorf("emptied role = %+v, %v", role, err)
+	}
+
+	admin := createAdmin(t, s, "meera@example.com")
+	if err := s.AssignRole(t.Context(), admin, "grader"); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if err := s.DeleteRole(t.Context(), "grader"); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	if _, err := s.GetRoleByName(t.Context(), "grader"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetRoleByName(deleted) error = %v, want ErrNotFound", err)
+	}
+	roles, err := s.GetAdminRoles(t.Context(), admin)
+	if err != nil || len(roles) != 0 {
+		t.Errorf("roles after deleting the role = %v, %v, want none", roleNames(roles), err)
+	}
+	if err := s.DeleteRole(t.Context(), "grader"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteRole(deleted) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testAssignRoles(t *testing.T, s storage.Storage) {
+	admin := createAdmin(t, s, "meera@example.com")
+
+	permissions, err := s.GetAdminPermissions(t.Context(), admin)
+	if err != nil || len(permissions) != 0 {
+		t.Errorf("new admin permissions = %v, %v, want none", permissions, err)
+	}
+
+	for _, role := range []string{"auditor", "registrar"} {
+		if err := s.AssignRole(t.Context(), admin, role); err != nil {
+			t.Fatalf("AssignRole(%s): %v", role, err)
+		}
+	}
+	if err := s.AssignRole(t.Context(), admin, "auditor"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("assigning a role twice error = %v, want ErrConflict", err)
+	}
+	if err := s.AssignRole(t.Context(), admin, "janitor"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("AssignRole(missing role) error = %v, want ErrNotFound", err)
+	}
+	if err := s.AssignRole(t.Context(), admin+100, "auditor"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("AssignRole(missing admin) error = %v, want ErrNotFound", err)
+	}
+
+	roles, err := s.GetAdminRoles(t.Context(), admin)
+	if err != nil {
+		t.Fatalf("GetAdminRoles: %v", err)
+	}
+	if got := fmt.Sprint(roleNames(roles)); got != "[registrar auditor]" {
+		t.Errorf("admin roles = %s, want them in role order", got)
+	}
+	if _, err := s.GetAdminRoles(t.Context(), admin+100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAdminRoles(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Permissions are the union of every role, each listed once.
+	permissions, err = s.GetAdminPermissions(t.Context(), admin)
+	if err != nil {
+		t.Fatalf("GetAdminPermissions: %v", err)
+	}
+	want := []models.Permission{
+		models.PermissionAdminsRead,
+		models.PermissionApplicationsManage,
+		models.PermissionApplicationsRead,
+		models.PermissionApplicationsReview,
+		models.PermissionAuditRead,
+		models.PermissionEnrollmentsManage,
+		models.PermissionEnrollmentsRead,
+		models.PermissionRolesRead,
+		models.PermissionStudentsPII,
+		models.PermissionStudentsRead,
+	}
+	if !samePermissions(permissions, want...) {
+		t.Errorf("permissions = %v, want %v", permissions, want)
+	}
+
+	if err := s.UnassignRole(t.Context(), admin, "registrar"); err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	if err := s.UnassignRole(t.Context(), admin, "registrar"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UnassignRole(not held) error = %v, want ErrNotFound", err)
+	}
+	permissions, err = s.GetAdminPermissions(t.Context(), admin)
+	if err != nil {
+		t.Fatalf("GetAdminPermissions: %v", err)
+	}
+	if models.HasPermission(permissions, models.PermissionEnrollmentsManage) {
+		t.Errorf("permissions after unassigning registrar = %v", permissions)
+	}
+}
+
+func testFirstAdminIsSuperadmin(t *testing.T, s storage.Storage) {
+	if _, err := s.CreateFirstAdmin(t.Context(), "Root", "root@example.com", "hash"); err != nil {
+		t.Fatalf("CreateFirstAdmin: %v", err)
+	}
+	admin, err := s.GetAdminByEmail(t.Context(), "root@example.com")
+	if err != nil {
+		t.Fatalf("GetAdminByEmail: %v", err)
+	}
+
+	roles, err := s.GetAdminRoles(t.Context(), admin.ID)
+	if err != nil || fmt.Sprint(roleNames(roles)) != "[superadmin]" {
+		t.Errorf("first admin roles = %v, %v, want [superadmin]", roleNames(roles), err)
+	}
+
+	// Admins created later start without roles.
+	other := createAdmin(t, s, "ravi@example.com")
+	roles, err = s.GetAdminRoles(t.Context(), other)
+	if err != nil || len(roles) != 0 {
+		t.Errorf("later admin roles = %v, %v, want none", roleNames(roles), err)
+	}
+}
+
+func testKeepRoleManager(t *testing.T, s storage.Storage) {
+	meera := createAdmin(t, s, "meera@example.com")
+	ravi := createAdmin(t, s, "ravi@example.com")
+	if _, err := s.CreateRole(t.Context(), "keeper", "", []models.Permission{models.PermissionRolesManage}); err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	if err := s.AssignRole(t.Context(), meera, "keeper"); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+
+	// meera is the only admin who can manage roles; ravi stays enabled, so
+	// only the role guard is in play.
+	if err := s.UnassignRole(t.Context(), meera, "keeper"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("unassigning the last role manager error = %v, want ErrConflict", err)
+	}
+	if _, err := s.SetRolePermissions(t.Context(), "keeper", nil); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("revoking roles:manage error = %v, want ErrConflict", err)
+	}
+	if err := s.DeleteRole(t.Context(), "keeper"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("deleting the last managing role error = %v, want ErrConflict", err)
+	}
+	if err := s.SetAdminDisabled(t.Context(), meera, true); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("disabling the last role manager error = %v, want ErrConflict", err)
+	}
+	if err := s.DeleteAdmin(t.Context(), meera); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("deleting the last role manager error = %v, want ErrConflict", err)
+	}
+
+	// Nothing was changed by the refused calls.
+	roles, err := s.GetAdminRoles(t.Context(), meera)
+	if err != nil || fmt.Sprint(roleNames(roles)) != "[keeper]" {
+		t.Errorf("meera roles = %v, %v", roleNames(roles), err)
+	}
+	permissions, err := s.GetAdminPermissions(t.Context(), meera)
+	if err != nil || !samePermissions(permissions, models.PermissionRolesManage) {
+		t.Errorf("meera permissions = %v, %v", permissions, err)
+	}
+	admin, err := s.GetAdminById(t.Context(), meera)
+	if err != nil || admin.Disabled {
+		t.Errorf("meera = %+v, %v", admin, err)
+	}
+
+	// With a second role manager, meera can give the role up.
+	if err := s.AssignRole(t.Context(), ravi, models.RoleSuperadmin); err != nil {
+		t.Fatalf("AssignRole(ravi): %v", err)
+	}
+	if err := s.UnassignRole(t.Context(), meera, "keeper"); err != nil {
+		t.Errorf("UnassignRole with another manager: %v", err)
+	}
+	if err := s.DeleteRole(t.Context(), "keeper"); err != nil {
+		t.Errorf("DeleteRole with another manager: %v", err)
+	}
+}
+
+// newToken is a token for the user issued now, expiring after lifetime.
+func newToken(jti string, userType models.UserType, userID int64, lifetime time.Duration) models.Token {
+	now := time.Now().UTC().Truncate(time.Second)
+	return models.Token{
+		JTI:       jti,
+		UserType:  userType,
+		UserID:    userID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	}
+}
+
+func createToken(t *testing.T, s storage.Storage, token models.Token) {
+	t.Helper()
+	if err := s.CreateToken(t.Context(), token); err != nil {
+		t.Fatalf("CreateToken(%s): %v", token.JTI, err)
+	}
+}
+
+func revoked(t *testing.T, s storage.Storage, jti string) bool {
+	t.Helper()
+	token, err := s.GetToken(t.Context(), jti)
+	if err != nil {
+		t.Fatalf("GetToken(%s): %v", jti, err)
+	}
+	return token.Revoked()
+}
+
+func testCreateAndGetToken(t *testing.T, s storage.Storage) {
+	want := newToken("a1", models.UserAdmin, 7, time.Hour)
+	createToken(t, s, want)
+
+	got, err := s.GetToken(t.Context(), "a1")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if got.JTI != want.JTI || got.UserType != want.UserType || got.UserID != want.UserID ||
+		!got.IssuedAt.Equal(want.IssuedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) || got.Revoked() {
+		t.Errorf("GetToken = %+v, want %+v", got, want)
+	}
+
+	if err := s.CreateToken(t.Context(), want); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("duplicate jti error = %v, want ErrConflict", err)
+	}
+	if err := s.CreateToken(t.Context(), newToken("b1", "robot", 7, time.Hour)); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("unknown user type error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.GetToken(t.Context(), "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetToken(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRevokeToken(t *testing.T, s storage.Storage) {
+	createToken(t, s, newToken("s1", models.UserStudent, 1, time.Hour))
+	createToken(t, s, newToken("s2", models.UserStudent, 1, time.Hour))
+
+	if err := s.RevokeToken(t.Context(), "s1"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	first, err := s.GetToken(t.Context(), "s1")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if !first.Revoked() {
+		t.Fatalf("revoked token = %+v", first)
+	}
+	if revoked(t, s, "s2") {
+		t.Errorf("revoking s1 revoked s2 too")
+	}
+
+	// Revoking again succeeds and keeps the first revocation time.
+	if err := s.RevokeToken(t.Context(), "s1"); err != nil {
+		t.Errorf("RevokeToken again: %v", err)
+	}
+	again, err := s.GetToken(t.Context(), "s1")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if !again.RevokedAt.Equal(*first.RevokedAt) {
+		t.Errorf("revocation time moved from %v to %v", first.RevokedAt, again.RevokedAt)
+	}
+
+	if err := s.RevokeToken(t.Context(), "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("RevokeToken(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testUseToken(t *testing.T, s storage.Storage) {
+	createToken(t, s, newToken("pending", models.UserAdmin, 7, time.Hour))
+	createToken(t, s, newToken("late", models.UserAdmin, 7, -time.Hour))
+	createToken(t, s, newToken("revoked", models.UserAdmin, 7, time.Hour))
+	if err := s.RevokeToken(t.Context(), "revoked"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	token, err := s.UseToken(t.Context(), "pending")
+	if err != nil || token.JTI != "pending" || token.UserID != 7 || !token.Revoked() {
+		t.Fatalf("UseToken = %+v, %v", token, err)
+	}
+	if !revoked(t, s, "pending") {
+		t.Error("UseToken did not revoke the token")
+	}
+
+	for _, tt := range []struct {
+		jti  string
+		want error
+	}{
+		{"pending", storage.ErrConflict},
+		{"revoked", storage.ErrConflict},
+		{"late", storage.ErrInvalid},
+		{"missing", storage.ErrNotFound},
+	} {
+		if _, err := s.UseToken(t.Context(), tt.jti); !errors.Is(err, tt.want) {
+			t.Errorf("UseToken(%s) error = %v, want %v", tt.jti, err, tt.want)
+		}
+	}
+}
+
+func testRevokeUserTokens(t *testing.T, s storage.Storage) {
+	createToken(t, s, newToken("laptop", models.UserStudent, 1, time.Hour))
+	createToken(t, s, newToken("phone", models.UserStudent, 1, time.Hour))
+	createToken(t, s, newToken("old", models.UserStudent, 1, -time.Hour))
+	createToken(t, s, newToken("other", models.UserStudent, 2, time.Hour))
+	createToken(t, s, newToken("admin", models.UserAdmin, 1, time.Hour))
+	if err := s.RevokeToken(t.Context(), "phone"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	// Only laptop was still active; phone was revoked and old has expired.
+	count, err := s.RevokeUserTokens(t.Context(), models.UserStudent, 1)
+	if err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("RevokeUserTokens revoked %d tokens, want 1", count)
+	}
+	if !revoked(t, s, "laptop") {
+		t.Errorf("laptop token was not revoked")
+	}
+	// Other users keep their tokens, including an admin with the same id.
+	for _, jti := range []string{"other", "admin"} {
+		if revoked(t, s, jti) {
+			t.Errorf("token %s was revoked", jti)
+		}
+	}
+
+	count, err = s.RevokeUserTokens(t.Context(), models.UserStudent, 1)
+	if err != nil || count != 0 {
+		t.Errorf("second RevokeUserTokens = %d, %v, want 0", count, err)
+	}
+}
+
+func testDeleteExpiredTokens(t *testing.T, s storage.Storage) {
+	createToken(t, s, newToken("expired", models.UserStudent, 1, -time.Hour))
+	createToken(t, s, newToken("active", models.UserStudent, 1, time.Hour))
+	createToken(t, s, newToken("revoked", models.UserStudent, 1, time.Hour))
+	if err := s.RevokeToken(t.Context(), "revoked"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	deleted, err := s.DeleteExpiredTokens(t.Context(), time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpiredTokens: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredTokens deleted %d tokens, want 1", deleted)
+	}
+	if _, err := s.GetToken(t.Context(), "expired"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expired token error = %v, want ErrNotFound", err)
+	}
+	// A revoked token is kept until it expires, so it stays refused.
+	if !revoked(t, s, "revoked") || revoked(t, s, "active") {
+		t.Errorf("unexpired tokens changed")
+	}
+}
+
+// newRefreshToken is a refresh token for the user in family, issued now and
+// expiring after lifetime.
+func newRefreshToken(hash string, family string, userType models.UserType, userID int64, lifetime time.Duration) models.RefreshToken {
+	now := time.Now().UTC().Truncate(time.Second)
+	return models.RefreshToken{
+		Hash:      hash,
+		Family:    family,
+		UserType:  userType,
+		UserID:    userID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	}
+}
+
+// familyToken is an access token issued in family.
+func familyToken(jti string, family string, userType models.UserType, userID int64) models.Token {
+	token := newToken(jti, userType, userID, time.Hour)
+	token.Family = family
+	return token
+}
+
+func createRefreshToken(t *testing.T, s storage.Storage, token models.RefreshToken) {
+	t.Helper()
+	if err := s.CreateRefreshToken(t.Context(), token); err != nil {
+		t.Fatalf("CreateRefreshToken(%s): %v", token.Hash, err)
+	}
+}
+
+func testCreateRefreshToken(t *testing.T, s storage.Storage) {
+	createRefreshToken(t, s, newRefreshToken("h1", "f1", models.UserStudent, 1, time.Hour))
+
+	if err := s.CreateRefreshToken(t.Context(), newRefreshToken("h1", "f2", models.UserStudent, 1, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("duplicate hash error = %v, want ErrConflict", err)
+	}
+	if err := s.CreateRefreshToken(t.Context(), newRefreshToken("h2", "f2", "robot", 1, time.Hour)); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("unknown user type error = %v, want ErrInvalid", err)
+	}
+
+	createToken(t, s, familyToken("a1", "f1", models.UserStudent, 1))
+	got, err := s.GetToken(t.Context(), "a1")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if got.Family != "f1" {
+		t.Errorf("token family = %q, want f1", got.Family)
+	}
+}
+
+func testRotateRefreshToken(t *testing.T, s storage.Storage) {
+	createRefreshToken(t, s, newRefreshToken("h1", "f1", models.UserAdmin, 7, time.Hour))
+
+	// The next token joins the current one's family and user, whatever it says.
+	next := newRefreshToken("h2", "elsewhere", models.UserStudent, 99, 2*time.Hour)
+	got, err := s.RotateRefreshToken(t.Context(), "h1", next)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if got.ID == 0 || got.Hash != "h2" || got.Family != "f1" || got.UserType != models.UserAdmin || got.UserID != 7 ||
+		!got.ExpiresAt.Equal(next.ExpiresAt) || got.UsedAt != nil || got.RevokedAt != nil {
+		t.Errorf("RotateRefreshToken = %+v", got)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "h2", newRefreshToken("h3", "", "", 0, time.Hour)); err != nil {
+		t.Errorf("rotating the new token: %v", err)
+	}
+
+	if _, err := s.RotateRefreshToken(t.Context(), "missing", newRefreshToken("h4", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unknown refresh token error = %v, want ErrNotFound", err)
+	}
+
+	createRefreshToken(t, s, newRefreshToken("old", "f2", models.UserAdmin, 7, -time.Minute))
+	if _, err := s.RotateRefreshToken(t.Context(), "old", newRefreshToken("h5", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("expired refresh token error = %v, want ErrInvalid", err)
+	}
+	// The refused rotation recorded nothing.
+	if _, err := s.RotateRefreshToken(t.Context(), "h5", newRefreshToken("h6", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("token from a refused rotation error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRefreshTokenReuse(t *testing.T, s storage.Storage) {
+	createToken(t, s, familyToken("first", "f1", models.UserStudent, 1))
+	createToken(t, s, familyToken("second", "f1", models.UserStudent, 1))
+	createToken(t, s, familyToken("elsewhere", "f2", models.UserStudent, 1))
+	createRefreshToken(t, s, newRefreshToken("h1", "f1", models.UserStudent, 1, time.Hour))
+	createRefreshToken(t, s, newRefreshToken("g1", "f2", models.UserStudent, 1, time.Hour))
+	if _, err := s.RotateRefreshToken(t.Context(), "h1", newRefreshToken("h2", "", "", 0, time.Hour)); err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	// Presenting h1 again means it was copied; the whole login is revoked.
+	if _, err := s.RotateRefreshToken(t.Context(), "h1", newRefreshToken("h3", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("reused refresh token error = %v, want ErrConflict", err)
+	}
+	if !revoked(t, s, "first") || !revoked(t, s, "second") {
+		t.Errorf("access tokens of the family were not revoked")
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "h2", newRefreshToken("h4", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("rotating the family's latest token error = %v, want ErrConflict", err)
+	}
+
+	// The user's other login is untouched.
+	if revoked(t, s, "elsewhere") {
+		t.Errorf("token of another family was revoked")
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "g1", newRefreshToken("g2", "", "", 0, time.Hour)); err != nil {
+		t.Errorf("rotating another family: %v", err)
+	}
+}
+
+func testRevokeTokenFamily(t *testing.T, s storage.Storage) {
+	createToken(t, s, familyToken("a1", "f1", models.UserStudent, 1))
+	createToken(t, s, familyToken("a2", "f2", models.UserStudent, 1))
+	createToken(t, s, newToken("bare", models.UserStudent, 1, time.Hour))
+	createRefreshToken(t, s, newRefreshToken("h1", "f1", models.UserStudent, 1, time.Hour))
+	createRefreshToken(t, s, newRefreshToken("h2", "f2", models.UserStudent, 1, time.Hour))
+
+	count, err := s.RevokeTokenFamily(t.Context(), "f1")
+	if err != nil {
+		t.Fatalf("RevokeTokenFamily: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("RevokeTokenFamily revoked %d tokens, want 2", count)
+	}
+	if !revoked(t, s, "a1") || revoked(t, s, "a2") || revoked(t, s, "bare") {
+		t.Errorf("RevokeTokenFamily revoked the wrong access tokens")
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "h1", newRefreshToken("h3", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("rotating a revoked refresh token error = %v, want ErrConflict", err)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "h2", newRefreshToken("h4", "", "", 0, time.Hour)); err != nil {
+		t.Errorf("rotating another family: %v", err)
+	}
+
+	count, err = s.RevokeTokenFamily(t.Context(), "f1")
+	if err != nil || count != 0 {
+		t.Errorf("second RevokeTokenFamily = %d, %v, want 0", count, err)
+	}
+	if _, err := s.RevokeTokenFamily(t.Context(), ""); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("empty family error = %v, want ErrInvalid", err)
+	}
+}
+
+func testRevokeUserRefreshTokens(t *testing.T, s storage.Storage) {
+	createRefreshToken(t, s, newRefreshToken("mine", "f1", models.UserAdmin, 1, time.Hour))
+	createRefreshToken(t, s, newRefreshToken("expired", "f2", models.UserAdmin, 1, -time.Hour))
+	createRefreshToken(t, s, newRefreshToken("student", "f3", models.UserStudent, 1, time.Hour))
+	createToken(t, s, familyToken("access", "f1", models.UserAdmin, 1))
+
+	count, err := s.RevokeUserTokens(t.Context(), models.UserAdmin, 1)
+	if err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("RevokeUserTokens revoked %d tokens, want 2", count)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "mine", newRefreshToken("next", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("rotating a revoked refresh token error = %v, want ErrConflict", err)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "student", newRefreshToken("next2", "", "", 0, time.Hour)); err != nil {
+		t.Errorf("rotating a student's refresh token: %v", err)
+	}
+}
+
+func testDeleteExpiredRefreshTokens(t *testing.T, s storage.Storage) {
+	createRefreshToken(t, s, newRefreshToken("expired", "f1", models.UserStudent, 1, -time.Hour))
+	createRefreshToken(t, s, newRefreshToken("active", "f2", models.UserStudent, 1, time.Hour))
+	createToken(t, s, newToken("old", models.UserStudent, 1, -time.Hour))
+
+	deleted, err := s.DeleteExpiredTokens(t.Context(), time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpiredTokens: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteExpiredTokens deleted %d tokens, want 2", deleted)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "expired", newRefreshToken("h1", "", "", 0, time.Hour)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("deleted refresh token error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.RotateRefreshToken(t.Context(), "active", newRefreshToken("h2", "", "", 0, time.Hour)); err != nil {
+		t.Errorf("rotating an unexpired refresh token: %v", err)
+	}
+}
+
+// newPasswordReset is a reset token for the student, created now and
+// expiring after lifetime.
+func newPasswordReset(hash string, studentID int64, lifetime time.Duration) models.PasswordReset {
+	now := time.Now().UTC().Truncate(time.Second)
+	return models.PasswordReset{
+		StudentID: studentID,
+		Hash:      hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+}
+
+func createPasswordReset(t *testing.T, s storage.Storage, reset models.PasswordReset) {
+	t.Helper()
+	if err := s.CreatePasswordReset(t.Context(), reset); err != nil {
+		t.Fatalf("CreatePasswordReset(%s): %v", reset.Hash, err)
+	}
+}
+
+func testCreatePasswordReset(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	createPasswordReset(t, s, newPasswordReset("r1", student, time.Hour))
+
+	if err := s.CreatePasswordReset(t.Context(), newPasswordReset("r1", student, time.Hour)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("duplicate hash error = %v, want ErrConflict", err)
+	}
+	if err := s.CreatePasswordReset(t.Context(), newPasswordReset("r2", student+100, time.Hour)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unknown student error = %v, want ErrNotFound", err)
+	}
+}
+
+func testResetPassword(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	other := createStudent(t, s, newStudent("ravi@example.com"))
+	createPasswordReset(t, s, newPasswordReset("first", student, time.Hour))
+	createPasswordReset(t, s, newPasswordReset("second", student, time.Hour))
+	createPasswordReset(t, s, newPasswordReset("others", other, time.Hour))
+	createToken(t, s, newToken("session", models.UserStudent, student, time.Hour))
+	createToken(t, s, newToken("other-session", models.UserStudent, other, time.Hour))
+
+	id, err := s.ResetPassword(t.Context(), "second", "new-hash")
+	if err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if id != student {
+		t.Errorf("ResetPassword returned student %d, want %d", id, student)
+	}
+	got, err := s.GetStudentByEmail(t.Context(), "asha@example.com")
+	if err != nil {
+		t.Fatalf("GetStudentByEmail: %v", err)
+	}
+	if got.Password != "new-hash" {
+		t.Errorf("password = %q, want new-hash", got.Password)
+	}
+	if !revoked(t, s, "session") {
+		t.Errorf("the student's session was not revoked")
+	}
+
+	// Every token of the student is used up, whichever was used.
+	for _, hash := range []string{"first", "second"} {
+		if _, err := s.ResetPassword(t.Context(), hash, "another-hash"); !errors.Is(err, storage.ErrInvalid) {
+			t.Errorf("ResetPassword(%s) after a reset error = %v, want ErrInvalid", hash, err)
+		}
+	}
+
+	// Other students are untouched.
+	if revoked(t, s, "other-session") {
+		t.Errorf("another student's session was revoked")
+	}
+	if _, err := s.ResetPassword(t.Context(), "others", "their-hash"); err != nil {
+		t.Errorf("ResetPassword for another student: %v", err)
+	}
+}
+
+func testChangeStudentPassword(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	other := createStudent(t, s, newStudent("ravi@example.com"))
+	createPasswordReset(t, s, newPasswordReset("pending", student, time.Hour))
+	createToken(t, s, familyToken("current", "this-login", models.UserStudent, student))
+	createRefreshToken(t, s, newRefreshToken("current-refresh", "this-login", models.UserStudent, student, time.Hour))
+	createToken(t, s, familyToken("elsewhere", "other-login", models.UserStudent, student))
+	createToken(t, s, newToken("legacy", models.UserStudent, student, time.Hour))
+	createToken(t, s, familyToken("other-student", "their-login", models.UserStudent, other))
+
+	if err := s.ChangeStudentPassword(t.Context(), student, "new-hash", "this-login"); err != nil {
+		t.Fatalf("ChangeStudentPassword: %v", err)
+	}
+	got, err := s.GetStudentById(t.Context(), student)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	if got.Password != "new-hash" {
+		t.Errorf("password = %q, want new-hash", got.Password)
+	}
+
+	for jti, want := range map[string]bool{"current": false, "elsewhere": true, "legacy": true, "other-student": false} {
+		if got := revoked(t, s, jti); got != want {
+			t.Errorf("token %s revoked = %v, want %v", jti, got, want)
+		}
+	}
+	// The login that changed the password can still refresh.
+	if _, err := s.RotateRefreshToken(t.Context(), "current-refresh", newRefreshToken("next", "", models.UserStudent, student, time.Hour)); err != nil {
+		t.Errorf("RotateRefreshToken of the kept login: %v", err)
+	}
+	if _, err := s.ResetPassword(t.Context(), "pending", "reset-hash"); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("ResetPassword after a change error = %v, want ErrInvalid", err)
+	}
+
+	// Without a login to keep, every session ends.
+	if err := s.ChangeStudentPassword(t.Context(), student, "newer-hash", ""); err != nil {
+		t.Fatalf("ChangeStudentPassword without a family: %v", err)
+	}
+	if !revoked(t, s, "current") {
+		t.Errorf("ChangeStudentPassword without a family kept a session")
+	}
+
+	if err := s.ChangeStudentPassword(t.Context(), 9999, "hash", ""); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ChangeStudentPassword of a missing student error = %v, want ErrNotFound", err)
+	}
+}
+
+func testResetPasswordRefusals(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	createPasswordReset(t, s, newPasswordReset("expired", student, -time.Minute))
+
+	if _, err := s.ResetPassword(t.Context(), "expired", "new-hash"); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("expired token error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.ResetPassword(t.Context(), "missing", "new-hash"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unknown token error = %v, want ErrNotFound", err)
+	}
+	got, err := s.GetStudentByEmail(t.Context(), "asha@example.com")
+	if err != nil {
+		t.Fatalf("GetStudentByEmail: %v", err)
+	}
+	if got.Password != "not-a-real-hash" {
+		t.Errorf("a refused reset changed the password to %q", got.Password)
+	}
+
+	deleted, err := s.DeleteExpiredTokens(t.Context(), time.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpiredTokens: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredTokens deleted %d tokens, want the expired reset", deleted)
+	}
+	if _, err := s.ResetPassword(t.Context(), "expired", "new-hash"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("deleted token error = %v, want ErrNotFound", err)
+	}
+}
+
+func recordFailure(t *testing.T, s storage.Storage, key string, at time.Time) models.LoginThrottle {
+	t.Helper()
+	throttle, err := s.RecordLoginFailure(t.Context(), key, at, time.Hour)
+	if err != nil {
+		t.Fatalf("RecordLoginFailure(%s): %v", key, err)
+	}
+	return throttle
+}
+
+func testLoginThrottle(t *testing.T, s storage.Storage) {
+	const key = "student:asha@example.com"
+	if _, err := s.GetLoginThrottle(t.Context(), key); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetLoginThrottle before any failure error = %v, want ErrNotFound", err)
+	}
+
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	for i := 1; i <= 3; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		throttle := recordFailure(t, s, key, at)
+		if throttle.Key != key || throttle.Failures != i || !throttle.LastFailureAt.Equal(at) || !throttle.ExpiresAt.Equal(at.Add(time.Hour)) {
+			t.Fatalf("after %d failures throttle = %+v", i, throttle)
+		}
+	}
+	recordFailure(t, s, "ip:192.0.2.1", start)
+
+	got, err := s.GetLoginThrottle(t.Context(), key)
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if got.Failures != 3 || got.LockedUntil != nil {
+		t.Errorf("GetLoginThrottle = %+v, want 3 failures and no lock", got)
+	}
+
+	// Failures after the throttle expired start over.
+	if throttle := recordFailure(t, s, key, start.Add(2*time.Hour)); throttle.Failures != 1 {
+		t.Errorf("failure after expiry counted %d failures, want 1", throttle.Failures)
+	}
+
+	if err := s.ClearLoginFailures(t.Context(), key); err != nil {
+		t.Fatalf("ClearLoginFailures: %v", err)
+	}
+	if _, err := s.GetLoginThrottle(t.Context(), key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetLoginThrottle after clearing error = %v, want ErrNotFound", err)
+	}
+	if err := s.ClearLoginFailures(t.Context(), key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("clearing twice error = %v, want ErrNotFound", err)
+	}
+	if got, err := s.GetLoginThrottle(t.Context(), "ip:192.0.2.1"); err != nil || got.Failures != 1 {
+		t.Errorf("clearing changed another key: %+v, %v", got, err)
+	}
+}
+
+func testLockLogin(t *testing.T, s storage.Storage) {
+	const key = "admin:root@example.com"
+	now := time.Now().Truncate(time.Second)
+	if err := s.LockLogin(t.Context(), key, now.Add(time.Minute)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("LockLogin without failures error = %v, want ErrNotFound", err)
+	}
+
+	recordFailure(t, s, key, now)
+	recordFailure(t, s, "ip:192.0.2.1", now)
+	until := now.Add(2 * time.Hour)
+	if err := s.LockLogin(t.Context(), key, until); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+
+	got, err := s.GetLoginThrottle(t.Context(), key)
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if !got.Locked(now) || !got.LockedUntil.Equal(until) || got.Locked(until) {
+		t.Errorf("locked throttle = %+v, want locked until %s", got, until)
+	}
+	// The throttle is kept while it is locked, even past its window.
+	if !got.ExpiresAt.Equal(until) {
+		t.Errorf("locked throttle expires at %s, want %s", got.ExpiresAt, until)
+	}
+
+	locked, err := s.GetLockedLogins(t.Context(), now)
+	if err != nil {
+		t.Fatalf("GetLockedLogins: %v", err)
+	}
+	if len(locked) != 1 || locked[0].Key != key {
+		t.Errorf("GetLockedLogins = %+v, want only %s", locked, key)
+	}
+	if locked, err := s.GetLockedLogins(t.Context(), until); err != nil || len(locked) != 0 {
+		t.Errorf("GetLockedLogins after the lock = %+v, %v, want none", locked, err)
+	}
+
+	// Another failure within the window keeps counting, and keeps the lock.
+	if throttle := recordFailure(t, s, key, now.Add(time.Minute)); throttle.Failures != 2 || !throttle.Locked(now) {
+		t.Errorf("failure while locked = %+v", throttle)
+	}
+}
+
+func testDeleteExpiredLoginThrottles(t *testing.T, s storage.Storage) {
+	now := time.Now()
+	recordFailure(t, s, "ip:192.0.2.1", now.Add(-2*time.Hour))
+	recordFailure(t, s, "ip:192.0.2.2", now)
+	recordFailure(t, s, "ip:192.0.2.3", now.Add(-2*time.Hour))
+	if err := s.LockLogin(t.Context(), "ip:192.0.2.3", now.Add(time.Minute)); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+
+	// Throttles are not tokens.
+	if deleted, err := s.DeleteExpiredTokens(t.Context(), now); err != nil || deleted != 0 {
+		t.Errorf("DeleteExpiredTokens = %d, %v, want 0", deleted, err)
+	}
+
+	deleted, err := s.DeleteExpiredLoginThrottles(t.Context(), now)
+	if err != nil {
+		t.Fatalf("DeleteExpiredLoginThrottles: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredLoginThrottles deleted %d, want 1", deleted)
+	}
+	if _, err := s.GetLoginThrottle(t.Context(), "ip:192.0.2.1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expired throttle error = %v, want ErrNotFound", err)
+	}
+	for _, key := range []string{"ip:192.0.2.2", "ip:192.0.2.3"} {
+		if _, err := s.GetLoginThrottle(t.Context(), key); err != nil {
+			t.Errorf("GetLoginThrottle(%s): %v", key, err)
+		}
+	}
+}
+
+func testAuditLog(t *testing.T, s storage.Storage) {
+	if entries, err := s.GetAuditEntries(t.Context(), 10); err != nil || len(entries) != 0 {
+		t.Fatalf("empty audit log = %+v, %v", entries, err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	want := []models.AuditEntry{
+		{Event: models.AuditLoginLocked, Subject: "student:asha@example.com", IP: "192.0.2.1", Detail: "10 failed logins", CreatedAt: now},
+		{Event: models.AuditLoginUnlocked, ActorType: models.UserAdmin, ActorID: 1, Subject: "student:asha@example.com", IP: "192.0.2.9", CreatedAt: now.Add(time.Second)},
+		{Event: models.AuditLoginLocked, Subject: "ip:192.0.2.1", IP: "192.0.2.1", CreatedAt: now.Add(2 * time.Second)},
+	}
+	for i := range want {
+		id, err := s.CreateAuditEntry(t.Context(), want[i])
+		if err != nil {
+			t.Fatalf("CreateAuditEntry: %v", err)
+		}
+		if id <= 0 {
+			t.Fatalf("CreateAuditEntry returned id %d", id)
+		}
+		want[i].ID = id
+	}
+
+	entries, err := s.GetAuditEntries(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("GetAuditEntries returned %d entries, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		expected := want[len(want)-1-i]
+		if !entry.CreatedAt.Equal(expected.CreatedAt) {
+			t.Errorf("entry %d created at %s, want %s", i, entry.CreatedAt, expected.CreatedAt)
+		}
+		entry.CreatedAt, expected.CreatedAt = time.Time{}, time.Time{}
+		if entry != expected {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, expected)
+		}
+	}
+
+	locked, err := s.GetAuditEntries(t.Context(), 10, models.AuditLoginLocked)
+	if err != nil {
+		t.Fatalf("GetAuditEntries(login.locked): %v", err)
+	}
+	if len(locked) != 2 || locked[0].ID != want[2].ID || locked[1].ID != want[0].ID {
+		t.Errorf("GetAuditEntries(login.locked) = %+v", locked)
+	}
+	if limited, err := s.GetAuditEntries(t.Context(), 1); err != nil || len(limited) != 1 || limited[0].ID != want[2].ID {
+		t.Errorf("GetAuditEntries with limit 1 = %+v, %v", limited, err)
+	}
+}
+
+func newTOTP(userType models.UserType, userID int64, secret string) models.TOTP {
+	return models.TOTP{UserType: userType, UserID: userID, Secret: secret, CreatedAt: time.Now().Truncate(time.Second)}
+}
+
+func testTOTPEnrollment(t *testing.T, s storage.Storage) {
+	if _, err := s.GetTOTP(t.Context(), models.UserAdmin, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetTOTP before setup error = %v, want ErrNotFound", err)
+	}
+	if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, 1, 100, nil); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ConfirmTOTP before setup error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.CreateTOTP(t.Context(), newTOTP(models.UserAdmin, 1, "FIRST")); err != nil {
+		t.Fatalf("CreateTOTP: %v", err)
+	}
+	// Setting up again before confirming replaces the secret.
+	want := newTOTP(models.UserAdmin, 1, "SECOND")
+	if err := s.CreateTOTP(t.Context(), want); err != nil {
+		t.Fatalf("CreateTOTP again: %v", err)
+	}
+	got, err := s.GetTOTP(t.Context(), models.UserAdmin, 1)
+	if err != nil {
+		t.Fatalf("GetTOTP: %v", err)
+	}
+	if got.Secret != "SECOND" || got.Confirmed() || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("GetTOTP = %+v, want unconfirmed secret SECOND", got)
+	}
+	// The same id of another user type is another user.
+	if _, err := s.GetTOTP(t.Context(), models.UserStudent, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetTOTP of student 1 error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, 1, 100, []string{"a", "b"}); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	got, err = s.GetTOTP(t.Context(), models.UserAdmin, 1)
+	if err != nil {
+		t.Fatalf("GetTOTP after confirming: %v", err)
+	}
+	if !got.Confirmed() || got.LastUsedStep != 100 {
+		t.Errorf("confirmed TOTP = %+v, want confirmed at step 100", got)
+	}
+
+	if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, 1, 101, nil); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("ConfirmTOTP twice error = %v, want ErrConflict", err)
+	}
+	if err := s.CreateTOTP(t.Context(), newTOTP(models.UserAdmin, 1, "THIRD")); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("CreateTOTP over a confirmed secret error = %v, want ErrConflict", err)
+	}
+	if got, err := s.GetTOTP(t.Context(), models.UserAdmin, 1); err != nil || got.Secret != "SECOND" {
+		t.Errorf("GetTOTP after refused setup = %+v, %v, want secret SECOND", got, err)
+	}
+}
+
+func testUseTOTPStep(t *testing.T, s storage.Storage) {
+	if err := s.CreateTOTP(t.Context(), newTOTP(models.UserStudent, 1, "SECRET")); err != nil {
+		t.Fatalf("CreateTOTP: %v", err)
+	}
+	if err := s.ConfirmTOTP(t.Context(), models.UserStudent, 1, 100, nil); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+
+	if err := s.UseTOTPStep(t.Context(), models.UserStudent, 1, 100); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("UseTOTPStep of the confirming step error = %v, want ErrConflict", err)
+	}
+	if err := s.UseTOTPStep(t.Context(), models.UserStudent, 1, 102); err != nil {
+		t.Fatalf("UseTOTPStep(102): %v", err)
+	}
+	for _, step := range []int64{102, 101} {
+		if err := s.UseTOTPStep(t.Context(), models.UserStudent, 1, step); !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("UseTOTPStep(%d) after 102 error = %v, want ErrConflict", step, err)
+		}
+	}
+	if got, err := s.GetTOTP(t.Context(), models.UserStudent, 1); err != nil || got.LastUsedStep != 102 {
+		t.Errorf("GetTOTP = %+v, %v, want last step 102", got, err)
+	}
+	if err := s.UseTOTPStep(t.Context(), models.UserStudent, 2, 200); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("UseTOTPStep without a secret error = %v, want ErrConflict", err)
+	}
+}
+
+func testRecoveryCodes(t *testing.T, s storage.Storage) {
+	if _, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode without codes error = %v, want ErrNotFound", err)
+	}
+
+	for _, id := range []int64{1, 2} {
+		if err := s.CreateTOTP(t.Context(), newTOTP(models.UserAdmin, id, "SECRET")); err != nil {
+			t.Fatalf("CreateTOTP: %v", err)
+		}
+		if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, id, 100, []string{"a", "b", "c"}); err != nil {
+			t.Fatalf("ConfirmTOTP: %v", err)
+		}
+	}
+
+	remaining, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "b")
+	if err != nil || remaining != 2 {
+		t.Fatalf("UseRecoveryCode = %d, %v, want 2 left", remaining, err)
+	}
+	if _, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "b"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode twice error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "z"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode of an unknown code error = %v, want ErrNotFound", err)
+	}
+	// Codes belong to one user.
+	if _, err := s.UseRecoveryCode(t.Context(), models.UserStudent, 1, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode of another user's code error = %v, want ErrNotFound", err)
+	}
+	if remaining, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 2, "b"); err != nil || remaining != 2 {
+		t.Errorf("UseRecoveryCode of admin 2 = %d, %v, want 2 left", remaining, err)
+	}
+	if remaining, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "a"); err != nil || remaining != 1 {
+		t.Errorf("UseRecoveryCode(a) = %d, %v, want 1 left", remaining, err)
+	}
+}
+
+func testDeleteTOTP(t *testing.T, s storage.Storage) {
+	if err := s.DeleteTOTP(t.Context(), models.UserAdmin, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteTOTP without a secret error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.CreateTOTP(t.Context(), newTOTP(models.UserAdmin, 1, "SECRET")); err != nil {
+		t.Fatalf("CreateTOTP: %v", err)
+	}
+	if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, 1, 100, []string{"a", "b"}); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	if err := s.DeleteTOTP(t.Context(), models.UserAdmin, 1); err != nil {
+		t.Fatalf("DeleteTOTP: %v", err)
+	}
+	if _, err := s.GetTOTP(t.Context(), models.UserAdmin, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetTOTP after DeleteTOTP error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode after DeleteTOTP error = %v, want ErrNotFound", err)
+	}
+
+	// Setting up again starts over.
+	if err := s.CreateTOTP(t.Context(), newTOTP(models.UserAdmin, 1, "NEW")); err != nil {
+		t.Fatalf("CreateTOTP after DeleteTOTP: %v", err)
+	}
+	if err := s.ConfirmTOTP(t.Context(), models.UserAdmin, 1, 50, []string{"c"}); err != nil {
+		t.Fatalf("ConfirmTOTP after DeleteTOTP: %v", err)
+	}
+	if remaining, err := s.UseRecoveryCode(t.Context(), models.UserAdmin, 1, "c"); err != nil || remaining != 0 {
+		t.Errorf("UseRecoveryCode of a new code = %d, %v, want 0 left", remaining, err)
+	}
+}
+
+func newAPIKey(hash string, adminID int64, permissions ...models.Permission) models.APIKey {
+	return models.APIKey{
+		Name:        "key " + hash,
+		Prefix:      "ctrlb_" + hash,
+		Hash:        hash,
+		Permissions: permissions,
+		CreatedBy:   adminID,
+		CreatedAt:   time.Now().Truncate(time.Second),
+	}
+}
+
+func createAPIKey(t *testing.T, s storage.Storage, key models.APIKey) models.APIKey {
+	t.Helper()
+	created, err := s.CreateAPIKey(t.Context(), key)
+	if err != nil {
+		t.Fatalf("CreateAPIKey(%s): %v", key.Hash, err)
+	}
+	return created
+}
+
+func testAPIKeys(t *testing.T, s storage.Storage) {
+	admin := createAdmin(t, s, "meera@example.com")
+
+	if _, err := s.GetAPIKeyByHash(t.Context(), "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAPIKeyByHash(missing) error = %v, want ErrNotFound", err)
+	}
+
+	want := newAPIKey("h1", admin, models.PermissionStudentsRead, models.PermissionCoursesWrite, models.PermissionStudentsRead)
+	expires := want.CreatedAt.Add(24 * time.Hour)
+	want.ExpiresAt = &expires
+	created := createAPIKey(t, s, want)
+	if created.ID <= 0 || created.Name != want.Name || created.Prefix != want.Prefix || created.CreatedBy != admin ||
+		!created.CreatedAt.Equal(want.CreatedAt) || created.ExpiresAt == nil || !created.ExpiresAt.Equal(expires) ||
+		created.LastUsedAt != nil || created.RevokedAt != nil {
+		t.Errorf("CreateAPIKey = %+v", created)
+	}
+	if !samePermissions(created.Permissions, models.PermissionCoursesWrite, models.PermissionStudentsRead) {
+		t.Errorf("CreateAPIKey permissions = %v, want sorted without duplicates", created.Permissions)
+	}
+
+	got, err := s.GetAPIKeyByHash(t.Context(), "h1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if got.ID != created.ID || got.Hash != "h1" || !samePermissions(got.Permissions, created.Permissions...) {
+		t.Errorf("GetAPIKeyByHash = %+v, want %+v", got, created)
+	}
+
+	// A key that never expires.
+	second := createAPIKey(t, s, newAPIKey("h2", admin))
+	if second.ExpiresAt != nil || len(second.Permissions) != 0 {
+		t.Errorf("CreateAPIKey without expiry or permissions = %+v", second)
+	}
+
+	if _, err := s.CreateAPIKey(t.Context(), newAPIKey("h1", admin)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("CreateAPIKey with a taken hash error = %v, want ErrConflict", err)
+	}
+	if _, err := s.CreateAPIKey(t.Context(), newAPIKey("h3", admin, "students:delete")); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("CreateAPIKey with an unknown permission error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.CreateAPIKey(t.Context(), newAPIKey("h4", admin+100)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("CreateAPIKey by an unknown admin error = %v, want ErrNotFound", err)
+	}
+
+	keys, err := s.GetAPIKeys(t.Context())
+	if err != nil {
+		t.Fatalf("GetAPIKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != created.ID || keys[1].ID != second.ID {
+		t.Errorf("GetAPIKeys = %+v, want h1 and h2 in creation order", keys)
+	}
+
+	used := time.Now().Truncate(time.Second)
+	if err := s.TouchAPIKey(t.Context(), created.ID, used); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	if got, err := s.GetAPIKeyByHash(t.Context(), "h1"); err != nil || got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+		t.Errorf("GetAPIKeyByHash after TouchAPIKey = %+v, %v, want last used %v", got, err, used)
+	}
+	if err := s.TouchAPIKey(t.Context(), second.ID+100, used); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("TouchAPIKey(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testRevokeAPIKey(t *testing.T, s storage.Storage) {
+	admin := createAdmin(t, s, "meera@example.com")
+	key := createAPIKey(t, s, newAPIKey("h1", admin, models.PermissionStudentsRead))
+	if !key.Usable(time.Now()) {
+		t.Errorf("new key %+v is not usable", key)
+	}
+
+	if err := s.RevokeAPIKey(t.Context(), key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	first, err := s.GetAPIKeyByHash(t.Context(), "h1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash of a revoked key: %v", err)
+	}
+	if first.RevokedAt == nil || first.Usable(time.Now()) {
+		t.Fatalf("revoked key = %+v", first)
+	}
+
+	// Revoking again succeeds and keeps the first revocation time.
+	if err := s.RevokeAPIKey(t.Context(), key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey again: %v", err)
+	}
+	again, err := s.GetAPIKeyByHash(t.Context(), "h1")
+	if err != nil || again.RevokedAt == nil || !again.RevokedAt.Equal(*first.RevokedAt) {
+		t.Errorf("revoked twice = %+v, %v, want revoked at %v", again, err, first.RevokedAt)
+	}
+
+	if err := s.RevokeAPIKey(t.Context(), key.ID+100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("RevokeAPIKey(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDeleteAdminDeletesAPIKeys(t *testing.T, s storage.Storage) {
+	meera := createAdmin(t, s, "meera@example.com")
+	ravi := createAdmin(t, s, "ravi@example.com")
+	createAPIKey(t, s, newAPIKey("meera", meera))
+	kept := createAPIKey(t, s, newAPIKey("ravi", ravi))
+
+	if err := s.DeleteAdmin(t.Context(), meera); err != nil {
+		t.Fatalf("DeleteAdmin: %v", err)
+	}
+	if _, err := s.GetAPIKeyByHash(t.Context(), "meera"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAPIKeyByHash of a deleted admin's key error = %v, want ErrNotFound", err)
+	}
+	keys, err := s.GetAPIKeys(t.Context())
+	if err != nil || len(keys) != 1 || keys[0].ID != kept.ID {
+		t.Errorf("GetAPIKeys after DeleteAdmin = %+v, %v, want only ravi's key", keys, err)
+	}
+}
+
+func newIdentity(subject string, userType models.UserType, userID int64) models.ExternalIdentity {
+	return models.ExternalIdentity{
+		Issuer:    "https://idp.example.com",
+		Subject:   subject,
+		UserType:  userType,
+		UserID:    userID,
+		Email:     subject + "@example.com",
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func testIdentities(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	admin := createAdmin(t, s, "meera@example.com")
+
+	if _, err := s.GetIdentity(t.Context(), "https://idp.example.com", "asha"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetIdentity(unlinked) error = %v, want ErrNotFound", err)
+	}
+
+	for _, want := range []models.ExternalIdentity{newIdentity("asha", models.UserStudent, student), newIdentity("meera", models.UserAdmin, admin)} {
+		if err := s.LinkIdentity(t.Context(), want); err != nil {
+			t.Fatalf("LinkIdentity(%s): %v", want.Subject, err)
+		}
+		got, err := s.GetIdentity(t.Context(), want.Issuer, want.Subject)
+		createdAt := got.CreatedAt
+		got.CreatedAt = want.CreatedAt
+		if err != nil || got != want || !createdAt.Equal(want.CreatedAt) {
+			t.Errorf("GetIdentity(%s) = %+v, %v, want %+v", want.Subject, got, err, want)
+		}
+	}
+
+	// Subjects are only unique within their issuer.
+	other := newIdentity("asha", models.UserAdmin, admin)
+	other.Issuer = "https://other.example.com"
+	if err := s.LinkIdentity(t.Context(), other); err != nil {
+		t.Errorf("LinkIdentity of another issuer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity models.ExternalIdentity
+		want     error
+	}{
+		{"linked identity", newIdentity("asha", models.UserAdmin, admin), storage.ErrConflict},
+		{"unknown student", newIdentity("ravi", models.UserStudent, student+100), storage.ErrNotFound},
+		{"unknown admin", newIdentity("ravi", models.UserAdmin, admin+100), storage.ErrNotFound},
+		{"unknown user type", newIdentity("ravi", "guest", student), storage.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.LinkIdentity(t.Context(), tt.identity); !errors.Is(err, tt.want) {
+				t.Errorf("LinkIdentity error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func testDeleteAdminUnlinksIdentities(t *testing.T, s storage.Storage) {
+	meera := createAdmin(t, s, "meera@example.com")
+	createAdmin(t, s, "ravi@example.com")
+	if err := s.LinkIdentity(t.Context(), newIdentity("meera", models.UserAdmin, meera)); err != nil {
+		t.Fatalf("LinkIdentity: %v", err)
+	}
+
+	if err := s.DeleteAdmin(t.Context(), meera); err != nil {
+		t.Fatalf("DeleteAdmin: %v", err)
+	}
+	if _, err := s.GetIdentity(t.Context(), "https://idp.example.com", "meera"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetIdentity of a deleted admin error = %v, want ErrNotFound", err)
+	}
+}
+
+func contextCalls(s storage.Storage, student int64, course int64) []struct {
+	name string
+	call func(ctx context.Context) error
+} {
+	return []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"CreateStudent", func(ctx context.Context) error {
+			_, err := s.CreateStudent(ctx, "Late", "late@example.com", "x", 20, "male", "1", "2005-01-01", "Indore")
+			return err
+		}},
+		{"GetStudentById", func(ctx context.Context) error {
+			_, err := s.GetStudentById(ctx, student)
+			return err
+		}},
+		{"GetAllCourses", func(ctx context.Context) error {
+			_, err := s.GetAllCourses(ctx)
+			return err
+		}},
+		{"UpdateCourse", func(ctx context.Context) error {
+			return s.UpdateCourse(ctx, course, newCourse("Renamed"))
+		}},
+		{"EnrollStudent", func(ctx context.Context) error {
+			_, err := s.EnrollStudent(ctx, student, course)
+			return err
+		}},
+		{"GetWaitlistByStudentID", func(ctx context.Context) error {
+			_, err := s.GetWaitlistByStudentID(ctx, student)
+			return err
+		}},
+		{"GetStudentsByCourseID", func(ctx context.Context) error {
+			_, err := s.GetStudentsByCourseID(ctx, course)
+			return err
+		}},
+		{"SubmitApplication", func(ctx context.Context) error {
+			_, err := s.SubmitApplication(ctx, student, course, nil)
+			return err
+		}},
+		{"GetApplications", func(ctx context.Context) error {
+			_, err := s.GetApplications(ctx)
+			return err
+		}},
+		{"GetAllAdmins", func(ctx context.Context) error {
+			_, err := s.GetAllAdmins(ctx)
+			return err
+		}},
+		{"GetAllRoles", func(ctx context.Context) error {
+			_, err := s.GetAllRoles(ctx)
+			return err
+		}},
+		{"RevokeUserTokens", func(ctx context.Context) error {
+			_, err := s.RevokeUserTokens(ctx, models.UserStudent, student)
+			return err
+		}},
+		{"RotateRefreshToken", func(ctx context.Context) error {
+			_, err := s.RotateRefreshToken(ctx, "late", newRefreshToken("later", "", "", 0, time.Hour))
+			return err
+		}},
+		{"RecordLoginFailure", func(ctx context.Context) error {
+			_, err := s.RecordLoginFailure(ctx, "ip:192.0.2.1", time.Now(), time.Hour)
+			return err
+		}},
+		{"GetAuditEntries", func(ctx context.Context) error {
+			_, err := s.GetAuditEntries(ctx, 10)
+			return err
+		}},
+		{"CreateTOTP", func(ctx context.Context) error {
+			return s.CreateTOTP(ctx, newTOTP(models.UserStudent, student, "SECRET"))
+		}},
+		{"GetTOTP", func(ctx context.Context) error {
+			_, err := s.GetTOTP(ctx, models.UserStudent, student)
+			return err
+		}},
+		{"CreateAPIKey", func(ctx context.Context) error {
+			_, err := s.CreateAPIKey(ctx, newAPIKey("late", 1))
+			return err
+		}},
+		{"GetAPIKeys", func(ctx context.Context) error {
+			_, err := s.GetAPIKeys(ctx)
+			return err
+		}},
+		{"LinkIdentity", func(ctx context.Context) error {
+			return s.LinkIdentity(ctx, newIdentity("late", models.UserStudent, student))
+		}},
+		{"GetIdentity", func(ctx context.Context) error {
+			_, err := s.GetIdentity(ctx, "https://idp.example.com", "late")
+			return err
+		}},
+	}
+}
+
+func testCanceledContext(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	course := createCourse(t, s, newCourse("Algorithms"))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	for _, tt := range contextCalls(s, student, course) {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s with a canceled context = %v, want context.Canceled", tt.name, err)
+			}
+			if errors.Is(err, storage.ErrTimeout) {
+				t.Errorf("%s with a canceled context reported a timeout", tt.name)
+			}
+		})
+	}
+}
+
+func testExpiredDeadline(t *testing.T, s storage.Storage) {
+	student := createStudent(t, s, newStudent("asha@example.com"))
+	course := createCourse(t, s, newCourse("Algorithms"))
+
+	ctx, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for _, tt := range contextCalls(s, student, course) {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(ctx); !errors.Is(err, storage.ErrTimeout) {
+				t.Errorf("%s past its deadline = %v, want storage.ErrTimeout", tt.name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, which tells a bearer API key apart from
+// a session token.
+const APIKeyPrefix = "ctrlb_"
+
+// apiKeyShown is how many leading characters of a key are kept in the clear,
+// so admins can tell their keys apart.
+const apiKeyShown = len(APIKeyPrefix) + 6
+
+// apiKeyTouchInterval is how stale a key's last use may get before a request
+// records it again, so busy clients do not write on every request.
+const apiKeyTouchInterval = time.Minute
+
+// ErrPermissionNotHeld means an admin asked for an API key with a permission
+// they do not hold themselves.
+var ErrPermissionNotHeld = errors.New("permission not held")
+
+// IsAPIKey reports whether a bearer token is an API key rather than a session
+// token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// CreateAPIKey issues a key that acts for the admin with the given
+// permissions, all of which the admin must hold. A nil expiresAt makes a key
+// that lasts until it is revoked. The key itself is returned but never
+// stored, so it cannot be shown again.
+func CreateAPIKey(ctx context.Context, s storage.Storage, adminID int64, name string, permissions []models.Permission, expiresAt *time.Time, ip string) (string, models.APIKey, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", models.APIKey{}, storage.Errorf(storage.ErrInvalid, "expires_at must be in the future")
+	}
+	held, err := s.GetAdminPermissions(ctx, adminID)
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	for _, permission := range permissions {
+		if !permission.Valid() {
+			return "", models.APIKey{}, storage.Errorf(storage.ErrInvalid, "unknown permission %q", permission)
+		}
+		if !models.HasPermission(held, permission) {
+			return "", models.APIKey{}, fmt.Errorf("%w: %s", ErrPermissionNotHeld, permission)
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	raw := APIKeyPrefix + secret
+	key, err := s.CreateAPIKey(ctx, models.APIKey{
+		Name:        name,
+		Prefix:      raw[:apiKeyShown],
+		Hash:        hashToken(raw),
+		Permissions: permissions,
+		CreatedBy:   adminID,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	Audit(ctx, s, models.AuditEntry{
+		Event:     models.AuditAPIKeyCreated,
+		ActorType: models.UserAdmin,
+		ActorID:   adminID,
+		Subject:   apiKeySubject(key.ID),
+		IP:        ip,
+		Detail:    key.Name,
+	})
+	return raw, key, nil
+}
+
+// RevokeAPIKey stops the key with id from working, on behalf of the admin.
+func RevokeAPIKey(ctx context.Context, s storage.Storage, adminID int64, id int64, ip string) error {
+	if err := s.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+	Audit(ctx, s, models.AuditEntry{Event: models.AuditAPIKeyRevoked, ActorType: models.UserAdmin, ActorID: adminID, Subject: apiKeySubject(id), IP: ip})
+	return nil
+}
+
+// VerifyAPIKey returns the stored key of raw and records that it was used.
+// An unknown or expired key is ErrInvalidToken; a revoked one is
+// ErrRevokedToken.
+func VerifyAPIKey(ctx context.Context, s storage.Storage, raw string) (models.APIKey, error) {
+	key, err := s.GetAPIKeyByHash(ctx, hashToken(raw))
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.APIKey{}, ErrInvalidToken
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return models.APIKey{}, ErrRevokedToken
+	}
+	if !key.Usable(now) {
+		return models.APIKey{}, ErrInvalidToken
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		// The request goes ahead even if its use cannot be recorded.
+		if err := s.TouchAPIKey(ctx, key.ID, now); err != nil {
+			slog.Error("Could not record API key use", slog.Int64("key", key.ID), slog.String("error", err.Error()))
+		}
+	}
+	return key, nil
+}
+
+// APIKeyPermissions returns the permissions a key grants: those of its own
+// that its creator still holds, so taking a role from an admin also takes it
+// from their keys.
+func APIKeyPermissions(ctx context.Context, s storage.Storage, key models.APIKey) ([]models.Permission, error) {
+	held, err := s.GetAdminPermissions(ctx, key.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	granted := []models.Permission{}
+	for _, permission := range key.Permissions {
+		if models.HasPermission(held, permission) {
+			granted = append(granted, permission)
+		}
+	}
+	return granted, nil
+}
+
+func apiKeySubject(id int64) string {
+	return fmt.Sprintf("apikey:%d", id)
+}
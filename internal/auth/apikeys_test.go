@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// superadmin creates an admin holding the superadmin role.
+func superadmin(t *testing.T, s *memory.Memory, email string) int64 {
+	t.Helper()
+	id, err := s.CreateAdmin(t.Context(), "Admin", email, "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	if err := s.AssignRole(t.Context(), id, models.RoleSuperadmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	return id
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	s := memory.New()
+	admin := superadmin(t, s, "root@example.com")
+
+	expires := time.Now().Add(time.Hour)
+	raw, key, err := auth.CreateAPIKey(t.Context(), s, admin, "nightly export", []models.Permission{models.PermissionStudentsRead}, &expires, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !auth.IsAPIKey(raw) || !strings.HasPrefix(raw, key.Prefix) || len(key.Prefix) >= len(raw) {
+		t.Errorf("CreateAPIKey = %q with prefix %q", raw, key.Prefix)
+	}
+	if key.CreatedBy != admin || key.Name != "nightly export" || !key.Usable(time.Now()) {
+		t.Errorf("CreateAPIKey stored %+v", key)
+	}
+	if strings.Contains(key.Hash, raw) {
+		t.Errorf("the key is stored in the clear: %+v", key)
+	}
+	entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditAPIKeyCreated)
+	if err != nil || len(entries) != 1 || entries[0].ActorID != admin || entries[0].Detail != "nightly export" {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name        string
+		permissions []models.Permission
+		expiresAt   *time.Time
+		want        error
+	}{
+		{"permission not held", []models.Permission{models.PermissionProfileUpdate}, nil, auth.ErrPermissionNotHeld},
+		{"unknown permission", []models.Permission{"students:delete"}, nil, storage.ErrInvalid},
+		{"expired", []models.Permission{models.PermissionStudentsRead}, &past, storage.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := auth.CreateAPIKey(t.Context(), s, admin, "key", tt.permissions, tt.expiresAt, ""); !errors.Is(err, tt.want) {
+				t.Errorf("CreateAPIKey error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	s := memory.New()
+	admin := superadmin(t, s, "root@example.com")
+	raw, key, err := auth.CreateAPIKey(t.Context(), s, admin, "export", []models.Permission{models.PermissionStudentsRead}, nil, "")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	got, err := auth.VerifyAPIKey(t.Context(), s, raw)
+	if err != nil || got.ID != key.ID {
+		t.Fatalf("VerifyAPIKey = %+v, %v", got, err)
+	}
+	stored, err := s.GetAPIKeyByHash(t.Context(), key.Hash)
+	if err != nil || stored.LastUsedAt == nil {
+		t.Fatalf("key after use = %+v, %v, want its last use recorded", stored, err)
+	}
+	// Uses within a minute of the last recorded one are not written.
+	if _, err := auth.VerifyAPIKey(t.Context(), s, raw); err != nil {
+		t.Fatalf("VerifyAPIKey again: %v", err)
+	}
+	if again, _ := s.GetAPIKeyByHash(t.Context(), key.Hash); !again.LastUsedAt.Equal(*stored.LastUsedAt) {
+		t.Errorf("last use moved from %v to %v within a minute", stored.LastUsedAt, again.LastUsedAt)
+	}
+
+	if _, err := auth.VerifyAPIKey(t.Context(), s, raw+"x"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("VerifyAPIKey of an unknown key error = %v, want ErrInvalidToken", err)
+	}
+
+	// A key that expired; the hash is how keys are stored.
+	expiredRaw := auth.APIKeyPrefix + "expired"
+	sum := sha256.Sum256([]byte(expiredRaw))
+	expiresAt := time.Now().Add(-time.Minute)
+	if _, err := s.CreateAPIKey(t.Context(), models.APIKey{Name: "old", Prefix: auth.APIKeyPrefix, Hash: hex.EncodeToString(sum[:]), CreatedBy: admin, CreatedAt: time.Now().Add(-time.Hour), ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("CreateAPIKey(expired): %v", err)
+	}
+	if _, err := auth.VerifyAPIKey(t.Context(), s, expiredRaw); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("VerifyAPIKey of an expired key error = %v, want ErrInvalidToken", err)
+	}
+
+	if err := auth.RevokeAPIKey(t.Context(), s, admin, key.ID, ""); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := auth.VerifyAPIKey(t.Context(), s, raw); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("VerifyAPIKey of a revoked key error = %v, want ErrRevokedToken", err)
+	}
+	if entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditAPIKeyRevoked); err != nil || len(entries) != 1 {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+}
+
+func TestAPIKeyPermissions(t *testing.T) {
+	s := memory.New()
+	superadmin(t, s, "root@example.com")
+	admin := superadmin(t, s, "ops@example.com")
+	if err := s.AssignRole(t.Context(), admin, "registrar"); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	_, key, err := auth.CreateAPIKey(t.Context(), s, admin, "ops", []models.Permission{models.PermissionAdminsRead, models.PermissionStudentsRead}, nil, "")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	// Taking superadmin from the admin takes admins:read from the key too,
+	// while registrar still grants students:read.
+	if err := s.UnassignRole(t.Context(), admin, models.RoleSuperadmin); err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	permissions, err := auth.APIKeyPermissions(t.Context(), s, key)
+	if err != nil {
+		t.Fatalf("APIKeyPermissions: %v", err)
+	}
+	if len(permissions) != 1 || permissions[0] != models.PermissionStudentsRead {
+		t.Errorf("APIKeyPermissions = %v, want [students:read]", permissions)
+	}
+}
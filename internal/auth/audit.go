@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"context"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"log/slog"
+	"time"
+)
+
+// Audit records a security event in the audit log and the server log. A
+// failure to record it is logged rather than returned: the event has
+// happened either way.
+func Audit(ctx context.Context, s storage.Storage, entry models.AuditEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	slog.Warn("Audit", slog.String("event", string(entry.Event)), slog.String("subject", entry.Subject),
+		slog.String("ip", entry.IP), slog.String("detail", entry.Detail))
+
+	if _, err := s.CreateAuditEntry(ctx, entry); err != nil {
+		slog.Error("Could not record audit entry", slog.String("event", string(entry.Event)), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,315 @@
+// Package auth issues and verifies session tokens. A login hands out a
+// short-lived JWT access token in the auth_token cookie and an opaque refresh
+// token in the refresh_token cookie, or in the response body for clients that
+// send Prefer: bearer and then present the access token as an Authorization:
+// Bearer header. Every access token carries a jti under
+// which it is recorded in storage, so it can be revoked before it expires;
+// refresh tokens are stored hashed and replaced on every use. The tokens of
+// one login share a family, which is revoked as a whole on logout or when a
+// used refresh token is presented again. Access tokens are signed with the
+// signing key of a Keys set and verified with any key in it.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// CookieName is the cookie holding the access token.
+const CookieName = "auth_token"
+
+// RefreshCookieName is the cookie holding the refresh token. It is only sent
+// to RefreshPath.
+const RefreshCookieName = "refresh_token"
+
+// RefreshPath is where refresh tokens are exchanged.
+const RefreshPath = "/api/auth/refresh"
+
+var (
+	// ErrInvalidToken means the token is malformed, badly signed, expired or
+	// unknown.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrRevokedToken means the access token was revoked, or is not on record.
+	ErrRevokedToken = errors.New("token revoked")
+	// ErrRefreshReused means a refresh token was presented after it had been
+	// used, so it was probably stolen. Its whole family is now revoked.
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// Session is what a login or a refresh hands the client.
+type Session struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Claims are the claims of a session token. The jti is RegisteredClaims.ID.
+type Claims struct {
+	Email    string          `json:"email"`
+	UserID   int64           `json:"id"`
+	UserType models.UserType `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Login starts a new token family for the user, with an access token and
+// its first refresh token.
+func Login(ctx context.Context, s storage.Storage, keys *Keys, cfg config.Config, userType models.UserType, userID int64, email string) (Session, error) {
+	family, err := newID()
+	if err != nil {
+		return Session{}, err
+	}
+
+	refresh, stored, err := newRefreshToken(cfg)
+	if err != nil {
+		return Session{}, err
+	}
+	stored.Family = family
+	stored.UserType = userType
+	stored.UserID = userID
+	if err := s.CreateRefreshToken(ctx, stored); err != nil {
+		return Session{}, err
+	}
+
+	return issue(ctx, s, keys, cfg, family, userType, userID, email, refresh, stored.ExpiresAt)
+}
+
+// Refresh exchanges a refresh token for a new access token and the next
+// refresh token of its family. The account is looked up again, so a deleted
+// or disabled admin cannot refresh.
+func Refresh(ctx context.Context, s storage.Storage, keys *Keys, cfg config.Config, refreshToken string) (Session, error) {
+	refresh, next, err := newRefreshToken(cfg)
+	if err != nil {
+		return Session{}, err
+	}
+
+	stored, err := s.RotateRefreshToken(ctx, hashToken(refreshToken), next)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		return Session{}, ErrRefreshReused
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalid):
+		return Session{}, ErrInvalidToken
+	case err != nil:
+		return Session{}, err
+	}
+
+	var email string
+	switch stored.UserType {
+	case models.UserStudent:
+		student, err := s.GetStudentById(ctx, stored.UserID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return Session{}, err
+		}
+		if err != nil {
+			return Session{}, revokeFamily(ctx, s, stored.Family)
+		}
+		email = student.Email
+	case models.UserAdmin:
+		admin, err := s.GetAdminById(ctx, stored.UserID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return Session{}, err
+		}
+		if err != nil || admin.Disabled {
+			return Session{}, revokeFamily(ctx, s, stored.Family)
+		}
+		email = admin.Email
+	}
+
+	return issue(ctx, s, keys, cfg, stored.Family, stored.UserType, stored.UserID, email, refresh, stored.ExpiresAt)
+}
+
+// Logout revokes the family of the access token jti, ending the login it
+// came from. Tokens issued before families existed are revoked alone.
+func Logout(ctx context.Context, s storage.Storage, jti string) error {
+	token, err := s.GetToken(ctx, jti)
+	if err != nil {
+		return err
+	}
+	if token.Family == "" {
+		return s.RevokeToken(ctx, jti)
+	}
+	_, err = s.RevokeTokenFamily(ctx, token.Family)
+	return err
+}
+
+// issue records and signs a new access token in family and pairs it with
+// the given refresh token.
+func issue(ctx context.Context, s storage.Storage, keys *Keys, cfg config.Config, family string, userType models.UserType, userID int64, email string, refresh string, refreshExpiresAt time.Time) (Session, error) {
+	jti, err := newID()
+	if err != nil {
+		return Session{}, err
+	}
+
+	// JWT times have second precision; the stored ones match them.
+	now := time.Now().UTC().Truncate(time.Second)
+	token := models.Token{
+		JTI:       jti,
+		Family:    family,
+		UserType:  userType,
+		UserID:    userID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(cfg.Auth.AccessTokenLifetime),
+	}
+	if err := s.CreateToken(ctx, token); err != nil {
+		return Session{}, err
+	}
+
+	claims := Claims{
+		Email:    email,
+		UserID:   userID,
+		UserType: userType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(token.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+		},
+	}
+	signed, err := keys.sign(claims)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{
+		AccessToken:      signed,
+		AccessExpiresAt:  token.ExpiresAt,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a new opaque refresh token and the record that
+// stores its hash, without family or user.
+func newRefreshToken(cfg config.Config) (string, models.RefreshToken, error) {
+	token, err := newSecret()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	return token, models.RefreshToken{
+		Hash:      hashToken(token),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(cfg.Auth.RefreshTokenLifetime),
+	}, nil
+}
+
+// newSecret returns an opaque token of 32 random bytes.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh and password reset tokens are stored. They are
+// random, so an unsalted hash is enough to keep a database leak from
+// exposing them.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// revokeFamily ends a login whose account is gone or disabled, and reports
+// the refresh as invalid.
+func revokeFamily(ctx context.Context, s storage.Storage, family string) error {
+	if _, err := s.RevokeTokenFamily(ctx, family); err != nil {
+		return err
+	}
+	return ErrInvalidToken
+}
+
+// Parse checks the signature and expiry of raw and returns its claims,
+// without consulting storage. Access tokens carry no audience; tokens with
+// one, such as pending logins, are refused.
+func Parse(keys *Keys, raw string) (*Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(raw, &claims, keys.accessKey, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.ID == "" || len(claims.Audience) != 0 || !claims.UserType.Valid() {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Verify parses raw and checks that its token is on record and not revoked.
+// Tokens issued before tokens were recorded carry no jti and are invalid.
+func Verify(ctx context.Context, s storage.Storage, keys *Keys, raw string) (*Claims, error) {
+	claims, err := Parse(keys, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.GetToken(ctx, claims.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrRevokedToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Revoked() || token.UserType != claims.UserType || token.UserID != claims.UserID {
+		return nil, ErrRevokedToken
+	}
+	return claims, nil
+}
+
+// SetCookies stores a session's tokens in the auth_token and refresh_token
+// cookies, and starts a new CSRF token in the csrf_token cookie.
+func SetCookies(w http.ResponseWriter, cfg config.Config, session Session) {
+	http.SetCookie(w, cookie(cfg, CookieName, session.AccessToken, "/", session.AccessExpiresAt, true, http.SameSiteLaxMode))
+	http.SetCookie(w, cookie(cfg, RefreshCookieName, session.RefreshToken, RefreshPath, session.RefreshExpiresAt, true, http.SameSiteStrictMode))
+	http.SetCookie(w, cookie(cfg, CSRFCookieName, newCSRFToken(), "/", session.RefreshExpiresAt, false, http.SameSiteLaxMode))
+}
+
+// ClearCookies tells the browser to drop the session cookies.
+func ClearCookies(w http.ResponseWriter, cfg config.Config) {
+	http.SetCookie(w, expiredCookie(cfg, CookieName, "/", true, http.SameSiteLaxMode))
+	http.SetCookie(w, expiredCookie(cfg, RefreshCookieName, RefreshPath, true, http.SameSiteStrictMode))
+	http.SetCookie(w, expiredCookie(cfg, CSRFCookieName, "/", false, http.SameSiteLaxMode))
+}
+
+// CleanupExpired deletes expired tokens and login throttles every interval
+// until ctx is done. Expired tokens are refused anyway, and expired throttles
+// count nothing, so their records are no longer needed.
+func CleanupExpired(ctx context.Context, s storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if deleted, err := s.DeleteExpiredTokens(ctx, now); err != nil {
+				slog.Error("Failed to delete expired tokens", slog.String("error", err.Error()))
+			} else if deleted > 0 {
+				slog.Info("Deleted expired tokens", slog.Int64("count", deleted))
+			}
+			if deleted, err := s.DeleteExpiredLoginThrottles(ctx, now); err != nil {
+				slog.Error("Failed to delete expired login throttles", slog.String("error", err.Error()))
+			} else if deleted > 0 {
+				slog.Info("Deleted expired login throttles", slog.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
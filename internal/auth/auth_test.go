@@ -0,0 +1,235 @@
+package auth_test
+
+import (
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const secret = "test-secret"
+
+var cfg = config.Config{
+	JWTSecret: secret,
+	Auth: config.AuthConfig{
+		AccessTokenLifetime:  15 * time.Minute,
+		RefreshTokenLifetime: time.Hour,
+	},
+}
+
+func loadKeys(t *testing.T, cfg config.Config) *auth.Keys {
+	t.Helper()
+	keys, err := auth.LoadKeys(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	return keys
+}
+
+func TestLoginAndVerify(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, 3, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if session.RefreshToken == "" || !session.RefreshExpiresAt.After(session.AccessExpiresAt) {
+		t.Errorf("session = %+v", session)
+	}
+
+	claims, err := auth.Verify(t.Context(), s, keys, session.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.UserType != models.UserStudent || claims.UserID != 3 || claims.Email != "asha@example.com" || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != cfg.Auth.AccessTokenLifetime {
+		t.Errorf("access token lifetime = %v, want %v", lifetime, cfg.Auth.AccessTokenLifetime)
+	}
+
+	token, err := s.GetToken(t.Context(), claims.ID)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if !token.ExpiresAt.Equal(claims.ExpiresAt.Time) {
+		t.Errorf("stored expiry %v, token expiry %v", token.ExpiresAt, claims.ExpiresAt.Time)
+	}
+
+	if _, err := auth.Verify(t.Context(), s, loadKeys(t, config.Config{JWTSecret: "other-secret"}), session.AccessToken); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Verify with the wrong secret error = %v, want ErrInvalidToken", err)
+	}
+
+	if err := s.RevokeToken(t.Context(), claims.ID); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, session.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Verify after revocation error = %v, want ErrRevokedToken", err)
+	}
+}
+
+func TestVerifyRejectsUnrecordedTokens(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	sign := func(claims jwt.MapClaims) string {
+		t.Helper()
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return raw
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	// Tokens issued before revocation existed carry no jti.
+	legacy := sign(jwt.MapClaims{"id": 1, "role": "admin", "exp": exp})
+	if _, err := auth.Verify(t.Context(), s, keys, legacy); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("token without jti error = %v, want ErrInvalidToken", err)
+	}
+
+	forged := sign(jwt.MapClaims{"id": 1, "role": "admin", "exp": exp, "jti": "never-issued"})
+	if _, err := auth.Verify(t.Context(), s, keys, forged); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("unrecorded token error = %v, want ErrRevokedToken", err)
+	}
+
+	noExpiry := sign(jwt.MapClaims{"id": 1, "role": "admin", "jti": "x"})
+	if _, err := auth.Verify(t.Context(), s, keys, noExpiry); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("token without exp error = %v, want ErrInvalidToken", err)
+	}
+
+	// A recorded jti must belong to the user the token names.
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, 3, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := auth.Parse(keys, session.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	stolen := sign(jwt.MapClaims{"id": 1, "role": "admin", "exp": exp, "jti": claims.ID})
+	if _, err := auth.Verify(t.Context(), s, keys, stolen); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("token reusing another user's jti error = %v, want ErrRevokedToken", err)
+	}
+}
+
+func TestRefreshRotates(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	id, err := s.CreateAdmin(t.Context(), "Meera", "meera@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	first, err := auth.Login(t.Context(), s, keys, cfg, models.UserAdmin, id, "meera@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	second, err := auth.Refresh(t.Context(), s, keys, cfg, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Errorf("Refresh did not rotate the tokens")
+	}
+	claims, err := auth.Verify(t.Context(), s, keys, second.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify(refreshed): %v", err)
+	}
+	if claims.UserType != models.UserAdmin || claims.UserID != id || claims.Email != "meera@example.com" {
+		t.Errorf("refreshed claims = %+v", claims)
+	}
+	// The earlier access token stays valid until it expires.
+	if _, err := auth.Verify(t.Context(), s, keys, first.AccessToken); err != nil {
+		t.Errorf("Verify(first): %v", err)
+	}
+
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, "not-a-refresh-token"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("unknown refresh token error = %v, want ErrInvalidToken", err)
+	}
+
+	// Logging out ends every token of the login.
+	if err := auth.Logout(t.Context(), s, claims.ID); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, first.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Verify(first) after logout error = %v, want ErrRevokedToken", err)
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, second.RefreshToken); err == nil {
+		t.Errorf("Refresh after logout succeeded")
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", "hash", 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	victim, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	other, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// An attacker refreshes first; the victim's later refresh reuses the token.
+	stolen, err := auth.Refresh(t.Context(), s, keys, cfg, victim.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, victim.RefreshToken); !errors.Is(err, auth.ErrRefreshReused) {
+		t.Fatalf("reused refresh token error = %v, want ErrRefreshReused", err)
+	}
+
+	for name, raw := range map[string]string{"original": victim.AccessToken, "stolen": stolen.AccessToken} {
+		if _, err := auth.Verify(t.Context(), s, keys, raw); !errors.Is(err, auth.ErrRevokedToken) {
+			t.Errorf("Verify(%s) after reuse error = %v, want ErrRevokedToken", name, err)
+		}
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, stolen.RefreshToken); !errors.Is(err, auth.ErrRefreshReused) {
+		t.Errorf("Refresh(stolen) after reuse error = %v, want ErrRefreshReused", err)
+	}
+
+	// The student's other login is untouched.
+	if _, err := auth.Verify(t.Context(), s, keys, other.AccessToken); err != nil {
+		t.Errorf("Verify(other login): %v", err)
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, other.RefreshToken); err != nil {
+		t.Errorf("Refresh(other login): %v", err)
+	}
+}
+
+func TestRefreshRefusesDisabledAdmin(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	// Ravi keeps an enabled admin around, so Meera can be disabled.
+	if _, err := s.CreateAdmin(t.Context(), "Ravi", "ravi@example.com", "hash"); err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	id, err := s.CreateAdmin(t.Context(), "Meera", "meera@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserAdmin, id, "meera@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := s.SetAdminDisabled(t.Context(), id, true); err != nil {
+		t.Fatalf("SetAdminDisabled: %v", err)
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, session.RefreshToken); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Refresh for a disabled admin error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, session.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Verify after refusing the refresh error = %v, want ErrRevokedToken", err)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"log/slog"
+)
+
+// ErrInvalidCredentials means an authenticator does not know the email or
+// the password is wrong.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// AdminAuthenticator checks the email and password of an admin login and
+// returns the admin it logs in as. Logins it does not accept are
+// ErrInvalidCredentials; other errors mean it could not check.
+type AdminAuthenticator interface {
+	Authenticate(ctx context.Context, email, password string) (models.Admin, error)
+}
+
+// NewAdminAuthenticator returns how admin logins are checked: against the
+// LDAP directory when cfg has one, then against the admins' own passwords.
+func NewAdminAuthenticator(s storage.Storage, cfg config.Config) AdminAuthenticator {
+	local := LocalAdmins{Storage: s}
+	if cfg.Auth.LDAP.URL == "" {
+		return local
+	}
+	return AdminChain{NewLDAP(cfg.Auth.LDAP, s), local}
+}
+
+// LocalAdmins checks passwords against the hashes kept with the admins.
+type LocalAdmins struct {
+	Storage storage.Storage
+}
+
+func (l LocalAdmins) Authenticate(ctx context.Context, email, password string) (models.Admin, error) {
+	admin, err := l.Storage.GetAdminByEmail(ctx, email)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return models.Admin{}, err
+	}
+	// An unknown email is checked against an empty hash, which takes as
+	// long as a wrong password. So is an admin without a password of their
+	// own, such as one who logs in through the directory.
+	if !security.CheckPasswordHash(password, admin.Password) || err != nil {
+		return models.Admin{}, ErrInvalidCredentials
+	}
+	return admin, nil
+}
+
+// AdminChain tries its authenticators in turn and logs in with the first that
+// accepts the login. One that cannot check, such as an unreachable directory,
+// is passed over; its error is returned when no other accepts the login.
+type AdminChain []AdminAuthenticator
+
+func (c AdminChain) Authenticate(ctx context.Context, email, password string) (models.Admin, error) {
+	var failed error
+	for _, authenticator := range c {
+		admin, err := authenticator.Authenticate(ctx, email, password)
+		if err == nil {
+			return admin, nil
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+		slog.Warn("Could not check admin login", slog.String("error", err.Error()))
+		if failed == nil {
+			failed = err
+		}
+	}
+	if failed != nil {
+		return models.Admin{}, failed
+	}
+	return models.Admin{}, ErrInvalidCredentials
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BearerPreference is the Prefer header (RFC 7240) preference with which a
+// client that keeps its own tokens, such as a mobile app or a script, asks
+// for them in response bodies instead of cookies. It sends them back in the
+// Authorization header.
+const BearerPreference = "bearer"
+
+// PrefersBearer reports whether the request asks for tokens in the response
+// body.
+func PrefersBearer(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(name), BearerPreference) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequestToken returns the token of the request's Authorization: Bearer
+// header or, without an Authorization header, of the named cookie. Any other
+// Authorization scheme carries no token.
+func RequestToken(r *http.Request, cookie string) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", false
+		}
+		return token, true
+	}
+
+	c, err := r.Cookie(cookie)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// DeliverSession hands a new session to the client: as fields added to body
+// when it prefers bearer tokens, and otherwise in the session cookies.
+func DeliverSession(w http.ResponseWriter, r *http.Request, cfg config.Config, session Session, body map[string]any) {
+	if !PrefersBearer(r) {
+		SetCookies(w, cfg, session)
+		return
+	}
+	for name, value := range SessionFields(session) {
+		body[name] = value
+	}
+}
+
+// SessionFields are the response fields that hand a session to a client that
+// keeps its own tokens.
+func SessionFields(session Session) map[string]any {
+	return map[string]any{
+		"token_type":         "Bearer",
+		"access_token":       session.AccessToken,
+		"expires_at":         session.AccessExpiresAt.Format(time.RFC3339),
+		"refresh_token":      session.RefreshToken,
+		"refresh_expires_at": session.RefreshExpiresAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,62 @@
+package auth_test
+
+import (
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		cookie        string
+		want          string
+		ok            bool
+	}{
+		{"cookie", "", "from-cookie", "from-cookie", true},
+		{"bearer", "Bearer from-header", "", "from-header", true},
+		{"bearer wins", "bearer from-header", "from-cookie", "from-header", true},
+		{"other scheme", "Basic dXNlcjpwYXNz", "from-cookie", "", false},
+		{"empty bearer", "Bearer ", "from-cookie", "", false},
+		{"nothing", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: auth.CookieName, Value: tt.cookie})
+			}
+			if got, ok := auth.RequestToken(r, auth.CookieName); got != tt.want || ok != tt.ok {
+				t.Errorf("RequestToken = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDeliverSession(t *testing.T) {
+	session := auth.Session{AccessToken: "access", AccessExpiresAt: time.Now().Add(time.Minute), RefreshToken: "refresh", RefreshExpiresAt: time.Now().Add(time.Hour)}
+
+	w := httptest.NewRecorder()
+	body := map[string]any{}
+	auth.DeliverSession(w, httptest.NewRequest("POST", "/", nil), cfg, session, body)
+	if len(w.Result().Cookies()) != 3 || len(body) != 0 {
+		t.Errorf("DeliverSession to a browser set cookies %+v and body %v", w.Result().Cookies(), body)
+	}
+
+	for _, prefer := range []string{"bearer", "respond-async, Bearer", "wait=5, bearer; x=1"} {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Prefer", prefer)
+		body = map[string]any{}
+		auth.DeliverSession(w, r, cfg, session, body)
+		if len(w.Result().Cookies()) != 0 || body["access_token"] != "access" || body["refresh_token"] != "refresh" || body["token_type"] != "Bearer" {
+			t.Errorf("DeliverSession with Prefer: %s set cookies %+v and body %v", prefer, w.Result().Cookies(), body)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetCookies(t *testing.T) {
+	session := auth.Session{AccessToken: "access", AccessExpiresAt: time.Now().Add(time.Minute), RefreshToken: "refresh", RefreshExpiresAt: time.Now().Add(time.Hour)}
+	cookieCfg := func(env string, cookies config.CookieConfig) config.Config {
+		c := cfg
+		c.Env = env
+		c.Auth.Cookies = cookies
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		secure   bool
+		domain   string
+		sameSite map[string]http.SameSite
+	}{
+		{"dev", cookieCfg(config.EnvDev, config.CookieConfig{Secure: config.CookieSecureAuto}), false, "",
+			map[string]http.SameSite{auth.CookieName: http.SameSiteLaxMode, auth.RefreshCookieName: http.SameSiteStrictMode, auth.CSRFCookieName: http.SameSiteLaxMode}},
+		{"production", cookieCfg("production", config.CookieConfig{Secure: config.CookieSecureAuto, Domain: "example.com"}), true, "example.com",
+			map[string]http.SameSite{auth.CookieName: http.SameSiteLaxMode, auth.RefreshCookieName: http.SameSiteStrictMode, auth.CSRFCookieName: http.SameSiteLaxMode}},
+		{"forced", cookieCfg(config.EnvDev, config.CookieConfig{Secure: config.CookieSecureTrue, SameSite: config.SameSiteNone}), true, "",
+			map[string]http.SameSite{auth.CookieName: http.SameSiteNoneMode, auth.RefreshCookieName: http.SameSiteNoneMode, auth.CSRFCookieName: http.SameSiteNoneMode}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			auth.SetCookies(w, tt.cfg, session)
+			cookies := w.Result().Cookies()
+			if len(cookies) != 3 {
+				t.Fatalf("SetCookies set %d cookies, want 3", len(cookies))
+			}
+			for _, c := range cookies {
+				if c.Secure != tt.secure || c.Domain != tt.domain || c.SameSite != tt.sameSite[c.Name] {
+					t.Errorf("cookie %s: Secure %v, Domain %q, SameSite %v", c.Name, c.Secure, c.Domain, c.SameSite)
+				}
+				if c.HttpOnly != (c.Name != auth.CSRFCookieName) {
+					t.Errorf("cookie %s: HttpOnly %v", c.Name, c.HttpOnly)
+				}
+				if c.Value == "" {
+					t.Errorf("cookie %s is empty", c.Name)
+				}
+			}
+
+			w = httptest.NewRecorder()
+			auth.ClearCookies(w, tt.cfg)
+			for _, c := range w.Result().Cookies() {
+				if c.MaxAge >= 0 || c.Domain != tt.domain {
+					t.Errorf("ClearCookies left cookie %s: MaxAge %d, Domain %q", c.Name, c.MaxAge, c.Domain)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		cookie        string
+		header        string
+		ok            bool
+	}{
+		{"safe method", "GET", "", "", "", true},
+		{"matching header", "POST", "", "csrf", "csrf", true},
+		{"bearer", "DELETE", "Bearer token", "", "", true},
+		{"no header", "POST", "", "csrf", "", false},
+		{"wrong header", "PUT", "", "csrf", "other", false},
+		{"no cookie", "POST", "", "", "csrf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(auth.CSRFHeader, tt.header)
+			}
+			err := auth.CheckCSRF(r)
+			if tt.ok && err != nil || !tt.ok && !errors.Is(err, auth.ErrCSRF) {
+				t.Errorf("CheckCSRF = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"log/slog"
+	"slices"
+)
+
+// ErrAccountExists means an external identity that is not linked yet has the
+// email of a portal user. It is not linked to them: the provider or directory
+// saying who someone is does not prove they own an account made elsewhere.
+var ErrAccountExists = errors.New("a portal account already has this email")
+
+// syncRoles gives an admin made for an external identity exactly the given
+// roles. Admins with a password of their own are local accounts, whose roles
+// are only managed in the portal, and are left alone. A role that cannot be
+// assigned or taken away, such as the last role manager's, is logged and left
+// as it is, so the login still goes ahead.
+func syncRoles(ctx context.Context, s storage.Storage, admin models.Admin, roles []string) {
+	if admin.Password != "" {
+		slog.Warn("Not syncing the roles of a local admin", slog.Int64("admin", admin.ID))
+		return
+	}
+	held, err := s.GetAdminRoles(ctx, admin.ID)
+	if err != nil {
+		slog.Error("Could not read admin roles", slog.Int64("admin", admin.ID), slog.String("error", err.Error()))
+		return
+	}
+	names := make([]string, 0, len(held))
+	for _, role := range held {
+		names = append(names, role.Name)
+		if !slices.Contains(roles, role.Name) {
+			if err := s.UnassignRole(ctx, admin.ID, role.Name); err != nil {
+				slog.Warn("Could not take role from admin", slog.Int64("admin", admin.ID), slog.String("role", role.Name), slog.String("error", err.Error()))
+			}
+		}
+	}
+	for _, role := range roles {
+		if !slices.Contains(names, role) {
+			if err := s.AssignRole(ctx, admin.ID, role); err != nil {
+				slog.Warn("Could not assign role to admin", slog.Int64("admin", admin.ID), slog.String("role", role), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
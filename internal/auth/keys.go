@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSPath is where the public verification keys are published.
+const JWKSPath = "/.well-known/jwks.json"
+
+// Algorithms of the keys in config.AuthConfig.Keys.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Keys sign and verify access tokens. Tokens name the key that signed them in
+// their kid header, so several keys can verify at once and the signing key
+// can change without invalidating the tokens already issued. Tokens without
+// a kid are HS256 with the jwt_secret, which is only used while no signing
+// key is set, or, with legacy_jwt_secret, to verify access tokens.
+type Keys struct {
+	signer *key
+	keys   map[string]*key
+	secret []byte
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for keys that only verify
+	public  crypto.PublicKey
+}
+
+// JWK is one key of a JSON Web Key Set (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeys reads the keys in cfg.Auth.Keys. The key named by
+// cfg.Auth.SigningKey signs new tokens; without one, tokens are signed with
+// HS256 and the jwt_secret, as before keys could be configured. Once a
+// signing key is set the jwt_secret is dropped, unless
+// cfg.Auth.LegacyJWTSecret keeps it to verify the access tokens it signed.
+func LoadKeys(cfg config.Config) (*Keys, error) {
+	keys := &Keys{keys: map[string]*key{}}
+	if cfg.JWTSecret != "" && (cfg.Auth.SigningKey == "" || cfg.Auth.LegacyJWTSecret) {
+		keys.secret = []byte(cfg.JWTSecret)
+	}
+
+	for _, kc := range cfg.Auth.Keys {
+		if kc.ID == "" {
+			return nil, fmt.Errorf("auth key without an id")
+		}
+		if _, ok := keys.keys[kc.ID]; ok {
+			return nil, fmt.Errorf("auth key %s is configured twice", kc.ID)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("auth key %s: %w", kc.ID, err)
+		}
+		keys.keys[kc.ID] = k
+	}
+
+	if cfg.Auth.SigningKey != "" {
+		k, ok := keys.keys[cfg.Auth.SigningKey]
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not among the auth keys", cfg.Auth.SigningKey)
+		}
+		if k.private == nil {
+			return nil, fmt.Errorf("signing key %s has no private key", cfg.Auth.SigningKey)
+		}
+		keys.signer = k
+	} else if keys.secret == nil {
+		return nil, fmt.Errorf("no way to sign tokens: set jwt_secret or auth.signing_key")
+	}
+	return keys, nil
+}
+
+func loadKey(kc config.KeyConfig) (*key, error) {
+	k := &key{id: kc.ID}
+	var parsePrivate func([]byte) (crypto.Signer, error)
+	var parsePublic func([]byte) (crypto.PublicKey, error)
+	switch kc.Algorithm {
+	case AlgorithmRS256:
+		k.method = jwt.SigningMethodRS256
+		parsePrivate = func(b []byte) (crypto.Signer, error) { return jwt.ParseRSAPrivateKeyFromPEM(b) }
+		parsePublic = func(b []byte) (crypto.PublicKey, error) { return jwt.ParseRSAPublicKeyFromPEM(b) }
+	case AlgorithmEdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		parsePrivate = func(b []byte) (crypto.Signer, error) {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(b)
+			if err != nil {
+				return nil, err
+			}
+			return private.(crypto.Signer), nil
+		}
+		parsePublic = func(b []byte) (crypto.PublicKey, error) { return jwt.ParseEdPublicKeyFromPEM(b) }
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q; use %s or %s", kc.Algorithm, AlgorithmRS256, AlgorithmEdDSA)
+	}
+
+	if kc.PrivateKeyFile != "" {
+		b, err := os.ReadFile(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if k.private, err = parsePrivate(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", kc.PrivateKeyFile, err)
+		}
+		k.public = k.private.Public()
+	}
+	if kc.PublicKeyFile != "" {
+		b, err := os.ReadFile(kc.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := parsePublic(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kc.PublicKeyFile, err)
+		}
+		if k.public != nil && !k.public.(interface{ Equal(crypto.PublicKey) bool }).Equal(public) {
+			return nil, fmt.Errorf("%s does not match %s", kc.PublicKeyFile, kc.PrivateKeyFile)
+		}
+		k.public = public
+	}
+	if k.public == nil {
+		return nil, fmt.Errorf("set private_key_file or public_key_file")
+	}
+	return k, nil
+}
+
+// sign signs claims with the signing key, or with the jwt_secret when there
+// is none.
+func (k *Keys) sign(claims jwt.Claims) (string, error) {
+	if k.signer == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+	token := jwt.NewWithClaims(k.signer.method, claims)
+	token.Header["kid"] = k.signer.id
+	return token.SignedString(k.signer.private)
+}
+
+// verificationKey finds the key a token names in its kid header, and refuses
+// tokens whose algorithm is not that key's. Tokens without a kid need the
+// jwt_secret to be signing: a secret kept only for legacy access tokens does
+// not verify pending logins and links, which are not on record.
+func (k *Keys) verificationKey(t *jwt.Token) (interface{}, error) {
+	return k.find(t, k.signer == nil)
+}
+
+// accessKey is verificationKey for access tokens, which the jwt_secret also
+// verifies while legacy_jwt_secret keeps it; they are checked against
+// storage too.
+func (k *Keys) accessKey(t *jwt.Token) (interface{}, error) {
+	return k.find(t, true)
+}
+
+// find returns the key named by the token's kid, or the jwt_secret for
+// tokens without one when secretOK.
+func (k *Keys) find(t *jwt.Token, secretOK bool) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if !secretOK || k.secret == nil || t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("token names no key")
+		}
+		return k.secret, nil
+	}
+
+	found, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", kid)
+	}
+	if t.Method.Alg() != found.method.Alg() {
+		return nil, fmt.Errorf("key %s does not sign with %s", kid, t.Method.Alg())
+	}
+	return found.public, nil
+}
+
+// JWKS returns the public half of every configured key, so other services
+// can verify access tokens. The jwt_secret is never published.
+func (k *Keys) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, found := range k.keys {
+		jwk := JWK{ID: found.id, Use: "sig", Algorithm: found.method.Alg()}
+		switch public := found.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	// Map order is random; a stable order keeps responses cacheable.
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].ID < set.Keys[j].ID })
+	return set
+}
@@ -0,0 +1,322 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey writes private, and its public half, as PEM files and returns
+// their paths.
+func writeKey(t *testing.T, name string, private crypto.Signer) (string, string) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub.pem")
+	for path, block := range map[string]*pem.Block{
+		privatePath: {Type: "PRIVATE KEY", Bytes: der},
+		publicPath:  {Type: "PUBLIC KEY", Bytes: publicDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	return privatePath, publicPath
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return private
+}
+
+func newEdKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	return private
+}
+
+// withKeys is cfg with its auth keys replaced.
+func withKeys(cfg config.Config, signingKey string, keys ...config.KeyConfig) config.Config {
+	cfg.Auth.SigningKey = signingKey
+	cfg.Auth.Keys = keys
+	return cfg
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, edKey := newRSAKey(t), newEdKey(t)
+	rsaPrivate, _ := writeKey(t, "rsa", rsaKey)
+	edPrivate, _ := writeKey(t, "ed", edKey)
+
+	for _, kc := range []config.KeyConfig{
+		{ID: "rsa-1", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: rsaPrivate},
+		{ID: "ed-1", Algorithm: auth.AlgorithmEdDSA, PrivateKeyFile: edPrivate},
+	} {
+		t.Run(kc.Algorithm, func(t *testing.T) {
+			s := memory.New()
+			// No jwt_secret: only the key can sign and verify.
+			keys := loadKeys(t, withKeys(config.Config{Auth: cfg.Auth}, kc.ID, kc))
+
+			session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, 3, "asha@example.com")
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(session.AccessToken, &auth.Claims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if parsed.Header["kid"] != kc.ID || parsed.Method.Alg() != kc.Algorithm {
+				t.Errorf("header = %v, want kid %s and alg %s", parsed.Header, kc.ID, kc.Algorithm)
+			}
+			if _, err := auth.Verify(t.Context(), s, keys, session.AccessToken); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	s := memory.New()
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", "hash", 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	oldPrivate, oldPublic := writeKey(t, "old", newEdKey(t))
+	newPrivate, _ := writeKey(t, "new", newRSAKey(t))
+
+	// Before: tokens are signed with the jwt_secret, then with the old key.
+	legacy := loadKeys(t, cfg)
+	legacySession, err := auth.Login(t.Context(), s, legacy, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	before := loadKeys(t, withKeys(cfg, "old",
+		config.KeyConfig{ID: "old", Algorithm: auth.AlgorithmEdDSA, PrivateKeyFile: oldPrivate},
+	))
+	oldSession, err := auth.Login(t.Context(), s, before, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// After: the new key signs, and the old one and the secret kept with
+	// legacy_jwt_secret still verify.
+	afterCfg := withKeys(cfg, "new",
+		config.KeyConfig{ID: "new", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: newPrivate},
+		config.KeyConfig{ID: "old", Algorithm: auth.AlgorithmEdDSA, PublicKeyFile: oldPublic},
+	)
+	afterCfg.Auth.LegacyJWTSecret = true
+	after := loadKeys(t, afterCfg)
+	newSession, err := auth.Refresh(t.Context(), s, after, cfg, oldSession.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	for name, raw := range map[string]string{"legacy": legacySession.AccessToken, "old": oldSession.AccessToken, "new": newSession.AccessToken} {
+		if _, err := auth.Verify(t.Context(), s, after, raw); err != nil {
+			t.Errorf("Verify(%s) after rotation: %v", name, err)
+		}
+	}
+
+	// Once the old key and the jwt_secret are dropped, their tokens are refused.
+	retired := loadKeys(t, withKeys(config.Config{Auth: cfg.Auth}, "new",
+		config.KeyConfig{ID: "new", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: newPrivate},
+	))
+	for name, raw := range map[string]string{"legacy": legacySession.AccessToken, "old": oldSession.AccessToken} {
+		if _, err := auth.Verify(t.Context(), s, retired, raw); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("Verify(%s) with its key retired error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+	if _, err := auth.Verify(t.Context(), s, retired, newSession.AccessToken); err != nil {
+		t.Errorf("Verify(new) after retiring the old key: %v", err)
+	}
+}
+
+// TestLegacyJWTSecret checks that the jwt_secret stops verifying once a
+// signing key is set, and that legacy_jwt_secret keeps it for access tokens
+// only: the tokens that are not on record could otherwise be forged by
+// anyone who knows it.
+func TestLegacyJWTSecret(t *testing.T) {
+	s := memory.New()
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", "hash", 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	session, err := auth.Login(t.Context(), s, loadKeys(t, cfg), cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	forge := func(claims jwt.MapClaims) string {
+		t.Helper()
+		claims["exp"] = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return raw
+	}
+	mfa := httptest.NewRequest("POST", auth.MFAPath+"/totp", nil)
+	mfa.Header.Set("Authorization", "Bearer "+forge(jwt.MapClaims{"sub": "1", "aud": "mfa", "role": models.UserAdmin, "email": "root@example.com", "step": auth.MFASetup}))
+	link := forge(jwt.MapClaims{"sub": strconv.FormatInt(id, 10), "aud": "email-verification", "email": "asha@example.com"})
+
+	private, _ := writeKey(t, "new", newEdKey(t))
+	keyCfg := withKeys(cfg, "new", config.KeyConfig{ID: "new", Algorithm: auth.AlgorithmEdDSA, PrivateKeyFile: private})
+	for _, legacy := range []bool{false, true} {
+		keyCfg.Auth.LegacyJWTSecret = legacy
+		keys := loadKeys(t, keyCfg)
+		if _, err := auth.Verify(t.Context(), s, keys, session.AccessToken); (err == nil) != legacy {
+			t.Errorf("legacy_jwt_secret %t: Verify of an access token signed with the secret error = %v", legacy, err)
+		}
+		if _, err := auth.PendingMFA(mfa, s, keys, keyCfg, auth.MFASetup); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("legacy_jwt_secret %t: PendingMFA of a token signed with the secret error = %v, want ErrInvalidToken", legacy, err)
+		}
+		if _, err := auth.VerifyEmail(t.Context(), s, keys, link); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("legacy_jwt_secret %t: VerifyEmail of a link signed with the secret error = %v, want ErrInvalidToken", legacy, err)
+		}
+	}
+	// Without a signing key the secret signs, and so verifies the link.
+	if _, err := auth.VerifyEmail(t.Context(), s, loadKeys(t, cfg), link); err != nil {
+		t.Errorf("VerifyEmail with the secret signing: %v", err)
+	}
+}
+
+func TestVerifyRejectsMismatchedAlgorithms(t *testing.T) {
+	s := memory.New()
+	rsaKey := newRSAKey(t)
+	private, public := writeKey(t, "rsa", rsaKey)
+	keys := loadKeys(t, withKeys(cfg, "rsa",
+		config.KeyConfig{ID: "rsa", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: private},
+	))
+
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, 3, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := auth.Parse(keys, session.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	publicPEM, err := os.ReadFile(public)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	forge := func(method jwt.SigningMethod, kid string, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		raw, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return raw
+	}
+	for name, raw := range map[string]string{
+		// HMAC keyed with the published RSA key.
+		"HS256 under an RSA kid": forge(jwt.SigningMethodHS256, "rsa", publicPEM),
+		"RS256 without a kid":    forge(jwt.SigningMethodRS256, "", rsaKey),
+		"unknown kid":            forge(jwt.SigningMethodRS256, "other", rsaKey),
+	} {
+		if _, err := auth.Verify(t.Context(), s, keys, raw); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, edKey := newRSAKey(t), newEdKey(t)
+	rsaPrivate, _ := writeKey(t, "rsa", rsaKey)
+	_, edPublic := writeKey(t, "ed", edKey)
+	keys := loadKeys(t, withKeys(cfg, "rsa",
+		config.KeyConfig{ID: "rsa", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: rsaPrivate},
+		config.KeyConfig{ID: "ed", Algorithm: auth.AlgorithmEdDSA, PublicKeyFile: edPublic},
+	))
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2 (the jwt_secret is never published)", len(set.Keys))
+	}
+	ed, rsaJWK := set.Keys[0], set.Keys[1]
+
+	x, _ := base64.RawURLEncoding.DecodeString(ed.X)
+	if ed.ID != "ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" ||
+		!edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+
+	n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if rsaJWK.ID != "rsa" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || !rsaKey.PublicKey.Equal(public) {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+
+	if set := loadKeys(t, cfg).JWKS(); len(set.Keys) != 0 {
+		t.Errorf("JWKS with only a jwt_secret = %+v, want no keys", set)
+	}
+}
+
+func TestLoadKeysErrors(t *testing.T) {
+	rsaPrivate, rsaPublic := writeKey(t, "rsa", newRSAKey(t))
+	_, otherPublic := writeKey(t, "other", newRSAKey(t))
+
+	for name, tc := range map[string]struct {
+		cfg  config.Config
+		want string
+	}{
+		"nothing to sign with": {config.Config{}, "set jwt_secret or auth.signing_key"},
+		"unknown algorithm": {withKeys(cfg, "", config.KeyConfig{ID: "k", Algorithm: "HS512", PublicKeyFile: rsaPublic}),
+			"unsupported algorithm"},
+		"no key file":  {withKeys(cfg, "", config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256}), "set private_key_file or public_key_file"},
+		"missing file": {withKeys(cfg, "", config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256, PublicKeyFile: "/nonexistent.pem"}), "no such file"},
+		"wrong algorithm for the key": {withKeys(cfg, "", config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmEdDSA, PublicKeyFile: rsaPublic}),
+			"auth key k"},
+		"mismatched key files": {withKeys(cfg, "", config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256, PrivateKeyFile: rsaPrivate, PublicKeyFile: otherPublic}),
+			"does not match"},
+		"duplicate id": {withKeys(cfg, "",
+			config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256, PublicKeyFile: rsaPublic},
+			config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256, PublicKeyFile: rsaPublic},
+		), "configured twice"},
+		"unknown signing key": {withKeys(cfg, "missing"), "not among the auth keys"},
+		"signing key without a private key": {withKeys(cfg, "k", config.KeyConfig{ID: "k", Algorithm: auth.AlgorithmRS256, PublicKeyFile: rsaPublic}),
+			"has no private key"},
+	} {
+		if _, err := auth.LoadKeys(tc.cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: LoadKeys error = %v, want one mentioning %q", name, err, tc.want)
+		}
+	}
+}
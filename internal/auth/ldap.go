@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrDirectory means the LDAP directory could not be reached or searched.
+var ErrDirectory = errors.New("LDAP directory unavailable")
+
+// LDAPIssuer is the issuer of the identities that link directory users, by
+// their DN, to the admins made for them.
+const LDAPIssuer = "ldap"
+
+// LDAP logs staff in as admins with their directory password. The directory
+// decides the roles of the admins it made too: they are set to those of the
+// user's groups on every login.
+type LDAP struct {
+	cfg     config.LDAPConfig
+	storage storage.Storage
+}
+
+// NewLDAP returns an authenticator for the directory at cfg.URL. It connects
+// once per login.
+func NewLDAP(cfg config.LDAPConfig, s storage.Storage) *LDAP {
+	return &LDAP{cfg: cfg, storage: s}
+}
+
+// DirectoryUser is what the directory says about a user.
+type DirectoryUser struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+// Authenticate binds as the directory user with email and returns the admin
+// linked to their DN. The first login creates that admin without a password
+// and links them; if a portal admin already has the email, the directory does
+// not take them over and the login is ErrInvalidCredentials here, leaving it
+// to the admin's own password. Users in no group mapped to a role are
+// ErrInvalidCredentials too.
+func (l *LDAP) Authenticate(ctx context.Context, email, password string) (models.Admin, error) {
+	user, err := l.Lookup(ctx, email, password)
+	if err != nil {
+		return models.Admin{}, err
+	}
+	roles := l.Roles(user.Groups)
+	if len(roles) == 0 {
+		return models.Admin{}, ErrInvalidCredentials
+	}
+
+	admin, err := l.admin(ctx, user)
+	if errors.Is(err, ErrAccountExists) {
+		slog.Warn("LDAP user has the email of an admin they are not linked to", slog.String("dn", user.DN), slog.String("email", user.Email))
+		return models.Admin{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.Admin{}, err
+	}
+	syncRoles(ctx, l.storage, admin, roles)
+	return admin, nil
+}
+
+// Lookup finds the user with email in the directory and checks their
+// password by binding as them. Unknown users, users the filter matches more
+// than once and wrong passwords are ErrInvalidCredentials.
+func (l *LDAP) Lookup(ctx context.Context, email, password string) (DirectoryUser, error) {
+	// A simple bind with an empty password is an anonymous bind, which
+	// succeeds whoever it names.
+	if email == "" || password == "" {
+		return DirectoryUser{}, ErrInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}))
+	if err != nil {
+		return DirectoryUser{}, fmt.Errorf("%w: %v", ErrDirectory, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetTimeout(l.cfg.Timeout)
+
+	if l.cfg.StartTLS {
+		serverURL, err := url.Parse(l.cfg.URL)
+		if err != nil {
+			return DirectoryUser{}, fmt.Errorf("%w: %v", ErrDirectory, err)
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: serverURL.Hostname()}); err != nil {
+			return DirectoryUser{}, fmt.Errorf("%w: start TLS: %v", ErrDirectory, err)
+		}
+	}
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return DirectoryUser{}, fmt.Errorf("%w: bind as %s: %v", ErrDirectory, l.cfg.BindDN, err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(l.cfg.UserFilter, ldap.EscapeFilter(email)),
+		[]string{l.cfg.EmailAttribute, l.cfg.NameAttribute, l.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return DirectoryUser{}, fmt.Errorf("%w: search: %v", ErrDirectory, err)
+	}
+	if len(result.Entries) != 1 {
+		if len(result.Entries) > 1 {
+			slog.Warn("LDAP user filter matches more than one user", slog.String("email", email), slog.Int("matches", len(result.Entries)))
+		}
+		return DirectoryUser{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return DirectoryUser{}, ErrInvalidCredentials
+		}
+		return DirectoryUser{}, fmt.Errorf("%w: bind as %s: %v", ErrDirectory, entry.DN, err)
+	}
+
+	user := DirectoryUser{
+		DN:     entry.DN,
+		Email:  entry.GetAttributeValue(l.cfg.EmailAttribute),
+		Name:   entry.GetAttributeValue(l.cfg.NameAttribute),
+		Groups: entry.GetAttributeValues(l.cfg.GroupAttribute),
+	}
+	// The admin is found by the directory's email, which a filter on
+	// another attribute, such as uid, may not have matched.
+	if user.Email == "" {
+		slog.Warn("LDAP user has no email", slog.String("dn", entry.DN))
+		return DirectoryUser{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// Roles returns the admin roles that the groups map to, sorted. Groups are
+// matched regardless of case, as DNs are.
+func (l *LDAP) Roles(groups []string) []string {
+	roles := []string{}
+	for group, role := range l.cfg.GroupRoles {
+		member := slices.ContainsFunc(groups, func(g string) bool { return strings.EqualFold(g, group) })
+		if member && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// admin returns the admin linked to the user's DN. One is created without a
+// password, linked and audited if there is none, unless an admin already has
+// the user's email, which is ErrAccountExists.
+func (l *LDAP) admin(ctx context.Context, user DirectoryUser) (models.Admin, error) {
+	linked, err := l.storage.GetIdentity(ctx, LDAPIssuer, user.DN)
+	if err == nil {
+		return l.storage.GetAdminById(ctx, linked.UserID)
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return models.Admin{}, err
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+	id, err := l.storage.CreateAdmin(ctx, name, user.Email, "")
+	if errors.Is(err, storage.ErrConflict) {
+		// Another login of the same user may have created and linked them
+		// first.
+		linked, err := l.storage.GetIdentity(ctx, LDAPIssuer, user.DN)
+		if err == nil {
+			return l.storage.GetAdminById(ctx, linked.UserID)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			return models.Admin{}, ErrAccountExists
+		}
+		return models.Admin{}, err
+	}
+	if err != nil {
+		return models.Admin{}, err
+	}
+	if err := l.storage.LinkIdentity(ctx, models.ExternalIdentity{
+		Issuer:    LDAPIssuer,
+		Subject:   user.DN,
+		UserType:  models.UserAdmin,
+		UserID:    id,
+		Email:     user.Email,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}); err != nil {
+		return models.Admin{}, err
+	}
+	Audit(ctx, l.storage, models.AuditEntry{
+		Event:     models.AuditIdentityLinked,
+		ActorType: models.UserAdmin,
+		ActorID:   id,
+		Subject:   userSubject(models.UserAdmin, id),
+		Detail:    LDAPIssuer + " " + user.DN,
+	})
+	return l.storage.GetAdminById(ctx, id)
+}
@@ -0,0 +1,214 @@
+package auth_test
+
+import (
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth/ldaptest"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	itGroup     = "cn=it,ou=groups,dc=example,dc=edu"
+	officeGroup = "cn=office,ou=groups,dc=example,dc=edu"
+)
+
+// newLDAP starts a directory and returns the config that logs in through it.
+func newLDAP(t *testing.T) (*ldaptest.Server, config.LDAPConfig) {
+	t.Helper()
+	directory := ldaptest.New(t)
+	return directory, config.LDAPConfig{
+		URL:            directory.URL,
+		BindDN:         directory.BindDN,
+		BindPassword:   directory.BindPassword,
+		BaseDN:         directory.BaseDN,
+		UserFilter:     "(&(objectClass=person)(mail=%s))",
+		EmailAttribute: "mail",
+		NameAttribute:  "cn",
+		GroupAttribute: "memberOf",
+		GroupRoles:     map[string]string{itGroup: models.RoleSuperadmin, "CN=Office,OU=Groups,DC=example,DC=edu": "registrar"},
+		Timeout:        5 * time.Second,
+	}
+}
+
+func TestLDAPLookup(t *testing.T) {
+	directory, ldapCfg := newLDAP(t)
+	dn := directory.AddUser("meera", "correct horse", "meera@example.com", officeGroup)
+	l := auth.NewLDAP(ldapCfg, memory.New())
+
+	user, err := l.Lookup(t.Context(), "meera@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if user.DN != dn || user.Email != "meera@example.com" || user.Name != "meera" || !slices.Equal(user.Groups, []string{officeGroup}) {
+		t.Errorf("Lookup = %+v", user)
+	}
+	// The search is made as the service account and the password checked by
+	// binding as the user.
+	if binds := directory.Binds(); !slices.Equal(binds, []string{directory.BindDN, dn}) {
+		t.Errorf("binds = %v", binds)
+	}
+
+	for _, login := range []struct{ email, password string }{
+		{"meera@example.com", "wrong"},
+		{"ravi@example.com", "correct horse"},
+		{"*", "correct horse"},
+		{"meera@example.com", ""},
+	} {
+		if _, err := l.Lookup(t.Context(), login.email, login.password); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("Lookup(%q, %q) error = %v, want ErrInvalidCredentials", login.email, login.password, err)
+		}
+	}
+
+	wrongService := ldapCfg
+	wrongService.BindPassword = "wrong"
+	if _, err := auth.NewLDAP(wrongService, memory.New()).Lookup(t.Context(), "meera@example.com", "correct horse"); !errors.Is(err, auth.ErrDirectory) {
+		t.Errorf("Lookup with a wrong service password error = %v, want ErrDirectory", err)
+	}
+	directory.Close()
+	if _, err := l.Lookup(t.Context(), "meera@example.com", "correct horse"); !errors.Is(err, auth.ErrDirectory) {
+		t.Errorf("Lookup with the directory down error = %v, want ErrDirectory", err)
+	}
+}
+
+func TestLDAPRoles(t *testing.T) {
+	_, ldapCfg := newLDAP(t)
+	l := auth.NewLDAP(ldapCfg, memory.New())
+
+	for _, test := range []struct {
+		groups []string
+		want   []string
+	}{
+		{nil, []string{}},
+		{[]string{"cn=alumni,ou=groups,dc=example,dc=edu"}, []string{}},
+		{[]string{officeGroup}, []string{"registrar"}},
+		{[]string{"cn=IT,ou=Groups,dc=example,dc=edu", officeGroup}, []string{"registrar", models.RoleSuperadmin}},
+	} {
+		if roles := l.Roles(test.groups); !slices.Equal(roles, test.want) {
+			t.Errorf("Roles(%v) = %v, want %v", test.groups, roles, test.want)
+		}
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	s := memory.New()
+	directory, ldapCfg := newLDAP(t)
+	l := auth.NewLDAP(ldapCfg, s)
+
+	// An admin the directory did not make is not taken over by a directory
+	// user with their email, nor are their roles touched.
+	meera, err := s.CreateAdmin(t.Context(), "Meera", "meera@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	if err := s.AssignRole(t.Context(), meera, models.RoleSuperadmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	meeraDN := directory.AddUser("meera", "correct horse", "meera@example.com", officeGroup)
+	if _, err := l.Authenticate(t.Context(), "meera@example.com", "correct horse"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("Authenticate for an existing admin's email error = %v, want ErrInvalidCredentials", err)
+	}
+	if roles := roleNames(t, s, meera); !slices.Equal(roles, []string{models.RoleSuperadmin}) {
+		t.Errorf("existing admin roles = %v, want them untouched", roles)
+	}
+	if _, err := s.GetIdentity(t.Context(), auth.LDAPIssuer, meeraDN); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetIdentity for a refused login error = %v, want ErrNotFound", err)
+	}
+
+	// A new admin is created without a password of their own, with the roles
+	// of their groups, and linked to their DN.
+	raviDN := directory.AddUser("ravi", "battery staple", "ravi@example.com", itGroup)
+	ravi, err := l.Authenticate(t.Context(), "ravi@example.com", "battery staple")
+	if err != nil || ravi.Name != "ravi" || ravi.Email != "ravi@example.com" || ravi.Password != "" {
+		t.Fatalf("Authenticate for a new admin = %+v, %v", ravi, err)
+	}
+	if roles := roleNames(t, s, ravi.ID); !slices.Equal(roles, []string{models.RoleSuperadmin}) {
+		t.Errorf("new admin roles = %v", roles)
+	}
+	if linked, err := s.GetIdentity(t.Context(), auth.LDAPIssuer, raviDN); err != nil || linked.UserType != models.UserAdmin || linked.UserID != ravi.ID {
+		t.Errorf("GetIdentity = %+v, %v", linked, err)
+	}
+	if entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditIdentityLinked); err != nil || len(entries) != 1 || entries[0].ActorID != ravi.ID {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+	// Later logins follow the link.
+	if again, err := l.Authenticate(t.Context(), "ravi@example.com", "battery staple"); err != nil || again.ID != ravi.ID {
+		t.Errorf("Authenticate for a linked admin = %+v, %v, want admin %d", again, err, ravi.ID)
+	}
+
+	// Directory users in no mapped group are not admins.
+	directory.AddUser("asha", "open sesame", "asha@example.com", "cn=alumni,ou=groups,dc=example,dc=edu")
+	if _, err := l.Authenticate(t.Context(), "asha@example.com", "open sesame"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("Authenticate without a mapped group error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := s.GetAdminByEmail(t.Context(), "asha@example.com"); err == nil {
+		t.Error("Authenticate without a mapped group created an admin")
+	}
+}
+
+func TestAdminChain(t *testing.T) {
+	s := memory.New()
+	directory, ldapCfg := newLDAP(t)
+	directory.AddUser("ravi", "battery staple", "ravi@example.com", itGroup)
+	// A cheap hash keeps the local checks quick.
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	local, err := s.CreateAdmin(t.Context(), "Admin", "admin@example.com", string(hash))
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+
+	chainCfg := cfg
+	chainCfg.Auth.LDAP = ldapCfg
+	admins := auth.NewAdminAuthenticator(s, chainCfg)
+	if _, ok := admins.(auth.AdminChain); !ok {
+		t.Fatalf("NewAdminAuthenticator with a directory = %T, want AdminChain", admins)
+	}
+	if _, ok := auth.NewAdminAuthenticator(s, cfg).(auth.LocalAdmins); !ok {
+		t.Errorf("NewAdminAuthenticator without a directory is not LocalAdmins")
+	}
+
+	// Directory users log in through the directory, and admins it does not
+	// know with their own password.
+	ravi, err := admins.Authenticate(t.Context(), "ravi@example.com", "battery staple")
+	if err != nil || ravi.Email != "ravi@example.com" {
+		t.Fatalf("Authenticate for a directory user = %+v, %v", ravi, err)
+	}
+	if admin, err := admins.Authenticate(t.Context(), "admin@example.com", "admin password"); err != nil || admin.ID != local {
+		t.Errorf("Authenticate for a local admin = %+v, %v, want admin %d", admin, err, local)
+	}
+	// Admins created by the directory have no password to fall back on.
+	for _, login := range []struct{ email, password string }{
+		{"ravi@example.com", "wrong"},
+		{"admin@example.com", "wrong"},
+	} {
+		if _, err := admins.Authenticate(t.Context(), login.email, login.password); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) error = %v, want ErrInvalidCredentials", login.email, login.password, err)
+		}
+	}
+
+	// Local admins still log in while the directory is down; anyone else,
+	// a local admin with a wrong password included, learns that it is, and
+	// LoginAdmin counts the failure.
+	directory.Close()
+	if admin, err := admins.Authenticate(t.Context(), "admin@example.com", "admin password"); err != nil || admin.ID != local {
+		t.Errorf("Authenticate for a local admin with the directory down = %+v, %v", admin, err)
+	}
+	for _, login := range []struct{ email, password string }{
+		{"ravi@example.com", "battery staple"},
+		{"admin@example.com", "wrong"},
+	} {
+		if _, err := admins.Authenticate(t.Context(), login.email, login.password); !errors.Is(err, auth.ErrDirectory) {
+			t.Errorf("Authenticate(%q, %q) with the directory down error = %v, want ErrDirectory", login.email, login.password, err)
+		}
+	}
+}
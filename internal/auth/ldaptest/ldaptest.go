@@ -0,0 +1,346 @@
+// Package ldaptest is an LDAP directory for tests. It keeps its entries in
+// memory and answers what logging in through a directory takes: simple binds,
+// and subtree searches with equality and presence filters joined by and, or
+// and not. Searches need a bind with a password first.
+package ldaptest
+
+import (
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP operations, from RFC 4511.
+const (
+	opBindRequest      ber.Tag = 0
+	opBindResponse     ber.Tag = 1
+	opUnbindRequest    ber.Tag = 2
+	opSearchRequest    ber.Tag = 3
+	opSearchEntry      ber.Tag = 4
+	opSearchDone       ber.Tag = 5
+	opExtendedRequest  ber.Tag = 23
+	opExtendedResponse ber.Tag = 24
+)
+
+// Search filters.
+const (
+	filterAnd      ber.Tag = 0
+	filterOr       ber.Tag = 1
+	filterNot      ber.Tag = 2
+	filterEquality ber.Tag = 3
+	filterPresent  ber.Tag = 7
+)
+
+// Result codes.
+const (
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+	resultInsufficientAccess = 50
+	resultUnwillingToPerform = 53
+)
+
+// Entry is an entry of the directory. Its userPassword is the password it
+// binds with and is never returned by searches.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Server is a running directory under BaseDN with a service account, BindDN,
+// that logins search as.
+type Server struct {
+	URL          string
+	BaseDN       string
+	BindDN       string
+	BindPassword string
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []Entry
+	conns    map[net.Conn]struct{}
+	binds    []string
+}
+
+// New starts a directory that stops when the test ends.
+func New(t *testing.T) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &Server{
+		URL:          "ldap://" + listener.Addr().String(),
+		BaseDN:       "dc=example,dc=edu",
+		BindDN:       "cn=portal,ou=services,dc=example,dc=edu",
+		BindPassword: "portal-secret",
+		listener:     listener,
+		conns:        map[net.Conn]struct{}{},
+	}
+	s.Add(Entry{DN: s.BindDN, Attributes: map[string][]string{"objectClass": {"applicationProcess"}, "userPassword": {s.BindPassword}}})
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Add adds an entry to the directory.
+func (s *Server) Add(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// AddUser adds a person with the password, email and groups, as the DNs of
+// the groups in memberOf.
+func (s *Server) AddUser(uid, password, email string, groups ...string) string {
+	dn := "uid=" + uid + ",ou=people," + s.BaseDN
+	s.Add(Entry{DN: dn, Attributes: map[string][]string{
+		"objectClass":  {"person", "inetOrgPerson"},
+		"uid":          {uid},
+		"cn":           {uid},
+		"mail":         {email},
+		"memberOf":     groups,
+		"userPassword": {password},
+	}})
+	return dn
+}
+
+// Binds returns the DNs that have bound successfully, in order.
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// Close stops the directory and drops its connections, after which it
+// cannot be reached.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of one connection until it is unbound or
+// closed.
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			code := s.bind(op)
+			bound = code == resultSuccess && len(op.Children) == 3 && op.Children[2].Data.Len() > 0
+			if err := reply(conn, id, result(opBindResponse, code)); err != nil {
+				return
+			}
+		case opSearchRequest:
+			if err := s.search(conn, id, op, bound); err != nil {
+				return
+			}
+		case opExtendedRequest:
+			if err := reply(conn, id, result(opExtendedResponse, resultUnwillingToPerform)); err != nil {
+				return
+			}
+		case opUnbindRequest:
+			return
+		default:
+			reply(conn, id, result(opExtendedResponse, resultProtocolError))
+			return
+		}
+	}
+}
+
+// bind checks a simple bind. One without a password is anonymous and
+// succeeds without binding.
+func (s *Server) bind(op *ber.Packet) int {
+	if len(op.Children) != 3 || op.Children[2].Tag != 0 {
+		return resultProtocolError
+	}
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+	if password == "" {
+		return resultSuccess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) && slices.Contains(values(entry, "userPassword"), password) {
+			s.binds = append(s.binds, entry.DN)
+			return resultSuccess
+		}
+	}
+	return resultInvalidCredentials
+}
+
+// search sends the entries under the base that match the filter.
+func (s *Server) search(conn net.Conn, id int64, op *ber.Packet, bound bool) error {
+	if !bound {
+		return reply(conn, id, result(opSearchDone, resultInsufficientAccess))
+	}
+	if len(op.Children) != 8 {
+		return reply(conn, id, result(opSearchDone, resultProtocolError))
+	}
+	base := op.Children[0].Data.String()
+	if !underDN(base, s.BaseDN) {
+		return reply(conn, id, result(opSearchDone, resultNoSuchObject))
+	}
+	var attributes []string
+	for _, attribute := range op.Children[7].Children {
+		attributes = append(attributes, attribute.Data.String())
+	}
+
+	s.mu.Lock()
+	var found []Entry
+	for _, entry := range s.entries {
+		if underDN(entry.DN, base) && matches(entry, op.Children[6]) {
+			found = append(found, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, entry := range found {
+		if err := reply(conn, id, searchEntry(entry, attributes)); err != nil {
+			return err
+		}
+	}
+	return reply(conn, id, result(opSearchDone, resultSuccess))
+}
+
+// matches evaluates a search filter against the entry.
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case filterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case filterEquality:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		return contains(values(entry, filter.Children[0].Data.String()), filter.Children[1].Data.String())
+	case filterPresent:
+		return len(values(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+// values returns the values of an attribute, whose name is matched
+// regardless of case.
+func values(entry Entry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// contains compares values regardless of case, as most LDAP attributes do.
+// Passwords are compared exactly.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// underDN reports whether dn is base or below it.
+func underDN(dn, base string) bool {
+	dn, base = strings.ToLower(dn), strings.ToLower(base)
+	return dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+func searchEntry(entry Entry, attributes []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchEntry, nil, "SearchResultEntry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, name := range attributes {
+		if strings.EqualFold(name, "userPassword") {
+			continue
+		}
+		vals := values(entry, name)
+		if len(vals) == 0 {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	op.AppendChild(list)
+	return op
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "LDAPResult")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+// reply sends op as the response to message id.
+func reply(w io.Writer, id int64, op *ber.Packet) error {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAPMessage")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "messageID"))
+	message.AppendChild(op)
+	_, err := w.Write(message.Bytes())
+	return err
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MFACookieName is the cookie holding the token of a login that waits for its
+// second step. It is only sent to MFAPath and the paths under it.
+const MFACookieName = "mfa_token"
+
+// MFAPath is where the second step of a login is completed.
+const MFAPath = "/api/auth/mfa"
+
+// mfaAudience keeps pending logins apart from sessions, which carry no
+// audience. Pending logins are recorded under their jti like access tokens,
+// but are refused everywhere but MFAPath.
+const mfaAudience = "mfa"
+
+// What the second step of a login asks for: a code, or setting up TOTP when
+// it is required and missing.
+const (
+	MFAVerify = "verify"
+	MFASetup  = "setup"
+)
+
+// MFAClaims name the user whose password was accepted and the step their
+// login waits for.
+type MFAClaims struct {
+	Email    string          `json:"email"`
+	UserType models.UserType `json:"role"`
+	Step     string          `json:"step"`
+	jwt.RegisteredClaims
+}
+
+// UserID is the user named by the token's subject.
+func (c *MFAClaims) UserID() int64 {
+	id, _ := strconv.ParseInt(c.Subject, 10, 64)
+	return id
+}
+
+// MFAStep returns the step a login of the user must pass after the password,
+// or "" when the password is enough.
+func MFAStep(ctx context.Context, s storage.Storage, cfg config.Config, userType models.UserType, userID int64) (string, error) {
+	enabled, err := HasMFA(ctx, s, userType, userID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case enabled:
+		return MFAVerify, nil
+	case userType == models.UserAdmin && cfg.Auth.RequireAdminMFA:
+		return MFASetup, nil
+	}
+	return "", nil
+}
+
+// StartMFA holds a login at step: instead of a session, the client gets a
+// short-lived token in the mfa_token cookie that only MFAPath accepts. The
+// token is recorded under its jti, so the login completes only once. A
+// client that prefers bearer tokens gets no cookie; the token is returned for
+// the response body instead, and is otherwise "".
+func StartMFA(w http.ResponseWriter, r *http.Request, s storage.Storage, keys *Keys, cfg config.Config, step string, userType models.UserType, userID int64, email string) (string, error) {
+	jti, err := newID()
+	if err != nil {
+		return "", err
+	}
+	// JWT times have second precision; the stored ones match them.
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.Add(cfg.Auth.MFATokenLifetime)
+	if err := s.CreateToken(r.Context(), models.Token{
+		JTI:       jti,
+		UserType:  userType,
+		UserID:    userID,
+		IssuedAt:  now,
+		ExpiresAt: expires,
+	}); err != nil {
+		return "", err
+	}
+
+	token, err := keys.sign(MFAClaims{
+		Email:    email,
+		UserType: userType,
+		Step:     step,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if PrefersBearer(r) {
+		return token, nil
+	}
+
+	http.SetCookie(w, cookie(cfg, MFACookieName, token, MFAPath, expires, true, http.SameSiteStrictMode))
+	return "", nil
+}
+
+// PendingMFA returns the claims of the request's bearer token or mfa_token
+// cookie, which must be waiting for step. The account is checked again, as
+// it may have changed since the password was accepted: a token that is
+// missing, expired, badly signed or already used, of an admin disabled since,
+// or of an account that no longer needs step is ErrInvalidToken.
+func PendingMFA(r *http.Request, s storage.Storage, keys *Keys, cfg config.Config, step string) (*MFAClaims, error) {
+	raw, ok := RequestToken(r, MFACookieName)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	var claims MFAClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, keys.verificationKey,
+		jwt.WithAudience(mfaAudience), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.ID == "" || claims.Step != step || !claims.UserType.Valid() || claims.UserID() == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	ctx := r.Context()
+	stored, err := s.GetToken(ctx, claims.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.Revoked() || stored.UserType != claims.UserType || stored.UserID != claims.UserID() {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.UserType == models.UserAdmin {
+		admin, err := s.GetAdminById(ctx, claims.UserID())
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if admin.Disabled {
+			return nil, ErrInvalidToken
+		}
+	}
+	current, err := MFAStep(ctx, s, cfg, claims.UserType, claims.UserID())
+	if err != nil {
+		return nil, err
+	}
+	if current != step {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// FinishMFA uses up the token of a pending login that passed its second
+// step, just before its session starts. A token used already, by another
+// request with the same token, is ErrInvalidToken.
+func FinishMFA(ctx context.Context, s storage.Storage, claims *MFAClaims) error {
+	_, err := s.UseToken(ctx, claims.ID)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalid) || errors.Is(err, storage.ErrConflict) {
+		return ErrInvalidToken
+	}
+	return err
+}
+
+// ClearMFACookie tells the browser to drop the mfa_token cookie.
+func ClearMFACookie(w http.ResponseWriter, cfg config.Config) {
+	http.SetCookie(w, expiredCookie(cfg, MFACookieName, MFAPath, true, http.SameSiteStrictMode))
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCPath is where a login through the OpenID Connect provider starts. The
+// provider sends the browser back to OIDCCallbackPath.
+const OIDCPath = "/api/auth/oidc"
+const OIDCCallbackPath = OIDCPath + "/callback"
+
+// OIDCCookieName is the cookie that carries a login through the provider and
+// back. It is only sent to OIDCPath.
+const OIDCCookieName = "oidc_login"
+
+// oidcAudience keeps oidc_login tokens from being accepted as anything else.
+const oidcAudience = "oidc-login"
+
+var (
+	// ErrNoRole means the provider's groups for a user map to no portal role
+	// they may log in with.
+	ErrNoRole = errors.New("no portal role for the user's groups")
+	// ErrUnverifiedEmail means the provider has not verified the email of a
+	// user who is not linked yet, so it cannot name a portal user.
+	ErrUnverifiedEmail = errors.New("email not verified by the identity provider")
+)
+
+// OIDC logs users in through an OpenID Connect provider, with the
+// authorization code flow and PKCE.
+type OIDC struct {
+	cfg      config.OIDCConfig
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC discovers the provider named by cfg.Issuer.
+func NewOIDC(ctx context.Context, cfg config.OIDCConfig) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover OpenID Connect provider %s: %w", cfg.Issuer, err)
+	}
+	scopes := cfg.Scopes
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &OIDC{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// OIDCIdentity is what the provider's ID token says about a user.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// oidcLoginClaims are the state, nonce and PKCE verifier of one login,
+// signed so that the browser carrying them cannot change them.
+type oidcLoginClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// Start begins a login: it keeps a new state, nonce and PKCE verifier in the
+// oidc_login cookie and returns the provider URL to send the browser to.
+func (o *OIDC) Start(w http.ResponseWriter, keys *Keys, cfg config.Config) (string, error) {
+	state, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	expires := now.Add(cfg.Auth.OIDC.LoginLifetime)
+	token, err := keys.sign(oidcLoginClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The provider sends the browser back with a top-level cross-site
+	// navigation, which carries Lax cookies but not Strict ones.
+	c := cookie(cfg, OIDCCookieName, token, OIDCPath, expires, true, http.SameSiteLaxMode)
+	if c.SameSite == http.SameSiteStrictMode {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, c)
+	return o.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), nil
+}
+
+// Finish completes a login the provider sent back to the callback: it checks
+// the state against the oidc_login cookie, trades the code for the user's ID
+// token and verifies it. A missing, expired or mismatched login is
+// ErrInvalidToken.
+func (o *OIDC) Finish(w http.ResponseWriter, r *http.Request, keys *Keys, cfg config.Config) (OIDCIdentity, error) {
+	http.SetCookie(w, expiredCookie(cfg, OIDCCookieName, OIDCPath, true, http.SameSiteLaxMode))
+
+	c, err := r.Cookie(OIDCCookieName)
+	if err != nil {
+		return OIDCIdentity{}, ErrInvalidToken
+	}
+	var login oidcLoginClaims
+	token, err := jwt.ParseWithClaims(c.Value, &login, keys.verificationKey,
+		jwt.WithAudience(oidcAudience), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || login.State == "" || r.URL.Query().Get("state") != login.State {
+		return OIDCIdentity{}, ErrInvalidToken
+	}
+
+	exchanged, err := o.oauth.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	rawIDToken, ok := exchanged.Extra("id_token").(string)
+	if !ok {
+		return OIDCIdentity{}, errors.New("token response has no id_token")
+	}
+	idToken, err := o.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("verify ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return OIDCIdentity{}, ErrInvalidToken
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	var all map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("read ID token claims: %w", err)
+	}
+	if err := idToken.Claims(&all); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("read ID token claims: %w", err)
+	}
+	return OIDCIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Groups:        groups(all[o.cfg.GroupsClaim]),
+	}, nil
+}
+
+// groups reads a groups claim, which providers send as a list of names or,
+// for a single group, a bare name.
+func groups(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []any:
+		names := []string{}
+		for _, name := range claim {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// Roles returns the portal roles that the groups map to, sorted, and whether
+// the user may log in as a student.
+func (o *OIDC) Roles(groups []string) (adminRoles []string, student bool) {
+	studentGroups := false
+	for group, role := range o.cfg.GroupRoles {
+		if role != models.RoleStudent {
+			if slices.Contains(groups, group) && !slices.Contains(adminRoles, role) {
+				adminRoles = append(adminRoles, role)
+			}
+			continue
+		}
+		studentGroups = true
+		if slices.Contains(groups, group) {
+			student = true
+		}
+	}
+	slices.Sort(adminRoles)
+	return adminRoles, student || !studentGroups
+}
+
+// User returns the portal user that identity logs in as. An identity that is
+// not linked yet gets a new admin or student with its email, created without
+// a password, and the link is audited. If a portal user already has the
+// email, the login is refused with ErrAccountExists rather than taking their
+// account over. The roles of an admin made this way are set to those of the
+// identity's groups on every login.
+func (o *OIDC) User(ctx context.Context, s storage.Storage, identity OIDCIdentity, ip string) (models.UserType, int64, string, error) {
+	adminRoles, student := o.Roles(identity.Groups)
+
+	linked, err := s.GetIdentity(ctx, o.cfg.Issuer, identity.Subject)
+	if err == nil {
+		if linked.UserType == models.UserAdmin {
+			if len(adminRoles) == 0 {
+				return "", 0, "", ErrNoRole
+			}
+			admin, err := s.GetAdminById(ctx, linked.UserID)
+			if err != nil {
+				return "", 0, "", err
+			}
+			syncRoles(ctx, s, admin, adminRoles)
+			return models.UserAdmin, admin.ID, admin.Email, nil
+		}
+		if !student {
+			return "", 0, "", ErrNoRole
+		}
+		existing, err := s.GetStudentById(ctx, linked.UserID)
+		if err != nil {
+			return "", 0, "", err
+		}
+		return models.UserStudent, existing.Id, existing.Email, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return "", 0, "", err
+	}
+
+	if len(adminRoles) == 0 && !student {
+		return "", 0, "", ErrNoRole
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		return "", 0, "", ErrUnverifiedEmail
+	}
+	var userType models.UserType
+	var userID int64
+	if len(adminRoles) > 0 {
+		userType = models.UserAdmin
+		userID, err = s.CreateAdmin(ctx, displayName(identity), identity.Email, "")
+	} else {
+		userType = models.UserStudent
+		userID, err = o.student(ctx, s, identity)
+	}
+	if errors.Is(err, storage.ErrConflict) {
+		return "", 0, "", ErrAccountExists
+	}
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	if err := s.LinkIdentity(ctx, models.ExternalIdentity{
+		Issuer:    o.cfg.Issuer,
+		Subject:   identity.Subject,
+		UserType:  userType,
+		UserID:    userID,
+		Email:     identity.Email,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}); err != nil {
+		return "", 0, "", err
+	}
+	Audit(ctx, s, models.AuditEntry{
+		Event:     models.AuditIdentityLinked,
+		ActorType: userType,
+		ActorID:   userID,
+		Subject:   userSubject(userType, userID),
+		IP:        ip,
+		Detail:    o.cfg.Issuer + " " + identity.Subject,
+	})
+	if userType == models.UserAdmin {
+		syncRoles(ctx, s, models.Admin{ID: userID}, adminRoles)
+	}
+	return userType, userID, identity.Email, nil
+}
+
+// student creates a student for the identity without a password or profile,
+// with the email the provider has verified. A student who already has the
+// email is storage.ErrConflict.
+func (o *OIDC) student(ctx context.Context, s storage.Storage, identity OIDCIdentity) (int64, error) {
+	id, err := s.CreateStudent(ctx, displayName(identity), identity.Email, "", 0, "", "", "", "")
+	if err != nil {
+		return 0, err
+	}
+	if err := s.VerifyStudentEmail(ctx, id, identity.Email); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func displayName(identity OIDCIdentity) string {
+	if identity.Name != "" {
+		return identity.Name
+	}
+	return identity.Email
+}
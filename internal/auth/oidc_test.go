@@ -0,0 +1,222 @@
+package auth_test
+
+import (
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth/oidctest"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newOIDC starts a provider and logs in through it with groupRoles.
+func newOIDC(t *testing.T, groupRoles map[string]string) (*oidctest.Provider, *auth.OIDC, config.Config) {
+	t.Helper()
+	provider := oidctest.New(t)
+	oidcCfg := cfg
+	oidcCfg.Auth.OIDC = config.OIDCConfig{
+		Issuer:        provider.URL,
+		ClientID:      provider.ClientID,
+		ClientSecret:  provider.ClientSecret,
+		RedirectURL:   "http://portal.example.com" + auth.OIDCCallbackPath,
+		Scopes:        []string{"email", "profile"},
+		GroupsClaim:   "groups",
+		GroupRoles:    groupRoles,
+		LoginLifetime: time.Minute,
+	}
+	o, err := auth.NewOIDC(t.Context(), oidcCfg.Auth.OIDC)
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	return provider, o, oidcCfg
+}
+
+// callback starts a login and returns the request with which the provider
+// sends the browser back after the user logged in with claims.
+func callback(t *testing.T, provider *oidctest.Provider, o *auth.OIDC, keys *auth.Keys, cfg config.Config, claims map[string]any) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	authURL, err := o.Start(w, keys, cfg)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.OIDCCookieName || cookies[0].Path != auth.OIDCPath || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Start set cookies %+v", cookies)
+	}
+
+	r := httptest.NewRequest("GET", provider.Authorize(t, authURL, claims), nil)
+	r.AddCookie(cookies[0])
+	return r
+}
+
+func TestOIDCFinish(t *testing.T) {
+	provider, o, oidcCfg := newOIDC(t, nil)
+	keys := loadKeys(t, oidcCfg)
+	claims := map[string]any{"sub": "u-1", "email": "asha@example.com", "email_verified": true, "name": "Asha K", "groups": []string{"students", "library"}}
+
+	r := callback(t, provider, o, keys, oidcCfg, claims)
+	identity, err := o.Finish(httptest.NewRecorder(), r, keys, oidcCfg)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if identity.Subject != "u-1" || identity.Email != "asha@example.com" || !identity.EmailVerified || identity.Name != "Asha K" || !slices.Equal(identity.Groups, []string{"students", "library"}) {
+		t.Errorf("Finish = %+v", identity)
+	}
+
+	// The provider takes each code once.
+	if _, err := o.Finish(httptest.NewRecorder(), r, keys, oidcCfg); err == nil {
+		t.Error("Finish with a used code succeeded")
+	}
+
+	r = callback(t, provider, o, keys, oidcCfg, map[string]any{"sub": "u-1", "groups": "staff"})
+	if identity, err := o.Finish(httptest.NewRecorder(), r, keys, oidcCfg); err != nil || !slices.Equal(identity.Groups, []string{"staff"}) {
+		t.Errorf("Finish with a single group = %+v, %v", identity, err)
+	}
+
+	forged := callback(t, provider, o, keys, oidcCfg, claims)
+	query := forged.URL.Query()
+	query.Set("state", "forged")
+	forged.URL.RawQuery = query.Encode()
+	if _, err := o.Finish(httptest.NewRecorder(), forged, keys, oidcCfg); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Finish with another state error = %v, want ErrInvalidToken", err)
+	}
+
+	started := callback(t, provider, o, keys, oidcCfg, claims)
+	elsewhere := httptest.NewRequest("GET", started.URL.String(), nil)
+	if _, err := o.Finish(httptest.NewRecorder(), elsewhere, keys, oidcCfg); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Finish without the oidc_login cookie error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestOIDCRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		groupRoles map[string]string
+		groups     []string
+		admin      []string
+		student    bool
+	}{
+		{"no mapping", nil, []string{"staff"}, nil, true},
+		{"admin groups", map[string]string{"it": "superadmin", "office": "registrar", "deans": "registrar"}, []string{"office", "deans", "it"}, []string{"registrar", "superadmin"}, true},
+		{"unmapped groups", map[string]string{"it": "superadmin"}, []string{"library"}, nil, true},
+		{"student group", map[string]string{"enrolled": models.RoleStudent}, []string{"enrolled"}, nil, true},
+		{"outside the student group", map[string]string{"enrolled": models.RoleStudent}, []string{"alumni"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, o, _ := newOIDC(t, tt.groupRoles)
+			admin, student := o.Roles(tt.groups)
+			if !slices.Equal(admin, tt.admin) || student != tt.student {
+				t.Errorf("Roles(%v) = %v, %v, want %v, %v", tt.groups, admin, student, tt.admin, tt.student)
+			}
+		})
+	}
+}
+
+func TestOIDCUser(t *testing.T) {
+	s := memory.New()
+	_, o, oidcCfg := newOIDC(t, map[string]string{"it": models.RoleSuperadmin, "office": "registrar", "enrolled": models.RoleStudent})
+	issuer := oidcCfg.Auth.OIDC.Issuer
+
+	// A new student is created, verified and linked.
+	asha := auth.OIDCIdentity{Subject: "u-1", Email: "asha@example.com", EmailVerified: true, Name: "Asha K", Groups: []string{"enrolled"}}
+	userType, id, email, err := o.User(t.Context(), s, asha, "192.0.2.1")
+	if err != nil || userType != models.UserStudent || email != "asha@example.com" {
+		t.Fatalf("User for a new student = %s, %d, %q, %v", userType, id, email, err)
+	}
+	student, err := s.GetStudentById(t.Context(), id)
+	if err != nil || student.FullName != "Asha K" || !student.Verified || student.Password != "" {
+		t.Errorf("created student = %+v, %v", student, err)
+	}
+	if linked, err := s.GetIdentity(t.Context(), issuer, "u-1"); err != nil || linked.UserType != models.UserStudent || linked.UserID != id {
+		t.Errorf("GetIdentity = %+v, %v", linked, err)
+	}
+	entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditIdentityLinked)
+	if err != nil || len(entries) != 1 || entries[0].ActorID != id || entries[0].IP != "192.0.2.1" {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+
+	// Later logins follow the link, whatever the email now is.
+	asha.Email, asha.EmailVerified = "asha.k@example.com", false
+	if userType, again, _, err := o.User(t.Context(), s, asha, ""); err != nil || userType != models.UserStudent || again != id {
+		t.Errorf("User for a linked student = %s, %d, %v, want student %d", userType, again, err, id)
+	}
+	asha.Groups = nil
+	if _, _, _, err := o.User(t.Context(), s, asha, ""); !errors.Is(err, auth.ErrNoRole) {
+		t.Errorf("User for a student who left the student group error = %v, want ErrNoRole", err)
+	}
+
+	// Portal users with the email are not taken over, nor their roles touched.
+	meera, err := s.CreateAdmin(t.Context(), "Meera", "meera@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	if err := s.AssignRole(t.Context(), meera, models.RoleSuperadmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	staff := auth.OIDCIdentity{Subject: "u-2", Email: "meera@example.com", EmailVerified: true, Groups: []string{"office"}}
+	if _, _, _, err := o.User(t.Context(), s, staff, ""); !errors.Is(err, auth.ErrAccountExists) {
+		t.Errorf("User for an existing admin's email error = %v, want ErrAccountExists", err)
+	}
+	if roles := roleNames(t, s, meera); !slices.Equal(roles, []string{models.RoleSuperadmin}) {
+		t.Errorf("existing admin roles = %v, want them untouched", roles)
+	}
+	if _, err := s.GetIdentity(t.Context(), issuer, "u-2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetIdentity for a refused login error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.CreateStudent(t.Context(), "Kiran", "kiran@example.com", "hash", 0, "", "", "", ""); err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	kiran := auth.OIDCIdentity{Subject: "u-6", Email: "kiran@example.com", EmailVerified: true, Groups: []string{"enrolled"}}
+	if _, _, _, err := o.User(t.Context(), s, kiran, ""); !errors.Is(err, auth.ErrAccountExists) {
+		t.Errorf("User for an existing student's email error = %v, want ErrAccountExists", err)
+	}
+
+	// A new admin is created with the roles of their groups, which they
+	// follow on later logins.
+	ravi := auth.OIDCIdentity{Subject: "u-3", Email: "ravi@example.com", EmailVerified: true, Groups: []string{"it"}}
+	userType, raviID, _, err := o.User(t.Context(), s, ravi, "")
+	if err != nil || userType != models.UserAdmin {
+		t.Fatalf("User for a new admin = %s, %v", userType, err)
+	}
+	if roles := roleNames(t, s, raviID); !slices.Equal(roles, []string{models.RoleSuperadmin}) {
+		t.Errorf("new admin roles = %v", roles)
+	}
+	ravi.Groups = []string{"office"}
+	if userType, again, _, err := o.User(t.Context(), s, ravi, ""); err != nil || userType != models.UserAdmin || again != raviID {
+		t.Fatalf("User for a linked admin = %s, %d, %v, want admin %d", userType, again, err, raviID)
+	}
+	if roles := roleNames(t, s, raviID); !slices.Equal(roles, []string{"registrar"}) {
+		t.Errorf("roles after another login = %v, want only registrar", roles)
+	}
+
+	unverified := auth.OIDCIdentity{Subject: "u-4", Email: "new@example.com", Groups: []string{"enrolled"}}
+	if _, _, _, err := o.User(t.Context(), s, unverified, ""); !errors.Is(err, auth.ErrUnverifiedEmail) {
+		t.Errorf("User with an unverified email error = %v, want ErrUnverifiedEmail", err)
+	}
+	outsider := auth.OIDCIdentity{Subject: "u-5", Email: "guest@example.com", EmailVerified: true, Groups: []string{"alumni"}}
+	if _, _, _, err := o.User(t.Context(), s, outsider, ""); !errors.Is(err, auth.ErrNoRole) {
+		t.Errorf("User without a mapped group error = %v, want ErrNoRole", err)
+	}
+}
+
+func roleNames(t *testing.T, s *memory.Memory, adminID int64) []string {
+	t.Helper()
+	roles, err := s.GetAdminRoles(t.Context(), adminID)
+	if err != nil {
+		t.Fatalf("GetAdminRoles: %v", err)
+	}
+	names := []string{}
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is as much of a password as bcrypt hashes.
+const maxPasswordBytes = 72
+
+var (
+	// ErrWeakPassword means a new password does not meet the password policy.
+	ErrWeakPassword = errors.New("password does not meet the password policy")
+	// ErrWrongPassword means the current password given to change it is wrong.
+	ErrWrongPassword = errors.New("current password is wrong")
+)
+
+// CheckPasswordPolicy reports everything password lacks under policy, in an
+// error that wraps ErrWeakPassword.
+func CheckPasswordPolicy(policy config.PasswordPolicyConfig, password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var problems []string
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("be at least %d characters long", policy.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("be at most %d bytes long", maxPasswordBytes))
+	}
+	for _, rule := range []struct {
+		required, met bool
+		problem       string
+	}{
+		{policy.RequireUpper, upper, "contain an uppercase letter"},
+		{policy.RequireLower, lower, "contain a lowercase letter"},
+		{policy.RequireDigit, digit, "contain a digit"},
+		{policy.RequireSymbol, symbol, "contain a symbol"},
+	} {
+		if rule.required && !rule.met {
+			problems = append(problems, rule.problem)
+		}
+	}
+
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: it must %s", ErrWeakPassword, problems[0])
+	}
+	last := len(problems) - 1
+	return fmt.Errorf("%w: it must %s and %s", ErrWeakPassword, strings.Join(problems[:last], ", "), problems[last])
+}
+
+// ChangePassword sets a new password for a logged-in student who knows their
+// current one, and logs out their other sessions; the login of the access
+// token jti stays. Wrong current passwords count as failed logins, so a stolen
+// session cannot be used to guess the password. The new password is expected
+// to meet the policy already.
+func ChangePassword(ctx context.Context, s storage.Storage, cfg config.Config, studentID int64, jti string, current string, password string, ip string) error {
+	student, err := s.GetStudentById(ctx, studentID)
+	if err != nil {
+		return err
+	}
+	if err := CheckLogin(ctx, s, models.UserStudent, student.Email, ip); err != nil {
+		return err
+	}
+	if !security.CheckPasswordHash(current, student.Password) {
+		if err := LoginFailed(ctx, s, cfg.Auth.LoginThrottle, models.UserStudent, student.Email, ip); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+
+	passwordHash, err := security.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// A session from before families existed has none; every session ends then.
+	var family string
+	token, err := s.GetToken(ctx, jti)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		family = token.Family
+	}
+	return s.ChangeStudentPassword(ctx, studentID, passwordHash, family)
+}
@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	strict := config.PasswordPolicyConfig{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		policy   config.PasswordPolicyConfig
+		password string
+		want     string // the error, or "" when the password passes
+	}{
+		{"long enough", config.PasswordPolicyConfig{MinLength: 8}, "abcdefgh", ""},
+		{"too short", config.PasswordPolicyConfig{MinLength: 8}, "abcdefg", "it must be at least 8 characters long"},
+		{"length in characters", config.PasswordPolicyConfig{MinLength: 4}, "пароль", ""},
+		{"longer than bcrypt hashes", config.PasswordPolicyConfig{}, strings.Repeat("a", 73), "it must be at most 72 bytes long"},
+		{"meets every rule", strict, "Correct-Horse-7", ""},
+		{"one rule missed", strict, "correct-horse-7", "it must contain an uppercase letter"},
+		{"several rules missed", strict, "horse", "it must be at least 10 characters long, contain an uppercase letter, contain a digit and contain a symbol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.CheckPasswordPolicy(tt.policy, tt.password)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("CheckPasswordPolicy: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, auth.ErrWeakPassword) || !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("CheckPasswordPolicy error = %v, want ErrWeakPassword ending %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	hash, err := security.HashPassword("old-password")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", hash, 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	here, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	elsewhere, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, "asha@example.com")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := auth.Parse(keys, here.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	changeCfg := cfg
+	changeCfg.Auth.LoginThrottle = throttleCfg
+	err = auth.ChangePassword(t.Context(), s, changeCfg, id, claims.ID, "wrong", "new-password", "192.0.2.1")
+	if !errors.Is(err, auth.ErrWrongPassword) {
+		t.Fatalf("ChangePassword with a wrong password error = %v, want ErrWrongPassword", err)
+	}
+	if throttle, err := s.GetLoginThrottle(t.Context(), auth.AccountKey(models.UserStudent, "asha@example.com")); err != nil || throttle.Failures != 1 {
+		t.Errorf("wrong current password counted as %+v, %v, want 1 failure", throttle, err)
+	}
+
+	if err := auth.ChangePassword(t.Context(), s, changeCfg, id, claims.ID, "old-password", "new-password", "192.0.2.1"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	student, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	if !security.CheckPasswordHash("new-password", student.Password) {
+		t.Error("the new password does not match")
+	}
+
+	if _, err := auth.Verify(t.Context(), s, keys, here.AccessToken); err != nil {
+		t.Errorf("the session that changed the password: %v", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, elsewhere.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("another session after the change error = %v, want ErrRevokedToken", err)
+	}
+	if _, err := auth.Refresh(t.Context(), s, keys, cfg, elsewhere.RefreshToken); err == nil {
+		t.Error("another session could refresh after the change")
+	}
+}
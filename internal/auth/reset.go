@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"net/url"
+	"time"
+)
+
+// ResetPasswordPath is where a password reset token and the new password
+// are posted.
+const ResetPasswordPath = "/api/students/password/reset"
+
+// RequestPasswordReset records a single-use reset token for the student and
+// mails it to them. Only the token's hash is stored.
+func RequestPasswordReset(ctx context.Context, s storage.Storage, mailer mail.Mailer, cfg config.Config, student models.Student) error {
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	reset := models.PasswordReset{
+		StudentID: student.Id,
+		Hash:      hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.Auth.PasswordResetLifetime),
+	}
+	if err := s.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mail.Message{
+		To:      student.Email,
+		Subject: "Reset your password",
+		Body:    resetBody(cfg, student, token),
+	})
+}
+
+func resetBody(cfg config.Config, student models.Student, token string) string {
+	var howTo string
+	if cfg.Auth.PasswordResetURL != "" {
+		link, err := url.Parse(cfg.Auth.PasswordResetURL)
+		if err == nil {
+			query := link.Query()
+			query.Set("token", token)
+			link.RawQuery = query.Encode()
+			howTo = "Choose a new password here:\n\n" + link.String()
+		}
+	}
+	if howTo == "" {
+		howTo = fmt.Sprintf("Post this token with your new password to %s:\n\n%s", ResetPasswordPath, token)
+	}
+
+	return fmt.Sprintf(`Hello %s,
+
+Someone asked to reset the password of your account. %s
+
+It works once and expires in %s. If you did not ask for this, ignore this
+mail; your password stays as it is.
+`, student.FullName, howTo, cfg.Auth.PasswordResetLifetime)
+}
+
+// ResetPassword sets the password of the student a reset token was mailed
+// to, and logs them out everywhere. An unknown, used or expired token is
+// ErrInvalidToken.
+func ResetPassword(ctx context.Context, s storage.Storage, token string, password string) (int64, error) {
+	passwordHash, err := security.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	studentID, err := s.ResetPassword(ctx, hashToken(token), passwordHash)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalid) {
+		return 0, ErrInvalidToken
+	}
+	return studentID, err
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"bytes"
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPasswordReset(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", "old-hash", 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	student, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, student.Email)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	resetCfg := cfg
+	resetCfg.Auth.PasswordResetURL = "https://portal.example.com/reset?lang=en"
+	resetCfg.Auth.PasswordResetLifetime = time.Hour
+	var outbox bytes.Buffer
+	if err := auth.RequestPasswordReset(t.Context(), s, mail.NewWriter(&outbox, "portal@example.com"), resetCfg, student); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+
+	link := regexp.MustCompile(`https://portal\.example\.com/reset\?\S+`).FindString(outbox.String())
+	if link == "" {
+		t.Fatalf("mail has no reset link:\n%s", outbox.String())
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	token := parsed.Query().Get("token")
+	if token == "" || parsed.Query().Get("lang") != "en" {
+		t.Fatalf("reset link = %s", link)
+	}
+
+	if _, err := auth.ResetPassword(t.Context(), s, "not-a-token", "new-secret"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("unknown reset token error = %v, want ErrInvalidToken", err)
+	}
+	if got, err := auth.ResetPassword(t.Context(), s, token, "new-secret"); err != nil || got != id {
+		t.Fatalf("ResetPassword = %d, %v, want %d", got, err, id)
+	}
+	if _, err := s.LoginStudent(t.Context(), student.Email, "new-secret"); err != nil {
+		t.Errorf("LoginStudent with the new password: %v", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, session.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Verify after the reset error = %v, want ErrRevokedToken", err)
+	}
+	if _, err := auth.ResetPassword(t.Context(), s, token, "other-secret"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("reusing a reset token error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockedError refuses a login while its account or client IP is locked.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return "too many failed logins; try again at " + e.Until.Format(time.RFC3339)
+}
+
+// RetryAfter is the Retry-After header value for the lock: whole seconds,
+// rounded up.
+func (e *LockedError) RetryAfter() string {
+	return strconv.Itoa(int(time.Until(e.Until).Seconds()) + 1)
+}
+
+// AccountKey is the throttle key of an account. Emails without an account
+// get one too, so the answer does not tell whether an account exists.
+func AccountKey(userType models.UserType, email string) string {
+	return string(userType) + ":" + storage.NormalizeEmail(email)
+}
+
+// IPKey is the throttle key of a client IP.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MailKey is the throttle key of the mail that users can have sent to an
+// email address, such as password resets.
+func MailKey(userType models.UserType, email string) string {
+	return "mail:" + AccountKey(userType, email)
+}
+
+// MailIPKey is the throttle key of the mail requested from a client IP.
+func MailIPKey(ip string) string {
+	return "mail:" + IPKey(ip)
+}
+
+// ClientIP is the IP a request came from. Requests from one of the
+// TrustedProxies take it from their ClientIPHeader, which lists the hops a
+// request passed through, as X-Forwarded-For does, or only the client, as
+// X-Real-IP does. Clients can put anything in front of what the proxies
+// append, so the client is the rightmost hop that is not a trusted proxy.
+// Other requests, and requests without the header, come from the peer address.
+func ClientIP(r *http.Request, cfg config.LoginThrottleConfig) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if cfg.ClientIPHeader == "" || !trustedProxy(peer, cfg.TrustedProxies) {
+		return peer
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(cfg.ClientIPHeader), ","), ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !trustedProxy(client, cfg.TrustedProxies) {
+			break
+		}
+	}
+	return client
+}
+
+// trustedProxy reports whether ip is one of proxies, given as addresses or
+// CIDR ranges.
+func trustedProxy(ip string, proxies []string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if proxyAddr, err := netip.ParseAddr(proxy); err == nil && proxyAddr.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLogin fails with a *LockedError while the account or the client IP is
+// locked. It is checked before the password, so a locked account refuses
+// even the right one.
+func CheckLogin(ctx context.Context, s storage.Storage, userType models.UserType, email string, ip string) error {
+	now := time.Now()
+	var locked *LockedError
+	for _, key := range []string{AccountKey(userType, email), IPKey(ip)} {
+		throttle, err := s.GetLoginThrottle(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if throttle.Locked(now) && (locked == nil || throttle.LockedUntil.After(locked.Until)) {
+			locked = &LockedError{Until: *throttle.LockedUntil}
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+	return nil
+}
+
+// LoginFailed counts a failed login against the account and the client IP,
+// and locks whichever has failed too often. Lockouts are audited; the shorter
+// backoff locks are not.
+func LoginFailed(ctx context.Context, s storage.Storage, cfg config.LoginThrottleConfig, userType models.UserType, email string, ip string) error {
+	now := time.Now()
+	limits := []struct {
+		key          string
+		free         int
+		lockoutAfter int
+	}{
+		{AccountKey(userType, email), cfg.FreeAttempts, cfg.LockoutAfter},
+		{IPKey(ip), cfg.IPFreeAttempts, cfg.IPLockoutAfter},
+	}
+	for _, limit := range limits {
+		throttle, err := s.RecordLoginFailure(ctx, limit.key, now, cfg.Window)
+		if err != nil {
+			return err
+		}
+
+		lockedOut := throttle.Failures >= limit.lockoutAfter
+		lock := backoff(throttle.Failures-limit.free, cfg.Backoff, cfg.LockoutDuration)
+		if lockedOut {
+			lock = cfg.LockoutDuration
+		}
+		if lock <= 0 {
+			continue
+		}
+		if err := s.LockLogin(ctx, limit.key, now.Add(lock)); err != nil {
+			return err
+		}
+		if lockedOut {
+			Audit(ctx, s, models.AuditEntry{
+				Event:     models.AuditLoginLocked,
+				Subject:   limit.key,
+				IP:        ip,
+				Detail:    fmt.Sprintf("%d failed logins; locked for %s", throttle.Failures, lock),
+				CreatedAt: now,
+			})
+		}
+	}
+	return nil
+}
+
+// ThrottleMail counts a request to mail email, such as a password reset,
+// against the address and the client IP. It fails with a *LockedError while
+// either has had its limit of mail within the window, and the request is not
+// counted then. Emails without an account are counted too, so the answer does
+// not tell whether one exists. Mail is counted apart from failed logins, so
+// requesting it cannot lock anyone out of logging in.
+func ThrottleMail(ctx context.Context, s storage.Storage, cfg config.MailThrottleConfig, userType models.UserType, email string, ip string) error {
+	now := time.Now()
+	limits := []struct {
+		key   string
+		limit int
+	}{
+		{MailKey(userType, email), cfg.PerEmail},
+		{MailIPKey(ip), cfg.PerIP},
+	}
+	var locked *LockedError
+	for _, limit := range limits {
+		throttle, err := s.GetLoginThrottle(ctx, limit.key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if throttle.Locked(now) && (locked == nil || throttle.LockedUntil.After(locked.Until)) {
+			locked = &LockedError{Until: *throttle.LockedUntil}
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+
+	for _, limit := range limits {
+		throttle, err := s.RecordLoginFailure(ctx, limit.key, now, cfg.Window)
+		if err != nil {
+			return err
+		}
+		if throttle.Failures >= limit.limit {
+			if err := s.LockLogin(ctx, limit.key, now.Add(cfg.Window)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backoff is how long the nth failure past the free attempts locks logins
+// for: first, then twice as long each time, never longer than limit.
+func backoff(n int, first time.Duration, limit time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	lock := first
+	for i := 1; i < n && lock < limit; i++ {
+		lock *= 2
+	}
+	return min(lock, limit)
+}
+
+// LoginSucceeded forgets the failures of the account. Those of the client IP
+// are kept, or a single account of the attacker's own would reset them.
+func LoginSucceeded(ctx context.Context, s storage.Storage, userType models.UserType, email string) error {
+	err := s.ClearLoginFailures(ctx, AccountKey(userType, email))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Unlock lifts the lock on an account or client IP before it expires, and
+// audits which admin lifted it.
+func Unlock(ctx context.Context, s storage.Storage, key string, adminID int64, ip string) error {
+	if err := s.ClearLoginFailures(ctx, key); err != nil {
+		return err
+	}
+	Audit(ctx, s, models.AuditEntry{
+		Event:     models.AuditLoginUnlocked,
+		ActorType: models.UserAdmin,
+		ActorID:   adminID,
+		Subject:   key,
+		IP:        ip,
+	})
+	return nil
+}
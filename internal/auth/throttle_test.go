@@ -0,0 +1,176 @@
+package auth_test
+
+import (
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var throttleCfg = config.LoginThrottleConfig{
+	FreeAttempts:    2,
+	LockoutAfter:    5,
+	IPFreeAttempts:  3,
+	IPLockoutAfter:  8,
+	Backoff:         time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// lockedFor reports how long CheckLogin refuses the account and IP for, or
+// zero when it lets them try.
+func lockedFor(t *testing.T, s *memory.Memory, email string, ip string) time.Duration {
+	t.Helper()
+	err := auth.CheckLogin(t.Context(), s, models.UserStudent, email, ip)
+	if err == nil {
+		return 0
+	}
+	var locked *auth.LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("CheckLogin: %v", err)
+	}
+	return time.Until(locked.Until).Round(time.Minute)
+}
+
+func TestLoginThrottle(t *testing.T) {
+	s := memory.New()
+	fail := func(email string, ip string) {
+		t.Helper()
+		if err := auth.LoginFailed(t.Context(), s, throttleCfg, models.UserStudent, email, ip); err != nil {
+			t.Fatalf("LoginFailed: %v", err)
+		}
+	}
+
+	// The free attempts lock nothing; every failure after them locks the
+	// account for twice as long, until it is locked out.
+	for i, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 15 * time.Minute} {
+		fail("Asha@Example.com", "192.0.2.1")
+		if got := lockedFor(t, s, "asha@example.com", "192.0.2.2"); got != want {
+			t.Errorf("after %d failures locked for %s, want %s", i+1, got, want)
+		}
+	}
+
+	entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditLoginLocked)
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Subject != "student:asha@example.com" || entries[0].IP != "192.0.2.1" {
+		t.Errorf("lockout audit entries = %+v", entries)
+	}
+
+	// Another account from the same IP is throttled by the IP's failures.
+	if got := lockedFor(t, s, "ravi@example.com", "192.0.2.1"); got != 2*time.Minute {
+		t.Errorf("IP after 5 failures locked for %s, want 2m", got)
+	}
+	if got := lockedFor(t, s, "ravi@example.com", "192.0.2.3"); got != 0 {
+		t.Errorf("unrelated account and IP locked for %s", got)
+	}
+
+	// Logging in forgets the account's failures but not the IP's.
+	if err := auth.LoginSucceeded(t.Context(), s, models.UserStudent, "asha@example.com"); err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+	if got := lockedFor(t, s, "asha@example.com", "192.0.2.2"); got != 0 {
+		t.Errorf("account still locked for %s after logging in", got)
+	}
+	if got := lockedFor(t, s, "asha@example.com", "192.0.2.1"); got != 2*time.Minute {
+		t.Errorf("IP locked for %s after logging in, want 2m", got)
+	}
+
+	if err := auth.Unlock(t.Context(), s, auth.IPKey("192.0.2.1"), 7, "198.51.100.1"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got := lockedFor(t, s, "asha@example.com", "192.0.2.1"); got != 0 {
+		t.Errorf("IP still locked for %s after Unlock", got)
+	}
+	entries, err = s.GetAuditEntries(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Event != models.AuditLoginUnlocked || entries[0].ActorID != 7 || entries[0].Subject != "ip:192.0.2.1" {
+		t.Errorf("unlock audit entries = %+v", entries)
+	}
+}
+
+func TestThrottleMail(t *testing.T) {
+	s := memory.New()
+	mailCfg := config.MailThrottleConfig{PerEmail: 2, PerIP: 3, Window: time.Hour}
+	request := func(email string, ip string) error {
+		t.Helper()
+		err := auth.ThrottleMail(t.Context(), s, mailCfg, models.UserStudent, email, ip)
+		var locked *auth.LockedError
+		if err != nil && !errors.As(err, &locked) {
+			t.Fatalf("ThrottleMail: %v", err)
+		}
+		return err
+	}
+
+	// Each address gets its limit of mail, whoever asks for it.
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := request("Asha@Example.com", ip); err != nil {
+			t.Errorf("request %d error = %v", i+1, err)
+		}
+	}
+	if err := request("asha@example.com", "192.0.2.3"); err == nil {
+		t.Error("request past the email's limit was not refused")
+	}
+
+	// Each IP gets its limit, whichever addresses it asks for.
+	for _, email := range []string{"ravi@example.com", "meera@example.com"} {
+		if err := request(email, "192.0.2.1"); err != nil {
+			t.Errorf("request for %s within the IP's limit error = %v", email, err)
+		}
+	}
+	if err := request("kiran@example.com", "192.0.2.1"); err == nil {
+		t.Error("request past the IP's limit was not refused")
+	}
+
+	// Mail is counted apart from logins.
+	if got := lockedFor(t, s, "asha@example.com", "192.0.2.1"); got != 0 {
+		t.Errorf("logins locked for %s after requests for mail", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	forwarded := config.LoginThrottleConfig{ClientIPHeader: "X-Forwarded-For", TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}
+	realIP := config.LoginThrottleConfig{ClientIPHeader: "X-Real-IP", TrustedProxies: []string{"10.0.0.1"}}
+
+	for _, test := range []struct {
+		name   string
+		cfg    config.LoginThrottleConfig
+		peer   string
+		header []string
+		want   string
+	}{
+		{"no header configured", config.LoginThrottleConfig{}, "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"untrusted peer", forwarded, "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"one hop", forwarded, "10.0.0.1:5000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed hops", forwarded, "10.0.0.1:5000", []string{"1.2.3.4, 5.6.7.8, 203.0.113.7"}, "203.0.113.7"},
+		{"spoofed trusted hop", forwarded, "10.0.0.1:5000", []string{"10.9.9.9, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of proxies", forwarded, "10.0.0.1:5000", []string{"1.2.3.4, 203.0.113.7, 192.0.2.1, 10.0.0.2"}, "203.0.113.7"},
+		{"repeated headers", forwarded, "10.0.0.1:5000", []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"garbage before the proxy's hop", forwarded, "10.0.0.1:5000", []string{"not-an-ip, 203.0.113.7"}, "203.0.113.7"},
+		{"only proxies", forwarded, "10.0.0.1:5000", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"missing header", forwarded, "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"ipv6", forwarded, "[::ffff:10.0.0.1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"real ip", realIP, "10.0.0.1:5000", []string{"203.0.113.7"}, "203.0.113.7"},
+	} {
+		r := httptest.NewRequest("POST", "/api/students/login", nil)
+		r.RemoteAddr = test.peer
+		for _, value := range test.header {
+			r.Header.Add(test.cfg.ClientIPHeader, value)
+		}
+		if test.cfg.ClientIPHeader == "" {
+			for _, value := range test.header {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+		}
+		if ip := auth.ClientIP(r, test.cfg); ip != test.want {
+			t.Errorf("%s: ClientIP = %q, want %q", test.name, ip, test.want)
+		}
+	}
+}
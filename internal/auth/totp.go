@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters, the defaults every authenticator app supports.
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew is how many steps before and after the current one are
+	// accepted, for clocks that drift.
+	totpSkew = 1
+)
+
+// recoveryCodeCount recovery codes are handed out when TOTP is confirmed.
+const recoveryCodeCount = 10
+
+// ErrInvalidCode means an authentication or recovery code is wrong, or was
+// already used.
+var ErrInvalidCode = errors.New("invalid authentication code")
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPSetup is a new secret for an authenticator app, as a key to type in and
+// as an otpauth:// URI for a QR code.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// SetUpTOTP generates a new secret for the user. Logins do not ask for codes
+// until the user confirms it with ConfirmTOTP.
+func SetUpTOTP(ctx context.Context, s storage.Storage, cfg config.Config, userType models.UserType, userID int64, email string) (TOTPSetup, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return TOTPSetup{}, err
+	}
+	secret := base32NoPadding.EncodeToString(b)
+
+	err := s.CreateTOTP(ctx, models.TOTP{UserType: userType, UserID: userID, Secret: secret, CreatedAt: time.Now()})
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+
+	issuer := cfg.Auth.MFAIssuer
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	uri := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + email, RawQuery: query.Encode()}
+	return TOTPSetup{Secret: secret, URI: uri.String()}, nil
+}
+
+// ConfirmTOTP turns on two-factor authentication once the user enters a code
+// from their new secret, and returns their recovery codes. Only their hashes
+// are stored, so they are shown this once.
+func ConfirmTOTP(ctx context.Context, s storage.Storage, userType models.UserType, userID int64, code string, ip string) ([]string, error) {
+	totp, err := s.GetTOTP(ctx, userType, userID)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+	if err := s.ConfirmTOTP(ctx, userType, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	Audit(ctx, s, models.AuditEntry{Event: models.AuditMFAEnabled, ActorType: userType, ActorID: userID, Subject: userSubject(userType, userID), IP: ip})
+	return codes, nil
+}
+
+// HasMFA reports whether logins of the user ask for a code.
+func HasMFA(ctx context.Context, s storage.Storage, userType models.UserType, userID int64) (bool, error) {
+	totp, err := s.GetTOTP(ctx, userType, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Confirmed(), nil
+}
+
+// CheckTOTP accepts a code from the user's confirmed secret, once.
+func CheckTOTP(ctx context.Context, s storage.Storage, userType models.UserType, userID int64, code string) error {
+	totp, err := s.GetTOTP(ctx, userType, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	step, ok := matchTOTP(totp.Secret, code, time.Now())
+	if !totp.Confirmed() || !ok {
+		return ErrInvalidCode
+	}
+
+	err = s.UseTOTPStep(ctx, userType, userID, step)
+	if errors.Is(err, storage.ErrConflict) {
+		return ErrInvalidCode
+	}
+	return err
+}
+
+// UseRecoveryCode accepts one of the user's recovery codes in place of a
+// code, uses it up, and reports how many remain.
+func UseRecoveryCode(ctx context.Context, s storage.Storage, userType models.UserType, userID int64, code string, ip string) (int, error) {
+	remaining, err := s.UseRecoveryCode(ctx, userType, userID, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, ErrInvalidCode
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	Audit(ctx, s, models.AuditEntry{
+		Event:     models.AuditRecoveryCode,
+		ActorType: userType,
+		ActorID:   userID,
+		Subject:   userSubject(userType, userID),
+		IP:        ip,
+		Detail:    fmt.Sprintf("%d recovery codes left", remaining),
+	})
+	return remaining, nil
+}
+
+// DisableTOTP turns off two-factor authentication, given a current code.
+func DisableTOTP(ctx context.Context, s storage.Storage, userType models.UserType, userID int64, code string, ip string) error {
+	if err := CheckTOTP(ctx, s, userType, userID, code); err != nil {
+		return err
+	}
+	if err := s.DeleteTOTP(ctx, userType, userID); err != nil {
+		return err
+	}
+	Audit(ctx, s, models.AuditEntry{Event: models.AuditMFADisabled, ActorType: userType, ActorID: userID, Subject: userSubject(userType, userID), IP: ip})
+	return nil
+}
+
+// GenerateTOTP returns the code of secret at the given time, as an
+// authenticator app shows it.
+func GenerateTOTP(secret string, at time.Time) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, at.Unix()/int64(totpPeriod.Seconds())), nil
+}
+
+// matchTOTP returns the time step, within the skew, whose code is code.
+func matchTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the HOTP value (RFC 4226) of key at counter step.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// newRecoveryCode returns 80 random bits as four groups of four characters,
+// such as "7kqm-2xhd-w9ta-c3pe".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32NoPadding.EncodeToString(b))
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// normalizeRecoveryCode accepts codes typed in capitals or without dashes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+// userSubject names a user in the audit log.
+func userSubject(userType models.UserType, userID int64) string {
+	return fmt.Sprintf("%s:%d", userType, userID)
+}
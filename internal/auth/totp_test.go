@@ -0,0 +1,274 @@
+package auth_test
+
+import (
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, appendix B, cut to six digits. The
+	// secret is "12345678901234567890".
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		at   int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := auth.GenerateTOTP(secret, time.Unix(tt.at, 0))
+		if err != nil || code != tt.code {
+			t.Errorf("GenerateTOTP at %d = %q, %v, want %q", tt.at, code, err, tt.code)
+		}
+	}
+}
+
+// setUpTOTP sets up and confirms TOTP for the user and returns the secret and
+// the recovery codes.
+func setUpTOTP(t *testing.T, s *memory.Memory, userType models.UserType, userID int64) (string, []string) {
+	t.Helper()
+	setup, err := auth.SetUpTOTP(t.Context(), s, cfg, userType, userID, "asha@example.com")
+	if err != nil {
+		t.Fatalf("SetUpTOTP: %v", err)
+	}
+	code, err := auth.GenerateTOTP(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateTOTP: %v", err)
+	}
+	codes, err := auth.ConfirmTOTP(t.Context(), s, userType, userID, code, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return setup.Secret, codes
+}
+
+func TestTOTP(t *testing.T) {
+	s := memory.New()
+	totpCfg := cfg
+	totpCfg.Auth.MFAIssuer = "CtrlB Portal"
+
+	setup, err := auth.SetUpTOTP(t.Context(), s, totpCfg, models.UserStudent, 1, "asha@example.com")
+	if err != nil {
+		t.Fatalf("SetUpTOTP: %v", err)
+	}
+	uri, err := url.Parse(setup.URI)
+	if err != nil || uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/CtrlB Portal:asha@example.com" {
+		t.Fatalf("otpauth URI = %q, %v", setup.URI, err)
+	}
+	if query := uri.Query(); query.Get("secret") != setup.Secret || query.Get("issuer") != "CtrlB Portal" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("otpauth URI query = %v", query)
+	}
+
+	// Until the secret is confirmed, logins ask for no code.
+	if enabled, err := auth.HasMFA(t.Context(), s, models.UserStudent, 1); err != nil || enabled {
+		t.Errorf("HasMFA before confirming = %v, %v", enabled, err)
+	}
+	now := time.Now()
+	code, _ := auth.GenerateTOTP(setup.Secret, now)
+	if err := auth.CheckTOTP(t.Context(), s, models.UserStudent, 1, code); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("CheckTOTP before confirming error = %v, want ErrInvalidCode", err)
+	}
+
+	wrong, _ := auth.GenerateTOTP(setup.Secret, now.Add(-time.Hour))
+	if _, err := auth.ConfirmTOTP(t.Context(), s, models.UserStudent, 1, wrong, "192.0.2.1"); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("ConfirmTOTP with an old code error = %v, want ErrInvalidCode", err)
+	}
+	codes, err := auth.ConfirmTOTP(t.Context(), s, models.UserStudent, 1, code, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	if len(codes) != 10 || len(codes[0]) != len("xxxx-xxxx-xxxx-xxxx") || codes[0] == codes[1] {
+		t.Errorf("recovery codes = %q", codes)
+	}
+	if enabled, err := auth.HasMFA(t.Context(), s, models.UserStudent, 1); err != nil || !enabled {
+		t.Errorf("HasMFA after confirming = %v, %v", enabled, err)
+	}
+
+	// Every code works once, and codes a step off are accepted.
+	if err := auth.CheckTOTP(t.Context(), s, models.UserStudent, 1, code); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("CheckTOTP with the confirming code error = %v, want ErrInvalidCode", err)
+	}
+	next, _ := auth.GenerateTOTP(setup.Secret, now.Add(30*time.Second))
+	if err := auth.CheckTOTP(t.Context(), s, models.UserStudent, 1, next); err != nil {
+		t.Errorf("CheckTOTP with the next code: %v", err)
+	}
+	if err := auth.CheckTOTP(t.Context(), s, models.UserStudent, 1, "12345"); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("CheckTOTP with a short code error = %v, want ErrInvalidCode", err)
+	}
+
+	// Recovery codes are accepted however they are typed, once.
+	typed := strings.ToUpper(strings.ReplaceAll(codes[3], "-", ""))
+	if remaining, err := auth.UseRecoveryCode(t.Context(), s, models.UserStudent, 1, typed, "192.0.2.1"); err != nil || remaining != 9 {
+		t.Errorf("UseRecoveryCode = %d, %v, want 9 left", remaining, err)
+	}
+	if _, err := auth.UseRecoveryCode(t.Context(), s, models.UserStudent, 1, codes[3], "192.0.2.1"); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("UseRecoveryCode twice error = %v, want ErrInvalidCode", err)
+	}
+
+	entries, err := s.GetAuditEntries(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Event != models.AuditRecoveryCode || entries[1].Event != models.AuditMFAEnabled ||
+		entries[1].ActorType != models.UserStudent || entries[1].ActorID != 1 {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	s := memory.New()
+	secret, _ := setUpTOTP(t, s, models.UserAdmin, 1)
+
+	if err := auth.DisableTOTP(t.Context(), s, models.UserAdmin, 1, "000000", "192.0.2.1"); !errors.Is(err, auth.ErrInvalidCode) {
+		t.Errorf("DisableTOTP with a wrong code error = %v, want ErrInvalidCode", err)
+	}
+	code, _ := auth.GenerateTOTP(secret, time.Now().Add(30*time.Second))
+	if err := auth.DisableTOTP(t.Context(), s, models.UserAdmin, 1, code, "192.0.2.1"); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if enabled, err := auth.HasMFA(t.Context(), s, models.UserAdmin, 1); err != nil || enabled {
+		t.Errorf("HasMFA after DisableTOTP = %v, %v", enabled, err)
+	}
+	if entries, err := s.GetAuditEntries(t.Context(), 10, models.AuditMFADisabled); err != nil || len(entries) != 1 {
+		t.Errorf("mfa.disabled audit entries = %+v, %v", entries, err)
+	}
+}
+
+func TestMFAStep(t *testing.T) {
+	s := memory.New()
+	setUpTOTP(t, s, models.UserStudent, 2)
+
+	tests := []struct {
+		name     string
+		require  bool
+		userType models.UserType
+		userID   int64
+		want     string
+	}{
+		{"student without TOTP", true, models.UserStudent, 1, ""},
+		{"student with TOTP", false, models.UserStudent, 2, auth.MFAVerify},
+		{"admin without TOTP", false, models.UserAdmin, 1, ""},
+		{"admin without required TOTP", true, models.UserAdmin, 1, auth.MFASetup},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stepCfg := cfg
+			stepCfg.Auth.RequireAdminMFA = tt.require
+			if step, err := auth.MFAStep(t.Context(), s, stepCfg, tt.userType, tt.userID); err != nil || step != tt.want {
+				t.Errorf("MFAStep = %q, %v, want %q", step, err, tt.want)
+			}
+		})
+	}
+}
+
+// startMFA holds a login of the admin at step and returns the request that
+// completes it, carrying the mfa_token cookie.
+func startMFA(t *testing.T, s *memory.Memory, keys *auth.Keys, cfg config.Config, step string, adminID int64) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if token, err := auth.StartMFA(w, httptest.NewRequest("POST", "/api/admin", nil), s, keys, cfg, step, models.UserAdmin, adminID, "root@example.com"); err != nil || token != "" {
+		t.Fatalf("StartMFA = %q, %v, want the token in a cookie", token, err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.MFACookieName || cookies[0].Path != auth.MFAPath {
+		t.Fatalf("StartMFA set cookies %+v", cookies)
+	}
+	r := httptest.NewRequest("POST", auth.MFAPath, nil)
+	r.AddCookie(cookies[0])
+	return r
+}
+
+func TestPendingMFA(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	pendingCfg := cfg
+	pendingCfg.Auth.MFATokenLifetime = time.Minute
+	if _, err := s.CreateFirstAdmin(t.Context(), "Ops", "ops@example.com", "hash"); err != nil {
+		t.Fatalf("CreateFirstAdmin: %v", err)
+	}
+	root, err := s.CreateAdmin(t.Context(), "Root", "root@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	setUpTOTP(t, s, models.UserAdmin, root)
+
+	r := startMFA(t, s, keys, pendingCfg, auth.MFAVerify, root)
+	claims, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFAVerify)
+	if err != nil || claims.UserType != models.UserAdmin || claims.UserID() != root || claims.Email != "root@example.com" {
+		t.Fatalf("PendingMFA = %+v, %v", claims, err)
+	}
+	if _, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFASetup); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("PendingMFA for another step error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, r.Cookies()[0].Value); err == nil {
+		t.Error("a pending login was accepted as an access token")
+	}
+	if _, err := auth.PendingMFA(httptest.NewRequest("POST", auth.MFAPath, nil), s, keys, pendingCfg, auth.MFAVerify); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("PendingMFA without a cookie error = %v, want ErrInvalidToken", err)
+	}
+
+	// A pending login completes once; replaying its token is refused.
+	if err := auth.FinishMFA(t.Context(), s, claims); err != nil {
+		t.Fatalf("FinishMFA: %v", err)
+	}
+	if err := auth.FinishMFA(t.Context(), s, claims); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("FinishMFA twice error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFAVerify); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("PendingMFA after FinishMFA error = %v, want ErrInvalidToken", err)
+	}
+
+	// The account is checked again: a login held before the admin was
+	// disabled is refused.
+	r = startMFA(t, s, keys, pendingCfg, auth.MFAVerify, root)
+	if err := s.SetAdminDisabled(t.Context(), root, true); err != nil {
+		t.Fatalf("SetAdminDisabled: %v", err)
+	}
+	if _, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFAVerify); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("PendingMFA of a disabled admin error = %v, want ErrInvalidToken", err)
+	}
+
+	// So is a login held for setting up TOTP once the admin has it.
+	pendingCfg.Auth.RequireAdminMFA = true
+	newcomer, err := s.CreateAdmin(t.Context(), "Newcomer", "newcomer@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	r = startMFA(t, s, keys, pendingCfg, auth.MFASetup, newcomer)
+	if _, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFASetup); err != nil {
+		t.Fatalf("PendingMFA for setup: %v", err)
+	}
+	setUpTOTP(t, s, models.UserAdmin, newcomer)
+	if _, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFASetup); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("PendingMFA for setup after TOTP was set up error = %v, want ErrInvalidToken", err)
+	}
+
+	// Clients that prefer bearer tokens get the token itself and send it back.
+	w := httptest.NewRecorder()
+	login := httptest.NewRequest("POST", "/api/students/login", nil)
+	login.Header.Set("Prefer", "bearer")
+	setUpTOTP(t, s, models.UserStudent, 8)
+	token, err := auth.StartMFA(w, login, s, keys, pendingCfg, auth.MFAVerify, models.UserStudent, 8, "asha@example.com")
+	if err != nil || token == "" || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("StartMFA preferring bearer = %q, %v, cookies %+v", token, err, w.Result().Cookies())
+	}
+	r = httptest.NewRequest("POST", auth.MFAPath, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if claims, err := auth.PendingMFA(r, s, keys, pendingCfg, auth.MFAVerify); err != nil || claims.UserID() != 8 {
+		t.Errorf("PendingMFA with a bearer token = %+v, %v", claims, err)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifyEmailPath is where verification links lead.
+const VerifyEmailPath = "/api/students/verify"
+
+// verificationAudience keeps verification tokens and access tokens apart:
+// access tokens carry no audience, and verification tokens carry no jti.
+const verificationAudience = "email-verification"
+
+// verificationClaims name the student and the email the link was sent to, so
+// a link stops working once the student changes their email.
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// SendVerification mails the student a signed link that verifies their email.
+// Nothing is stored: the link is checked by its signature and expiry.
+func SendVerification(ctx context.Context, keys *Keys, mailer mail.Mailer, cfg config.Config, student models.Student) error {
+	now := time.Now()
+	claims := verificationClaims{
+		Email: student.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(student.Id, 10),
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.Auth.EmailVerificationLifetime)),
+		},
+	}
+	token, err := keys.sign(claims)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(cfg.Auth.EmailVerificationURL)
+	if err != nil {
+		return fmt.Errorf("auth.email_verification_url: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mailer.Send(ctx, mail.Message{
+		To:      student.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(`Hello %s,
+
+Confirm that this is your email by opening this link:
+
+%s
+
+The link expires in %s. If you did not register, ignore this mail.
+`, student.FullName, link, cfg.Auth.EmailVerificationLifetime),
+	})
+}
+
+// VerifyEmail checks a verification token and marks its student verified.
+// A token that is badly signed, expired, or for an email the student no
+// longer has is ErrInvalidToken. Verifying twice is harmless.
+func VerifyEmail(ctx context.Context, s storage.Storage, keys *Keys, token string) (int64, error) {
+	var claims verificationClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, keys.verificationKey,
+		jwt.WithAudience(verificationAudience), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return 0, ErrInvalidToken
+	}
+	studentID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	err = s.VerifyStudentEmail(ctx, studentID, claims.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, ErrInvalidToken
+	}
+	return studentID, err
+}
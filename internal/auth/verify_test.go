@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"bytes"
+	"errors"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage/memory"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestEmailVerification(t *testing.T) {
+	s := memory.New()
+	keys := loadKeys(t, cfg)
+	id, err := s.CreateStudent(t.Context(), "Asha", "asha@example.com", "hash", 20, "female", "1", "2000-01-01", "x")
+	if err != nil {
+		t.Fatalf("CreateStudent: %v", err)
+	}
+	student, err := s.GetStudentById(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetStudentById: %v", err)
+	}
+
+	verifyCfg := cfg
+	verifyCfg.Auth.EmailVerificationURL = "https://portal.example.com/verify"
+	verifyCfg.Auth.EmailVerificationLifetime = time.Hour
+	send := func() string {
+		t.Helper()
+		var outbox bytes.Buffer
+		if err := auth.SendVerification(t.Context(), keys, mail.NewWriter(&outbox, "portal@example.com"), verifyCfg, student); err != nil {
+			t.Fatalf("SendVerification: %v", err)
+		}
+		link := regexp.MustCompile(`https://portal\.example\.com/verify\?\S+`).FindString(outbox.String())
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Query().Get("token") == "" {
+			t.Fatalf("mail has no verification link:\n%s", outbox.String())
+		}
+		return parsed.Query().Get("token")
+	}
+	token := send()
+
+	session, err := auth.Login(t.Context(), s, keys, cfg, models.UserStudent, id, student.Email)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := auth.VerifyEmail(t.Context(), s, keys, session.AccessToken); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("VerifyEmail with an access token error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := auth.Verify(t.Context(), s, keys, token); err == nil {
+		t.Error("a verification token was accepted as an access token")
+	}
+
+	if got, err := auth.VerifyEmail(t.Context(), s, keys, token); err != nil || got != id {
+		t.Fatalf("VerifyEmail = %d, %v, want %d", got, err, id)
+	}
+	if got, _ := s.GetStudentById(t.Context(), id); !got.Verified {
+		t.Error("student is not verified after VerifyEmail")
+	}
+
+	// A link sent before the email changed must not verify the new one.
+	token = send()
+	student.Email = "asha.k@example.com"
+	if err := s.UpdateStudent(t.Context(), id, student); err != nil {
+		t.Fatalf("UpdateStudent: %v", err)
+	}
+	if _, err := auth.VerifyEmail(t.Context(), s, keys, token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("VerifyEmail for an old email error = %v, want ErrInvalidToken", err)
+	}
+	if got, _ := s.GetStudentById(t.Context(), id); got.Verified {
+		t.Error("changed email is verified by a link sent to the old one")
+	}
+	if _, err := auth.VerifyEmail(t.Context(), s, keys, send()); err != nil {
+		t.Errorf("VerifyEmail for the new email: %v", err)
+	}
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"flag"
 	"log"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -11,17 +14,225 @@ type HTTPServer struct{
 	Addr string `yaml:"address" env-required:"true"`
 }
 
+// AdminConfig is the first admin, created on startup only while the
+// database has no admins. Later admins are managed through the API.
 type AdminConfig struct {
-	Email    string `yaml:"email"`
-	Password string `yaml:"password"`
+	Name     string `yaml:"name" env:"ADMIN_NAME" env-default:"Admin"`
+	Email    string `yaml:"email" env:"ADMIN_EMAIL"`
+	Password string `yaml:"password" env:"ADMIN_PASSWORD"`
+}
+
+// StorageConfig selects the storage backend. The sqlite driver uses
+// Config.StoragePath, the postgres driver connects with DSN. QueryTimeout
+// bounds every storage call that has no earlier deadline; zero disables it.
+type StorageConfig struct {
+	Driver       string        `yaml:"driver" env:"STORAGE_DRIVER" env-default:"sqlite"`
+	DSN          string        `yaml:"dsn" env:"STORAGE_DSN"`
+	QueryTimeout time.Duration `yaml:"query_timeout" env:"STORAGE_QUERY_TIMEOUT" env-default:"5s"`
+}
+
+// AuthConfig sets how long session tokens live and which keys sign them.
+// Access tokens are short-lived JWTs; refresh tokens renew them and are
+// replaced on every use. Every key in Keys verifies access tokens and is
+// published at /.well-known/jwks.json; SigningKey names the one that signs
+// new tokens. Without a SigningKey, tokens are signed with Config.JWTSecret;
+// with one, the secret is ignored unless LegacyJWTSecret keeps it verifying
+// the access tokens it signed, while they expire.
+type AuthConfig struct {
+	AccessTokenLifetime  time.Duration `yaml:"access_token_lifetime" env:"ACCESS_TOKEN_LIFETIME" env-default:"15m"`
+	RefreshTokenLifetime time.Duration `yaml:"refresh_token_lifetime" env:"REFRESH_TOKEN_LIFETIME" env-default:"720h"`
+	SigningKey           string        `yaml:"signing_key" env:"SIGNING_KEY"`
+	Keys                 []KeyConfig   `yaml:"keys"`
+	LegacyJWTSecret      bool          `yaml:"legacy_jwt_secret" env:"LEGACY_JWT_SECRET"`
+	// PasswordResetURL is the page that takes a reset token from its token
+	// query parameter. Without one, reset mails carry the bare token.
+	PasswordResetURL      string        `yaml:"password_reset_url" env:"PASSWORD_RESET_URL"`
+	PasswordResetLifetime time.Duration `yaml:"password_reset_lifetime" env:"PASSWORD_RESET_LIFETIME" env-default:"1h"`
+	// EmailVerificationURL is where verification links lead: this server's
+	// /api/students/verify, as students reach it.
+	EmailVerificationURL      string        `yaml:"email_verification_url" env:"EMAIL_VERIFICATION_URL" env-default:"http://localhost:8082/api/students/verify"`
+	EmailVerificationLifetime time.Duration `yaml:"email_verification_lifetime" env:"EMAIL_VERIFICATION_LIFETIME" env-default:"72h"`
+	// RequireVerifiedEmail is what unverified students cannot do until they
+	// follow the link: nothing (none), log in (login), or enroll (enrollment).
+	RequireVerifiedEmail string               `yaml:"require_verified_email" env:"REQUIRE_VERIFIED_EMAIL" env-default:"none"`
+	LoginThrottle        LoginThrottleConfig  `yaml:"login_throttle"`
+	MailThrottle         MailThrottleConfig   `yaml:"mail_throttle"`
+	PasswordPolicy       PasswordPolicyConfig `yaml:"password_policy"`
+	// RequireAdminMFA makes admins without two-factor authentication set it
+	// up before their next login completes, and keeps them from turning it
+	// off. MFAIssuer names this service in authenticator apps. A login
+	// waiting for its code expires after MFATokenLifetime.
+	RequireAdminMFA  bool          `yaml:"require_admin_mfa" env:"REQUIRE_ADMIN_MFA"`
+	MFAIssuer        string        `yaml:"mfa_issuer" env:"MFA_ISSUER" env-default:"CtrlB"`
+	MFATokenLifetime time.Duration `yaml:"mfa_token_lifetime" env:"MFA_TOKEN_LIFETIME" env-default:"5m"`
+	Cookies          CookieConfig  `yaml:"cookies"`
+	OIDC             OIDCConfig    `yaml:"oidc"`
+	LDAP             LDAPConfig    `yaml:"ldap"`
+}
+
+// LDAPConfig lets staff log in as admins with their directory password when
+// URL is set, an ldap:// or ldaps:// address; StartTLS upgrades an ldap://
+// connection. Logins bind as BindDN, or anonymously without one, to find the
+// user with UserFilter under BaseDN; its %s is the escaped email. The user's
+// GroupAttribute values, such as the DNs of their groups, map to admin roles
+// through GroupRoles, and users in none of the groups are not logged in by the
+// directory. Each login must finish within Timeout.
+type LDAPConfig struct {
+	URL            string            `yaml:"url" env:"LDAP_URL"`
+	StartTLS       bool              `yaml:"start_tls" env:"LDAP_START_TLS"`
+	BindDN         string            `yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword   string            `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN         string            `yaml:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter     string            `yaml:"user_filter" env:"LDAP_USER_FILTER" env-default:"(&(objectClass=person)(mail=%s))"`
+	EmailAttribute string            `yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE" env-default:"mail"`
+	NameAttribute  string            `yaml:"name_attribute" env:"LDAP_NAME_ATTRIBUTE" env-default:"cn"`
+	GroupAttribute string            `yaml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE" env-default:"memberOf"`
+	GroupRoles     map[string]string `yaml:"group_roles"`
+	Timeout        time.Duration     `yaml:"timeout" env:"LDAP_TIMEOUT" env-default:"5s"`
+}
+
+// OIDCConfig turns on single sign-on through an OpenID Connect provider when
+// Issuer is set. RedirectURL is this server's /api/auth/oidc/callback, as the
+// provider sends browsers to it; once logged in they go on to AfterLoginURL.
+// GroupRoles maps the provider's groups, read from the GroupsClaim of its ID
+// tokens, to portal roles: users in a group mapped to an admin role log in as
+// admins holding exactly the roles of their groups, and anyone else as a
+// student, or only members of a group mapped to student when there is one.
+// A login must come back from the provider within LoginLifetime.
+type OIDCConfig struct {
+	Issuer        string            `yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID      string            `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret  string            `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL   string            `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes        []string          `yaml:"scopes" env:"OIDC_SCOPES" env-default:"openid,email,profile"`
+	GroupsClaim   string            `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM" env-default:"groups"`
+	GroupRoles    map[string]string `yaml:"group_roles"`
+	AfterLoginURL string            `yaml:"after_login_url" env:"OIDC_AFTER_LOGIN_URL" env-default:"/"`
+	LoginLifetime time.Duration     `yaml:"login_lifetime" env:"OIDC_LOGIN_LIFETIME" env-default:"10m"`
+}
+
+// CookieConfig sets the attributes of the cookies the portal sets. Secure is
+// auto, true or false; auto keeps the cookies to HTTPS in every environment
+// but dev. Domain shares them with subdomains, which can then also set them;
+// empty keeps them to this host. SameSite is lax, strict or none, which
+// needs Secure; empty keeps auth_token and csrf_token Lax and the cookies
+// sent only to their own paths Strict.
+type CookieConfig struct {
+	Secure   string `yaml:"secure" env:"COOKIE_SECURE" env-default:"auto"`
+	Domain   string `yaml:"domain" env:"COOKIE_DOMAIN"`
+	SameSite string `yaml:"same_site" env:"COOKIE_SAME_SITE"`
+}
+
+// What CookieConfig.Secure and CookieConfig.SameSite can be.
+const (
+	CookieSecureAuto  = "auto"
+	CookieSecureTrue  = "true"
+	CookieSecureFalse = "false"
+
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// exampleJWTSecret is the jwt_secret the example config once shipped with.
+// It is public, so anyone could sign tokens with it.
+const exampleJWTSecret = "CTRLB"
+
+// EnvDev is the environment of a developer's machine, served over plain HTTP.
+const EnvDev = "dev"
+
+// SecureCookies reports whether cookies are kept to HTTPS.
+func (c *Config) SecureCookies() bool {
+	switch c.Auth.Cookies.Secure {
+	case CookieSecureTrue:
+		return true
+	case CookieSecureFalse:
+		return false
+	}
+	return c.Env != EnvDev
+}
+
+// LoginThrottleConfig slows down password guessing. Failed logins are counted
+// per account and per client IP for Window after the last one. Past the free
+// attempts, every failure locks logins for Backoff, doubling with each further
+// failure; at LockoutAfter failures the account or IP is locked out for
+// LockoutDuration. ClientIPHeader names the header a reverse proxy puts the
+// client IP in, and is only read from requests of the TrustedProxies,
+// addresses or CIDR ranges; without one, the peer address is the client IP.
+type LoginThrottleConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts" env:"LOGIN_FREE_ATTEMPTS" env-default:"3"`
+	LockoutAfter    int           `yaml:"lockout_after" env:"LOGIN_LOCKOUT_AFTER" env-default:"10"`
+	IPFreeAttempts  int           `yaml:"ip_free_attempts" env:"LOGIN_IP_FREE_ATTEMPTS" env-default:"10"`
+	IPLockoutAfter  int           `yaml:"ip_lockout_after" env:"LOGIN_IP_LOCKOUT_AFTER" env-default:"50"`
+	Backoff         time.Duration `yaml:"backoff" env:"LOGIN_BACKOFF" env-default:"1s"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" env-default:"15m"`
+	Window          time.Duration `yaml:"window" env:"LOGIN_THROTTLE_WINDOW" env-default:"1h"`
+	ClientIPHeader  string        `yaml:"client_ip_header" env:"CLIENT_IP_HEADER"`
+	TrustedProxies  []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// MailThrottleConfig limits the mail that anyone can have sent, password
+// resets and verification links, to PerEmail per email address and PerIP per
+// client IP within Window. Further requests are refused until Window has
+// passed.
+type MailThrottleConfig struct {
+	PerEmail int           `yaml:"per_email" env:"MAIL_THROTTLE_PER_EMAIL" env-default:"3"`
+	PerIP    int           `yaml:"per_ip" env:"MAIL_THROTTLE_PER_IP" env-default:"20"`
+	Window   time.Duration `yaml:"window" env:"MAIL_THROTTLE_WINDOW" env-default:"1h"`
+}
+
+// PasswordPolicyConfig is what a new password must contain, when a student
+// registers, resets or changes it, and when an admin is created with one.
+// Passwords already set are not checked again.
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	RequireUpper  bool `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireLower  bool `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireDigit  bool `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireSymbol bool `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+}
+
+// What AuthConfig.RequireVerifiedEmail can block.
+const (
+	RequireVerifiedNone       = "none"
+	RequireVerifiedLogin      = "login"
+	RequireVerifiedEnrollment = "enrollment"
+)
+
+// KeyConfig is one access token key, read from PEM files. ID is the kid that
+// tokens signed with it carry. A key without a private key only verifies.
+type KeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"` // RS256 | EdDSA
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// MailConfig selects how mail is sent. The stdout and file drivers print
+// messages instead of delivering them, for local development and tests.
+type MailConfig struct {
+	Driver string     `yaml:"driver" env:"MAIL_DRIVER" env-default:"stdout"` // stdout | file | smtp
+	From   string     `yaml:"from" env:"MAIL_FROM" env-default:"no-reply@localhost"`
+	File   string     `yaml:"file" env:"MAIL_FILE"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
 }
 
 type Config struct{
 	Env string `yaml:"env" env:"ENV" env-required:"true" env-default:"production"`
-	StoragePath string `yaml:"storage_path" env-required:"true"`
+	StoragePath string `yaml:"storage_path"`
+	Storage StorageConfig `yaml:"storage"`
 	HTTPServer `yaml:"http_server"`
-	JWTSecret string `yaml:"jwt_secret"`
-	Admin AdminConfig  `yaml:"admin" env-required:"true"`
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET"`
+	Auth AuthConfig `yaml:"auth"`
+	Mail MailConfig `yaml:"mail"`
+	Admin AdminConfig  `yaml:"admin"`
 }
 
 func MustLoad() *Config{
@@ -49,5 +260,59 @@ func MustLoad() *Config{
 		log.Fatalf("Cannot read config file %s",err.Error())
 	}
 
+	if cfg.JWTSecret==exampleJWTSecret{
+		log.Fatalf("jwt_secret is the example secret from the repository; set a random one with JWT_SECRET")
+	}
+	if cfg.Auth.LegacyJWTSecret && (cfg.Auth.SigningKey=="" || cfg.JWTSecret==""){
+		log.Fatalf("auth.legacy_jwt_secret needs both a jwt_secret and an auth.signing_key")
+	}
+
+	switch cfg.Auth.RequireVerifiedEmail{
+	case RequireVerifiedNone, RequireVerifiedLogin, RequireVerifiedEnrollment:
+	default:
+		log.Fatalf("auth.require_verified_email must be none, login or enrollment, not %q",cfg.Auth.RequireVerifiedEmail)
+	}
+	if throttle:=cfg.Auth.LoginThrottle; throttle.Window<throttle.LockoutDuration{
+		log.Fatalf("auth.login_throttle.window must be at least its lockout_duration")
+	}
+	if throttle:=cfg.Auth.MailThrottle; throttle.PerEmail<1 || throttle.PerIP<1{
+		log.Fatalf("auth.mail_throttle.per_email and per_ip must be at least 1")
+	}
+	if throttle:=cfg.Auth.LoginThrottle; throttle.ClientIPHeader!="" && len(throttle.TrustedProxies)==0{
+		log.Fatalf("auth.login_throttle.client_ip_header needs the trusted_proxies that set it")
+	}
+	for _, proxy:=range cfg.Auth.LoginThrottle.TrustedProxies{
+		if _, err:=netip.ParsePrefix(proxy); err!=nil{
+			if _, err:=netip.ParseAddr(proxy); err!=nil{
+				log.Fatalf("auth.login_throttle.trusted_proxies must be addresses or CIDR ranges, not %q",proxy)
+			}
+		}
+	}
+	switch cfg.Auth.Cookies.Secure{
+	case CookieSecureAuto, CookieSecureTrue, CookieSecureFalse:
+	default:
+		log.Fatalf("auth.cookies.secure must be auto, true or false, not %q",cfg.Auth.Cookies.Secure)
+	}
+	switch cfg.Auth.Cookies.SameSite{
+	case "", SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !cfg.SecureCookies(){
+			log.Fatalf("auth.cookies.same_site none needs secure cookies")
+		}
+	default:
+		log.Fatalf("auth.cookies.same_site must be lax, strict or none, not %q",cfg.Auth.Cookies.SameSite)
+	}
+	if oidc:=cfg.Auth.OIDC; oidc.Issuer!="" && (oidc.ClientID=="" || oidc.RedirectURL==""){
+		log.Fatalf("auth.oidc needs a client_id and redirect_url")
+	}
+	if ldap:=cfg.Auth.LDAP; ldap.URL!=""{
+		if ldap.BaseDN==""{
+			log.Fatalf("auth.ldap needs a base_dn")
+		}
+		if strings.Count(ldap.UserFilter,"%s")!=1{
+			log.Fatalf("auth.ldap.user_filter must have one %%s for the email, not %q",ldap.UserFilter)
+		}
+	}
+
 	return &cfg
 }
\ No newline at end of file
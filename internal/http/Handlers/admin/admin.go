@@ -2,13 +2,27 @@ package admin
 
 import (
 	"encoding/json"
-	"github.com/golang-jwt/jwt/v5"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/mfa"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"io"
+	"log/slog"
 	"net/http"
-	"time"
+	"strconv"
 )
 
-func LoginAdmin(cfg config.Config) http.HandlerFunc {
+// LoginAdmin logs an admin in with the first of admins that accepts their
+// email and password, such as the directory and then the admins' own
+// passwords.
+func LoginAdmin(admins auth.AdminAuthenticator, storage storage.Storage, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var creds struct {
 			Email    string `json:"email"`
@@ -20,49 +34,190 @@ func LoginAdmin(cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		if creds.Email!=cfg.Admin.Email || creds.Password!=cfg.Admin.Password {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.CheckLogin(r.Context(), storage, models.UserAdmin, creds.Email, ip); err != nil {
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", locked.RetryAfter())
+				http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+				return
+			}
+			response.StorageError(w, err)
 			return
 		}
 
-		claims := jwt.MapClaims{
-			"email": creds.Email,
-			"role":  "admin",
-			"exp": time.Now().Add(24 * time.Hour).Unix(),
+		admin, err := admins.Authenticate(r.Context(), creds.Email, creds.Password)
+		// A login the directory could not check counts as failed too, so
+		// that local passwords cannot be guessed freely while it is down.
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrDirectory) {
+			if err := auth.LoginFailed(r.Context(), storage, cfg.Auth.LoginThrottle, models.UserAdmin, creds.Email, ip); err != nil {
+				slog.Error("Could not count failed login", slog.String("error", err.Error()))
+			}
+			if errors.Is(err, auth.ErrDirectory) {
+				http.Error(w, "Could not reach the login directory; try again later", http.StatusBadGateway)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if admin.Disabled {
+			http.Error(w, "Forbidden: Admin account is disabled", http.StatusForbidden)
+			return
+		}
+		// A login held for its second step keeps its failures counted until
+		// the code is accepted, so logging in again cannot reset them.
+		if mfa.Challenge(w, r, storage, keys, cfg, models.UserAdmin, admin.ID, admin.Email) {
+			return
+		}
+		if err := auth.LoginSucceeded(r.Context(), storage, models.UserAdmin, creds.Email); err != nil {
+			slog.Error("Could not clear failed logins", slog.String("error", err.Error()))
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		signedToken, err := token.SignedString([]byte(cfg.JWTSecret))
+		session, err := auth.Login(r.Context(), storage, keys, cfg, models.UserAdmin, admin.ID, admin.Email)
 		if err != nil {
+			slog.Error("Could not issue token", slog.String("error", err.Error()))
 			http.Error(w, "Could not generate token", http.StatusInternalServerError)
 			return
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:     "auth_token",
-			Value:    signedToken,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
-		json.NewEncoder(w).Encode(map[string]string{"message": "Admin login successful"})
+		body := map[string]any{"message": "Admin login successful"}
+		auth.DeliverSession(w, r, cfg, session, body)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// Logout revokes the tokens of the login the request was made with.
+func Logout(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jti, _ := r.Context().Value(middlewares.TokenIDKey).(string)
+		if err := auth.Logout(r.Context(), storage, jti); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		auth.ClearCookies(w, cfg)
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Admin logged out successfully"})
+	}
+}
+
+// LogoutEverywhere revokes every access and refresh token of the logged-in
+// admin, on every device.
+func LogoutEverywhere(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := r.Context().Value(middlewares.AdminIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+			return
+		}
+
+		revoked, err := storage.RevokeUserTokens(r.Context(), models.UserAdmin, adminID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Admin logged out everywhere", slog.String("Admin Id: ", fmt.Sprint(adminID)), slog.Int64("revoked", revoked))
+		auth.ClearCookies(w, cfg)
+		response.WriteJson(w, http.StatusOK, map[string]any{"message": "Logged out of every session", "revoked": revoked})
 	}
 }
 
-func Logout() http.HandlerFunc {
+func CreateAdmin(storage storage.Storage, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		http.SetCookie(w, &http.Cookie{
-			Name:     "auth_token",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   -1,
-			Expires:  time.Unix(0, 0),
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"message":"Admin logged out successfully"}`))
+		var body struct {
+			Name     string `json:"name" validate:"required"`
+			Email    string `json:"email" validate:"required,email"`
+			Password string `json:"password" validate:"required"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if verr := validator.New().Struct(body); verr != nil {
+			validateError := verr.(validator.ValidationErrors)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateError))
+			return
+		}
+		if err := auth.CheckPasswordPolicy(cfg.Auth.PasswordPolicy, body.Password); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		hashedPassword, err := security.HashPassword(body.Password)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+
+		id, err := storage.CreateAdmin(r.Context(), body.Name, body.Email, hashedPassword)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Admin created", slog.String("Admin Id: ", fmt.Sprint(id)))
+		response.WriteJson(w, http.StatusCreated, map[string]int64{"id": id})
+	}
+}
+
+func GetAllAdmins(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admins, err := storage.GetAllAdmins(r.Context())
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, admins)
+	}
+}
+
+// SetDisabled disables or re-enables an admin. A disabled admin can no
+// longer log in.
+func SetDisabled(storage storage.Storage, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		if err := storage.SetAdminDisabled(r.Context(), id, disabled); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		message := "Admin enabled successfully"
+		if disabled {
+			message = "Admin disabled successfully"
+		}
+		slog.Info(message, slog.String("Admin Id: ", fmt.Sprint(id)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": message})
+	}
+}
+
+func DeleteAdmin(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		if err := storage.DeleteAdmin(r.Context(), id); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Admin deleted", slog.String("Admin Id: ", fmt.Sprint(id)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Admin deleted successfully"})
 	}
 }
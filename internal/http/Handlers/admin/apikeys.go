@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CreateAPIKey issues an API key for a machine client, acting for the
+// logged-in admin with some of their permissions. The key is in the response
+// and is not shown again. Keys cannot create keys, so a leaked key cannot
+// outlive its own expiry.
+func CreateAPIKey(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := r.Context().Value(middlewares.AdminIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+			return
+		}
+		if _, viaKey := r.Context().Value(middlewares.APIKeyIDKey).(int64); viaKey {
+			http.Error(w, "Forbidden: API keys cannot create API keys", http.StatusForbidden)
+			return
+		}
+
+		var body struct {
+			Name        string              `json:"name" validate:"required"`
+			Permissions []models.Permission `json:"permissions" validate:"required,min=1"`
+			ExpiresAt   *time.Time          `json:"expires_at"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		raw, key, err := auth.CreateAPIKey(r.Context(), storage, adminID, body.Name, body.Permissions, body.ExpiresAt, ip)
+		if errors.Is(err, auth.ErrPermissionNotHeld) {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("API key created", slog.Int64("key", key.ID), slog.String("Admin Id: ", fmt.Sprint(adminID)))
+		response.WriteJson(w, http.StatusCreated, map[string]any{
+			"message": "Store this key now; it is not shown again",
+			"key":     raw,
+			"api_key": key,
+		})
+	}
+}
+
+// GetAPIKeys lists every API key, revoked and expired ones included.
+func GetAPIKeys(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := storage.GetAPIKeys(r.Context())
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, keys)
+	}
+}
+
+// RevokeAPIKey stops an API key from working.
+func RevokeAPIKey(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := r.Context().Value(middlewares.AdminIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+			return
+		}
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.RevokeAPIKey(r.Context(), storage, adminID, id, ip); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("API key revoked", slog.Int64("key", id), slog.String("Admin Id: ", fmt.Sprint(adminID)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+	}
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Audit log pages hold this many entries unless the limit query parameter
+// asks for fewer, or up to maxAuditLimit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetLockedLogins lists the accounts and client IPs whose logins are locked.
+func GetLockedLogins(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		throttles, err := storage.GetLockedLogins(r.Context(), time.Now())
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, throttles)
+	}
+}
+
+// Unlock forgets the failed logins of a throttle key, such as
+// student:asha@example.com or ip:203.0.113.7, lifting its lock.
+func Unlock(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := r.Context().Value(middlewares.AdminIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+			return
+		}
+
+		key := r.PathValue("key")
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.Unlock(r.Context(), storage, key, adminID, ip); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Login unlocked", slog.String("key", key), slog.String("Admin Id: ", fmt.Sprint(adminID)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Unlocked " + key})
+	}
+}
+
+// GetAuditLog lists the newest audit entries, of the events given in event
+// query parameters or of every event.
+func GetAuditLog(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultAuditLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxAuditLimit {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)))
+				return
+			}
+			limit = n
+		}
+
+		var events []models.AuditEvent
+		for _, event := range r.URL.Query()["event"] {
+			events = append(events, models.AuditEvent(event))
+		}
+
+		entries, err := storage.GetAuditEntries(r.Context(), limit, events...)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, entries)
+	}
+}
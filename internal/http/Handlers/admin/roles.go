@@ -0,0 +1,155 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func GetAllRoles(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := storage.GetAllRoles(r.Context())
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, roles)
+	}
+}
+
+func CreateRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name        string              `json:"name" validate:"required"`
+			Description string              `json:"description"`
+			Permissions []models.Permission `json:"permissions"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		role, err := storage.CreateRole(r.Context(), body.Name, body.Description, body.Permissions)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Role created", slog.String("role", role.Name))
+		response.WriteJson(w, http.StatusCreated, role)
+	}
+}
+
+// SetRolePermissions replaces every permission of a role.
+func SetRolePermissions(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Permissions []models.Permission `json:"permissions"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		role, err := storage.SetRolePermissions(r.Context(), r.PathValue("name"), body.Permissions)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Role permissions changed", slog.String("role", role.Name))
+		response.WriteJson(w, http.StatusOK, role)
+	}
+}
+
+func DeleteRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := storage.DeleteRole(r.Context(), name); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Role deleted", slog.String("role", name))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Role deleted successfully"})
+	}
+}
+
+func GetAdminRoles(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		roles, err := storage.GetAdminRoles(r.Context(), id)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, roles)
+	}
+}
+
+func AssignRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		var body struct {
+			Role string `json:"role" validate:"required"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		if err := storage.AssignRole(r.Context(), id, body.Role); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Role assigned", slog.String("Admin Id: ", fmt.Sprint(id)), slog.String("role", body.Role))
+		response.WriteJson(w, http.StatusCreated, map[string]string{"message": "Role assigned successfully"})
+	}
+}
+
+func UnassignRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		role := r.PathValue("role")
+		if err := storage.UnassignRole(r.Context(), id, role); err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Role unassigned", slog.String("Admin Id: ", fmt.Sprint(id)), slog.String("role", role))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Role unassigned successfully"})
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+		return false
+	}
+
+	if verr := validator.New().Struct(dst); verr != nil {
+		validatorError := verr.(validator.ValidationErrors)
+		response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validatorError))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,279 @@
+package applications
+
+import (
+	"encoding/json"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Student
+
+func SubmitApplication(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized: No student ID found", http.StatusUnauthorized)
+			return
+		}
+
+		var body models.Application
+		if !decode(w, r, &body) {
+			return
+		}
+
+		application, err := storage.SubmitApplication(r.Context(), studentID, body.CourseID, body.Answers)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Application submitted", slog.String("Application ID: ", fmt.Sprint(application.ID)))
+		response.WriteJson(w, http.StatusCreated, application)
+	}
+}
+
+func GetMyApplications(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized: No student ID found", http.StatusUnauthorized)
+			return
+		}
+
+		applications, err := storage.GetApplicationsByStudentID(r.Context(), studentID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, applications)
+	}
+}
+
+// GetMyApplication shows a student one of their own applications. Reviews
+// are internal to the admissions team, so they are left out.
+func GetMyApplication(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized: No student ID found", http.StatusUnauthorized)
+			return
+		}
+
+		id, ok := applicationID(w, r)
+		if !ok {
+			return
+		}
+
+		application, err := storage.GetApplicationById(r.Context(), id)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		// Someone else's application is reported as missing, not forbidden,
+		// so its existence is not given away.
+		if application.StudentID != studentID {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no application found with id %d", id)))
+			return
+		}
+
+		application.Reviews = nil
+		response.WriteJson(w, http.StatusOK, application)
+	}
+}
+
+// Admin
+
+func GetApplications(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := statusFilter(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		applications, err := storage.GetApplications(r.Context(), statuses...)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, applications)
+	}
+}
+
+func GetApplicationById(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := applicationID(w, r)
+		if !ok {
+			return
+		}
+
+		application, err := storage.GetApplicationById(r.Context(), id)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, application)
+	}
+}
+
+func AssignReviewer(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := applicationID(w, r)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Reviewer string `json:"reviewer" validate:"required,email"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		admin, err := storage.GetAdminByEmail(r.Context(), body.Reviewer)
+		if err != nil && response.StatusCode(err) != http.StatusNotFound {
+			response.StorageError(w, err)
+			return
+		}
+		if err != nil || admin.Disabled {
+			response.WriteJson(w, http.StatusUnprocessableEntity, response.GeneralError(fmt.Errorf("reviewer %s is not an active admin", body.Reviewer)))
+			return
+		}
+		permissions, err := storage.GetAdminPermissions(r.Context(), admin.ID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if !models.HasPermission(permissions, models.PermissionApplicationsReview) {
+			response.WriteJson(w, http.StatusUnprocessableEntity, response.GeneralError(fmt.Errorf("reviewer %s cannot review applications", body.Reviewer)))
+			return
+		}
+
+		review, err := storage.AssignReviewer(r.Context(), id, body.Reviewer)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Reviewer assigned", slog.String("Application ID: ", fmt.Sprint(id)), slog.String("reviewer", review.Reviewer))
+		response.WriteJson(w, http.StatusCreated, review)
+	}
+}
+
+// ReviewApplication records the logged-in admin's score and comment, which
+// needs them to be one of the application's reviewers.
+func ReviewApplication(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewer, ok := r.Context().Value(middlewares.AdminEmailKey).(string)
+		if !ok {
+			http.Error(w, "Unauthorized: No admin email found", http.StatusUnauthorized)
+			return
+		}
+
+		id, ok := applicationID(w, r)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Score   *int   `json:"score" validate:"required,gte=0,lte=10"`
+			Comment string `json:"comment"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		review, err := storage.ReviewApplication(r.Context(), id, reviewer, *body.Score, body.Comment)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Application reviewed", slog.String("Application ID: ", fmt.Sprint(id)), slog.String("reviewer", review.Reviewer))
+		response.WriteJson(w, http.StatusOK, review)
+	}
+}
+
+func DecideApplication(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := applicationID(w, r)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Decision models.ApplicationStatus `json:"decision" validate:"required,oneof=accepted rejected waitlisted"`
+			Note     string                   `json:"note"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		application, err := storage.DecideApplication(r.Context(), id, body.Decision, body.Note)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Application decided", slog.String("Application ID: ", fmt.Sprint(id)), slog.String("decision", string(application.Status)))
+		response.WriteJson(w, http.StatusOK, application)
+	}
+}
+
+// applicationID parses the id path value, answering 400 when it is not a number.
+func applicationID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+		return 0, false
+	}
+	return id, true
+}
+
+// decode reads and validates a JSON body into dst, answering 400 when it
+// cannot.
+func decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+		return false
+	}
+
+	if verr := validator.New().Struct(dst); verr != nil {
+		validatorError := verr.(validator.ValidationErrors)
+		response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validatorError))
+		return false
+	}
+	return true
+}
+
+// statusFilter reads the application statuses to list from the status query
+// parameter, which may be repeated or hold a comma-separated list. Without it,
+// or with "all", every status is listed.
+func statusFilter(r *http.Request) ([]models.ApplicationStatus, error) {
+	var statuses []models.ApplicationStatus
+	for _, value := range r.URL.Query()["status"] {
+		for _, name := range strings.Split(value, ",") {
+			status := models.ApplicationStatus(strings.TrimSpace(name))
+			if status == "all" {
+				return nil, nil
+			}
+			if !status.Valid() {
+				return nil, fmt.Errorf("unknown application status %q", status)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
@@ -40,18 +40,20 @@ func CreateCourse(storage storage.Storage) http.HandlerFunc{
 		}
 
 		lastCourseId,err:=storage.CreateCourse(
+			r.Context(),
 			course.Name,
 			course.Description,
 			course.Duration,
 			course.Credits,
 			course.Price,
+			course.Capacity,
 		)
 
-		slog.Info("Courses Added successfully",slog.String("Course ID: ",fmt.Sprint(lastCourseId)))
 		if err!=nil{
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
+		slog.Info("Courses Added successfully",slog.String("Course ID: ",fmt.Sprint(lastCourseId)))
 		response.WriteJson(w, http.StatusCreated, map[string]int64{"id": lastCourseId})
 	}
 }
@@ -65,10 +67,10 @@ func GetCourseById(storage storage.Storage) http.HandlerFunc{
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
-		course,err:=storage.GetCourseById(CourseId)
+		course,err:=storage.GetCourseById(r.Context(), CourseId)
 		if err!=nil{
 			slog.Info("Error getting course", slog.String("Id", id))
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
 		response.WriteJson(w, http.StatusOK,course)
@@ -77,9 +79,9 @@ func GetCourseById(storage storage.Storage) http.HandlerFunc{
 
 func GetAllCourses(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		courses, err := storage.GetAllCourses()
+		courses, err := storage.GetAllCourses(r.Context())
 		if err!=nil {
-			response.WriteJson(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch courses"})
+			response.StorageError(w, err)
 			return
 		}
 		response.WriteJson(w, http.StatusOK, courses)
@@ -100,9 +102,9 @@ func UpdateCourse(storage storage.Storage) http.HandlerFunc {
 		}
 
 		// Fetch existing course first
-		existingCourse, err := storage.GetCourseById(courseId)
+		existingCourse, err := storage.GetCourseById(r.Context(), courseId)
 		if err != nil {
-			response.WriteJson(w, http.StatusNotFound, map[string]string{"error": "Course not found"})
+			response.StorageError(w, err)
 			return
 		}
 
@@ -135,11 +137,23 @@ func UpdateCourse(storage storage.Storage) http.HandlerFunc {
 		if ok {
 			existingCourse.Price = int(priceFloat)
 		}
+		capacityFloat, ok := incomingData["capacity"].(float64);
+		if ok {
+			existingCourse.Capacity = int(capacityFloat)
+		}
+
+		// request validator
+		verr:=validator.New().Struct(existingCourse)
+		if verr!=nil{
+			validatorError:=verr.(validator.ValidationErrors)
+			response.WriteJson(w,http.StatusBadRequest,response.ValidationError((validatorError)))
+			return
+		}
 
 		// Save updated course
-		err = storage.UpdateCourse(courseId, existingCourse)
+		err = storage.UpdateCourse(r.Context(), courseId, existingCourse)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update course"})
+			response.StorageError(w, err)
 			return
 		}
 
@@ -155,9 +169,9 @@ func SearchCoursesByName(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		courses, err := storage.SearchCoursesByName(name)
+		courses, err := storage.SearchCoursesByName(r.Context(), name)
 		if err != nil {
-			response.WriteJson(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			response.StorageError(w, err)
 			return
 		}
 
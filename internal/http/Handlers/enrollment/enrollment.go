@@ -5,17 +5,23 @@ import (
 	"errors"
 	"fmt"
 	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
 	"github/Bharatjawa2/CtrlB_Assignment/models"
 	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-func EnrollStudent(storage storage.Storage) http.HandlerFunc{
+// EnrollStudent enrolls the logged-in student, or the student named by an
+// admin who manages enrollments. It refuses students who have not verified
+// their email when the config requires it.
+func EnrollStudent(storage storage.Storage, cfg config.Config) http.HandlerFunc{
 	return func(w http.ResponseWriter, r *http.Request){
 		slog.Info("Enrolling Student")
 		var enroll models.Enrollment
@@ -31,6 +37,12 @@ func EnrollStudent(storage storage.Storage) http.HandlerFunc{
 			return
 		}
 
+		studentID,ok:=studentFor(w,r,enroll.StudentID)
+		if !ok{
+			return
+		}
+		enroll.StudentID=studentID
+
 		// request validator
 		verr:=validator.New().Struct(enroll)
 		if verr!=nil{
@@ -39,20 +51,44 @@ func EnrollStudent(storage storage.Storage) http.HandlerFunc{
 			return
 		}
 
-		lastEnrollId,err:=storage.EnrollStudent(
+		// The logged-in student is held to their own verification, whoever
+		// the request names.
+		if caller,isStudent:=r.Context().Value(middlewares.StudentIDKey).(int64); isStudent && cfg.Auth.RequireVerifiedEmail!=config.RequireVerifiedNone{
+			student,err:=storage.GetStudentById(r.Context(),caller)
+			if err!=nil{
+				response.StorageError(w, err)
+				return
+			}
+			if !student.Verified{
+				http.Error(w,"Forbidden: Verify your email before enrolling",http.StatusForbidden)
+				return
+			}
+		}
+
+		enrollment,err:=storage.EnrollStudent(
+			r.Context(),
 			enroll.StudentID,
 			enroll.CourseID,
 		)
-		slog.Info("Student Enrolled Successfully",slog.String("Enrollment ID: ",fmt.Sprint(lastEnrollId)))
 		if err!=nil{
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
+			return
+		}
+
+		// A full course queues the student instead of seating them.
+		if enrollment.Waitlisted{
+			slog.Info("Student Waitlisted",slog.String("Position: ",fmt.Sprint(enrollment.Position)))
+			response.WriteJson(w, http.StatusAccepted, enrollment)
 			return
 		}
-		response.WriteJson(w, http.StatusCreated, map[string]int64{"id": lastEnrollId})
+		slog.Info("Student Enrolled Successfully",slog.String("Enrollment ID: ",fmt.Sprint(enrollment.ID)))
+		response.WriteJson(w, http.StatusCreated, enrollment)
 	
 	}
 }
 
+// GetCoursesByStudentID lists the courses of the logged-in student, or of
+// any student for admins who manage enrollments.
 func GetCoursesByStudentID(storage storage.Storage) http.HandlerFunc{
 	return func(w http.ResponseWriter,r *http.Request){
 		slog.Info("List of Courses Registered by Student")
@@ -64,11 +100,20 @@ func GetCoursesByStudentID(storage storage.Storage) http.HandlerFunc{
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
+		if _, ok := studentFor(w, r, studentId); !ok {
+			return
+		}
 		
+		statuses, err := statusFilter(r, models.EnrollmentPending, models.EnrollmentApproved)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
 		// Fetch courses by student ID
-		courses, err := storage.GetCoursesByStudentID(studentId)
+		courses, err := storage.GetCoursesByStudentID(r.Context(), studentId, statuses...)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
 
@@ -89,17 +134,25 @@ func GetStudentsByCourseID(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
+		statuses, err := statusFilter(r, models.EnrollmentPending, models.EnrollmentApproved)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
 		// Fetch students by course ID
-		students, err := storage.GetStudentsByCourseID(courseID)
+		students, err := storage.GetStudentsByCourseID(r.Context(), courseID, statuses...)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
 
-		response.WriteJson(w, http.StatusOK, students)
+		response.WriteJson(w, http.StatusOK, models.StudentViews(students, middlewares.Can(r.Context(), models.PermissionStudentsPII)))
 	}
 }
 
+// UnenrollStudent unenrolls the logged-in student, or the student named by
+// an admin who manages enrollments.
 func UnenrollStudent(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var enrollment models.Enrollment
@@ -110,17 +163,200 @@ func UnenrollStudent(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
+		studentID, ok := studentFor(w, r, enrollment.StudentID)
+		if !ok {
+			return
+		}
+		enrollment.StudentID = studentID
+
 		if enrollment.StudentID == 0 || enrollment.CourseID == 0 {
 			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Missing student_id or course_id"})
 			return
 		}
 
-		err = storage.UnenrollStudent(enrollment.StudentID, enrollment.CourseID)
+		err = storage.UnenrollStudent(r.Context(), enrollment.StudentID, enrollment.CourseID)
 		if err != nil {
-			response.WriteJson(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			response.StorageError(w, err)
 			return
 		}
 
 		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Student unenrolled from course successfully"})
 	}
 }
+
+func GetMyWaitlist(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized: No student ID found", http.StatusUnauthorized)
+			return
+		}
+
+		entries, err := storage.GetWaitlistByStudentID(r.Context(), studentID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, entries)
+	}
+}
+
+func GetWaitlistPosition(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized: No student ID found", http.StatusUnauthorized)
+			return
+		}
+
+		// Extract course ID from URL
+		id := r.PathValue("id")
+		courseID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		entry, err := storage.GetWaitlistPosition(r.Context(), studentID, courseID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, entry)
+	}
+}
+
+func GetWaitlistByCourseID(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Waitlist of Course")
+
+		// Extract course ID from URL
+		id := r.PathValue("id")
+		courseID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		entries, err := storage.GetWaitlistByCourseID(r.Context(), courseID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, entries)
+	}
+}
+
+func GetEnrollmentsByCourseID(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Enrollments of Course")
+
+		// Extract course ID from URL
+		id := r.PathValue("id")
+		courseID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		statuses, err := statusFilter(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		enrollments, err := storage.GetEnrollmentsByCourseID(r.Context(), courseID, statuses...)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, enrollments)
+	}
+}
+
+// UpdateEnrollmentStatus lets an admin approve, reject, drop or complete an
+// enrollment.
+func UpdateEnrollmentStatus(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		enrollmentID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		var body struct {
+			Status models.EnrollmentStatus `json:"status" validate:"required"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if verr := validator.New().Struct(body); verr != nil {
+			validatorError := verr.(validator.ValidationErrors)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validatorError))
+			return
+		}
+
+		enrollment, err := storage.UpdateEnrollmentStatus(r.Context(), enrollmentID, body.Status)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Enrollment status changed", slog.String("Enrollment ID: ", id), slog.String("status", string(enrollment.Status)))
+		response.WriteJson(w, http.StatusOK, enrollment)
+	}
+}
+
+// statusFilter reads the enrollment statuses to list from the status query
+// parameter, which may be repeated or hold a comma-separated list. Without
+// it the fallback statuses are used; "all" (or no fallback) means every status.
+func statusFilter(r *http.Request, fallback ...models.EnrollmentStatus) ([]models.EnrollmentStatus, error) {
+	values := r.URL.Query()["status"]
+	if len(values) == 0 {
+		return fallback, nil
+	}
+
+	var statuses []models.EnrollmentStatus
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			status := models.EnrollmentStatus(strings.TrimSpace(name))
+			if status == "all" {
+				return nil, nil
+			}
+			if !status.Valid() {
+				return nil, fmt.Errorf("unknown enrollment status %q", status)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// studentFor returns the student that a request for id acts on. Students act
+// only on themselves, and may leave id out; anyone else needs
+// enrollments:manage. Otherwise it answers the request and returns false.
+func studentFor(w http.ResponseWriter, r *http.Request, id int64) (int64, bool) {
+	if studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64); ok {
+		if id != 0 && id != studentID {
+			http.Error(w, "Forbidden: Students can only act on their own enrollments", http.StatusForbidden)
+			return 0, false
+		}
+		return studentID, true
+	}
+	if !middlewares.Can(r.Context(), models.PermissionEnrollmentsManage) {
+		http.Error(w, "Forbidden: Requires permission "+string(models.PermissionEnrollmentsManage), http.StatusForbidden)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,267 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Challenge holds a login whose password was accepted at its second step,
+// when it has one, and reports whether it answered the request. Otherwise the
+// login handler goes on to start the session.
+func Challenge(w http.ResponseWriter, r *http.Request, storage storage.Storage, keys *auth.Keys, cfg config.Config, userType models.UserType, userID int64, email string) bool {
+	step, err := auth.MFAStep(r.Context(), storage, cfg, userType, userID)
+	if err != nil {
+		response.StorageError(w, err)
+		return true
+	}
+	if step == "" {
+		return false
+	}
+
+	token, err := auth.StartMFA(w, r, storage, keys, cfg, step, userType, userID, email)
+	if err != nil {
+		slog.Error("Could not issue token", slog.String("error", err.Error()))
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return true
+	}
+	message := "Enter the code from your authenticator app"
+	if step == auth.MFASetup {
+		message = "Set up two-factor authentication to finish logging in"
+	}
+	body := map[string]string{"message": message, "mfa": step}
+	if token != "" {
+		body["mfa_token"] = token
+	}
+	response.WriteJson(w, http.StatusOK, body)
+	return true
+}
+
+// Verify completes a login held by Challenge with a code from the user's
+// authenticator app or one of their recovery codes. Wrong codes count as
+// failed logins.
+func Verify(storage storage.Storage, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if (input.Code == "") == (input.RecoveryCode == "") {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(errors.New("give either code or recovery_code")))
+			return
+		}
+
+		claims, err := auth.PendingMFA(r, storage, keys, cfg, auth.MFAVerify)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Unauthorized: No pending login; log in again", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		userID := claims.UserID()
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.CheckLogin(r.Context(), storage, claims.UserType, claims.Email, ip); err != nil {
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", locked.RetryAfter())
+				http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+				return
+			}
+			response.StorageError(w, err)
+			return
+		}
+
+		body := map[string]any{"message": "Login successful"}
+		if input.Code != "" {
+			err = auth.CheckTOTP(r.Context(), storage, claims.UserType, userID, input.Code)
+		} else {
+			var remaining int
+			remaining, err = auth.UseRecoveryCode(r.Context(), storage, claims.UserType, userID, input.RecoveryCode, ip)
+			body["recovery_codes_left"] = remaining
+		}
+		if errors.Is(err, auth.ErrInvalidCode) {
+			if err := auth.LoginFailed(r.Context(), storage, cfg.Auth.LoginThrottle, claims.UserType, claims.Email, ip); err != nil {
+				slog.Error("Could not count failed login", slog.String("error", err.Error()))
+			}
+			http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if err := auth.LoginSucceeded(r.Context(), storage, claims.UserType, claims.Email); err != nil {
+			slog.Error("Could not clear failed logins", slog.String("error", err.Error()))
+		}
+
+		if !login(w, r, storage, keys, cfg, claims, body) {
+			return
+		}
+		response.WriteJson(w, http.StatusOK, body)
+	}
+}
+
+// SetUpTOTP generates a new TOTP secret for the user, to add to an
+// authenticator app. Logins ask for codes once ConfirmTOTP confirms it.
+func SetUpTOTP(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userType, userID, email, err := currentUser(r.Context(), storage)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		setup, err := auth.SetUpTOTP(r.Context(), storage, cfg, userType, userID, email)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		response.WriteJson(w, http.StatusOK, setup)
+	}
+}
+
+// ConfirmTOTP turns on two-factor authentication with a code from the new
+// secret and returns the user's recovery codes, which are not shown again. A
+// login that was held until the admin set it up completes here.
+func ConfirmTOTP(storage storage.Storage, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Code string `json:"code" validate:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		userType, userID, _, err := currentUser(r.Context(), storage)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		codes, err := auth.ConfirmTOTP(r.Context(), storage, userType, userID, input.Code, ip)
+		if errors.Is(err, auth.ErrInvalidCode) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		slog.Info("Two-factor authentication enabled", slog.String("user", fmt.Sprintf("%s:%d", userType, userID)))
+
+		body := map[string]any{"message": "Two-factor authentication enabled", "recovery_codes": codes}
+		if claims, pending := r.Context().Value(middlewares.MFAPendingKey).(*auth.MFAClaims); pending {
+			if !login(w, r, storage, keys, cfg, claims, body) {
+				return
+			}
+			body["message"] = "Two-factor authentication enabled; login successful"
+		}
+		response.WriteJson(w, http.StatusOK, body)
+	}
+}
+
+// DisableTOTP turns off two-factor authentication, given a current code.
+// Admins cannot while it is required of them.
+func DisableTOTP(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Code string `json:"code" validate:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		userType, userID, _, err := currentUser(r.Context(), storage)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if userType == models.UserAdmin && cfg.Auth.RequireAdminMFA {
+			http.Error(w, "Forbidden: Admins must use two-factor authentication", http.StatusForbidden)
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		err = auth.DisableTOTP(r.Context(), storage, userType, userID, input.Code, ip)
+		if errors.Is(err, auth.ErrInvalidCode) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		slog.Info("Two-factor authentication disabled", slog.String("user", fmt.Sprintf("%s:%d", userType, userID)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// currentUser is the user the request was let through as, by a session or by
+// a pending login, with their email.
+func currentUser(ctx context.Context, storage storage.Storage) (models.UserType, int64, string, error) {
+	if adminID, ok := ctx.Value(middlewares.AdminIDKey).(int64); ok {
+		email, _ := ctx.Value(middlewares.AdminEmailKey).(string)
+		return models.UserAdmin, adminID, email, nil
+	}
+	studentID, _ := ctx.Value(middlewares.StudentIDKey).(int64)
+	student, err := storage.GetStudentById(ctx, studentID)
+	if err != nil {
+		return "", 0, "", err
+	}
+	return models.UserStudent, studentID, student.Email, nil
+}
+
+// login starts the session of a pending login that passed its second step,
+// handing it over through body for clients that prefer bearer tokens, and
+// reports whether it did; otherwise it has answered the request. The pending
+// login's token is used up first, so that it starts one session only.
+func login(w http.ResponseWriter, r *http.Request, storage storage.Storage, keys *auth.Keys, cfg config.Config, claims *auth.MFAClaims, body map[string]any) bool {
+	err := auth.FinishMFA(r.Context(), storage, claims)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		http.Error(w, "Unauthorized: No pending login; log in again", http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		response.StorageError(w, err)
+		return false
+	}
+
+	session, err := auth.Login(r.Context(), storage, keys, cfg, claims.UserType, claims.UserID(), claims.Email)
+	if err != nil {
+		slog.Error("Could not issue token", slog.String("error", err.Error()))
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return false
+	}
+	auth.DeliverSession(w, r, cfg, session, body)
+	auth.ClearMFACookie(w, cfg)
+	return true
+}
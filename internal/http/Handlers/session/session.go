@@ -0,0 +1,80 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Refresh exchanges the refresh_token cookie for a new access token and the
+// next refresh token. It needs no access token, since that has usually just
+// expired. Clients that keep their own tokens send the refresh token as
+// {"refresh_token": "..."} instead, and get the new ones in the response body.
+func Refresh(storage storage.Storage, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var refreshToken string
+		fromBody := false
+		if cookie, err := r.Cookie(auth.RefreshCookieName); err == nil && cookie.Value != "" {
+			refreshToken = cookie.Value
+		} else {
+			var input struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+				return
+			}
+			refreshToken, fromBody = input.RefreshToken, true
+		}
+		if refreshToken == "" {
+			http.Error(w, "Unauthorized: No refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		session, err := auth.Refresh(r.Context(), storage, keys, cfg, refreshToken)
+		if errors.Is(err, auth.ErrRefreshReused) {
+			slog.Warn("Refresh token reused; revoked its login")
+			auth.ClearCookies(w, cfg)
+			http.Error(w, "Unauthorized: Refresh token was already used; log in again", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, auth.ErrInvalidToken) {
+			auth.ClearCookies(w, cfg)
+			http.Error(w, "Unauthorized: Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		body := map[string]any{
+			"message":    "Session refreshed",
+			"expires_at": session.AccessExpiresAt.Format(time.RFC3339),
+		}
+		if fromBody {
+			for name, value := range auth.SessionFields(session) {
+				body[name] = value
+			}
+		} else {
+			auth.DeliverSession(w, r, cfg, session, body)
+		}
+		response.WriteJson(w, http.StatusOK, body)
+	}
+}
+
+// JWKS publishes the public keys that verify access tokens, for other
+// services. Keys change only on restart, so clients may cache the set briefly.
+func JWKS(keys *auth.Keys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.WriteJson(w, http.StatusOK, keys.JWKS())
+	}
+}
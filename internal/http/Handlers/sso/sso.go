@@ -0,0 +1,115 @@
+// Package sso logs users in through the OpenID Connect provider.
+package sso
+
+import (
+	"errors"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// Login sends the browser to the provider to log in.
+func Login(oidc *auth.OIDC, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authURL, err := oidc.Start(w, keys, cfg)
+		if err != nil {
+			slog.Error("Could not start single sign-on", slog.String("error", err.Error()))
+			http.Error(w, "Could not start single sign-on", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// Callback finishes a login the provider sent back, starts the session of
+// the user it names and sends the browser on to the after-login page. A
+// login that needs its second step gets the mfa_token cookie instead, and the
+// page gets mfa=verify or mfa=setup in its query.
+func Callback(storage storage.Storage, oidc *auth.OIDC, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+			http.Error(w, "Unauthorized: The identity provider refused the login: "+providerErr, http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := oidc.Finish(w, r, keys, cfg)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Unauthorized: Login expired or was started elsewhere; try again", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.Error("Single sign-on failed", slog.String("error", err.Error()))
+			http.Error(w, "Could not complete single sign-on", http.StatusBadGateway)
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		userType, userID, email, err := oidc.User(r.Context(), storage, identity, ip)
+		if errors.Is(err, auth.ErrNoRole) {
+			http.Error(w, "Forbidden: Your groups do not grant access to the portal", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, auth.ErrUnverifiedEmail) {
+			http.Error(w, "Forbidden: Verify your email with your identity provider first", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, auth.ErrAccountExists) {
+			http.Error(w, "Conflict: A portal account already has your email; log in with its password", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if userType == models.UserAdmin {
+			admin, err := storage.GetAdminById(r.Context(), userID)
+			if err != nil {
+				response.StorageError(w, err)
+				return
+			}
+			if admin.Disabled {
+				http.Error(w, "Forbidden: Admin account is disabled", http.StatusForbidden)
+				return
+			}
+		}
+
+		next, err := url.Parse(cfg.Auth.OIDC.AfterLoginURL)
+		if err != nil {
+			slog.Error("Invalid after-login URL", slog.String("error", err.Error()))
+			http.Error(w, "Could not complete single sign-on", http.StatusInternalServerError)
+			return
+		}
+		step, err := auth.MFAStep(r.Context(), storage, cfg, userType, userID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		if step != "" {
+			if _, err := auth.StartMFA(w, r, storage, keys, cfg, step, userType, userID, email); err != nil {
+				slog.Error("Could not issue token", slog.String("error", err.Error()))
+				http.Error(w, "Could not generate token", http.StatusInternalServerError)
+				return
+			}
+			query := next.Query()
+			query.Set("mfa", step)
+			next.RawQuery = query.Encode()
+			http.Redirect(w, r, next.String(), http.StatusFound)
+			return
+		}
+
+		session, err := auth.Login(r.Context(), storage, keys, cfg, userType, userID, email)
+		if err != nil {
+			slog.Error("Could not issue token", slog.String("error", err.Error()))
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		auth.SetCookies(w, cfg, session)
+		slog.Info("Single sign-on login", slog.String("type", string(userType)), slog.Int64("id", userID))
+		http.Redirect(w, r, next.String(), http.StatusFound)
+	}
+}
@@ -5,26 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
 	"github/Bharatjawa2/CtrlB_Assignment/models"
 	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
 	"github/Bharatjawa2/CtrlB_Assignment/utils/security"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/http/Handlers/mfa"
 	"github/Bharatjawa2/CtrlB_Assignment/internal/http/middlewares"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func Register(storage storage.Storage) http.HandlerFunc {
+// Register creates a student and mails them a link that verifies their
+// email. The account exists either way; the link can be resent.
+func Register(storage storage.Storage, keys *auth.Keys, mailer mail.Mailer, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("Creating a Student")
-		var student models.Student
-		err := json.NewDecoder(r.Body).Decode(&student)
+		var input models.CreateStudentRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
 
 		if errors.Is(err, io.EOF) { // Body is Empty so ut give EOF Error
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
@@ -37,12 +40,17 @@ func Register(storage storage.Storage) http.HandlerFunc {
 		}
 
 		// request validation
-		verr := validator.New().Struct(student)
+		verr := validator.New().Struct(input)
 		if verr != nil {
 			validateError := verr.(validator.ValidationErrors)
 			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateError))
 			return
 		}
+		student := input.Student()
+		if err := auth.CheckPasswordPolicy(cfg.Auth.PasswordPolicy, student.Password); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
 
 		hashedPassword, err:=security.HashPassword(student.Password)
 		if err!=nil{
@@ -51,6 +59,7 @@ func Register(storage storage.Storage) http.HandlerFunc {
 		}
 
 		lastid, err := storage.CreateStudent(
+			r.Context(),
 			student.FullName,
 			student.Email,
 			hashedPassword,
@@ -61,18 +70,23 @@ func Register(storage storage.Storage) http.HandlerFunc {
 			student.Address,
 		)
 
-		slog.Info("User created successfully", slog.String("User Id: ", fmt.Sprint(lastid)))
-
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
 
+		slog.Info("User created successfully", slog.String("User Id: ", fmt.Sprint(lastid)))
+
+		student.Id = lastid
+		if err := auth.SendVerification(r.Context(), keys, mailer, cfg, student); err != nil {
+			slog.Error("Could not send verification email", slog.String("error", err.Error()))
+		}
+
 		response.WriteJson(w, http.StatusCreated, map[string]int64{"id": lastid})
 	}
 }
 
-func LoginStudent(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+func LoginStudent(storage storage.Storage, keys *auth.Keys, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var creds struct {
 			Email    string `json:"email"`
@@ -85,38 +99,55 @@ func LoginStudent(storage storage.Storage, cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		student, err := storage.GetStudentByEmail(creds.Email)
-		if err != nil || !security.CheckPasswordHash(creds.Password, student.Password) {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.CheckLogin(r.Context(), storage, models.UserStudent, creds.Email, ip); err != nil {
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", locked.RetryAfter())
+				http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+				return
+			}
+			response.StorageError(w, err)
 			return
 		}
 
-		// Generate JWT
-		claims := jwt.MapClaims{
-			"email": student.Email,
-			"id":    student.Id,
-			"role":  "student",  
-			"exp":   time.Now().Add(24 * time.Hour).Unix(),
+		student, err := storage.GetStudentByEmail(r.Context(), creds.Email)
+		if err != nil && response.StatusCode(err) != http.StatusNotFound {
+			response.StorageError(w, err)
+			return
+		}
+		// An unknown email is checked against an empty hash, which takes as
+		// long as a wrong password.
+		if !security.CheckPasswordHash(creds.Password, student.Password) || err != nil {
+			if err := auth.LoginFailed(r.Context(), storage, cfg.Auth.LoginThrottle, models.UserStudent, creds.Email, ip); err != nil {
+				slog.Error("Could not count failed login", slog.String("error", err.Error()))
+			}
+			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+			return
+		}
+		if cfg.Auth.RequireVerifiedEmail == config.RequireVerifiedLogin && !student.Verified {
+			http.Error(w, "Forbidden: Verify your email before logging in", http.StatusForbidden)
+			return
+		}
+		// A login held for its second step keeps its failures counted until
+		// the code is accepted, so logging in again cannot reset them.
+		if mfa.Challenge(w, r, storage, keys, cfg, models.UserStudent, student.Id, student.Email) {
+			return
+		}
+		if err := auth.LoginSucceeded(r.Context(), storage, models.UserStudent, creds.Email); err != nil {
+			slog.Error("Could not clear failed logins", slog.String("error", err.Error()))
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		signedToken, err := token.SignedString([]byte(cfg.JWTSecret))
+		session, err := auth.Login(r.Context(), storage, keys, cfg, models.UserStudent, student.Id, student.Email)
 		if err != nil {
+			slog.Error("Could not issue token", slog.String("error", err.Error()))
 			http.Error(w, "Could not generate token", http.StatusInternalServerError)
 			return
 		}
+		body := map[string]any{"message": "Login successful"}
+		auth.DeliverSession(w, r, cfg, session, body)
 
-		// Set token in cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "auth_token",
-			Value:    signedToken,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   false, // true in production with HTTPS
-			SameSite: http.SameSiteLaxMode,
-		})
-
-		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Login successful"})
+		response.WriteJson(w, http.StatusOK, body)
 	}
 }
 
@@ -131,13 +162,13 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
-		student, err := storage.GetStudentById(Intid)
+		student, err := storage.GetStudentById(r.Context(), Intid)
 		if err != nil {
 			slog.Info("Error getting user", slog.String("Id", id))
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
-		response.WriteJson(w, http.StatusOK, student)
+		response.WriteJson(w, http.StatusOK, models.StudentView(student, middlewares.Can(r.Context(), models.PermissionStudentsPII)))
 	}
 }
 
@@ -145,12 +176,12 @@ func GetAllStudents(storage storage.Storage) http.HandlerFunc{
 	return func(w http.ResponseWriter, r *http.Request){
 		slog.Info("Fetching all students")
 
-		students, err := storage.GetAllStudents()
+		students, err := storage.GetAllStudents(r.Context())
 		if err!=nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.StorageError(w, err)
 			return
 		}
-		response.WriteJson(w, http.StatusOK, students)
+		response.WriteJson(w, http.StatusOK, models.StudentViews(students, middlewares.Can(r.Context(), models.PermissionStudentsPII)))
 	}
 }
 
@@ -163,92 +194,283 @@ func UpdateStudent(storage storage.Storage) http.HandlerFunc {
 		}
 
 		// Fetch existing student first
-		existingStudent, err := storage.GetStudentById(studentID)
+		existingStudent, err := storage.GetStudentById(r.Context(), studentID)
 		if err != nil {
-			response.WriteJson(w, http.StatusNotFound, map[string]string{"error": "Student not found"})
+			response.StorageError(w, err)
 			return
 		}
 
-		var incomingData map[string]interface{}
-		err = json.NewDecoder(r.Body).Decode(&incomingData)
+		var input models.UpdateStudentRequest
+		err = json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
 			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
 			return
 		}
+		// Changing the password takes the current one; see ChangePassword.
+		if input.Password != nil {
+			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Change the password through PUT /api/students/password"})
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
 
 		// Update only fields present
-		fullName, ok := incomingData["full_name"].(string);
-		if ok {
-			existingStudent.FullName = fullName
+		input.Apply(&existingStudent)
+
+		err = storage.UpdateStudent(r.Context(), studentID, existingStudent)
+		if err != nil {
+			response.StorageError(w, err)
+			return
 		}
-		email, ok := incomingData["email"].(string);
-		if ok {
-			existingStudent.Email = email
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Student updated successfully"})
+	}
+}
+
+
+func GetStudentByEmail(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := r.URL.Query().Get("email") // Want to Fetch from Query parameters 
+		if email == "" {
+			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Missing email query parameter"})
+			return
 		}
-		password, ok := incomingData["password"].(string);
-		if ok {
-			existingStudent.Password = password
+		student, err := storage.GetStudentByEmail(r.Context(), email)
+		if err != nil {
+			response.StorageError(w, err)
+			return
 		}
-		ageFloat, ok := incomingData["age"].(float64);
-		if ok {
-			existingStudent.Age = int(ageFloat)
+		response.WriteJson(w, http.StatusOK, models.StudentView(student, middlewares.Can(r.Context(), models.PermissionStudentsPII)))
+	}
+}
+
+// Logout revokes the tokens of the login the request was made with.
+func Logout(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jti, _ := r.Context().Value(middlewares.TokenIDKey).(string)
+		if err := auth.Logout(r.Context(), storage, jti); err != nil {
+			response.StorageError(w, err)
+			return
 		}
-		gender, ok := incomingData["gender"].(string); 
-		if ok {
-			existingStudent.Gender = gender
+
+		auth.ClearCookies(w, cfg)
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+	}
+}
+
+// LogoutEverywhere revokes every access and refresh token of the logged-in
+// student, on every device.
+func LogoutEverywhere(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Students only", http.StatusForbidden)
+			return
 		}
-		phone, ok := incomingData["phone_number"].(string);
-		if ok {
-			existingStudent.PhoneNumber = phone
+
+		revoked, err := storage.RevokeUserTokens(r.Context(), models.UserStudent, studentID)
+		if err != nil {
+			response.StorageError(w, err)
+			return
 		}
-		dob, ok := incomingData["dob"].(string);
-		if ok {
-			existingStudent.DOB = dob
+
+		slog.Info("Student logged out everywhere", slog.String("Student Id: ", fmt.Sprint(studentID)), slog.Int64("revoked", revoked))
+		auth.ClearCookies(w, cfg)
+		response.WriteJson(w, http.StatusOK, map[string]any{"message": "Logged out of every session", "revoked": revoked})
+	}
+}
+
+// ForgotPassword mails a password reset token to the student with the given
+// email. It answers the same whether or not the email is registered, so it
+// cannot be used to find out who has an account. Requests are limited per
+// email and per client IP, so it cannot be used to flood a mailbox either.
+func ForgotPassword(storage storage.Storage, mailer mail.Mailer, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Email string `json:"email" validate:"required,email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
 		}
-		address, ok := incomingData["address"].(string);
-		if ok {
-			existingStudent.Address = address
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.ThrottleMail(r.Context(), storage, cfg.Auth.MailThrottle, models.UserStudent, input.Email, ip); err != nil {
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", locked.RetryAfter())
+				http.Error(w, "Too many requests for mail; try again later", http.StatusTooManyRequests)
+				return
+			}
+			response.StorageError(w, err)
+			return
 		}
 
-		err = storage.UpdateStudent(studentID, existingStudent)
+		student, err := storage.GetStudentByEmail(r.Context(), input.Email)
+		if err == nil {
+			err = auth.RequestPasswordReset(r.Context(), storage, mailer, cfg, student)
+		}
+		if err != nil && response.StatusCode(err) != http.StatusNotFound {
+			slog.Error("Could not send password reset", slog.String("error", err.Error()))
+		}
+
+		response.WriteJson(w, http.StatusAccepted, map[string]string{"message": "If the email is registered, a password reset link has been sent to it"})
+	}
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. Every
+// session of the student ends, so they log in again with the new password.
+func ResetPassword(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Token    string `json:"token" validate:"required"`
+			Password string `json:"password" validate:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+		if err := auth.CheckPasswordPolicy(cfg.Auth.PasswordPolicy, input.Password); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		studentID, err := auth.ResetPassword(r.Context(), storage, input.Token, input.Password)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid or expired password reset token")))
+			return
+		}
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update student"})
+			response.StorageError(w, err)
 			return
 		}
-		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Student updated successfully"})
+
+		slog.Info("Student reset their password", slog.String("Student Id: ", fmt.Sprint(studentID)))
+		auth.ClearCookies(w, cfg)
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Password reset; log in with the new password"})
 	}
 }
 
+// ChangePassword sets a new password for the logged-in student, given their
+// current one. Their other sessions end; this one stays logged in.
+func ChangePassword(storage storage.Storage, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		studentID, ok := r.Context().Value(middlewares.StudentIDKey).(int64)
+		if !ok {
+			http.Error(w, "Forbidden: Students only", http.StatusForbidden)
+			return
+		}
 
-func GetStudentByEmail(storage storage.Storage) http.HandlerFunc {
+		var input struct {
+			CurrentPassword string `json:"current_password" validate:"required"`
+			NewPassword     string `json:"new_password" validate:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+		if err := auth.CheckPasswordPolicy(cfg.Auth.PasswordPolicy, input.NewPassword); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+
+		jti, _ := r.Context().Value(middlewares.TokenIDKey).(string)
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		err := auth.ChangePassword(r.Context(), storage, cfg, studentID, jti, input.CurrentPassword, input.NewPassword, ip)
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", locked.RetryAfter())
+			http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, auth.ErrWrongPassword) {
+			response.WriteJson(w, http.StatusForbidden, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+
+		slog.Info("Student changed their password", slog.String("Student Id: ", fmt.Sprint(studentID)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Password changed; other sessions were logged out"})
+	}
+}
+
+// VerifyEmail marks the student a verification link was mailed to verified.
+func VerifyEmail(storage storage.Storage, keys *auth.Keys) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		email := r.URL.Query().Get("email") // Want to Fetch from Query parameters 
-		if email == "" {
-			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Missing email query parameter"})
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			response.WriteJson(w, http.StatusBadRequest, map[string]string{"error": "Missing token query parameter"})
+			return
+		}
+
+		studentID, err := auth.VerifyEmail(r.Context(), storage, keys, token)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid or expired verification link")))
 			return
 		}
-		student, err := storage.GetStudentByEmail(email)
 		if err != nil {
-			response.WriteJson(w, http.StatusNotFound, map[string]string{"error": "Student not found"})
+			response.StorageError(w, err)
 			return
 		}
-		response.WriteJson(w, http.StatusOK, student)
+
+		slog.Info("Student verified their email", slog.String("Student Id: ", fmt.Sprint(studentID)))
+		response.WriteJson(w, http.StatusOK, map[string]string{"message": "Email verified"})
 	}
 }
 
-func Logout() http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        http.SetCookie(w, &http.Cookie{
-            Name:     "auth_token",
-            Value:    "",
-            Path:     "/",
-            Expires:  time.Unix(0, 0), // Set expiration to Unix epoch to expire immediately
-            HttpOnly: true,
-            Secure:   false, // Set true in production with HTTPS
-            SameSite: http.SameSiteLaxMode,
-        })
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusOK)
-        w.Write([]byte(`{"message":"Logged out successfully"}`))
-    }
+// ResendVerification mails a new verification link to an unverified student.
+// Like ForgotPassword, it answers the same whatever the email, and shares its
+// limits.
+func ResendVerification(storage storage.Storage, keys *auth.Keys, mailer mail.Mailer, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Email string `json:"email" validate:"required,email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		if err := validator.New().Struct(input); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		ip := auth.ClientIP(r, cfg.Auth.LoginThrottle)
+		if err := auth.ThrottleMail(r.Context(), storage, cfg.Auth.MailThrottle, models.UserStudent, input.Email, ip); err != nil {
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				w.Header().Set("Retry-After", locked.RetryAfter())
+				http.Error(w, "Too many requests for mail; try again later", http.StatusTooManyRequests)
+				return
+			}
+			response.StorageError(w, err)
+			return
+		}
+
+		student, err := storage.GetStudentByEmail(r.Context(), input.Email)
+		if err == nil && !student.Verified {
+			err = auth.SendVerification(r.Context(), keys, mailer, cfg, student)
+		}
+		if err != nil && response.StatusCode(err) != http.StatusNotFound {
+			slog.Error("Could not resend verification email", slog.String("error", err.Error()))
+		}
+
+		response.WriteJson(w, http.StatusAccepted, map[string]string{"message": "If the email is registered and unverified, a verification link has been sent to it"})
+	}
 }
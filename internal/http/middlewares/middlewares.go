@@ -2,114 +2,217 @@ package middlewares
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
-	"github.com/golang-jwt/jwt/v5"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/auth"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"github/Bharatjawa2/CtrlB_Assignment/models"
+	"github/Bharatjawa2/CtrlB_Assignment/utils/response"
 )
 
 type contextKey string
 
+// StudentIDKey holds the logged-in student's id in the request context.
+const StudentIDKey = contextKey("studentID")
 
-func AuthMiddleware(secret string, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("auth_token")
-		if err != nil {
-			http.Error(w, "Unauthorized: No token", http.StatusUnauthorized)
-			return
-		}
+// AdminIDKey and AdminEmailKey hold the logged-in admin's id and email in the
+// request context.
+const AdminIDKey = contextKey("adminID")
+const AdminEmailKey = contextKey("adminEmail")
 
-		token, err := jwt.Parse(cookie.Value, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(secret), nil
-		})
+// PermissionsKey holds the permissions of the logged-in user in the request
+// context, for handlers whose answer depends on more than the route's
+// permission.
+const PermissionsKey = contextKey("permissions")
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-			return
-		}
+// TokenIDKey holds the jti of the request's session token in the request
+// context, so logging out can revoke it.
+const TokenIDKey = contextKey("tokenID")
+
+// APIKeyIDKey holds the id of the API key a request was made with in the
+// request context. Such requests carry no session token.
+const APIKeyIDKey = contextKey("apiKeyID")
 
-		next.ServeHTTP(w, r)
-	}
-}
 
+// Authenticate lets through any logged-in student or enabled admin whose
+// token has not been revoked. API keys are not let through, since routes
+// without a permission act on the caller's own login.
+func Authenticate(keys *auth.Keys, storage storage.Storage, next http.HandlerFunc) http.HandlerFunc {
+	return Authorize(keys, storage, "", next)
+}
 
-func AdminMiddleware(secret string, next http.HandlerFunc) http.HandlerFunc {
+// Authorize lets a request through only when the logged-in user holds
+// permission. Students hold the permissions of the student role; admins hold
+// those of every role assigned to them. Both are read on each request, so
+// changes to roles take effect without logging in again. The session token
+// comes from an Authorization: Bearer header or the auth_token cookie; a
+// bearer API key is let through as its admin, see authorizeAPIKey. Requests
+// that change state with the cookie must repeat the csrf_token cookie in the
+// X-CSRF-Token header, see auth.CheckCSRF.
+func Authorize(keys *auth.Keys, storage storage.Storage, permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("auth_token")
-		if err != nil {
+		raw, ok := auth.RequestToken(r, auth.CookieName)
+		if !ok {
 			http.Error(w, "Unauthorized: No token", http.StatusUnauthorized)
 			return
 		}
+		if err := auth.CheckCSRF(r); err != nil {
+			http.Error(w, "Forbidden: Missing or wrong CSRF token", http.StatusForbidden)
+			return
+		}
+		if auth.IsAPIKey(raw) {
+			authorizeAPIKey(w, r, storage, permission, raw, next)
+			return
+		}
 
-		token, err := jwt.Parse(cookie.Value, func(t *jwt.Token) (interface{}, error) {
-			_, ok := t.Method.(*jwt.SigningMethodHMAC); 
-			if !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := auth.Verify(r.Context(), storage, keys, raw)
+		if errors.Is(err, auth.ErrInvalidToken) {
 			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Unauthorized: Invalid claims", http.StatusUnauthorized)
+		if errors.Is(err, auth.ErrRevokedToken) {
+			http.Error(w, "Unauthorized: Token revoked", http.StatusUnauthorized)
 			return
 		}
+		if err != nil {
+			response.StorageError(w, err)
+			return
+		}
+		id := claims.UserID
+
+		ctx := context.WithValue(r.Context(), TokenIDKey, claims.ID)
+		var permissions []models.Permission
+		switch claims.UserType {
+		case models.UserStudent:
+			role, err := storage.GetRoleByName(ctx, models.RoleStudent)
+			if err != nil {
+				response.StorageError(w, err)
+				return
+			}
+			permissions = role.Permissions
+			ctx = context.WithValue(ctx, StudentIDKey, id)
+
+		case models.UserAdmin:
+			admin, ok := enabledAdmin(w, ctx, storage, id)
+			if !ok {
+				return
+			}
+			permissions, err = storage.GetAdminPermissions(ctx, id)
+			if err != nil {
+				response.StorageError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, AdminIDKey, id)
+			ctx = context.WithValue(ctx, AdminEmailKey, admin.Email)
+		}
 
-		role, ok := claims["role"].(string)
-		if !ok || role != "admin" {
-			http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+		if permission != "" && !models.HasPermission(permissions, permission) {
+			http.Error(w, "Forbidden: Requires permission "+string(permission), http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx = context.WithValue(ctx, PermissionsKey, permissions)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
-const StudentIDKey = contextKey("studentID")
+// authorizeAPIKey lets a request made with an API key through when the key
+// grants permission. The key acts for the admin who created it, as long as
+// they are enabled, so handlers see that admin.
+func authorizeAPIKey(w http.ResponseWriter, r *http.Request, storage storage.Storage, permission models.Permission, raw string, next http.HandlerFunc) {
+	if permission == "" {
+		http.Error(w, "Forbidden: API keys cannot be used here", http.StatusForbidden)
+		return
+	}
 
+	key, err := auth.VerifyAPIKey(r.Context(), storage, raw)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		http.Error(w, "Unauthorized: Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, auth.ErrRevokedToken) {
+		http.Error(w, "Unauthorized: API key revoked", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		response.StorageError(w, err)
+		return
+	}
 
-func StudentMiddleware(secret string, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("auth_token")
-		if err != nil {
-			http.Error(w, "Unauthorized: No token", http.StatusUnauthorized)
-			return
-		}
+	admin, ok := enabledAdmin(w, r.Context(), storage, key.CreatedBy)
+	if !ok {
+		return
+	}
+	permissions, err := auth.APIKeyPermissions(r.Context(), storage, key)
+	if err != nil {
+		response.StorageError(w, err)
+		return
+	}
+	if !models.HasPermission(permissions, permission) {
+		http.Error(w, "Forbidden: Requires permission "+string(permission), http.StatusForbidden)
+		return
+	}
 
-		token, err := jwt.Parse(cookie.Value, func(t *jwt.Token) (interface{}, error) {
-			_, ok := t.Method.(*jwt.SigningMethodHMAC);
-			if !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(secret), nil
-		})
+	ctx := context.WithValue(r.Context(), APIKeyIDKey, key.ID)
+	ctx = context.WithValue(ctx, AdminIDKey, admin.ID)
+	ctx = context.WithValue(ctx, AdminEmailKey, admin.Email)
+	ctx = context.WithValue(ctx, PermissionsKey, permissions)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
-			return
-		}
+// enabledAdmin reads the admin with id, and reports whether they exist and
+// are enabled; otherwise it has answered the request.
+func enabledAdmin(w http.ResponseWriter, ctx context.Context, storage storage.Storage, id int64) (models.Admin, bool) {
+	admin, err := storage.GetAdminById(ctx, id)
+	if err != nil && response.StatusCode(err) == http.StatusNotFound {
+		http.Error(w, "Unauthorized: Unknown admin", http.StatusUnauthorized)
+		return models.Admin{}, false
+	}
+	if err != nil {
+		response.StorageError(w, err)
+		return models.Admin{}, false
+	}
+	if admin.Disabled {
+		http.Error(w, "Forbidden: Admin account is disabled", http.StatusForbidden)
+		return models.Admin{}, false
+	}
+	return admin, true
+}
+
+// Can reports whether the logged-in user of ctx holds permission.
+func Can(ctx context.Context, permission models.Permission) bool {
+	permissions, _ := ctx.Value(PermissionsKey).([]models.Permission)
+	return models.HasPermission(permissions, permission)
+}
+
+// MFAPendingKey holds the claims of a login waiting for its second step in
+// the request context, for requests let through by PendingMFA.
+const MFAPendingKey = contextKey("mfaPending")
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["role"] != "student" {
-			http.Error(w, "Forbidden: Students only", http.StatusForbidden)
+// PendingMFA lets through a login that waits for step, as the user named by
+// its mfa_token, from an Authorization: Bearer header or the cookie. It stands in for Authenticate while an admin sets up
+// the two-factor authentication their login requires.
+func PendingMFA(storage storage.Storage, keys *auth.Keys, cfg config.Config, step string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.PendingMFA(r, storage, keys, cfg, step)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Unauthorized: No pending login; log in again", http.StatusUnauthorized)
 			return
 		}
-
-		idFloat, ok := claims["id"].(float64)
-		if !ok {
-			http.Error(w, "Unauthorized: Invalid token claims", http.StatusUnauthorized)
+		if err != nil {
+			response.StorageError(w, err)
 			return
 		}
-		studentID := int64(idFloat)
 
-		ctx := context.WithValue(r.Context(), StudentIDKey, studentID)
+		ctx := context.WithValue(r.Context(), MFAPendingKey, claims)
+		switch claims.UserType {
+		case models.UserStudent:
+			ctx = context.WithValue(ctx, StudentIDKey, claims.UserID())
+		case models.UserAdmin:
+			ctx = context.WithValue(ctx, AdminIDKey, claims.UserID())
+			ctx = context.WithValue(ctx, AdminEmailKey, claims.Email)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,195 @@
+// Package mail sends email. The SMTP mailer delivers it; the writer mailers
+// print it to stdout or append it to a file instead, for local development
+// and tests.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer cfg.Driver selects.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "stdout":
+		return NewWriter(os.Stdout, cfg.From), nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("the file mail driver needs mail.file")
+		}
+		return NewFile(cfg.File, cfg.From), nil
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("the smtp mail driver needs mail.smtp.host")
+		}
+		return NewSMTP(cfg.SMTP, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// format renders msg as an RFC 5322 message from from.
+func format(from string, msg Message) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("mail header contains a line break")
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String()), nil
+}
+
+// Writer writes every message to an io.Writer instead of sending it.
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriter(w io.Writer, from string) *Writer {
+	return &Writer{w: w, from: from}
+}
+
+func (m *Writer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	raw, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = fmt.Fprintf(m.w, "%s\n", raw)
+	return err
+}
+
+// File appends every message to a file instead of sending it.
+type File struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFile(path string, from string) *File {
+	return &File{path: path, from: from}
+}
+
+func (m *File) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	raw, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s\n", raw); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SMTP delivers messages through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it.
+type SMTP struct {
+	cfg  config.SMTPConfig
+	from string
+}
+
+func NewSMTP(cfg config.SMTPConfig, from string) *SMTP {
+	return &SMTP{cfg: cfg, from: from}
+}
+
+func (m *SMTP) Send(ctx context.Context, msg Message) error {
+	raw, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	// net/smtp knows nothing of contexts; the deadline bounds the whole exchange.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
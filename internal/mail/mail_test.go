@@ -0,0 +1,139 @@
+package mail_test
+
+import (
+	"bufio"
+	"bytes"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/config"
+	"github/Bharatjawa2/CtrlB_Assignment/internal/mail"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var msg = mail.Message{To: "asha@example.com", Subject: "Hello", Body: "line one\nline two"}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	if err := mail.NewWriter(&out, "portal@example.com").Send(t.Context(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"From: portal@example.com\r\n", "To: asha@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message %q lacks %q", got, want)
+		}
+	}
+
+	injected := msg
+	injected.Subject = "Hello\r\nBcc: everyone@example.com"
+	if err := mail.NewWriter(&out, "portal@example.com").Send(t.Context(), injected); err == nil {
+		t.Errorf("Send accepted a header with a line break")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := mail.NewFile(path, "portal@example.com")
+	for range 2 {
+		if err := mailer.Send(t.Context(), msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if n := strings.Count(string(b), "Subject: Hello"); n != 2 {
+		t.Errorf("file holds %d messages, want 2", n)
+	}
+}
+
+// serveSMTP accepts one SMTP session without STARTTLS or AUTH and returns
+// what was sent as DATA.
+func serveSMTP(t *testing.T) (int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 test ESMTP")
+		var body strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 test")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					body.WriteString(line)
+				}
+				data <- body.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, data
+}
+
+func TestSMTP(t *testing.T) {
+	port, data := serveSMTP(t)
+	mailer, err := mail.New(config.MailConfig{
+		Driver: "smtp",
+		From:   "portal@example.com",
+		SMTP:   config.SMTPConfig{Host: "127.0.0.1", Port: port},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := mailer.Send(t.Context(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-data; !strings.Contains(got, "To: asha@example.com") || !strings.Contains(got, "line two") {
+		t.Errorf("server received %q", got)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, cfg := range []config.MailConfig{
+		{Driver: "pigeon"},
+		{Driver: "file"},
+		{Driver: "smtp", SMTP: config.SMTPConfig{Port: 25}},
+	} {
+		if _, err := mail.New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+	if _, err := mail.New(config.MailConfig{Driver: "stdout"}); err != nil {
+		t.Errorf("New(stdout): %v", err)
+	}
+}
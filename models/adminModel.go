@@ -1,7 +1,12 @@
 package models
 
-type admin struct{
-	Name string
-	Email string
-	Password string
-}
\ No newline at end of file
+import "time"
+
+type Admin struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name" validate:"required"`
+	Email     string     `json:"email" validate:"required,email"`
+	Password  string     `json:"-"` // bcrypt hash, never serialized
+	Disabled  bool       `json:"disabled"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// APIKey lets a machine client call the API without logging in. The key is
+// shown once when it is created and stored by its SHA-256 hash; Prefix, its
+// first characters, tells keys apart. A key acts for the admin who created it,
+// with those of its permissions that the admin still holds.
+type APIKey struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Prefix      string       `json:"prefix"`
+	Hash        string       `json:"-"`
+	Permissions []Permission `json:"permissions"` // sorted
+	CreatedBy   int64        `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ExpiresAt   *time.Time   `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at"`
+	RevokedAt   *time.Time   `json:"revoked_at"`
+}
+
+// Usable reports whether the key is neither revoked nor expired at t.
+func (k APIKey) Usable(at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(at))
+}
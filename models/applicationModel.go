@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+type ApplicationStatus string
+
+const (
+	ApplicationSubmitted   ApplicationStatus = "submitted"
+	ApplicationUnderReview ApplicationStatus = "under_review"
+	ApplicationAccepted    ApplicationStatus = "accepted"
+	ApplicationRejected    ApplicationStatus = "rejected"
+	ApplicationWaitlisted  ApplicationStatus = "waitlisted"
+)
+
+// MaxReviewScore is the highest score a reviewer can give; the lowest is 0.
+const MaxReviewScore = 10
+
+// applicationTransitions is the application state machine: a submitted
+// application goes under review once a reviewer is assigned, and any open
+// application can be decided. A waitlisted application is decided again
+// later; accepted and rejected are final.
+var applicationTransitions = map[ApplicationStatus][]ApplicationStatus{
+	ApplicationSubmitted:   {ApplicationUnderReview, ApplicationAccepted, ApplicationRejected, ApplicationWaitlisted},
+	ApplicationUnderReview: {ApplicationAccepted, ApplicationRejected, ApplicationWaitlisted},
+	ApplicationWaitlisted:  {ApplicationAccepted, ApplicationRejected},
+}
+
+// Valid reports whether s is a known status.
+func (s ApplicationStatus) Valid() bool {
+	switch s {
+	case ApplicationSubmitted, ApplicationUnderReview, ApplicationAccepted, ApplicationRejected, ApplicationWaitlisted:
+		return true
+	}
+	return false
+}
+
+// Decision reports whether an admin can decide an application with s.
+func (s ApplicationStatus) Decision() bool {
+	return s == ApplicationAccepted || s == ApplicationRejected || s == ApplicationWaitlisted
+}
+
+// Open reports whether an application in status s still awaits a final
+// decision. A student has at most one open application per course.
+func (s ApplicationStatus) Open() bool {
+	return s == ApplicationSubmitted || s == ApplicationUnderReview || s == ApplicationWaitlisted
+}
+
+// CanTransitionTo reports whether an application may move from s to next.
+func (s ApplicationStatus) CanTransitionTo(next ApplicationStatus) bool {
+	for _, allowed := range applicationTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type Application struct {
+	ID           int64             `json:"id,omitempty"`
+	StudentID    int64             `json:"student_id"`
+	CourseID     int64             `json:"course_id" validate:"required"`
+	Answers      map[string]string `json:"answers,omitempty"` // free-form answers keyed by question
+	Status       ApplicationStatus `json:"status,omitempty"`
+	DecisionNote string            `json:"decision_note,omitempty"`
+	SubmittedAt  *time.Time        `json:"submitted_at,omitempty"`
+	DecidedAt    *time.Time        `json:"decided_at,omitempty"` // the latest decision
+
+	// Reviews is only filled in when a single application is fetched.
+	Reviews []ApplicationReview `json:"reviews,omitempty"`
+}
+
+// ApplicationReview is a reviewer's assignment to an application, with their
+// score and comment once they have reviewed it.
+type ApplicationReview struct {
+	ID            int64      `json:"id"`
+	ApplicationID int64      `json:"application_id"`
+	Reviewer      string     `json:"reviewer"` // the reviewing admin's email
+	Score         *int       `json:"score,omitempty" validate:"omitempty,gte=0,lte=10"`
+	Comment       string     `json:"comment,omitempty"`
+	AssignedAt    *time.Time `json:"assigned_at,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// LoginThrottle counts the recent failed logins against one key: an account,
+// such as "student:asha@example.com", or a client IP, such as
+// "ip:203.0.113.7". Failures are forgotten once the throttle expires.
+type LoginThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+}
+
+// Locked reports whether logins against the throttle's key are refused at t.
+func (t LoginThrottle) Locked(at time.Time) bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(at)
+}
+
+// AuditEvent is the kind of a security event in the audit log.
+type AuditEvent string
+
+const (
+	AuditLoginLocked    AuditEvent = "login.locked"
+	AuditLoginUnlocked  AuditEvent = "login.unlocked"
+	AuditMFAEnabled     AuditEvent = "mfa.enabled"
+	AuditMFADisabled    AuditEvent = "mfa.disabled"
+	AuditRecoveryCode   AuditEvent = "mfa.recovery_code_used"
+	AuditAPIKeyCreated  AuditEvent = "apikey.created"
+	AuditAPIKeyRevoked  AuditEvent = "apikey.revoked"
+	AuditIdentityLinked AuditEvent = "identity.linked"
+)
+
+// AuditEntry records a security event. The actor is the user who caused it,
+// if any was logged in; Subject is what it happened to. Entries name users
+// rather than reference them, so they outlive the users.
+type AuditEntry struct {
+	ID        int64      `json:"id"`
+	Event     AuditEvent `json:"event"`
+	ActorType UserType   `json:"actor_type,omitempty"`
+	ActorID   int64      `json:"actor_id,omitempty"`
+	Subject   string     `json:"subject"`
+	IP        string     `json:"ip"`
+	Detail    string     `json:"detail"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -7,4 +7,5 @@ type Course struct {
     Duration    string `json:"duration"` 
     Credits     int    `json:"credits"`
 	Price		int	   `json:"price"`
+	Capacity    int    `json:"capacity" validate:"gte=0"` // seats; 0 means unlimited
 }
@@ -1,7 +1,62 @@
 package models
 
+import "time"
+
+type EnrollmentStatus string
+
+const (
+	EnrollmentPending   EnrollmentStatus = "pending"
+	EnrollmentApproved  EnrollmentStatus = "approved"
+	EnrollmentRejected  EnrollmentStatus = "rejected"
+	EnrollmentDropped   EnrollmentStatus = "dropped"
+	EnrollmentCompleted EnrollmentStatus = "completed"
+)
+
+// enrollmentTransitions is the enrollment state machine: a new enrollment is
+// pending until an admin approves or rejects it, and an approved one ends up
+// dropped or completed. Rejected, dropped and completed are final.
+var enrollmentTransitions = map[EnrollmentStatus][]EnrollmentStatus{
+	EnrollmentPending:  {EnrollmentApproved, EnrollmentRejected},
+	EnrollmentApproved: {EnrollmentDropped, EnrollmentCompleted},
+}
+
+// Valid reports whether s is a known status.
+func (s EnrollmentStatus) Valid() bool {
+	switch s {
+	case EnrollmentPending, EnrollmentApproved, EnrollmentRejected, EnrollmentDropped, EnrollmentCompleted:
+		return true
+	}
+	return false
+}
+
+// Active reports whether an enrollment in status s holds a seat in its course.
+// A student has at most one active enrollment per course.
+func (s EnrollmentStatus) Active() bool {
+	return s == EnrollmentPending || s == EnrollmentApproved
+}
+
+// CanTransitionTo reports whether an enrollment may move from s to next.
+func (s EnrollmentStatus) CanTransitionTo(next EnrollmentStatus) bool {
+	for _, allowed := range enrollmentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Enrollment struct {
-	ID        int64 `json:"id,omitempty"`
-	StudentID int64 `json:"student_id" validate:"required"`
-	CourseID  int64 `json:"course_id" validate:"required"`
+	ID         int64            `json:"id,omitempty"`
+	StudentID  int64            `json:"student_id" validate:"required"`
+	CourseID   int64            `json:"course_id" validate:"required"`
+	Status     EnrollmentStatus `json:"status,omitempty"`
+	Waitlisted bool             `json:"waitlisted,omitempty"` // the course was full, so the student was queued
+	Position   int              `json:"position,omitempty"`   // place in the waitlist, starting at 1
+
+	// When the enrollment entered each status; nil until it has.
+	EnrolledAt  *time.Time `json:"enrolled_at,omitempty"`
+	ApprovedAt  *time.Time `json:"approved_at,omitempty"`
+	RejectedAt  *time.Time `json:"rejected_at,omitempty"`
+	DroppedAt   *time.Time `json:"dropped_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ExternalIdentity links a user of an OpenID Connect provider, named by the
+// provider's issuer and their subject there, to a student or admin, who can
+// then log in through the provider. Email is the one the provider gave when
+// the identity was linked.
+type ExternalIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserType  UserType  `json:"user_type"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
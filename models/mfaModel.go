@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// TOTP is a user's RFC 6238 authenticator secret. It is confirmed once the
+// user has entered a code from it; until then logins do not ask for codes.
+// LastUsedStep is the time step of the last code accepted, so that each code
+// works only once.
+type TOTP struct {
+	UserType     UserType   `json:"user_type"`
+	UserID       int64      `json:"user_id"`
+	Secret       string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"-"`
+}
+
+// Confirmed reports whether logins ask for codes from the secret.
+func (t TOTP) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
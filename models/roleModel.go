@@ -0,0 +1,80 @@
+package models
+
+// Permission is one action a role allows. Every route in routes.go names the
+// permission it requires.
+type Permission string
+
+const (
+	PermissionStudentsRead       Permission = "students:read"
+	PermissionStudentsPII        Permission = "students:pii" // with students:read or enrollments:read, see students' personal details
+	PermissionCoursesWrite       Permission = "courses:write"
+	PermissionEnrollmentsRead    Permission = "enrollments:read"
+	PermissionEnrollmentsManage  Permission = "enrollments:manage"
+	PermissionApplicationsRead   Permission = "applications:read"
+	PermissionApplicationsReview Permission = "applications:review"
+	PermissionApplicationsManage Permission = "applications:manage"
+	PermissionAdminsRead         Permission = "admins:read"
+	PermissionAdminsManage       Permission = "admins:manage"
+	PermissionRolesRead          Permission = "roles:read"
+	PermissionRolesManage        Permission = "roles:manage"
+	PermissionAuditRead          Permission = "audit:read"
+	PermissionLoginsManage       Permission = "logins:manage"
+	PermissionAPIKeysManage      Permission = "apikeys:manage"
+
+	// Self-service permissions, which act on the logged-in student's own data.
+	PermissionProfileUpdate    Permission = "profile:update"
+	PermissionEnrollmentsSelf  Permission = "enrollments:self"
+	PermissionApplicationsSelf Permission = "applications:self"
+)
+
+// Permissions lists every known permission.
+var Permissions = []Permission{
+	PermissionStudentsRead,
+	PermissionStudentsPII,
+	PermissionCoursesWrite,
+	PermissionEnrollmentsRead,
+	PermissionEnrollmentsManage,
+	PermissionApplicationsRead,
+	PermissionApplicationsReview,
+	PermissionApplicationsManage,
+	PermissionAdminsRead,
+	PermissionAdminsManage,
+	PermissionRolesRead,
+	PermissionRolesManage,
+	PermissionAuditRead,
+	PermissionLoginsManage,
+	PermissionAPIKeysManage,
+	PermissionProfileUpdate,
+	PermissionEnrollmentsSelf,
+	PermissionApplicationsSelf,
+}
+
+// Valid reports whether p is a known permission.
+func (p Permission) Valid() bool {
+	return HasPermission(Permissions, p)
+}
+
+// Built-in roles cannot be changed or deleted. Every admin created from the
+// config file is a superadmin, and every student holds the student role.
+const (
+	RoleSuperadmin = "superadmin"
+	RoleStudent    = "student"
+)
+
+type Role struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name" validate:"required"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"` // sorted
+	BuiltIn     bool         `json:"built_in"`
+}
+
+// HasPermission reports whether p is among permissions.
+func HasPermission(permissions []Permission, p Permission) bool {
+	for _, held := range permissions {
+		if held == p {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,143 @@
 package models
 
 
+// Student is a stored student. It never goes out as JSON as it is: responses
+// use StudentPublicView or StudentAdminView, so the password hash and personal
+// details only reach callers allowed to see them.
 type Student struct {
 	Id              int64  `json:"id"`
-	FullName        string `json:"full_name" validate:"required"`
-	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password,omitempty" validate:"required,min=6"` // omitted in JSON response
-	Age             int    `json:"age" validate:"required,min=16,max=100"`
-	Gender          string `json:"gender" validate:"required,oneof=male female other"`
-	PhoneNumber     string `json:"phone_number" validate:"required"`
-	DOB             string `json:"dob" validate:"required"` // format: YYYY-MM-DD
-	Address         string `json:"address" validate:"required"`
+	FullName        string `json:"full_name"`
+	Email           string `json:"email"`
+	Password        string `json:"-"` // bcrypt hash
+	Age             int    `json:"age"`
+	Gender          string `json:"gender"`
+	PhoneNumber     string `json:"phone_number"`
+	DOB             string `json:"dob"` // format: YYYY-MM-DD
+	Address         string `json:"address"`
+	Verified        bool   `json:"verified"` // set by following the mailed link, never by the client
+}
+
+// CreateStudentRequest is the body that registers a student.
+type CreateStudentRequest struct {
+	FullName    string `json:"full_name" validate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	Password    string `json:"password" validate:"required,min=6"`
+	Age         int    `json:"age" validate:"required,min=16,max=100"`
+	Gender      string `json:"gender" validate:"required,oneof=male female other"`
+	PhoneNumber string `json:"phone_number" validate:"required"`
+	DOB         string `json:"dob" validate:"required"` // format: YYYY-MM-DD
+	Address     string `json:"address" validate:"required"`
+}
+
+// Student is the student the request registers, with the password as given.
+func (r CreateStudentRequest) Student() Student {
+	return Student{
+		FullName:    r.FullName,
+		Email:       r.Email,
+		Password:    r.Password,
+		Age:         r.Age,
+		Gender:      r.Gender,
+		PhoneNumber: r.PhoneNumber,
+		DOB:         r.DOB,
+		Address:     r.Address,
+	}
+}
+
+// UpdateStudentRequest changes the fields of a student's profile that it
+// carries, and leaves the others.
+type UpdateStudentRequest struct {
+	FullName    *string `json:"full_name" validate:"omitnil,min=1"`
+	Email       *string `json:"email" validate:"omitnil,email"`
+	Age         *int    `json:"age" validate:"omitnil,min=16,max=100"`
+	Gender      *string `json:"gender" validate:"omitnil,oneof=male female other"`
+	PhoneNumber *string `json:"phone_number" validate:"omitnil,min=1"`
+	DOB         *string `json:"dob" validate:"omitnil,min=1"`
+	Address     *string `json:"address" validate:"omitnil,min=1"`
+	// Password is only read to refuse it: changing the password takes the
+	// current one.
+	Password *string `json:"password"`
+}
+
+// Apply copies the fields the request carries onto student.
+func (r UpdateStudentRequest) Apply(student *Student) {
+	for _, field := range []struct {
+		from *string
+		to   *string
+	}{
+		{r.FullName, &student.FullName},
+		{r.Email, &student.Email},
+		{r.Gender, &student.Gender},
+		{r.PhoneNumber, &student.PhoneNumber},
+		{r.DOB, &student.DOB},
+		{r.Address, &student.Address},
+	} {
+		if field.from != nil {
+			*field.to = *field.from
+		}
+	}
+	if r.Age != nil {
+		student.Age = *r.Age
+	}
+}
+
+// StudentPublicView is what every admin allowed to list students sees of one.
+type StudentPublicView struct {
+	Id       int64  `json:"id"`
+	FullName string `json:"full_name"`
+	Verified bool   `json:"verified"`
+}
+
+// StudentAdminView adds the student's contact and personal details, for
+// admins holding students:pii.
+type StudentAdminView struct {
+	StudentPublicView
+	Email       string `json:"email"`
+	Age         int    `json:"age"`
+	Gender      string `json:"gender"`
+	PhoneNumber string `json:"phone_number"`
+	DOB         string `json:"dob"`
+	Address     string `json:"address"`
+}
+
+// NewStudentPublicView projects student onto its public fields.
+func NewStudentPublicView(student Student) StudentPublicView {
+	return StudentPublicView{Id: student.Id, FullName: student.FullName, Verified: student.Verified}
+}
+
+// NewStudentAdminView projects student onto every field but its password.
+func NewStudentAdminView(student Student) StudentAdminView {
+	return StudentAdminView{
+		StudentPublicView: NewStudentPublicView(student),
+		Email:             student.Email,
+		Age:               student.Age,
+		Gender:            student.Gender,
+		PhoneNumber:       student.PhoneNumber,
+		DOB:               student.DOB,
+		Address:           student.Address,
+	}
+}
+
+// StudentViews projects students for a response: onto StudentAdminView when
+// pii allows personal details, and onto StudentPublicView otherwise.
+func StudentViews(students []Student, pii bool) any {
+	if pii {
+		views := make([]StudentAdminView, len(students))
+		for i, student := range students {
+			views[i] = NewStudentAdminView(student)
+		}
+		return views
+	}
+	views := make([]StudentPublicView, len(students))
+	for i, student := range students {
+		views[i] = NewStudentPublicView(student)
+	}
+	return views
+}
+
+// StudentView projects one student like StudentViews.
+func StudentView(student Student, pii bool) any {
+	if pii {
+		return NewStudentAdminView(student)
+	}
+	return NewStudentPublicView(student)
 }
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// UserType is the kind of user a token was issued to, carried in its role
+// claim.
+type UserType string
+
+const (
+	UserStudent UserType = "student"
+	UserAdmin   UserType = "admin"
+)
+
+// Valid reports whether t is a known user type.
+func (t UserType) Valid() bool {
+	return t == UserStudent || t == UserAdmin
+}
+
+// Token records an issued access token under its jti, so it can be revoked
+// before it expires. Family names the login it was minted from. The tokens of
+// logins waiting for their second step are recorded too, without a family,
+// and revoked once used.
+type Token struct {
+	JTI       string     `json:"jti"`
+	Family    string     `json:"family"`
+	UserType  UserType   `json:"user_type"`
+	UserID    int64      `json:"user_id"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// Revoked reports whether the token has been revoked.
+func (t Token) Revoked() bool {
+	return t.RevokedAt != nil
+}
+
+// RefreshToken records an opaque refresh token by its SHA-256 hash. Every
+// refresh marks it used and issues the next one in the same family; a used
+// token presented again means it was stolen, and the family is revoked.
+type RefreshToken struct {
+	ID        int64      `json:"id"`
+	Hash      string     `json:"-"`
+	Family    string     `json:"family"`
+	UserType  UserType   `json:"user_type"`
+	UserID    int64      `json:"user_id"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// PasswordReset records a single-use password reset token by its SHA-256
+// hash. It is mailed to the student and works once, before it expires.
+type PasswordReset struct {
+	ID        int64      `json:"id"`
+	StudentID int64      `json:"student_id"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type WaitlistEntry struct {
+	ID        int64     `json:"id"`
+	StudentID int64     `json:"student_id"`
+	CourseID  int64     `json:"course_id"`
+	Position  int       `json:"position"` // 1 is next in line for a seat
+	CreatedAt time.Time `json:"created_at"`
+}
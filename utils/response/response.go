@@ -1,8 +1,12 @@
 package response
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -34,6 +38,37 @@ func GeneralError(err error) Response{
 	}
 }
 
+// StatusCode maps a storage error onto the HTTP status it should produce.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrConstraint):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return 499 // client closed request
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// StorageError writes err with the status from StatusCode. Unexpected
+// failures are logged and reported without driver details.
+func StorageError(w http.ResponseWriter, err error) error {
+	status := StatusCode(err)
+	if status == http.StatusInternalServerError {
+		slog.Error("storage failure", slog.String("error", err.Error()))
+		return WriteJson(w, status, GeneralError(errors.New("internal server error")))
+	}
+	return WriteJson(w, status, GeneralError(err))
+}
+
 func ValidationError(errs validator.ValidationErrors) Response{
 	var errMsg[] string
 
@@ -0,0 +1,33 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	storage "github/Bharatjawa2/CtrlB_Assignment/internal/Storage"
+	"net/http"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", storage.Errorf(storage.ErrNotFound, "no course found with id %d", 7), http.StatusNotFound},
+		{"conflict", fmt.Errorf("%w: UNIQUE constraint failed", storage.ErrConflict), http.StatusConflict},
+		{"constraint", fmt.Errorf("%w: FOREIGN KEY constraint failed", storage.ErrConstraint), http.StatusUnprocessableEntity},
+		{"invalid", fmt.Errorf("%w: bad value", storage.ErrInvalid), http.StatusBadRequest},
+		{"timeout", storage.ContextError(context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"canceled", context.Canceled, 499},
+		{"driver failure", errors.New("disk I/O error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusCode(tt.err); got != tt.want {
+				t.Errorf("StatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,23 @@ package security
 
 import "golang.org/x/crypto/bcrypt"
 
+// unknownUserHash stands in for the hash of a user that does not exist. It
+// has the same cost as real hashes, so refusing an unknown email takes as
+// long as refusing a wrong password.
+const unknownUserHash = "$2a$14$fEMESjHmrsMBH24JKs4mhe/5HKSfKy2CTF3t2SFbqWUCc4wUhLdRq"
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
 }
 
+// CheckPasswordHash reports whether password matches hash. An empty hash,
+// of a user that was not found, never matches but takes as long to check.
 func CheckPasswordHash(password, hash string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(unknownUserHash), []byte(password))
+		return false
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
-}
\ No newline at end of file
+}